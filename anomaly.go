@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	anomalyCmd        = kingpin.Command("anomaly", "alert when anomaly score of Elastic ML job results in --time-period window exceeds thresholds")
+	anomalyJobID      = anomalyCmd.Flag("job-id", "anomaly detection job id").Envar("CHECK_ES_JOB_ID").Required().String()
+	anomalyResultType = anomalyCmd.Flag("result-type", "compare scores of single anomaly records (record) or of whole buckets (bucket)").Envar("CHECK_ES_RESULT_TYPE").Default("record").Enum(escheck.AnomalyResultTypes...)
+	anomalyWarning    = anomalyCmd.Flag("warning-score", "warning when anomaly score reaches this value, 0 disables").Envar("CHECK_ES_WARNING_SCORE").Default("50").Float64()
+	anomalyCritical   = anomalyCmd.Flag("critical-score", "critical when anomaly score reaches this value").Envar("CHECK_ES_CRITICAL_SCORE").Default("75").Float64()
+	anomalyTop        = anomalyCmd.Flag("top", "number of the highest scored anomalies listed in long output").Envar("CHECK_ES_TOP").Default("5").Int()
+)
+
+// getAnomalyCheck returns ML anomaly check definition given by command line
+// flags
+func getAnomalyCheck() escheck.AnomalyCheck {
+	return escheck.AnomalyCheck{
+		JobID:      *anomalyJobID,
+		ResultType: *anomalyResultType,
+		TimePeriod: *timePeriod,
+		Warning:    *anomalyWarning,
+		Critical:   *anomalyCritical,
+		Top:        *anomalyTop,
+	}
+}
+
+func runAnomalyCheck() *escheck.CheckResult {
+	check := getAnomalyCheck()
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		return c.Client.RunAnomaly(check)
+	}, aggregateWorstResults)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	countMin     = kingpin.Flag("min", "CRITICAL when logs count is below this value, with --max logs count is expected to stay within band instead of being compared with --threshold").Envar("CHECK_ES_MIN").String()
+	countMax     = kingpin.Flag("max", "CRITICAL when logs count is above this value").Envar("CHECK_ES_MAX").String()
+	warningMin   = kingpin.Flag("warning-min", "WARNING when logs count is below this value").Envar("CHECK_ES_WARNING_MIN").String()
+	warningMax   = kingpin.Flag("warning-max", "WARNING when logs count is above this value").Envar("CHECK_ES_WARNING_MAX").String()
+	countRange   = kingpin.Flag("range", "CRITICAL band in Nagios range syntax instead of --min and --max, eg.: 10:500, 10: (at least 10), ~:500 or @10:20 (CRITICAL within 10..20)").Envar("CHECK_ES_RANGE").String()
+	warningRange = kingpin.Flag("warning-range", "WARNING band in Nagios range syntax").Envar("CHECK_ES_WARNING_RANGE").String()
+)
+
+// criticalBand and warningBand are set up in main from band flags, nil when
+// not given
+var criticalBand, warningBand *escheck.CountRange
+
+// setupBands parses --range and --warning-range or builds them of --min
+// and --max flags
+func setupBands() error {
+	var err error
+	if criticalBand, err = getBand("range", *countRange, "min", *countMin, "max", *countMax); err != nil {
+		return err
+	}
+	if warningBand, err = getBand("warning-range", *warningRange, "warning-min", *warningMin, "warning-max", *warningMax); err != nil {
+		return err
+	}
+	if warningBand != nil && criticalBand == nil {
+		return fmt.Errorf("warning band requires range, min or max parameter")
+	}
+	return nil
+}
+
+// getBand returns band given in range syntax or by its minimum and maximum
+func getBand(rangeName, spec, minName, min, maxName, max string) (*escheck.CountRange, error) {
+	if spec != "" {
+		if min != "" || max != "" {
+			return nil, fmt.Errorf("%s parameter can't be combined with %s or %s", rangeName, minName, maxName)
+		}
+		band, err := escheck.ParseCountRange(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s parameter: %v", rangeName, err)
+		}
+		return band, nil
+	}
+	if min == "" && max == "" {
+		return nil, nil
+	}
+	band := &escheck.CountRange{}
+	for _, bound := range []struct {
+		name  string
+		value string
+		dest  **int
+	}{{minName, min, &band.Low}, {maxName, max, &band.High}} {
+		if bound.value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s parameter should be a number", bound.name)
+		}
+		*bound.dest = &n
+	}
+	if band.Low != nil && band.High != nil && *band.Low > *band.High {
+		return nil, fmt.Errorf("%s parameter should not be greater than %s", minName, maxName)
+	}
+	return band, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	batchCmd         = kingpin.Command("batch", "evaluate named checks of YAML file concurrently in one run")
+	batchCmdFile     = batchCmd.Arg("file", "YAML file with checks, see --batch").Required().String()
+	batchFile        = kingpin.Flag("batch", "YAML file with list of named checks evaluated concurrently in one run, each check inherits command line options and may override name, query, index-pattern, data-stream, alias, time-period, threshold, warning-threshold, compare-operator and breakdown-field; in --serve mode also interval (duration or cron expression)").Envar("CHECK_ES_BATCH").String()
+	batchConcurrency = kingpin.Flag("batch-concurrency", "number of batch checks evaluated at the same time").Envar("CHECK_ES_BATCH_CONCURRENCY").Default("4").Int()
+	batchOutput      = kingpin.Flag("batch-output", "batch result output: aggregate (single result with worst state and per-check long output) or per-check (one result per check in --output format)").Envar("CHECK_ES_BATCH_OUTPUT").Default("aggregate").Enum("aggregate", "per-check")
+)
+
+// stringList : list accepting both single YAML string and list of strings,
+// values are split on commas like repeatable flags
+type stringList []string
+
+// UnmarshalYAML decodes scalar or list value
+func (l *stringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		var s string
+		if err := unmarshal(&s); err != nil {
+			return err
+		}
+		list = []string{s}
+	}
+	*l = splitList(list)
+	return nil
+}
+
+// BatchCheck : struct containts single check of --batch file, unset fields
+// inherit values of command line flags
+type BatchCheck struct {
+	Name             string     `yaml:"name"`
+	Query            *string    `yaml:"query"`
+	IndexPatterns    stringList `yaml:"index-pattern"`
+	DataStreams      stringList `yaml:"data-stream"`
+	Aliases          stringList `yaml:"alias"`
+	TimePeriod       *int       `yaml:"time-period"`
+	Threshold        *int       `yaml:"threshold"`
+	WarningThreshold *int       `yaml:"warning-threshold"`
+	CompareOperator  *string    `yaml:"compare-operator"`
+	BreakdownField   *string    `yaml:"breakdown-field"`
+	Interval         string     `yaml:"interval"`
+}
+
+// apply returns check with values of batch entry applied over defaults,
+// requests of the check are attributed to its name
+func (b BatchCheck) apply(check escheck.Check) escheck.Check {
+	check.OpaqueID = getOpaqueID(b.Name)
+	if b.Query != nil {
+		check.Query = *b.Query
+	}
+	if len(b.IndexPatterns) > 0 {
+		check.Index.Patterns = b.IndexPatterns
+	}
+	if len(b.DataStreams) > 0 {
+		check.Index.DataStreams = b.DataStreams
+	}
+	if len(b.Aliases) > 0 {
+		check.Index.Aliases = b.Aliases
+	}
+	if b.TimePeriod != nil {
+		check.TimePeriod = *b.TimePeriod
+		check.BucketInterval = bucketIntervalFor(check.TimePeriod)
+	}
+	if b.Threshold != nil {
+		check.Threshold = *b.Threshold
+	}
+	if b.WarningThreshold != nil {
+		check.Warning = *b.WarningThreshold
+	}
+	if b.CompareOperator != nil {
+		check.Operator = *b.CompareOperator
+	}
+	if b.BreakdownField != nil {
+		check.BreakdownField = *b.BreakdownField
+	}
+	return check
+}
+
+func loadBatchChecks(path string) ([]BatchCheck, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var checks []BatchCheck
+	if err := yaml.Unmarshal(data, &checks); err != nil {
+		return nil, fmt.Errorf("batch file %s: %v", path, err)
+	}
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("batch file %s: no checks defined", path)
+	}
+
+	seen := make(map[string]bool)
+	for i, c := range checks {
+		if c.Name == "" {
+			return nil, fmt.Errorf("batch file %s: check %d has no name", path, i+1)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("batch file %s: duplicate check name %s", path, c.Name)
+		}
+		seen[c.Name] = true
+		if _, err := parseSchedule(c.Interval, *scrapeInterval); err != nil {
+			return nil, fmt.Errorf("batch file %s: check %s: %v", path, c.Name, err)
+		}
+	}
+	return checks, nil
+}
+
+// runBatchChecks evaluates checks concurrently, results are in the order of
+// checks
+func runBatchChecks(checks []escheck.Check, concurrency int) []*escheck.CheckResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]*escheck.CheckResult, len(checks))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			results[i] = evaluateCheck(checks[i])
+			results[i].Duration = time.Since(start)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// statusSeverity orders statuses from best to worst for aggregation,
+// UNKNOWN is better than WARNING the same way as in nagiosplugin
+var statusSeverity = map[nagiosplugin.Status]int{
+	nagiosplugin.OK:       0,
+	nagiosplugin.UNKNOWN:  1,
+	nagiosplugin.WARNING:  2,
+	nagiosplugin.CRITICAL: 3,
+}
+
+// aggregateBatchResults combines results into single result with worst
+// state, one long output line and count perfdata value per check
+func aggregateBatchResults(names []string, results []*escheck.CheckResult) *escheck.CheckResult {
+	aggregate := &escheck.CheckResult{Status: nagiosplugin.OK}
+	var failed []string
+	for i, r := range results {
+		if statusSeverity[r.Status] > statusSeverity[aggregate.Status] {
+			aggregate.Status = r.Status
+		}
+		if r.Status != nagiosplugin.OK {
+			failed = append(failed, fmt.Sprintf("%s %s", names[i], r.Status))
+		}
+		aggregate.LongOutput = append(aggregate.LongOutput, fmt.Sprintf("%s %s: %s", names[i], r.Status, r.Message))
+		for _, p := range r.PerfData {
+			if p.Label == "count" {
+				p.Label = names[i]
+				aggregate.AddPerfDatum(p)
+			}
+		}
+	}
+
+	if len(failed) == 0 {
+		aggregate.Message = fmt.Sprintf("all %d checks OK", len(results))
+	} else {
+		aggregate.Message = fmt.Sprintf("%d of %d checks not OK: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return aggregate
+}
+
+// getBatchChecks returns names and checks of --batch file with command line
+// options applied as defaults
+func getBatchChecks() ([]string, []escheck.Check, error) {
+	batchChecks, err := loadBatchChecks(*batchFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defaults := getCheck()
+	names := make([]string, len(batchChecks))
+	checks := make([]escheck.Check, len(batchChecks))
+	for i, b := range batchChecks {
+		names[i] = b.Name
+		checks[i] = b.apply(defaults)
+	}
+	return names, checks, nil
+}
+
+// runBatch evaluates checks of --batch file and prints either aggregated or
+// per-check results, exit code is the worst state
+func runBatch() error {
+	names, checks, err := getBatchChecks()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	results := runBatchChecks(checks, *batchConcurrency)
+	for i, r := range results {
+		recordResult(names[i], r)
+	}
+	aggregate := aggregateBatchResults(names, results)
+	aggregate.Duration = time.Since(start)
+
+	submitResult(aggregate)
+	if *batchOutput == "aggregate" {
+		printResult(aggregate, *outputFormat)
+	}
+
+	var f escheck.Formatter
+	for i, r := range results {
+		formatter, line, err := formatResult(names[i], r, checks[i], *outputFormat)
+		if err != nil {
+			return err
+		}
+		f = formatter
+		fmt.Println(line)
+	}
+	if f == nil {
+		os.Exit(int(aggregate.Status))
+	}
+	os.Exit(exitCode(f, aggregate.Status))
+	return nil
+}
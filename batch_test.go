@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+)
+
+func TestBatchChecksOpaqueID(t *testing.T) {
+	var mu sync.Mutex
+	ids := map[string]bool{}
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids[r.Header.Get("X-Opaque-Id")] = true
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"8.11.0"}}`))
+			return
+		}
+		w.Write([]byte(`{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},"hits":{"total":{"value":4,"relation":"eq"},"hits":[]}}`))
+	}))
+	defer es.Close()
+	defer func(saved *escheck.Client) { esClient = saved }(esClient)
+	esClient = escheck.NewClient(escheck.ClientOptions{URLs: []string{es.URL}, Timeout: 5 * time.Second, OpaqueID: "process"})
+
+	defaults := escheck.Check{Index: escheck.IndexOptions{Patterns: []string{"logs-*"}}, Query: "*", TimePeriod: 5, Threshold: 10, Operator: "lt"}
+	checks := []escheck.Check{
+		BatchCheck{Name: "payments"}.apply(defaults),
+		BatchCheck{Name: "checkout"}.apply(defaults),
+	}
+	for _, r := range runBatchChecks(checks, 2) {
+		if r.Count == nil {
+			t.Fatalf("check failed: %s", r.Message)
+		}
+	}
+
+	// every request carries id of its check instead of the client's one
+	if len(ids) != 2 || ids["process"] {
+		t.Fatalf("X-Opaque-Id headers = %v, want one per check", ids)
+	}
+	for _, name := range []string{"payments", "checkout"} {
+		found := false
+		for id := range ids {
+			found = found || strings.HasPrefix(id, "check-es-logs-count/"+name+"@")
+		}
+		if !found {
+			t.Errorf("X-Opaque-Id headers = %v, want one naming check %s", ids, name)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	bucketInterval = kingpin.Flag("bucket-interval", "size of histogram buckets in long plugin output, sparkline and gap detection, eg.: 1m; auto splits --time-period into at most 12 round buckets").Envar("CHECK_ES_BUCKET_INTERVAL").Default("auto").String()
+)
+
+// fixedBucketInterval is set up in main from --bucket-interval, 0 in auto
+// mode
+var fixedBucketInterval time.Duration
+
+// setupBucketInterval parses --bucket-interval flag
+func setupBucketInterval() error {
+	if *bucketInterval == "auto" {
+		return nil
+	}
+	d, err := time.ParseDuration(*bucketInterval)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("bucket-interval %s should be positive duration or auto", *bucketInterval)
+	}
+	fixedBucketInterval = d
+	return nil
+}
+
+// bucketIntervalFor returns histogram interval of check with time window of
+// period minutes
+func bucketIntervalFor(period int) time.Duration {
+	if fixedBucketInterval > 0 {
+		return fixedBucketInterval
+	}
+	return escheck.AutoBucketInterval(time.Duration(period) * time.Minute)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	cardinalityCmd            = kingpin.Command("cardinality", "count unique values of field over log entries matching query in time window, eg.: hosts sending logs, and compare it with thresholds using --compare-operator")
+	cardinalityField          = cardinalityCmd.Flag("field", "field whose unique values are counted, eg.: host.name or user.id").Envar("CHECK_ES_FIELD").Required().String()
+	cardinalityWarning        = cardinalityCmd.Flag("warning-value", "warning threshold for number of unique values, 0 disables").Envar("CHECK_ES_WARNING_VALUE").Float64()
+	cardinalityCritical       = cardinalityCmd.Flag("critical-value", "critical threshold for number of unique values, eg.: 40 with default 'gt' operator alerts when fewer than 40 hosts sent logs").Envar("CHECK_ES_CRITICAL_VALUE").Required().Float64()
+	cardinalityPrecision      = cardinalityCmd.Flag("precision-threshold", "count below which unique values are expected to be exact (cardinality precision_threshold, max 40000), 0 keeps elasticsearch default").Envar("CHECK_ES_PRECISION_THRESHOLD").Int()
+	cardinalityTimestampField = cardinalityCmd.Flag("timestamp-field", "field holding time of log entry").Envar("CHECK_ES_TIMESTAMP_FIELD").Default("@timestamp").String()
+)
+
+// getCardinalityCheck returns metric check counting unique values given by
+// command line flags
+func getCardinalityCheck() escheck.MetricCheck {
+	return escheck.MetricCheck{
+		Index:              getIndexOptions(),
+		Search:             getSearchOptions(),
+		Query:              *esQuery,
+		TimePeriod:         *timePeriod,
+		TimestampField:     *cardinalityTimestampField,
+		TimestampFormat:    *timestampFormat,
+		Field:              *cardinalityField,
+		Aggregation:        "cardinality",
+		PrecisionThreshold: *cardinalityPrecision,
+		Warning:            *cardinalityWarning,
+		Critical:           *cardinalityCritical,
+		Operator:           *compareOperator,
+		SearchTimeout:      *esTimeout,
+	}
+}
+
+func runCardinalityCheck() *escheck.CheckResult {
+	check := getCardinalityCheck()
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		return c.Client.RunMetric(check)
+	}, aggregateWorstResults)
+}
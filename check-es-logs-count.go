@@ -4,13 +4,13 @@ import (
 	"fmt"
 	"time"
 	"strings"
-	"text/template"
 	"bytes"
 	"encoding/json"
+	"net/url"
+	"os"
 
-	"github.com/parnurzeal/gorequest"
-	"gopkg.in/alecthomas/kingpin.v1"
-	"github.com/olorin/nagiosplugin"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
 )
 
 const (
@@ -18,200 +18,326 @@ const (
 )
 
 var (
-	esURL = kingpin.Flag("url", "elasticsearch URL").Default("http://localhost:9200").Short('u').String()
-	timeout = kingpin.Flag("timeout", "timeout for HTTP requests in seconds").Default("20").Int()
-	timePeriod = kingpin.Flag("time-period", "check last X minutes until now").Default("5").Short('t').Int()
-	indexPattern = kingpin.Flag("index-pattern", "index pattern, eg.: logstash-mediawiki").Default("logstash-*").Short('i').String()
-	esQuery = kingpin.Flag("query", "elasticsearch query").Default("*").Short('q').String()
-	countThreshold = kingpin.Flag("threshold", "threshold for logs count").Short('T').Required().Int()
-	compareOperator = kingpin.Flag("compare-operator", "operator to compare returned value with threshold, 'lt' or 'gt'").Short('o').Default("gt").String()
+	countCmd = kingpin.Command("count", "count log entries matching query in time window and compare count with thresholds (default command)").Default()
+	esURLs = kingpin.Flag("url", "elasticsearch URL, can be repeated or comma-separated to fail over to next URL when node is unreachable, times out or returns HTTP 5xx").Envar("CHECK_ES_URL").Default("http://localhost:9200").Short('u').Strings()
+	timeout = kingpin.Flag("timeout", "overall timeout in seconds for elasticsearch requests including retries and failover").Envar("CHECK_ES_TIMEOUT").Default("20").Int()
+	timePeriods = kingpin.Flag("time-period", "check last X minutes until now, given as minutes or duration, eg.: 5 or 1h; repeat to evaluate more windows in one run, each with --threshold and --warning-threshold of the same position or the last one given").Envar("CHECK_ES_TIME_PERIOD").Default("5").Short('t').Strings()
+	indexPatterns = kingpin.Flag("index-pattern", "index pattern, eg.: logstash-mediawiki, date math <logstash-{now/d}> (searched as logstash-* when time window crosses --index-rotation period) or remote cluster europe:logstash-*; can be repeated or comma-separated").Envar("CHECK_ES_INDEX_PATTERN").Default("logstash-*").Short('i').Strings()
+	dateSuffix = kingpin.Flag("date-suffix", "append -YYYY.MM.DD to index pattern, use --no-date-suffix to use index pattern verbatim (aliases, data streams, ILM)").Envar("CHECK_ES_DATE_SUFFIX").Default("true").Bool()
+	indexDateFormat = kingpin.Flag("index-date-format", "index date suffix format in logstash notation (YYYY, MM, dd, HH, xxxx, ww), defaults to format matching --index-rotation").Envar("CHECK_ES_INDEX_DATE_FORMAT").String()
+	indexRotation = kingpin.Flag("index-rotation", "index rotation period: hourly, daily, weekly or monthly").Envar("CHECK_ES_INDEX_ROTATION").Default("daily").Enum("hourly", "daily", "weekly", "monthly")
+	indexDateUTC = kingpin.Flag("index-date-utc", "compute index date suffix in UTC instead of local time (logstash default)").Envar("CHECK_ES_INDEX_DATE_UTC").Bool()
+	dataStreams = kingpin.Flag("data-stream", "data stream name, eg.: logs-app-default; overrides index pattern and skips date suffix logic, can be repeated or comma-separated").Envar("CHECK_ES_DATA_STREAM").Strings()
+	aliases = kingpin.Flag("alias", "alias name to query; overrides index pattern and skips date suffix logic, can be repeated or comma-separated").Envar("CHECK_ES_ALIAS").Strings()
+	verifyAliases = kingpin.Flag("verify-alias", "verify via _alias API that alias resolves to at least one index before querying").Envar("CHECK_ES_VERIFY_ALIAS").Bool()
+	ignoreUnavailable = kingpin.Flag("ignore-unavailable", "ignore missing or closed indices instead of failing the search, status line then reports successful of total shards of the indices found, missing indices have no shards and are not counted, --resolve lists indices searched").Envar("CHECK_ES_IGNORE_UNAVAILABLE").Bool()
+	allowNoIndices = kingpin.Flag("allow-no-indices", "allow wildcard expressions and aliases resolving to no indices, use --no-allow-no-indices to fail instead").Envar("CHECK_ES_ALLOW_NO_INDICES").Default("true").Bool()
+	ignoreThrottled = kingpin.Flag("ignore-throttled", "skip frozen (throttled) indices in the search").Envar("CHECK_ES_IGNORE_THROTTLED").Bool()
+	includeFrozen = kingpin.Flag("include-frozen", "include frozen (throttled) indices in the search, sets ignore_throttled=false").Envar("CHECK_ES_INCLUDE_FROZEN").Bool()
+	checkIndexExists = kingpin.Flag("check-index-exists", "only verify that target indices for the time window exist and have at least one started shard").Envar("CHECK_ES_CHECK_INDEX_EXISTS").Bool()
+	resolveTargets = kingpin.Flag("resolve", "resolve targets via _resolve/index API and report concrete indices, aliases and data streams covered").Envar("CHECK_ES_RESOLVE").Bool()
+	routing = kingpin.Flag("routing", "custom routing value(s) to limit the search to relevant shards, comma-separated").Envar("CHECK_ES_ROUTING").String()
+	requestCache = kingpin.Flag("request-cache", "enable (true) or disable (false) shard request cache for the search regardless of index setting, true saves repeated aggregation cost of --align windows, false validates fresh data").Envar("CHECK_ES_REQUEST_CACHE").Enum("true", "false")
+	preference = kingpin.Flag("preference", "shard copy preference, eg.: _local or custom string").Envar("CHECK_ES_PREFERENCE").String()
+	esTimeout = kingpin.Flag("es-timeout", "search timeout enforced by elasticsearch itself (timeout in search body), eg.: 10s; partial results are reported per --timed-out-status, 0 disables").Envar("CHECK_ES_ES_TIMEOUT").Default("0s").Duration()
+	restTotalHitsAsInt = kingpin.Flag("rest-total-hits-as-int", "request hits.total as integer like elasticsearch 6.x returned (rest_total_hits_as_int=true), supported since 6.6").Envar("CHECK_ES_REST_TOTAL_HITS_AS_INT").Bool()
+	docType = kingpin.Flag("doc-type", "document type inserted into search URL (index/type/_search) for legacy elasticsearch 2.x/5.x clusters").Envar("CHECK_ES_DOC_TYPE").String()
+	printQuery = kingpin.Flag("print-query", "print target URL and rendered query in Kibana Dev Tools format and exit without contacting elasticsearch").Envar("CHECK_ES_PRINT_QUERY").Bool()
+	esQuery = kingpin.Flag("query", "elasticsearch query").Envar("CHECK_ES_QUERY").Default("*").Short('q').String()
+	warningThresholds = kingpin.Flag("warning-threshold", "warning threshold for logs count, evaluated with the same compare operator, 0 disables; repeat for every --time-period").Envar("CHECK_ES_WARNING_THRESHOLD").Short('W').Ints()
+	countThresholds = kingpin.Flag("threshold", "threshold for logs count, required except in --check-index-exists mode; repeat for every --time-period").Envar("CHECK_ES_THRESHOLD").Short('T').Ints()
+	percentileField = kingpin.Flag("percentile-field", "compare thresholds with --percentile of numeric field over matching entries instead of their count, eg.: event.duration for latency from logs").Envar("CHECK_ES_PERCENTILE_FIELD").String()
+	percentile = kingpin.Flag("percentile", "percentile of --percentile-field compared with thresholds, eg.: 95 or 99.9").Envar("CHECK_ES_PERCENTILE").Default("95").Float64()
+	trend = kingpin.Flag("trend", "compare thresholds with moving-avg or derivative of counts in --trend-interval buckets taken from the last complete bucket instead of total count, so spiky sources are judged on trend").Envar("CHECK_ES_TREND").Enum("moving-avg", "derivative")
+	trendWindow = kingpin.Flag("trend-window", "number of preceding buckets averaged by --trend moving-avg").Envar("CHECK_ES_TREND_WINDOW").Default("5").Int()
+	trendInterval = kingpin.Flag("trend-interval", "histogram bucket size for --trend").Envar("CHECK_ES_TREND_INTERVAL").Default("1m").Duration()
+	sumField = kingpin.Flag("sum-field", "compare thresholds with sum of numeric field over matching entries instead of their count, eg.: network.bytes for data volume ingested in the window").Envar("CHECK_ES_SUM_FIELD").String()
+	compareOperator = kingpin.Flag("compare-operator", "operator to compare returned value with threshold, 'lt' or 'gt'").Envar("CHECK_ES_COMPARE_OPERATOR").Short('o').Default("gt").String()
+	maxLag = kingpin.Flag("max-lag", "critical when the newest matching entry is older, so pipelines alive but lagging are detected even when counts look fine, eg.: 10m, 0 disables").Envar("CHECK_ES_MAX_LAG").Default("0s").Duration()
+	warningLag = kingpin.Flag("warning-lag", "warning when the newest matching entry is older, 0 disables").Envar("CHECK_ES_WARNING_LAG").Default("0s").Duration()
+	sparklineStyle = kingpin.Flag("sparkline", "append per-bucket counts of the time window drawn as unicode or ascii sparkline to status line").Envar("CHECK_ES_SPARKLINE").Enum("unicode", "ascii")
+	withHistogram = kingpin.Flag("with-histogram", "request date_histogram of --bucket-interval buckets with the count, without it plain count query with no aggregation is sent unless other options need one").Envar("CHECK_ES_WITH_HISTOGRAM").Bool()
+	histogramOutput = kingpin.Flag("histogram-output", "print per-bucket counts of --with-histogram as long plugin output, use --no-histogram-output to disable").Envar("CHECK_ES_HISTOGRAM_OUTPUT").Default("true").Bool()
+	explainZero = kingpin.Flag("explain-zero", "when no entries are found, request index stats and report whether index is missing, empty or has only not matching entries").Envar("CHECK_ES_EXPLAIN_ZERO").Bool()
+	align = kingpin.Flag("align", "end time window at the last whole --bucket-interval bucket (--trend-interval with --trend, minute without histogram) instead of now, so successive runs evaluate the same bucket edges").Envar("CHECK_ES_ALIGN").Bool()
+	timestampFormat = kingpin.Flag("timestamp-format", "elasticsearch date format of time window bounds in range query on timestamp field: epoch_millis, epoch_second for fields indexed in epoch seconds, strict_date_optional_time or custom pattern, eg.: yyyy-MM-dd HH:mm:ss").Envar("CHECK_ES_TIMESTAMP_FORMAT").Default(escheck.DefaultTimestampFormat).String()
+	samples = kingpin.Flag("samples", "number of newest matching documents to fetch and append to long plugin output, 0 disables").Envar("CHECK_ES_SAMPLES").Int()
+	sampleFields = kingpin.Flag("sample-fields", "document fields to fetch for samples, eg.: message,host.name, can be repeated or comma-separated").Envar("CHECK_ES_SAMPLE_FIELDS").Strings()
+	sampleMaxLen = kingpin.Flag("sample-max-len", "cut values of --sample-fields, or whole sample documents without them, to this many characters, 0 disables").Envar("CHECK_ES_SAMPLE_MAX_LEN").Int()
+	maskFields = kingpin.Flag("mask-fields", "sample document fields with values replaced by *** before printing, eg.: user.email,http.request.headers.authorization, can be repeated or comma-separated").Envar("CHECK_ES_MASK_FIELDS").Strings()
+	maskPatterns = kingpin.Flag("mask-pattern", "regular expression replaced by *** in string values of sample documents before printing, repeatable, eg.: '[\\w.+-]+@[\\w-]+\\.[\\w.]+'").Envar("CHECK_ES_MASK_PATTERN").Strings()
+	sampleDedup = kingpin.Flag("sample-dedup", "print samples differing only in numbers and hexadecimal ids, eg.: repeated stack traces, once with occurrence count, use --no-sample-dedup to print every sample").Envar("CHECK_ES_SAMPLE_DEDUP").Default("true").Bool()
+	samplesOn = kingpin.Flag("samples-on", "check states in which samples are printed: non-ok, ok or always").Envar("CHECK_ES_SAMPLES_ON").Default("non-ok").Enum("non-ok", "ok", "always")
+	breakdownField = kingpin.Flag("breakdown-field", "field for terms aggregation appending top contributors to long plugin output, eg.: host.name").Envar("CHECK_ES_BREAKDOWN_FIELD").String()
+	breakdownSize = kingpin.Flag("breakdown-size", "number of top contributors in breakdown").Envar("CHECK_ES_BREAKDOWN_SIZE").Default("5").Int()
+	samplerShardSize = kingpin.Flag("sampler-shard-size", "compute --breakdown-field and --significant-fields from sample of this many best matching entries per shard, bounding query cost on very large indices at expense of exactness, 0 disables").Envar("CHECK_ES_SAMPLER_SHARD_SIZE").Int()
+	significantFields = kingpin.Flag("significant-fields", "on CRITICAL run significant_terms aggregation of fields against --significant-background window and append standout values to long plugin output, eg.: host.name,service.name, can be repeated or comma-separated").Envar("CHECK_ES_SIGNIFICANT_FIELDS").Strings()
+	significantBackground = kingpin.Flag("significant-background", "length of background window preceding --time-period window for --significant-fields").Envar("CHECK_ES_SIGNIFICANT_BACKGROUND").Default("24h").Duration()
+	significantSize = kingpin.Flag("significant-size", "number of standout values per --significant-fields field").Envar("CHECK_ES_SIGNIFICANT_SIZE").Default("5").Int()
+	outputTemplate = kingpin.Flag("output-template", "Go template for status line, available fields: .Status .Count .Rate .Percent .Query .Window .Warning .Threshold .Operator").Envar("CHECK_ES_OUTPUT_TEMPLATE").String()
+	maxOutputBytes = kingpin.Flag("max-output-bytes", "truncate Nagios output to this many bytes keeping status line and perfdata valid, eg.: 1024 for NRPE 2.x, 0 disables").Envar("CHECK_ES_MAX_OUTPUT_BYTES").Int()
+	shardFailureStatus = kingpin.Flag("shard-failure-status", "status reported when some shards failed and count is incomplete: warning, critical, unknown or ignore to evaluate thresholds anyway").Envar("CHECK_ES_SHARD_FAILURE_STATUS").Default("warning").Enum("warning", "critical", "unknown", "ignore")
+	retryPartial = kingpin.Flag("retry-partial", "repeat search once within --timeout when some shards failed or search timed out before reporting --shard-failure-status or --timed-out-status, use --no-retry-partial to disable").Envar("CHECK_ES_RETRY_PARTIAL").Default("true").Bool()
+	timedOutStatus = kingpin.Flag("timed-out-status", "status reported when search timed out and returned partial results: warning, critical, unknown or ignore to evaluate thresholds anyway").Envar("CHECK_ES_TIMED_OUT_STATUS").Default("unknown").Enum("warning", "critical", "unknown", "ignore")
+	outputFormat = kingpin.Flag("output", "output format: nagios, checkmk (local check), json, sensu, influx (line protocol for telegraf exec input) or prometheus (text format for node_exporter textfile collector)").Envar("CHECK_ES_OUTPUT").Default("nagios").String()
+	pointInTime = kingpin.Flag("point-in-time", "open point in time (Elasticsearch 7.10 or later) before search, so count, its --retry-partial retry and --significant-fields search see the same snapshot of indices during heavy ingestion").Envar("CHECK_ES_POINT_IN_TIME").Bool()
+	perIndexSearch = kingpin.Flag("per-index-search", "search every index of time window separately with this many concurrent searches and merge counts client-side, can be faster than one search across cold and hot tier indices, 0 searches all indices at once").Envar("CHECK_ES_PER_INDEX_SEARCH").Int()
+	asyncSearch = kingpin.Flag("async-search", "submit search via _async_search API and poll for result until --timeout, for long lookbacks on cold or frozen data").Envar("CHECK_ES_ASYNC_SEARCH").Bool()
+	asyncPollInterval = kingpin.Flag("async-poll-interval", "how long single async search request waits for completion before polling again").Envar("CHECK_ES_ASYNC_POLL_INTERVAL").Default("1s").Duration()
+	showDeprecations = kingpin.Flag("show-deprecations", "append deprecation warnings returned by elasticsearch in Warning headers to long plugin output").Envar("CHECK_ES_SHOW_DEPRECATIONS").Bool()
+	kibanaURL = kingpin.Flag("kibana-url", "Kibana base URL, appends Discover link with query and time range to the output, eg.: https://kibana.example.com").Envar("CHECK_ES_KIBANA_URL").String()
+	kibanaIndexPatternID = kingpin.Flag("kibana-index-pattern-id", "Kibana index pattern (data view) id used in Discover link").Envar("CHECK_ES_KIBANA_INDEX_PATTERN_ID").String()
 )
 
-// TemplateESQuery : struct containts elasticsearch query data
-type TemplateESQuery struct {
-	TimeFrom int64
-	Query string
-}
-
-// QueryResult : struct containts elasticsearch query result
-type QueryResult struct {
-	Hits struct {
-		Total int `json:"total"`
-	} `json:"hits"`
-}
-
-// Msg : struct containts channel message content
-type Msg struct {
-	Count int
-	Err error
-}
-
-var (
-	templateSource = `
-	{
-		"size": 0,
-		"query": {
-			"bool": {
-				"must": [
-					{
-						"query_string": {
-							"analyze_wildcard": true,
-							"query": "{{ .Query }}"
-						}
-					},
-					{
-						"range": {
-							"@timestamp": {
-								"lte": "now",
-								"gte": {{ .TimeFrom }},
-								"format": "epoch_millis"
-							}
-						}
-					}
-				],
-				"must_not": []
-			}
-		},
-		"_source": {
-			"excludes": []
-		},
-		"aggs": {
-			"3": {
-				"date_histogram": {
-					"field": "@timestamp",
-					"interval": "1h",
-					"time_zone": "UTC",
-					"min_doc_count": 1
-				}
+// splitList splits repeated and comma-separated flag values
+func splitList(values []string) []string {
+	var result []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				result = append(result, s)
 			}
 		}
 	}
-	`
-)
+	return result
+}
 
-func getRenderedTemplate(templateSource, query string, timeFrom int64) (string, error) {
-	t := TemplateESQuery{
-		timeFrom * 1000,
-		query,
+func getIndexOptions() escheck.IndexOptions {
+	return escheck.IndexOptions{
+		Patterns: splitList(*indexPatterns),
+		DataStreams: splitList(*dataStreams),
+		Aliases: splitList(*aliases),
+		VerifyAliases: *verifyAliases,
+		DateSuffix: *dateSuffix,
+		DateFormat: *indexDateFormat,
+		Rotation: *indexRotation,
+		UTC: *indexDateUTC,
+		Resolve: *resolveTargets,
+		DocType: *docType,
 	}
+}
 
-	tmpl, err := template.New("TemplateESQuery").Parse(templateSource)
-	if err != nil {
-		return "", err
+func getSearchOptions() escheck.SearchOptions {
+	return escheck.SearchOptions{
+		IgnoreUnavailable: *ignoreUnavailable,
+		AllowNoIndices: *allowNoIndices,
+		IgnoreThrottled: *ignoreThrottled,
+		IncludeFrozen: *includeFrozen,
+		Routing: *routing,
+		Preference: *preference,
+		RestTotalHitsAsInt: *restTotalHitsAsInt,
+		Async: *asyncSearch,
+		AsyncPollInterval: *asyncPollInterval,
+		RequestCache: *requestCache,
+		PointInTime: *pointInTime,
+		PerIndex: *perIndexSearch,
 	}
+}
 
-	var tpl bytes.Buffer
-	err = tmpl.Execute(&tpl, t)
-	if err != nil {
-		return "", err
+// getCheck returns check definition given by command line flags
+func getCheck() escheck.Check {
+	return escheck.Check{
+		Index: getIndexOptions(),
+		Search: getSearchOptions(),
+		Query: *esQuery,
+		TimePeriod: *timePeriod,
+		Warning: windowThreshold(*warningThresholds, 0),
+		Threshold: windowThreshold(*countThresholds, 0),
+		Operator: *compareOperator,
+		CheckIndexExists: *checkIndexExists,
+		Samples: *samples,
+		SampleFields: splitList(*sampleFields),
+		SamplesOn: *samplesOn,
+		SampleMaxLen: *sampleMaxLen,
+		SampleDedup: *sampleDedup,
+		MaskFields: splitList(*maskFields),
+		MaskPatterns: *maskPatterns,
+		BreakdownField: *breakdownField,
+		BreakdownSize: *breakdownSize,
+		Histogram: *withHistogram && *histogramOutput,
+		SearchTimeout: *esTimeout,
+		OutputTemplate: *outputTemplate,
+		KibanaURL: *kibanaURL,
+		KibanaIndexPatternID: *kibanaIndexPatternID,
+		ShardFailureStatus: *shardFailureStatus,
+		TimedOutStatus: *timedOutStatus,
+		RetryPartial: *retryPartial,
+		ShowDeprecations: *showDeprecations,
+		MinUnique: minUniqueConditions,
+		SumField: *sumField,
+		PercentileField: *percentileField,
+		Percentile: *percentile,
+		TermThresholds: termThresholdList,
+		FilterThresholds: filterThresholdList,
+		Trend: *trend,
+		TrendWindow: *trendWindow,
+		TrendInterval: *trendInterval,
+		SignificantFields: splitList(*significantFields),
+		SignificantBackground: *significantBackground,
+		SignificantSize: *significantSize,
+		Sparkline: *sparklineStyle,
+		SamplerShardSize: *samplerShardSize,
+		MaxLag: *maxLag,
+		Profile: *profileFile != "",
+		BucketInterval: bucketIntervalFor(*timePeriod),
+		WarningLag: *warningLag,
+		Align: *align,
+		TimestampFormat: *timestampFormat,
+		FieldFilters: getFieldFilters(),
+		ExplainZero: *explainZero,
+		Range: criticalBand,
+		WarningRange: warningBand,
 	}
-
-	return tpl.String(), nil
 }
 
-func esQueryPost(url, content string) (string, error) {
-	request := gorequest.New()
-	resp, body, errs := request.Post(url).Send(content).End()
-
-	if errs != nil {
-		var errsStr []string
-		for _, e := range errs {
-			errsStr = append(errsStr, fmt.Sprintf("%s", e))
-		}
-		return "", fmt.Errorf("%s", strings.Join(errsStr, ", "))
+func runCheck() *escheck.CheckResult {
+	if len(windowPeriods) > 1 {
+		return runWindowChecks(getCheck())
 	}
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("HTTP response code: %s", resp.Status)
-	}
-	return body, nil
+	return evaluateCheck(getCheck())
 }
 
-func getQueryResultCount(url, indexPattern, templateSource, query string, timeFrom int64, c chan Msg) {
-	var msg Msg
-	tmpl, err := getRenderedTemplate(templateSource, query, timeFrom)
+// printSearchRequest renders search request in Kibana Dev Tools console
+// format without contacting elasticsearch
+func printSearchRequest() error {
+	searchURL, tmpl, err := esClient.SearchRequest(getCheck())
 	if err != nil {
-		msg.Err = err
-		c <- msg
-		return
+		return err
 	}
 
-	currentTime := time.Now().Local()
-	url = url + "/" + indexPattern + "-" + currentTime.Format("2006.01.02") + "/_search"
-
-	data, err := esQueryPost(url, tmpl)
+	u, err := url.Parse(searchURL)
 	if err != nil {
-		msg.Err = err
-		c <- msg
-		return
+		return err
 	}
-
-	result, err := parseResult(data)
-	if err != nil {
-		msg.Err = err
-		c <- msg
-		return
+	var body bytes.Buffer
+	if err := json.Indent(&body, []byte(tmpl), "", "  "); err != nil {
+		return fmt.Errorf("rendered query is not valid JSON: %v", err)
 	}
-
-	msg.Count = result.Hits.Total
-	msg.Err = nil
-	c <- msg
+	fmt.Printf("# %s\nPOST %s\n%s\n", escheck.RedactURL(searchURL), u.RequestURI(), body.String())
+	return nil
 }
 
-func parseResult(data string) (QueryResult, error) {
-	var result QueryResult
-	err := json.Unmarshal([]byte(data), &result)
+func main() {
+	kingpin.Version(ver)
+	args, err := expandConfigFile(os.Args[1:])
 	if err != nil {
-		return result, fmt.Errorf("JSON parse failed")
+		kingpin.Fatalf("%v", err)
+	}
+	command := kingpin.MustParse(kingpin.CommandLine.Parse(args))
+	if err := setupLogging(); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if err := setupHTTPClients(); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if err := setupFormatters(); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if err := setupErrorAs(); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if err := setupMinUnique(); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if err := setupTermThresholds(); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if err := setupFilterThresholds(); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if err := setupBucketInterval(); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if err := setupTimePeriods(); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if err := setupBands(); err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if err := setupHeartbeat(); err != nil {
+		kingpin.Fatalf("%v", err)
 	}
-	return result, nil
-}
-
-func normalizeEsQuery(str string) string {
-	return strings.Replace(str, `"`, `\"`, -1)
-}
 
-func main() {
-	kingpin.Version(ver)
-	kingpin.Parse()
+	// commands select the same modes as --batch and --serve flags, which are
+	// kept for existing configurations
+	run := runCheck
+	switch command {
+	case freshnessCmd.FullCommand():
+		run = runFreshnessCheck
+	case metricCmd.FullCommand():
+		run = runMetricCheck
+	case healthCmd.FullCommand():
+		run = runHealthCheck
+	case growthCmd.FullCommand():
+		run = runGrowthCheck
+	case ingestCmd.FullCommand():
+		run = runIngestCheck
+	case cardinalityCmd.FullCommand():
+		run = runCardinalityCheck
+	case gapCmd.FullCommand():
+		run = runGapCheck
+	case anomalyCmd.FullCommand():
+		run = runAnomalyCheck
+	case ratioCmd.FullCommand():
+		run = runRatioCheck
+	case heartbeatCmd.FullCommand():
+		run = runHeartbeatCheck
+	case lossCmd.FullCommand():
+		run = runLossCheck
+	case compareCmd.FullCommand():
+		if len(clusterClients) != 2 {
+			kingpin.Fatalf("compare command requires reference and replica given by two --cluster flags")
+		}
+		run = runCompareCheck
+	case batchCmd.FullCommand():
+		*batchFile = *batchCmdFile
+	case serveCmd.FullCommand():
+		if *serveCmdAddr != "" {
+			*serveAddr = *serveCmdAddr
+		}
+		if *serveAddr == "" {
+			kingpin.Fatalf("serve command requires address")
+		}
+	}
 
-	check := nagiosplugin.NewCheck()
-	defer check.Finish()
+	if *serveAddr != "" {
+		if err := runServer(*serveAddr); err != nil {
+			kingpin.Fatalf("%v", err)
+		}
+		return
+	}
 
-	if *compareOperator != "lt" && *compareOperator != "gt" {
-		check.AddResult(nagiosplugin.UNKNOWN, "compare-operator parameter should be 'lt' or 'gt'")
+	if *listenAddr != "" {
+		if err := runExporter(*listenAddr, *scrapeInterval); err != nil {
+			kingpin.Fatalf("%v", err)
+		}
 		return
 	}
 
-	if *countThreshold == 0 {
-		check.AddResult(nagiosplugin.UNKNOWN, "threshold cannot be equal to 0")
+	if *printQuery {
+		if err := printSearchRequest(); err != nil {
+			kingpin.Fatalf("%v", err)
+		}
 		return
 	}
 
-	c := make(chan Msg)
-	go getQueryResultCount(
-		*esURL,
-		*indexPattern,
-		templateSource,
-		normalizeEsQuery(*esQuery),
-		time.Now().Unix() - int64(60) * int64(*timePeriod),
-		c,
-	)
-
-	var msg Msg
-
-	select {
-	case msg = <-c:
-		if msg.Err == nil {
-			perc := float64(msg.Count) / float64(*countThreshold) * 100
-			if (*compareOperator == "gt" && msg.Count >= *countThreshold) || (*compareOperator == "lt" && msg.Count <= *countThreshold) {
-				check.AddResult(nagiosplugin.OK, fmt.Sprintf("%d entries of '%s' (%.2f%%) found in the past %d minutes", msg.Count, *esQuery, perc, *timePeriod))
-			} else if (*compareOperator == "gt" && msg.Count < *countThreshold) || (*compareOperator == "lt" && msg.Count > *countThreshold) {
-				check.AddResult(nagiosplugin.CRITICAL, fmt.Sprintf("%d entries of '%s' (%.2f%%) found in the past %d minutes", msg.Count, *esQuery, perc, *timePeriod))
-			}
-		} else {
-			check.AddResult(nagiosplugin.UNKNOWN, fmt.Sprintf("%v", msg.Err))
+	if *batchFile != "" {
+		if err := runBatch(); err != nil {
+			kingpin.Fatalf("%v", err)
 		}
-	case <-time.After(time.Second * time.Duration(*timeout)):
-		check.AddResult(nagiosplugin.UNKNOWN, "connection timeout")
+		return
+	}
+
+	start := time.Now()
+	result, interrupted := runInterruptible(run)
+	result.Duration = time.Since(start)
+	applyCheckName(result)
+	recordResult(commandLineCheckName(), result)
+
+	// external systems may block while process is being stopped
+	if !interrupted {
+		submitResult(result)
 	}
+	printResult(result, *outputFormat)
 }
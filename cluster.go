@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	clusterSpecs       = kingpin.Flag("cluster", "elasticsearch cluster given as label=URL[,URL...] queried concurrently with the same check instead of --url, repeatable, eg.: --cluster dc1=https://es-dc1:9200 --cluster dc2=https://es-dc2:9200").Envar("CHECK_ES_CLUSTER").Strings()
+	clusterAggregation = kingpin.Flag("cluster-aggregation", "how results of --cluster clusters are combined: worst (each cluster is compared with thresholds, worst state wins) or sum (thresholds are compared with total count, any unreachable cluster makes the check UNKNOWN, not available with --sum-field, --percentile-field, --min-unique or --trend)").Envar("CHECK_ES_CLUSTER_AGGREGATION").Default("worst").Enum("worst", "sum")
+	urlAggregation     = kingpin.Flag("url-aggregation", "how several --url URLs are used: failover (nodes of single cluster tried in turn) or sum (every URL is separate cluster labeled by its host, thresholds are compared with total count like --cluster-aggregation sum, which can't be combined with --cluster)").Envar("CHECK_ES_URL_AGGREGATION").Default("failover").Enum("failover", "sum")
+)
+
+// ClusterClient : struct containts client of single --cluster cluster
+type ClusterClient struct {
+	Label  string
+	Client *escheck.Client
+	// Store keeps state of the cluster between check runs, nil when not
+	// configured
+	Store escheck.StateStore
+}
+
+// clusterClients is set up in main from --cluster flags, empty when single
+// cluster is given by --url
+var clusterClients []ClusterClient
+
+// parseClusterSpec splits label=URL[,URL...] cluster specification
+func parseClusterSpec(spec string) (string, []string, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	label := strings.TrimSpace(parts[0])
+	if len(parts) != 2 || label == "" || strings.Contains(label, "://") {
+		return "", nil, fmt.Errorf("cluster %s should be given as label=URL", spec)
+	}
+	urls := splitList([]string{parts[1]})
+	if len(urls) == 0 {
+		return "", nil, fmt.Errorf("cluster %s has no URL", label)
+	}
+	return label, urls, nil
+}
+
+// urlClusterSpecs returns cluster specification of every --url URL labeled
+// by its host
+func urlClusterSpecs() ([]string, error) {
+	var specs []string
+	for _, u := range splitList(*esURLs) {
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("url parameter %s should be absolute URL", u)
+		}
+		specs = append(specs, parsed.Host+"="+u)
+	}
+	return specs, nil
+}
+
+// setupClusterClients creates client for every --cluster cluster or every
+// --url URL with --url-aggregation sum, circuit breaker state is kept in
+// separate file per cluster
+func setupClusterClients() error {
+	specs := *clusterSpecs
+	if *urlAggregation == "sum" {
+		if len(specs) > 0 {
+			return fmt.Errorf("url-aggregation parameter sum can't be combined with cluster parameter")
+		}
+		var err error
+		if specs, err = urlClusterSpecs(); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		label, urls, err := parseClusterSpec(spec)
+		if err != nil {
+			return err
+		}
+		if seen[label] {
+			return fmt.Errorf("duplicate cluster label %s", label)
+		}
+		seen[label] = true
+
+		opts := getClientOptions()
+		opts.URLs = urls
+		// discovery flags describe single cluster
+		opts.Discovery = nil
+		opts.Breaker.Store = getStateStore(urls, label)
+		clusterClients = append(clusterClients, ClusterClient{Label: label, Client: escheck.NewClient(opts), Store: opts.Breaker.Store})
+	}
+	return nil
+}
+
+// evaluateCheck runs check against --url cluster or all --cluster clusters
+func evaluateCheck(check escheck.Check) *escheck.CheckResult {
+	aggregation := getClusterAggregation()
+	if err := validateClusterAggregation(check, aggregation); err != nil {
+		return &escheck.CheckResult{Status: nagiosplugin.UNKNOWN, Message: err.Error(), Failure: escheck.FailureInternal}
+	}
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		result := c.Client.Run(check)
+		recordProfile(check, c.Label, result)
+		return result
+	}, func(results []*escheck.CheckResult) *escheck.CheckResult {
+		return aggregateClusterResults(check, results, aggregation)
+	})
+}
+
+// validateClusterAggregation rejects sum of clusters for checks evaluating
+// other value than count of documents, summed document counts would be
+// compared with their thresholds
+func validateClusterAggregation(check escheck.Check, aggregation string) error {
+	if aggregation != "sum" {
+		return nil
+	}
+	var mode string
+	switch {
+	case check.SumField != "":
+		mode = "sum-field"
+	case check.PercentileField != "":
+		mode = "percentile-field"
+	case len(check.MinUnique) > 0:
+		mode = "min-unique"
+	case check.Trend != "":
+		mode = "trend"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s parameter can't be combined with summed cluster counts of cluster-aggregation or url-aggregation sum", mode)
+}
+
+// getClusterAggregation returns how per-cluster counts are combined, --url
+// URLs summed by --url-aggregation are always summed
+func getClusterAggregation() string {
+	if *urlAggregation == "sum" {
+		return "sum"
+	}
+	return *clusterAggregation
+}
+
+// evaluate runs run against --url cluster or concurrently against all
+// --cluster clusters and combines their results with aggregate
+func evaluate(run func(ClusterClient) *escheck.CheckResult, aggregate func([]*escheck.CheckResult) *escheck.CheckResult) *escheck.CheckResult {
+	start := time.Now()
+	if len(clusterClients) == 0 {
+		result := applyErrorAs(run(ClusterClient{Client: esClient, Store: getStateStore(splitList(*esURLs), "")}))
+		addSelfPerfData(result, time.Since(start), result.Requests)
+		return result
+	}
+
+	results := make([]*escheck.CheckResult, len(clusterClients))
+	var wg sync.WaitGroup
+	for i, c := range clusterClients {
+		wg.Add(1)
+		go func(i int, c ClusterClient) {
+			defer wg.Done()
+			results[i] = applyErrorAs(run(c))
+		}(i, c)
+	}
+	wg.Wait()
+	combined := aggregate(results)
+	combined.Requests = mergeRequestStats(results)
+	addSelfPerfData(combined, time.Since(start), combined.Requests)
+	return combined
+}
+
+// mergeRequestStats sums request stats of results
+func mergeRequestStats(results []*escheck.CheckResult) *escheck.RequestStats {
+	stats := &escheck.RequestStats{}
+	for _, r := range results {
+		if r.Requests == nil {
+			continue
+		}
+		stats.Requests += r.Requests.Requests
+		stats.Retries += r.Requests.Retries
+		if r.Requests.MaxLatency > stats.MaxLatency {
+			stats.MaxLatency = r.Requests.MaxLatency
+		}
+		stats.Spans = append(stats.Spans, r.Requests.Spans...)
+	}
+	return stats
+}
+
+// aggregateWorstResults combines per-cluster results into one with the
+// worst status, message of every cluster and perfdata suffixed by cluster
+// label
+func aggregateWorstResults(results []*escheck.CheckResult) *escheck.CheckResult {
+	aggregate := &escheck.CheckResult{Status: nagiosplugin.OK}
+	var states []string
+	for i, r := range results {
+		label := clusterClients[i].Label
+		if statusSeverity[r.Status] > statusSeverity[aggregate.Status] {
+			aggregate.Status = r.Status
+		}
+		states = append(states, fmt.Sprintf("%s %s", label, r.Status))
+		aggregate.LongOutput = append(aggregate.LongOutput, fmt.Sprintf("%s %s: %s", label, r.Status, r.Message))
+		for _, p := range r.PerfData {
+			p.Label += "_" + label
+			aggregate.AddPerfDatum(p)
+		}
+	}
+	aggregate.Message = fmt.Sprintf("%d clusters: %s", len(results), strings.Join(states, ", "))
+	return aggregate
+}
+
+// aggregateClusterResults combines per-cluster results into one with total
+// count, status according to aggregation and per-cluster long output and
+// perfdata
+func aggregateClusterResults(check escheck.Check, results []*escheck.CheckResult, aggregation string) *escheck.CheckResult {
+	aggregate := &escheck.CheckResult{Status: nagiosplugin.OK}
+	var total int
+	var counts []string
+	var failed []string
+	for i, r := range results {
+		label := clusterClients[i].Label
+		if r.Count == nil {
+			failed = append(failed, label)
+			counts = append(counts, fmt.Sprintf("%s %s", label, r.Status))
+		} else {
+			total += *r.Count
+			counts = append(counts, fmt.Sprintf("%s %d %s", label, *r.Count, r.Status))
+		}
+		if statusSeverity[r.Status] > statusSeverity[aggregate.Status] {
+			aggregate.Status = r.Status
+		}
+		aggregate.LongOutput = append(aggregate.LongOutput, fmt.Sprintf("%s %s: %s", label, r.Status, r.Message))
+	}
+
+	var breach string
+	if aggregation == "sum" {
+		aggregate.Status, breach = escheck.TotalStatus(check, total)
+		if len(failed) > 0 {
+			aggregate.Status = nagiosplugin.UNKNOWN
+		}
+	}
+
+	rate := float64(total) / float64(check.TimePeriod)
+	aggregate.Message = fmt.Sprintf("%d entries of '%s' found in the past %d minutes (%.2f/min) in %d clusters: %s", total, check.Query, check.TimePeriod, rate, len(results), strings.Join(counts, ", "))
+	if breach != "" {
+		aggregate.Message += ", total " + breach
+	}
+	if len(failed) > 0 {
+		aggregate.Message += fmt.Sprintf(", incomplete count: %s failed", strings.Join(failed, ", "))
+	}
+	if len(failed) < len(results) {
+		aggregate.Count = &total
+	}
+
+	// thresholds apply to total count only when it is evaluated
+	count := escheck.PerfDatum{Label: "count", Value: float64(total), Min: floatPtr(0)}
+	ratePerf := escheck.PerfDatum{Label: "rate", Value: rate, Min: floatPtr(0)}
+	if aggregation == "sum" {
+		count.Crit = floatPtr(float64(check.Threshold))
+		ratePerf.Crit = floatPtr(float64(check.Threshold) / float64(check.TimePeriod))
+		if check.Warning != 0 {
+			count.Warn = floatPtr(float64(check.Warning))
+			ratePerf.Warn = floatPtr(float64(check.Warning) / float64(check.TimePeriod))
+		}
+	}
+	aggregate.AddPerfDatum(count)
+	aggregate.AddPerfDatum(ratePerf)
+	if aggregation == "sum" && check.Range != nil {
+		escheck.SetRangePerfData(aggregate, check.Range, check.WarningRange)
+	}
+	for i, r := range results {
+		for _, p := range r.PerfData {
+			if p.Label == "count" {
+				p.Label = "count_" + clusterClients[i].Label
+				aggregate.AddPerfDatum(p)
+			}
+		}
+	}
+	return aggregate
+}
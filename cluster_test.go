@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+)
+
+func TestAggregateClusterResultsSumBand(t *testing.T) {
+	defer func(saved []ClusterClient) { clusterClients = saved }(clusterClients)
+	clusterClients = []ClusterClient{{Label: "eu"}, {Label: "us"}}
+
+	low := 100
+	check := escheck.Check{Query: "*", TimePeriod: 60, Range: &escheck.CountRange{Low: &low}}
+	eu, us := 30, 40
+	results := []*escheck.CheckResult{
+		{Status: nagiosplugin.CRITICAL, Count: &eu},
+		{Status: nagiosplugin.CRITICAL, Count: &us},
+	}
+
+	// band applies to total, not to counts of single clusters
+	result := aggregateClusterResults(check, results, "sum")
+	if result.Status != nagiosplugin.CRITICAL || !strings.HasSuffix(result.Message, ", total below minimum 100") {
+		t.Errorf("result = %v %q, want CRITICAL breaching minimum of total", result.Status, result.Message)
+	}
+	if p := result.PerfData[0]; p.Label != "count" || p.CritRange != "100:" || p.Crit != nil {
+		t.Errorf("count perfdata = %+v, want critical range 100:", p)
+	}
+
+	us = 80
+	if result := aggregateClusterResults(check, results, "sum"); result.Status != nagiosplugin.OK {
+		t.Errorf("status of total 110 = %v, want OK within band", result.Status)
+	}
+}
+
+func TestURLClusterSpecs(t *testing.T) {
+	defer func(saved []string) { *esURLs = saved }(*esURLs)
+
+	*esURLs = []string{"https://es-1:9200,https://es-2:9200/prefix"}
+	specs, err := urlClusterSpecs()
+	want := []string{"es-1:9200=https://es-1:9200", "es-2:9200=https://es-2:9200/prefix"}
+	if err != nil || !reflect.DeepEqual(specs, want) {
+		t.Errorf("urlClusterSpecs() = %v, %v, want %v", specs, err, want)
+	}
+
+	*esURLs = []string{"es-1:9200"}
+	if _, err := urlClusterSpecs(); err == nil {
+		t.Error("urlClusterSpecs() of URL without scheme succeeded, want error")
+	}
+}
+
+func TestSetupClusterClientsURLAggregation(t *testing.T) {
+	defer func(specs []string, aggregation string) {
+		*clusterSpecs, *urlAggregation = specs, aggregation
+	}(*clusterSpecs, *urlAggregation)
+
+	*clusterSpecs = []string{"dc1=https://es-dc1:9200"}
+	*urlAggregation = "sum"
+	if err := setupClusterClients(); err == nil || !strings.Contains(err.Error(), "can't be combined with cluster parameter") {
+		t.Errorf("setupClusterClients() = %v, want error of sum combined with cluster", err)
+	}
+	if got := getClusterAggregation(); got != "sum" {
+		t.Errorf("getClusterAggregation() = %s, want sum of urls", got)
+	}
+}
+
+func TestValidateClusterAggregation(t *testing.T) {
+	tests := []struct {
+		name    string
+		check   escheck.Check
+		wantErr bool
+	}{
+		{"count", escheck.Check{}, false},
+		{"band", escheck.Check{Range: &escheck.CountRange{}}, false},
+		{"sum-field", escheck.Check{SumField: "network.bytes"}, true},
+		{"percentile-field", escheck.Check{PercentileField: "event.duration", Percentile: 95}, true},
+		{"min-unique", escheck.Check{MinUnique: []escheck.UniqueCondition{{Field: "host.name", Min: 3}}}, true},
+		{"trend", escheck.Check{Trend: "moving-avg"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateClusterAggregation(tt.check, "sum"); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateClusterAggregation() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		// each cluster compares its own value with thresholds
+		if err := validateClusterAggregation(tt.check, "worst"); err != nil {
+			t.Errorf("%s: validateClusterAggregation() of worst = %v, want nil", tt.name, err)
+		}
+	}
+}
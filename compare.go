@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	compareCmd            = kingpin.Command("compare", "count log entries matching query on two --cluster clusters, the first one being reference (eg.: primary and DR replica), and alert when counts diverge")
+	compareWarning        = compareCmd.Flag("warning-divergence", "warning when replica count differs from reference count by more percent, 0 disables").Envar("CHECK_ES_WARNING_DIVERGENCE").Float64()
+	compareCritical       = compareCmd.Flag("critical-divergence", "critical when replica count differs from reference count by more percent").Envar("CHECK_ES_CRITICAL_DIVERGENCE").Default("5").Float64()
+	compareDelay          = compareCmd.Flag("delay", "end the window this long before now so replication lag isn't reported as divergence").Envar("CHECK_ES_DELAY").Default("1m").Duration()
+	compareTimestampField = compareCmd.Flag("timestamp-field", "field holding time of log entry").Envar("CHECK_ES_TIMESTAMP_FIELD").Default("@timestamp").String()
+)
+
+// getCompareCheck returns cross-cluster comparison definition given by
+// command line flags
+func getCompareCheck() escheck.CompareCheck {
+	return escheck.CompareCheck{
+		Index:           getIndexOptions(),
+		Search:          getSearchOptions(),
+		Query:           *esQuery,
+		TimestampField:  *compareTimestampField,
+		TimestampFormat: *timestampFormat,
+		TimePeriod:      *timePeriod,
+		Delay:           *compareDelay,
+		Warning:         *compareWarning,
+		Critical:        *compareCritical,
+		SearchTimeout:   *esTimeout,
+	}
+}
+
+func runCompareCheck() *escheck.CheckResult {
+	start := time.Now()
+	reference, replica := clusterClients[0], clusterClients[1]
+	result := applyErrorAs(escheck.CompareCounts(reference.Client, replica.Client, getCompareCheck()))
+	result.Message = fmt.Sprintf("%s/%s: %s", reference.Label, replica.Label, result.Message)
+	addSelfPerfData(result, time.Since(start), result.Requests)
+	return result
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	configFile = kingpin.Flag("config", "YAML file with option values keyed by long flag name, eg.: 'url: https://user:secret@es:9200'; flags given on command line or in CHECK_ES_* environment variables override values from the file").Envar("CHECK_ES_CONFIG").String()
+)
+
+// shortFlags maps short flag names to long ones so flags given in short
+// form on command line override config file values as well
+var shortFlags = map[byte]string{
+	'u': "url",
+	't': "time-period",
+	'i': "index-pattern",
+	'q': "query",
+	'W': "warning-threshold",
+	'T': "threshold",
+	'o': "compare-operator",
+	'v': "debug",
+}
+
+// flagEnvar returns name of environment variable overriding default of
+// flag, eg.: CHECK_ES_TIME_PERIOD for --time-period
+func flagEnvar(name string) string {
+	return "CHECK_ES_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// findConfigFile returns value of --config flag given on command line or
+// in environment
+func findConfigFile(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "--config=") {
+			return strings.TrimPrefix(arg, "--config=")
+		}
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv(flagEnvar("config"))
+}
+
+// commandLineFlags returns long names of flags given on command line,
+// --no-X counts as X
+func commandLineFlags(args []string) map[string]bool {
+	flags := make(map[string]bool)
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			name := strings.SplitN(arg[2:], "=", 2)[0]
+			flags[name] = true
+			flags[strings.TrimPrefix(name, "no-")] = true
+		case len(arg) >= 2 && arg[0] == '-':
+			if name, ok := shortFlags[arg[1]]; ok {
+				flags[name] = true
+			}
+		}
+	}
+	return flags
+}
+
+// loadConfigArgs reads config file and converts its values to command line
+// arguments, lists become repeated flags, maps repeated --X=key=value flags
+// and booleans --X or --no-X
+func loadConfigArgs(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		if name == "config" {
+			return nil, fmt.Errorf("config file %s: config option can't be nested", path)
+		}
+		switch v := values[name].(type) {
+		case nil:
+		case bool:
+			if v {
+				args = append(args, "--"+name)
+			} else {
+				args = append(args, "--no-"+name)
+			}
+		case []interface{}:
+			for _, item := range v {
+				args = append(args, fmt.Sprintf("--%s=%v", name, item))
+			}
+		case map[interface{}]interface{}:
+			items := make(map[string]interface{})
+			var keys []string
+			for key, value := range v {
+				switch value.(type) {
+				case map[interface{}]interface{}, []interface{}:
+					return nil, fmt.Errorf("config file %s: %s: nested values are not supported", path, name)
+				}
+				items[fmt.Sprint(key)] = value
+				keys = append(keys, fmt.Sprint(key))
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				args = append(args, fmt.Sprintf("--%s=%s=%v", name, key, items[key]))
+			}
+		default:
+			args = append(args, fmt.Sprintf("--%s=%v", name, v))
+		}
+	}
+	return args, nil
+}
+
+// expandConfigFile appends values of --config file to command line
+// arguments, so flags of commands are given after the command, skipping options given on command line or in CHECK_ES_*
+// environment variables so those take precedence also for repeatable flags
+func expandConfigFile(args []string) ([]string, error) {
+	path := findConfigFile(args)
+	if path == "" {
+		return args, nil
+	}
+	configArgs, err := loadConfigArgs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	given := commandLineFlags(args)
+	var expanded []string
+	for _, arg := range configArgs {
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		name = strings.TrimPrefix(name, "no-")
+		if given[name] || os.Getenv(flagEnvar(name)) != "" {
+			continue
+		}
+		expanded = append(expanded, arg)
+	}
+
+	// positional arguments may follow "--" terminator
+	for i, arg := range args {
+		if arg == "--" {
+			return append(append(append([]string{}, args[:i]...), expanded...), args[i:]...), nil
+		}
+	}
+	return append(args, expanded...), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	debug     = kingpin.Flag("debug", "log request URL, body, headers and elasticsearch response, same as --log-level=debug").Envar("CHECK_ES_DEBUG").Short('v').Bool()
+	logLevel  = kingpin.Flag("log-level", "minimum level of log messages: debug, info, warn or error; logs never go to stdout, which is reserved for check result").Envar("CHECK_ES_LOG_LEVEL").Default("info").Enum("debug", "info", "warn", "error")
+	logFormat = kingpin.Flag("log-format", "log format: text or json").Envar("CHECK_ES_LOG_FORMAT").Default("text").Enum("text", "json")
+	logFile   = kingpin.Flag("log-file", "append logs to this file instead of stderr").Envar("CHECK_ES_LOG_FILE").String()
+)
+
+// logger writes to stderr until setupLogging applies log flags
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// setupLogging creates logger according to log flags, it is called after
+// flags are parsed
+func setupLogging() error {
+	var w io.Writer = os.Stderr
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+
+	level := logLevels[*logLevel]
+	if *debug {
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if *logFormat == "json" {
+		logger = slog.New(slog.NewJSONHandler(w, opts))
+	} else {
+		logger = slog.New(slog.NewTextHandler(w, opts))
+	}
+	return nil
+}
+
+// logResult logs outcome of check evaluation, failed evaluations (UNKNOWN)
+// are logged as warnings
+func logResult(name string, result *escheck.CheckResult) {
+	attrs := []interface{}{"check", name, "status", result.Status.String(), "message", result.Message, "duration", result.Duration}
+	if result.Count != nil {
+		attrs = append(attrs, "count", *result.Count)
+	}
+	if result.Status == nagiosplugin.UNKNOWN {
+		logger.Warn("check evaluation failed", attrs...)
+		return
+	}
+	logger.Debug("check evaluated", attrs...)
+}
+
+func debugf(format string, args ...interface{}) {
+	logger.Debug(fmt.Sprintf(format, args...))
+}
+
+// getDebugLogger returns logger passed to escheck, nil unless debug level
+// is enabled so request and response dumps are skipped entirely
+func getDebugLogger() escheck.Logf {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return nil
+	}
+	return debugf
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	discoveryInterval = kingpin.Flag("discovery-interval", "how often discovered elasticsearch nodes are refreshed in --listen and --serve mode").Envar("CHECK_ES_DISCOVERY_INTERVAL").Default("30s").Duration()
+	consulService     = kingpin.Flag("consul-service", "query healthy instances of this Consul service instead of --url hosts, --url still gives scheme and credentials, eg.: elasticsearch-coordinators").Envar("CHECK_ES_CONSUL_SERVICE").String()
+	consulAddr        = kingpin.Flag("consul-addr", "Consul HTTP API URL, defaults to CONSUL_HTTP_ADDR or http://127.0.0.1:8500").Envar("CHECK_ES_CONSUL_ADDR").String()
+	consulTag         = kingpin.Flag("consul-tag", "only use Consul service instances with this tag").Envar("CHECK_ES_CONSUL_TAG").String()
+	consulDatacenter  = kingpin.Flag("consul-datacenter", "Consul datacenter of the service, defaults to datacenter of the agent").Envar("CHECK_ES_CONSUL_DATACENTER").String()
+	consulToken       = kingpin.Flag("consul-token", "Consul ACL token, defaults to CONSUL_HTTP_TOKEN").Envar("CHECK_ES_CONSUL_TOKEN").String()
+	k8sService        = kingpin.Flag("k8s-service", "query ready pods of this Kubernetes service given as namespace/name instead of --url hosts, --url still gives scheme and credentials; EndpointSlice API is used when running in-cluster (service account needs list permission on endpointslices), cluster DNS otherwise").Envar("CHECK_ES_K8S_SERVICE").String()
+	k8sPort           = kingpin.Flag("k8s-port", "name or number of elasticsearch port of --k8s-service pods, the first port of the service when not set").Envar("CHECK_ES_K8S_PORT").String()
+	k8sClusterDomain  = kingpin.Flag("k8s-cluster-domain", "Kubernetes cluster domain used for DNS discovery").Envar("CHECK_ES_K8S_CLUSTER_DOMAIN").Default("cluster.local").String()
+	srvRecord         = kingpin.Flag("srv", "query targets of this DNS SRV record instead of --url hosts, --url still gives scheme and credentials, eg.: _es._tcp.logging.internal; --resolver is used when set").Envar("CHECK_ES_SRV").String()
+)
+
+// getConsulAddr returns Consul API URL, CONSUL_HTTP_ADDR may be given
+// without scheme
+func getConsulAddr() string {
+	addr := *consulAddr
+	if addr == "" {
+		addr = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if addr == "" {
+		return "http://127.0.0.1:8500"
+	}
+	if !strings.Contains(addr, "://") {
+		return "http://" + addr
+	}
+	return addr
+}
+
+// checkDiscoveryFlags fails when more than one discovery method is given
+func checkDiscoveryFlags() error {
+	var methods []string
+	if *consulService != "" {
+		methods = append(methods, "consul-service")
+	}
+	if *srvRecord != "" {
+		methods = append(methods, "srv")
+	}
+	if *k8sService != "" {
+		methods = append(methods, "k8s-service")
+		if _, _, err := splitKubernetesService(*k8sService); err != nil {
+			return err
+		}
+	}
+	if len(methods) > 1 {
+		return fmt.Errorf("%s parameters are mutually exclusive", strings.Join(methods, " and "))
+	}
+	return nil
+}
+
+// serviceAccountDir is where Kubernetes mounts service account credentials
+// into pods
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+func splitKubernetesService(s string) (string, string, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("k8s-service parameter should be given as namespace/name")
+	}
+	return parts[0], parts[1], nil
+}
+
+// getKubernetesDiscovery returns discovery of --k8s-service pods, API is
+// used only when running in-cluster
+func getKubernetesDiscovery() *escheck.KubernetesDiscovery {
+	namespace, service, _ := splitKubernetesService(*k8sService)
+	d := &escheck.KubernetesDiscovery{
+		Namespace:     namespace,
+		Service:       service,
+		Port:          *k8sPort,
+		ClusterDomain: *k8sClusterDomain,
+		Request: escheck.RequestOptions{
+			Timeout:          *requestTimeout,
+			MaxResponseBytes: *maxResponseBytes,
+			Debugf:           getDebugLogger(),
+		},
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return d
+	}
+	d.APIServer = "https://" + net.JoinHostPort(host, port)
+	if _, err := os.Stat(filepath.Join(serviceAccountDir, "token")); err == nil {
+		d.TokenFile = filepath.Join(serviceAccountDir, "token")
+	}
+	tlsConfig := &tls.Config{}
+	if ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt")); err == nil {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(ca)
+	}
+	d.HTTPClient = &http.Client{Transport: escheck.NewTransport(getTransportOptions(tlsConfig))}
+	return d
+}
+
+// getDiscoverer returns service discovery of elasticsearch nodes, nil when
+// --url hosts are queried directly
+func getDiscoverer() escheck.Discoverer {
+	if *k8sService != "" {
+		return getKubernetesDiscovery()
+	}
+	if *srvRecord != "" {
+		return &escheck.SRVDiscovery{Name: *srvRecord, Server: *resolverAddr}
+	}
+	if *consulService != "" {
+		token := *consulToken
+		if token == "" {
+			token = os.Getenv("CONSUL_HTTP_TOKEN")
+		}
+		return &escheck.ConsulDiscovery{
+			Address:    getConsulAddr(),
+			Service:    *consulService,
+			Tag:        *consulTag,
+			Datacenter: *consulDatacenter,
+			Token:      token,
+			HTTPClient: httpClient,
+			Request: escheck.RequestOptions{
+				Timeout:          *requestTimeout,
+				MaxResponseBytes: *maxResponseBytes,
+				Debugf:           getDebugLogger(),
+			},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	unknownExitCode = kingpin.Flag("unknown-exit-code", "exit code used for UNKNOWN state, eg.: 2 for schedulers treating 3 as plugin crash").Envar("CHECK_ES_UNKNOWN_EXIT_CODE").Default("3").Int()
+	statusAs        = kingpin.Flag("status-as", "report elasticsearch error response of given HTTP status with given state instead of --error-as, given as code=state or code=state:message replacing error message, repeatable; eg.: --status-as '404=ok:no index yet' --status-as 401=critical").Envar("CHECK_ES_STATUS_AS").Strings()
+	errorAs         = kingpin.Flag("error-as", "report failures of given kind with given state instead of UNKNOWN, given as kind=state, repeatable; kinds: internal (invalid options, plugin errors), elasticsearch (unreachable cluster, error response), timeout; states: ok, warning, critical, unknown; eg.: --error-as timeout=warning").Envar("CHECK_ES_ERROR_AS").Strings()
+)
+
+var failureKinds = []escheck.Failure{escheck.FailureInternal, escheck.FailureElasticsearch, escheck.FailureTimeout}
+
+var stateNames = map[string]nagiosplugin.Status{
+	"ok":       nagiosplugin.OK,
+	"warning":  nagiosplugin.WARNING,
+	"critical": nagiosplugin.CRITICAL,
+	"unknown":  nagiosplugin.UNKNOWN,
+}
+
+// failureStatus maps kinds of failures to states, it is set up in main from
+// --error-as flags
+var failureStatus = make(map[escheck.Failure]nagiosplugin.Status)
+
+// responseState : struct containts state and optional message replacing
+// error of elasticsearch response with HTTP status
+type responseState struct {
+	status  nagiosplugin.Status
+	message string
+}
+
+// responseStatus maps HTTP status codes to states, it is set up in main
+// from --status-as flags
+var responseStatus = make(map[int]responseState)
+
+// setupErrorAs parses --error-as flags and checks --unknown-exit-code
+func setupErrorAs() error {
+	if *unknownExitCode < 0 || *unknownExitCode > 255 {
+		return fmt.Errorf("unknown-exit-code parameter should be between 0 and 255")
+	}
+	for _, spec := range splitList(*errorAs) {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("error-as %s should be given as kind=state", spec)
+		}
+		kind := escheck.Failure(parts[0])
+		known := false
+		for _, k := range failureKinds {
+			known = known || k == kind
+		}
+		if !known {
+			return fmt.Errorf("error-as kind should be internal, elasticsearch or timeout, got %s", parts[0])
+		}
+		status, ok := stateNames[parts[1]]
+		if !ok {
+			return fmt.Errorf("error-as state should be ok, warning, critical or unknown, got %s", parts[1])
+		}
+		failureStatus[kind] = status
+	}
+	for _, spec := range *statusAs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("status-as %s should be given as code=state or code=state:message", spec)
+		}
+		code, err := strconv.Atoi(parts[0])
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("status-as code should be HTTP status between 100 and 599, got %s", parts[0])
+		}
+		state := strings.SplitN(parts[1], ":", 2)
+		status, ok := stateNames[state[0]]
+		if !ok {
+			return fmt.Errorf("status-as state should be ok, warning, critical or unknown, got %s", state[0])
+		}
+		r := responseState{status: status}
+		if len(state) == 2 {
+			r.message = state[1]
+		}
+		responseStatus[code] = r
+	}
+	return nil
+}
+
+// applyErrorAs changes state of failed check according to --status-as or
+// --error-as
+func applyErrorAs(result *escheck.CheckResult) *escheck.CheckResult {
+	if r, ok := responseStatus[result.HTTPStatus]; ok && result.HTTPStatus != 0 {
+		result.Status = r.status
+		if r.message != "" {
+			result.LongOutput = append(result.LongOutput, result.Message)
+			result.Message = r.message
+		}
+		return result
+	}
+	if status, ok := failureStatus[result.Failure]; ok && result.Failure != "" {
+		result.Status = status
+	}
+	return result
+}
+
+// exitCode returns exit code of printed result, --unknown-exit-code replaces
+// code 3 of formats following Nagios plugin convention
+func exitCode(f escheck.Formatter, status nagiosplugin.Status) int {
+	code := f.ExitCode(status)
+	if status == nagiosplugin.UNKNOWN && code == int(nagiosplugin.UNKNOWN) {
+		return *unknownExitCode
+	}
+	return code
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	listenAddr     = kingpin.Flag("listen", "run as Prometheus exporter listening on this address, eg.: :9123").Envar("CHECK_ES_LISTEN").String()
+	scrapeInterval = kingpin.Flag("interval", "evaluation interval in exporter mode and default interval of checks in --serve mode").Envar("CHECK_ES_INTERVAL").Default("60s").Duration()
+)
+
+// Exporter : struct containts latest check result served as Prometheus metrics
+type Exporter struct {
+	mu      sync.RWMutex
+	result  *escheck.CheckResult
+	lastRun time.Time
+	labels  string
+	// running is start of evaluation in progress
+	running time.Time
+}
+
+func getPrometheusLabels() string {
+	return escheck.PrometheusLabels("", getCheck())
+}
+
+func newExporter() *Exporter {
+	return &Exporter{
+		labels: getPrometheusLabels(),
+	}
+}
+
+func (e *Exporter) evaluate() {
+	start := time.Now()
+	e.mu.Lock()
+	e.running = start
+	e.mu.Unlock()
+
+	result := runCheck()
+	result.Duration = time.Since(start)
+	applyCheckName(result)
+	recordResult(commandLineCheckName(), result)
+
+	e.mu.Lock()
+	e.result = result
+	e.lastRun = start
+	e.running = time.Time{}
+	e.mu.Unlock()
+}
+
+func (e *Exporter) loop(interval time.Duration) {
+	e.evaluate()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		e.evaluate()
+	}
+}
+
+// healthy fails when evaluation is stuck
+func (e *Exporter) healthy() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return stuckEvaluation(e.running)
+}
+
+// ready fails until first evaluation finished
+func (e *Exporter) ready() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.result == nil {
+		return fmt.Errorf("no evaluation finished yet")
+	}
+	return nil
+}
+
+// ServeHTTP serves latest result as Prometheus metrics
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.RLock()
+	result, lastRun := e.result, e.lastRun
+	e.mu.RUnlock()
+
+	if result == nil {
+		http.Error(w, "no evaluation finished yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, escheck.FormatPrometheusMetrics(result, e.labels, lastRun))
+}
+
+func runExporter(addr string, interval time.Duration) error {
+	e := newExporter()
+	go e.loop(interval)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	registerAdminHandlers(mux, e.healthy, e.ready)
+	return listenAndServe(addr, mux, e.healthy)
+}
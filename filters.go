@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	namedFilters     = kingpin.Flag("filter", "named query counted within --query by filters aggregation of the same search, given as name=query, repeatable; in --config file given as map of names to queries, eg.: --filter errors=level:error --filter timeouts='message:\"timed out\"'").Envar("CHECK_ES_FILTER").Strings()
+	filterThresholds = kingpin.Flag("filter-threshold", "thresholds of count of entries matching --filter given as name=[warning:]critical, required for every filter, compared with --compare-operator like total count, eg.: --filter-threshold errors=10:50").Envar("CHECK_ES_FILTER_THRESHOLD").Strings()
+)
+
+// filterThresholdList is set up in main from --filter and --filter-threshold
+// flags
+var filterThresholdList []escheck.FilterThreshold
+
+// setupFilterThresholds pairs --filter queries with their thresholds
+func setupFilterThresholds() error {
+	thresholds := make(map[string]escheck.FilterThreshold)
+	// queries may contain commas, so values are not split
+	for _, spec := range *filterThresholds {
+		name, warning, critical, err := parseNamedThreshold("filter-threshold", spec)
+		if err != nil {
+			return err
+		}
+		thresholds[name] = escheck.FilterThreshold{Name: name, Warning: warning, Critical: critical}
+	}
+
+	seen := make(map[string]bool)
+	for _, spec := range *namedFilters {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("filter %s should be given as name=query", spec)
+		}
+		f, ok := thresholds[parts[0]]
+		if !ok {
+			return fmt.Errorf("filter %s has no filter-threshold", parts[0])
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("filter %s given more than once", f.Name)
+		}
+		seen[f.Name] = true
+		f.Query = parts[1]
+		filterThresholdList = append(filterThresholdList, f)
+	}
+	for name := range thresholds {
+		if !seen[name] {
+			return fmt.Errorf("filter-threshold %s has no filter", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	freshnessCmd            = kingpin.Command("freshness", "alert when the newest log entry matching query is older than thresholds")
+	freshnessWarningAge     = freshnessCmd.Flag("warning-age", "warning when the newest matching entry is older, eg.: 2m, 0 disables").Envar("CHECK_ES_WARNING_AGE").Default("0s").Duration()
+	freshnessCriticalAge    = freshnessCmd.Flag("critical-age", "critical when the newest matching entry is older, eg.: 5m").Envar("CHECK_ES_CRITICAL_AGE").Default("5m").Duration()
+	freshnessLookback       = freshnessCmd.Flag("lookback", "how far back the newest matching entry is searched, limits indices queried; no entry found is critical").Envar("CHECK_ES_LOOKBACK").Default("24h").Duration()
+	freshnessGroupBy        = freshnessCmd.Flag("group-by", "evaluate age of the newest entry of each value of field, eg.: host.name, reporting which sources went silent; sources without entries in --lookback are not known").Envar("CHECK_ES_GROUP_BY").String()
+	freshnessGroupSize      = freshnessCmd.Flag("group-size", "number of --group-by values fetched per search, values are evaluated page by page up to 100 pages within --timeout").Envar("CHECK_ES_GROUP_SIZE").Default("100").Int()
+	freshnessTimestampField = freshnessCmd.Flag("timestamp-field", "field holding time of log entry").Envar("CHECK_ES_TIMESTAMP_FIELD").Default("@timestamp").String()
+)
+
+// getFreshnessCheck returns freshness check definition given by command
+// line flags
+func getFreshnessCheck() escheck.FreshnessCheck {
+	return escheck.FreshnessCheck{
+		Index:              getIndexOptions(),
+		Search:             getSearchOptions(),
+		Query:              *esQuery,
+		TimestampField:     *freshnessTimestampField,
+		TimestampFormat:    *timestampFormat,
+		Lookback:           *freshnessLookback,
+		Warning:            *freshnessWarningAge,
+		Critical:           *freshnessCriticalAge,
+		GroupBy:            *freshnessGroupBy,
+		GroupSize:          *freshnessGroupSize,
+		SearchTimeout:      *esTimeout,
+		ShardFailureStatus: *shardFailureStatus,
+		TimedOutStatus:     *timedOutStatus,
+	}
+}
+
+func runFreshnessCheck() *escheck.CheckResult {
+	check := getFreshnessCheck()
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		return c.Client.RunFreshness(check)
+	}, aggregateWorstResults)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	gapCmd            = kingpin.Command("gap", "alert when the longest period without log entries matching query in --time-period window exceeds --max-gap")
+	gapMax            = gapCmd.Flag("max-gap", "critical when no matching entry was found for this long, eg.: 10m").Envar("CHECK_ES_MAX_GAP").Required().Duration()
+	gapWarning        = gapCmd.Flag("warning-gap", "warning when no matching entry was found for this long, 0 disables").Envar("CHECK_ES_WARNING_GAP").Default("0s").Duration()
+	gapInterval       = gapCmd.Flag("interval", "histogram bucket size, the resolution of reported gaps, defaults to --bucket-interval").Envar("CHECK_ES_INTERVAL").Duration()
+	gapTimestampField = gapCmd.Flag("timestamp-field", "field holding time of log entry").Envar("CHECK_ES_TIMESTAMP_FIELD").Default("@timestamp").String()
+)
+
+// getGapCheck returns gap check definition given by command line flags
+func getGapCheck() escheck.GapCheck {
+	interval := *gapInterval
+	if interval == 0 {
+		interval = bucketIntervalFor(*timePeriod)
+	}
+	return escheck.GapCheck{
+		Index:           getIndexOptions(),
+		Search:          getSearchOptions(),
+		Query:           *esQuery,
+		TimestampField:  *gapTimestampField,
+		TimestampFormat: *timestampFormat,
+		TimePeriod:      *timePeriod,
+		Interval:        interval,
+		Warning:         *gapWarning,
+		Critical:        *gapMax,
+		SearchTimeout:   *esTimeout,
+	}
+}
+
+func runGapCheck() *escheck.CheckResult {
+	check := getGapCheck()
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		return c.Client.RunGap(check)
+	}, aggregateWorstResults)
+}
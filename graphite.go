@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	graphiteAddr   = kingpin.Flag("graphite-addr", "Graphite/Carbon plaintext protocol address (host:port) to send count and status to").Envar("CHECK_ES_GRAPHITE_ADDR").String()
+	graphitePrefix = kingpin.Flag("graphite-prefix", "Graphite metric path prefix").Envar("CHECK_ES_GRAPHITE_PREFIX").Default("es_logs").String()
+	graphiteCheck  = kingpin.Flag("graphite-check", "check name used in Graphite metric path <prefix>.<check>.count").Envar("CHECK_ES_GRAPHITE_CHECK").Default("check_es_logs_count").String()
+)
+
+var graphiteInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_\-]+`)
+
+func graphiteNode(s string) string {
+	return graphiteInvalidChars.ReplaceAllString(s, "_")
+}
+
+// formatGraphiteMetrics renders result in Carbon plaintext protocol,
+// "<path> <value> <timestamp>" per line
+func formatGraphiteMetrics(result *escheck.CheckResult, prefix, check string, t time.Time) string {
+	path := graphiteNode(check)
+	if prefix != "" {
+		path = prefix + "." + path
+	}
+
+	var lines []string
+	if result.Count != nil {
+		lines = append(lines, fmt.Sprintf("%s.count %d %d", path, *result.Count, t.Unix()))
+	}
+	lines = append(lines, fmt.Sprintf("%s.status %d %d", path, int(result.Status), t.Unix()))
+	lines = append(lines, fmt.Sprintf("%s.duration %.3f %d", path, result.Duration.Seconds(), t.Unix()))
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func sendGraphiteMetrics(result *escheck.CheckResult) error {
+	conn, err := net.DialTimeout("tcp", *graphiteAddr, time.Second*time.Duration(*timeout))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second * time.Duration(*timeout)))
+
+	_, err = conn.Write([]byte(formatGraphiteMetrics(result, *graphitePrefix, *graphiteCheck, time.Now())))
+	return err
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	growthCmd         = kingpin.Command("growth", "record document count and store size of target indices in --state-file or --state-redis and alert on growth rate between runs")
+	growthWarningMin  = growthCmd.Flag("warning-min-growth", "warning when fewer documents per minute were added since the previous run, 0 disables").Envar("CHECK_ES_WARNING_MIN_GROWTH").Float64()
+	growthCriticalMin = growthCmd.Flag("critical-min-growth", "critical when fewer documents per minute were added since the previous run, eg.: 1 for stopped ingestion, 0 disables").Envar("CHECK_ES_CRITICAL_MIN_GROWTH").Float64()
+	growthWarningMax  = growthCmd.Flag("warning-max-growth", "warning when more documents per minute were added since the previous run, 0 disables").Envar("CHECK_ES_WARNING_MAX_GROWTH").Float64()
+	growthCriticalMax = growthCmd.Flag("critical-max-growth", "critical when more documents per minute were added since the previous run, 0 disables").Envar("CHECK_ES_CRITICAL_MAX_GROWTH").Float64()
+	growthCriticalNo  = growthCmd.Flag("critical-no-growth", "critical when no document at all was added since the previous run, cheap check of stopped indexing without rate thresholds").Envar("CHECK_ES_CRITICAL_NO_GROWTH").Bool()
+)
+
+// getGrowthCheck returns index growth check definition given by command
+// line flags
+func getGrowthCheck(store escheck.StateStore) escheck.GrowthCheck {
+	return escheck.GrowthCheck{
+		Index:            getIndexOptions(),
+		Store:            store,
+		WarningMin:       *growthWarningMin,
+		CriticalMin:      *growthCriticalMin,
+		WarningMax:       *growthWarningMax,
+		CriticalMax:      *growthCriticalMax,
+		CriticalNoGrowth: *growthCriticalNo,
+	}
+}
+
+func runGrowthCheck() *escheck.CheckResult {
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		return c.Client.RunGrowth(getGrowthCheck(c.Store))
+	}, aggregateWorstResults)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	enablePprof = kingpin.Flag("pprof", "expose net/http/pprof profiling handlers under /debug/pprof/ in --serve and --listen mode").Envar("CHECK_ES_PPROF").Bool()
+)
+
+// registerAdminHandlers adds /healthz, which fails when healthy returns
+// error (eg.: evaluation is stuck), /readyz, which succeeds once ready
+// returns nil, and optionally pprof handlers
+func registerAdminHandlers(mux *http.ServeMux, healthy, ready func() error) {
+	mux.Handle("/healthz", statusHandler(healthy))
+	mux.Handle("/readyz", statusHandler(ready))
+
+	if *enablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+}
+
+func statusHandler(status func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := status(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// stuckEvaluation returns error when evaluation started at given time runs
+// much longer than --timeout allows
+func stuckEvaluation(started time.Time) error {
+	limit := 2 * time.Second * time.Duration(*timeout)
+	if d := time.Since(started); !started.IsZero() && d > limit {
+		return fmt.Errorf("evaluation running for %v", d.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	healthCmd                  = kingpin.Command("health", "check _cluster/health: yellow status is warning, red critical, shard and pending task counts are compared with thresholds")
+	healthWarningUnassigned    = healthCmd.Flag("warning-unassigned", "warning when more shards are unassigned, 0 disables").Envar("CHECK_ES_WARNING_UNASSIGNED").Int()
+	healthCriticalUnassigned   = healthCmd.Flag("critical-unassigned", "critical when more shards are unassigned, 0 disables").Envar("CHECK_ES_CRITICAL_UNASSIGNED").Int()
+	healthWarningRelocating    = healthCmd.Flag("warning-relocating", "warning when more shards are relocating, 0 disables").Envar("CHECK_ES_WARNING_RELOCATING").Int()
+	healthCriticalRelocating   = healthCmd.Flag("critical-relocating", "critical when more shards are relocating, 0 disables").Envar("CHECK_ES_CRITICAL_RELOCATING").Int()
+	healthWarningInitializing  = healthCmd.Flag("warning-initializing", "warning when more shards are initializing, 0 disables").Envar("CHECK_ES_WARNING_INITIALIZING").Int()
+	healthCriticalInitializing = healthCmd.Flag("critical-initializing", "critical when more shards are initializing, 0 disables").Envar("CHECK_ES_CRITICAL_INITIALIZING").Int()
+	healthWarningPendingTasks  = healthCmd.Flag("warning-pending-tasks", "warning when more cluster tasks are pending, 0 disables").Envar("CHECK_ES_WARNING_PENDING_TASKS").Int()
+	healthCriticalPendingTasks = healthCmd.Flag("critical-pending-tasks", "critical when more cluster tasks are pending, 0 disables").Envar("CHECK_ES_CRITICAL_PENDING_TASKS").Int()
+)
+
+// getHealthCheck returns cluster health check definition given by command
+// line flags
+func getHealthCheck() escheck.HealthCheck {
+	return escheck.HealthCheck{
+		Unassigned:   escheck.HealthThreshold{Warning: *healthWarningUnassigned, Critical: *healthCriticalUnassigned},
+		Relocating:   escheck.HealthThreshold{Warning: *healthWarningRelocating, Critical: *healthCriticalRelocating},
+		Initializing: escheck.HealthThreshold{Warning: *healthWarningInitializing, Critical: *healthCriticalInitializing},
+		PendingTasks: escheck.HealthThreshold{Warning: *healthWarningPendingTasks, Critical: *healthCriticalPendingTasks},
+	}
+}
+
+func runHealthCheck() *escheck.CheckResult {
+	check := getHealthCheck()
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		return c.Client.RunHealth(check)
+	}, aggregateWorstResults)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	heartbeatCmd     = kingpin.Command("heartbeat", "alert on single marker event matching query and --marker fields: critical when expected heartbeat is missing in --time-period window, or with --expect absent when event that should never happen was logged even once, the matching document is shown in long output")
+	heartbeatExpect  = heartbeatCmd.Flag("expect", "present: critical when no marker event was found, absent: critical when any marker event was found").Envar("CHECK_ES_EXPECT").Default("present").Enum("present", "absent")
+	heartbeatMarkers = heartbeatCmd.Flag("marker", "exact value of field marker event has, given as field=value, repeatable, eg.: --marker event.action=backup-finished").Envar("CHECK_ES_MARKER").Strings()
+)
+
+// heartbeatFilters are set up in main from --marker flags
+var heartbeatFilters []escheck.FieldFilter
+
+// parseMarker parses field=value marker of heartbeat event
+func parseMarker(spec string) (escheck.FieldFilter, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	field := strings.TrimSpace(parts[0])
+	if len(parts) != 2 || field == "" || parts[1] == "" {
+		return escheck.FieldFilter{}, fmt.Errorf("marker %s should be given as field=value", spec)
+	}
+	return escheck.FieldFilter{Field: field, Values: []string{parts[1]}}, nil
+}
+
+// setupHeartbeat parses --marker flags, values may contain commas, so they
+// are not split
+func setupHeartbeat() error {
+	for _, spec := range *heartbeatMarkers {
+		f, err := parseMarker(spec)
+		if err != nil {
+			return err
+		}
+		heartbeatFilters = append(heartbeatFilters, f)
+	}
+	return nil
+}
+
+// getHeartbeatCheck returns count check of marker events with band
+// replacing thresholds: at least one event when present is expected, none
+// when absent is
+func getHeartbeatCheck() escheck.Check {
+	check := getCheck()
+	check.FieldFilters = append(check.FieldFilters, heartbeatFilters...)
+	check.Warning, check.WarningRange = 0, nil
+	zero, one := 0, 1
+	check.Range = &escheck.CountRange{Low: &one}
+	if *heartbeatExpect == "absent" {
+		check.Range = &escheck.CountRange{High: &zero}
+		// the event itself tells responders what happened
+		if check.Samples == 0 {
+			check.Samples = 1
+		}
+	}
+	return check
+}
+
+func runHeartbeatCheck() *escheck.CheckResult {
+	return evaluateCheck(getHeartbeatCheck())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+)
+
+func TestParseMarker(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    escheck.FieldFilter
+		wantErr bool
+	}{
+		{"event.action=backup-finished", escheck.FieldFilter{Field: "event.action", Values: []string{"backup-finished"}}, false},
+		{" job = a=b,c", escheck.FieldFilter{Field: "job", Values: []string{" a=b,c"}}, false},
+		{"event.action", escheck.FieldFilter{}, true},
+		{"=backup-finished", escheck.FieldFilter{}, true},
+		{"event.action=", escheck.FieldFilter{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseMarker(tt.spec)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMarker(%q) = %+v, %v, want %+v, error %v", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGetHeartbeatCheck(t *testing.T) {
+	defer func(expect string, filters []escheck.FieldFilter) {
+		*heartbeatExpect, heartbeatFilters = expect, filters
+	}(*heartbeatExpect, heartbeatFilters)
+	heartbeatFilters = []escheck.FieldFilter{{Field: "event.action", Values: []string{"backup-finished"}}}
+
+	tests := []struct {
+		expect  string
+		count   int
+		status  nagiosplugin.Status
+		samples int
+	}{
+		{"present", 0, nagiosplugin.CRITICAL, 0},
+		{"present", 1, nagiosplugin.OK, 0},
+		{"absent", 0, nagiosplugin.OK, 1},
+		{"absent", 1, nagiosplugin.CRITICAL, 1},
+	}
+	for _, tt := range tests {
+		*heartbeatExpect = tt.expect
+		check := getHeartbeatCheck()
+		if status, _ := escheck.TotalStatus(check, tt.count); status != tt.status {
+			t.Errorf("expect %s: status of %d events = %v, want %v", tt.expect, tt.count, status, tt.status)
+		}
+		// absent event is shown even when samples aren't requested
+		if check.Samples != tt.samples {
+			t.Errorf("expect %s: samples = %d, want %d", tt.expect, check.Samples, tt.samples)
+		}
+		if n := len(check.FieldFilters); n == 0 || !reflect.DeepEqual(check.FieldFilters[n-1], heartbeatFilters[0]) {
+			t.Errorf("expect %s: field filters = %+v, want marker", tt.expect, check.FieldFilters)
+		}
+	}
+}
+
+func TestHeartbeatClusterSum(t *testing.T) {
+	defer func(saved []ClusterClient, expect string) {
+		clusterClients, *heartbeatExpect = saved, expect
+	}(clusterClients, *heartbeatExpect)
+	clusterClients = []ClusterClient{{Label: "eu"}, {Label: "us"}}
+	*heartbeatExpect = "present"
+
+	// marker logged to one of the clusters is enough
+	eu, us := 1, 0
+	results := []*escheck.CheckResult{
+		{Status: nagiosplugin.OK, Count: &eu},
+		{Status: nagiosplugin.CRITICAL, Count: &us},
+	}
+	if result := aggregateClusterResults(getHeartbeatCheck(), results, "sum"); result.Status != nagiosplugin.OK {
+		t.Errorf("status = %v %q, want OK", result.Status, result.Message)
+	}
+	eu = 0
+	if result := aggregateClusterResults(getHeartbeatCheck(), results, "sum"); result.Status != nagiosplugin.CRITICAL {
+		t.Errorf("status = %v %q, want CRITICAL without marker", result.Status, result.Message)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var historyFile = kingpin.Flag("history-file", "append JSON line with timestamp, status, count and timings of every check run to this file").Envar("CHECK_ES_HISTORY_FILE").String()
+
+// HistoryEntry : struct containts single line of --history-file
+type HistoryEntry struct {
+	Time       time.Time `json:"time"`
+	Check      string    `json:"check"`
+	Status     string    `json:"status"`
+	Count      *int      `json:"count,omitempty"`
+	TookMs     *int      `json:"took_ms,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Message    string    `json:"message"`
+}
+
+// historyMu serializes writes of concurrently evaluated checks
+var historyMu sync.Mutex
+
+// appendHistory writes result to --history-file, file is opened on every
+// write so it can be rotated without restarting --serve daemon
+func appendHistory(name string, result *escheck.CheckResult) error {
+	data, err := json.Marshal(HistoryEntry{
+		Time:       time.Now().UTC(),
+		Check:      name,
+		Status:     result.Status.String(),
+		Count:      result.Count,
+		TookMs:     result.Took,
+		DurationMs: int64(result.Duration / time.Millisecond),
+		Message:    result.Message,
+	})
+	if err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	f, err := os.OpenFile(*historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// recordResult logs result of check evaluation, notifies webhooks of state
+// change and appends it to --history-file
+func recordResult(name string, result *escheck.CheckResult) {
+	logResult(name, result)
+	notifyStateChange(name, result)
+	if *historyFile == "" {
+		return
+	}
+	if err := appendHistory(name, result); err != nil {
+		logger.Warn("history file write failed", "file", *historyFile, "error", err)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	urlSelection     = kingpin.Flag("url-selection", "order in which multiple elasticsearch URLs are tried: failover (always first URL first), round-robin (rotates between runs of --listen mode, one-shot runs start at random URL) or random").Envar("CHECK_ES_URL_SELECTION").Default("failover").Enum("failover", "round-robin", "random")
+	retries          = kingpin.Flag("retries", "number of retries of elasticsearch requests failed with connection error or HTTP 502/503/504").Envar("CHECK_ES_RETRIES").Default("0").Int()
+	retryDelay       = kingpin.Flag("retry-delay", "initial delay between retries, doubled after each attempt with random jitter").Envar("CHECK_ES_RETRY_DELAY").Default("500ms").Duration()
+	connectTimeout   = kingpin.Flag("connect-timeout", "timeout for establishing TCP connection and TLS handshake with elasticsearch node").Envar("CHECK_ES_CONNECT_TIMEOUT").Default("5s").Duration()
+	compression      = kingpin.Flag("compression", "request gzip compressed elasticsearch responses, use --no-compression to disable").Envar("CHECK_ES_COMPRESSION").Default("true").Bool()
+	compressRequest  = kingpin.Flag("compress-request", "gzip compress elasticsearch request bodies, requires http.compression enabled on the cluster").Envar("CHECK_ES_COMPRESS_REQUEST").Bool()
+	forceHTTP1       = kingpin.Flag("http1", "force HTTP/1.1, by default HTTP/2 is negotiated via TLS ALPN when server supports it").Envar("CHECK_ES_HTTP1").Bool()
+	resolverAddr     = kingpin.Flag("resolver", "DNS server (host:port) used to resolve elasticsearch host names instead of system resolver, eg.: 10.0.0.53:53").Envar("CHECK_ES_RESOLVER").String()
+	ipFamily         = kingpin.Flag("ip-family", "IP family used to connect to elasticsearch: 4, 6 or any").Envar("CHECK_ES_IP_FAMILY").Default("any").Enum("any", "4", "6")
+	maxResponseBytes = kingpin.Flag("max-response-bytes", "maximum size of HTTP response body read into memory, larger responses fail the check").Envar("CHECK_ES_MAX_RESPONSE_BYTES").Default("10485760").Int64()
+	compatibleWith   = kingpin.Flag("compatible-with", "send elasticsearch REST API compatibility headers requesting responses of given major version, eg.: 7 on 8.x cluster; not supported by OpenSearch, 0 disables").Envar("CHECK_ES_COMPATIBLE_WITH").Int()
+	unixSocket       = kingpin.Flag("unix-socket", "connect to elasticsearch over this unix domain socket, --url is still used for Host header and path").Envar("CHECK_ES_UNIX_SOCKET").String()
+	requestTimeout   = kingpin.Flag("request-timeout", "timeout for single HTTP request including reading response, 0 means only --timeout applies").Envar("CHECK_ES_REQUEST_TIMEOUT").Default("0s").Duration()
+	sniff            = kingpin.Flag("sniff", "discover elasticsearch nodes with HTTP enabled via _nodes API of --url nodes and query them, --url nodes are kept as fallback").Envar("CHECK_ES_SNIFF").Bool()
+	sniffInterval    = kingpin.Flag("sniff-interval", "how often discovered node list is refreshed in --listen mode").Envar("CHECK_ES_SNIFF_INTERVAL").Default("5m").Duration()
+	esVersion        = kingpin.Flag("es-version", "elasticsearch or OpenSearch version, eg.: 7.17; detected via GET / when not set").Envar("CHECK_ES_ES_VERSION").String()
+	distribution     = kingpin.Flag("distribution", "cluster distribution: elasticsearch, opensearch or auto to detect it; with detection enabled mismatch fails the check").Envar("CHECK_ES_DISTRIBUTION").Default("auto").Enum("auto", "elasticsearch", "opensearch")
+	stateFile        = kingpin.Flag("state-file", "file keeping state between check runs, eg.: /var/lib/nagios/check-es-logs-count-app.json").Envar("CHECK_ES_STATE_FILE").String()
+	stateRedis       = kingpin.Flag("state-redis", "keep state in Redis instead of --state-file so several check instances share it, eg.: redis://:password@redis:6379/2; rediss:// uses TLS").Envar("CHECK_ES_STATE_REDIS").String()
+	stateKey         = kingpin.Flag("state-key", "Redis key of --state-redis state, derived from --url when not set").Envar("CHECK_ES_STATE_KEY").String()
+	cacheDir         = kingpin.Flag("cache-dir", "share search results between checks running the same query with different thresholds through files in this directory, eg.: /var/cache/check-es-logs-count").Envar("CHECK_ES_CACHE_DIR").String()
+	cacheTTL         = kingpin.Flag("cache-ttl", "how long search results in --cache-dir are reused").Envar("CHECK_ES_CACHE_TTL").Default("30s").Duration()
+	breakerThreshold = kingpin.Flag("breaker-threshold", "open circuit breaker after this many consecutive runs failing to reach elasticsearch, requires --state-file or --state-redis, 0 disables").Envar("CHECK_ES_BREAKER_THRESHOLD").Int()
+	userAgent        = kingpin.Flag("user-agent", "User-Agent header of elasticsearch requests, eg.: to attribute monitoring traffic in proxy logs").Envar("CHECK_ES_USER_AGENT").Default("check-es-logs-count/" + ver).String()
+	opaqueID         = kingpin.Flag("opaque-id", "X-Opaque-Id header of elasticsearch requests attributing them in slow logs and tasks API, defaults to check-es-logs-count/<check name>@<hostname> naming --name, --batch or --serve check, check-es-logs-count@<hostname> without name").Envar("CHECK_ES_OPAQUE_ID").String()
+	followRedirects  = kingpin.Flag("follow-redirects", "follow HTTP redirects of elasticsearch requests, eg.: gateway pointing to active cluster; requests are repeated with the same method, body and credentials, redirects from https to plain http are refused; without it redirect responses fail the check").Envar("CHECK_ES_FOLLOW_REDIRECTS").Bool()
+	maxRedirects     = kingpin.Flag("max-redirects", "maximum number of redirects followed with --follow-redirects").Envar("CHECK_ES_MAX_REDIRECTS").Default("3").Int()
+	maxConcurrent    = kingpin.Flag("max-concurrent", "maximum number of elasticsearch requests in flight shared by all checks of the process, eg.: --batch or --serve checks, 0 disables").Envar("CHECK_ES_MAX_CONCURRENT").Int()
+	requestQPS       = kingpin.Flag("qps", "maximum number of elasticsearch requests started per second shared by all checks of the process, requests over it wait within --timeout, 0 disables").Envar("CHECK_ES_QPS").Float64()
+	breakerCooldown  = kingpin.Flag("breaker-cooldown", "how long runs report UNKNOWN without contacting elasticsearch once circuit breaker is open").Envar("CHECK_ES_BREAKER_COOLDOWN").Default("5m").Duration()
+)
+
+// httpClient is shared by all requests to external systems so TCP
+// connections and TLS sessions are reused in --listen mode, it is set up in
+// main after flags are parsed
+var httpClient *http.Client
+
+// esClient is elasticsearch client shared by all check runs
+var esClient *escheck.Client
+
+// requestLimiter limits requests of esClient and --cluster clients, nil
+// when --max-concurrent and --qps are not set
+var requestLimiter *escheck.RequestLimiter
+
+// setupHTTPClients creates shared clients, it is called after flags are
+// parsed
+func setupHTTPClients() error {
+	if err := checkDiscoveryFlags(); err != nil {
+		return err
+	}
+	if err := setupTrace(); err != nil {
+		return err
+	}
+	if *followRedirects && *maxRedirects <= 0 {
+		return fmt.Errorf("max-redirects parameter should be greater than 0")
+	}
+	if *maxConcurrent < 0 || *requestQPS < 0 {
+		return fmt.Errorf("max-concurrent and qps parameters should not be negative")
+	}
+	if *maxConcurrent > 0 || *requestQPS > 0 {
+		requestLimiter = escheck.NewRequestLimiter(*maxConcurrent, *requestQPS)
+	}
+	httpClient = &http.Client{Transport: escheck.NewTransport(getTransportOptions(nil))}
+	esClient = escheck.NewClient(getClientOptions())
+	return setupClusterClients()
+}
+
+// insecureHTTPClient skips TLS verification, it is created on first use and
+// shared the same way as httpClient
+var insecureHTTPClient struct {
+	sync.Once
+	client *http.Client
+}
+
+func getInsecureHTTPClient() *http.Client {
+	insecureHTTPClient.Do(func() {
+		insecureHTTPClient.client = &http.Client{Transport: escheck.NewTransport(getTransportOptions(&tls.Config{InsecureSkipVerify: true}))}
+	})
+	return insecureHTTPClient.client
+}
+
+func getTransportOptions(tlsConfig *tls.Config) escheck.TransportOptions {
+	return escheck.TransportOptions{
+		ConnectTimeout: *connectTimeout,
+		Compression:    *compression,
+		ForceHTTP1:     *forceHTTP1,
+		Resolver:       *resolverAddr,
+		IPFamily:       *ipFamily,
+		TLSConfig:      tlsConfig,
+	}
+}
+
+func getClientOptions() escheck.ClientOptions {
+	transport := getTransportOptions(nil)
+	transport.UnixSocket = *unixSocket
+	opts := escheck.ClientOptions{
+		URLs:             splitList(*esURLs),
+		URLSelection:     *urlSelection,
+		Sniff:            *sniff,
+		SniffInterval:    *sniffInterval,
+		Timeout:          time.Second * time.Duration(*timeout),
+		RequestTimeout:   *requestTimeout,
+		Retries:          *retries,
+		RetryDelay:       *retryDelay,
+		MaxResponseBytes: *maxResponseBytes,
+		CompressRequest:  *compressRequest,
+		CompatibleWith:   *compatibleWith,
+		Version:          *esVersion,
+		Distribution:     *distribution,
+		Transport:        transport,
+		Breaker: escheck.BreakerOptions{
+			Store:     getStateStore(splitList(*esURLs), ""),
+			Threshold: *breakerThreshold,
+			Cooldown:  *breakerCooldown,
+		},
+		Debugf:            getDebugLogger(),
+		Discovery:         getDiscoverer(),
+		DiscoveryInterval: *discoveryInterval,
+		Context:           interruptContext,
+		UserAgent:         *userAgent,
+		OpaqueID:          getOpaqueID(*checkName),
+		Trace:             checkTrace,
+		Limiter:           requestLimiter,
+	}
+	if *followRedirects {
+		opts.MaxRedirects = *maxRedirects
+	}
+	if *cacheDir != "" {
+		opts.Cache = &escheck.FileResultCache{Dir: *cacheDir}
+		opts.CacheTTL = *cacheTTL
+	}
+	return opts
+}
+
+// getOpaqueID returns --opaque-id or name of the plugin and check on this
+// host, name may be empty
+func getOpaqueID(name string) string {
+	if *opaqueID != "" {
+		return *opaqueID
+	}
+	id := "check-es-logs-count"
+	if name != "" {
+		id += "/" + name
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return id
+	}
+	return id + "@" + hostname
+}
+
+// newTimeoutContext returns context cancelled after --timeout seconds, the
+// overall deadline of the check
+func newTimeoutContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Second*time.Duration(*timeout))
+}
+
+// httpRequest sends request bound to ctx and returns response together with
+// its body, response body is always read and closed
+func httpRequest(ctx context.Context, client *http.Client, method, rawURL string, header http.Header, body string) (*http.Response, string, error) {
+	return escheck.HTTPRequest(ctx, client, method, rawURL, header, body, escheck.RequestOptions{
+		Timeout:          *requestTimeout,
+		MaxResponseBytes: *maxResponseBytes,
+		Debugf:           getDebugLogger(),
+	})
+}
+
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	icingaURL      = kingpin.Flag("icinga-url", "Icinga2 API URL to submit result to via process-check-result, eg.: https://icinga:5665").Envar("CHECK_ES_ICINGA_URL").String()
+	icingaUser     = kingpin.Flag("icinga-user", "Icinga2 API user").Envar("CHECK_ES_ICINGA_USER").String()
+	icingaPassword = kingpin.Flag("icinga-password", "Icinga2 API password").Envar("CHECK_ES_ICINGA_PASSWORD").String()
+	icingaHost     = kingpin.Flag("icinga-host", "Icinga2 host name the service belongs to, defaults to hostname").Envar("CHECK_ES_ICINGA_HOST").String()
+	icingaService  = kingpin.Flag("icinga-service", "Icinga2 service name").Envar("CHECK_ES_ICINGA_SERVICE").Default("check-es-logs-count").String()
+	icingaInsecure = kingpin.Flag("icinga-insecure", "skip TLS certificate verification of Icinga2 API").Envar("CHECK_ES_ICINGA_INSECURE").Bool()
+)
+
+// IcingaCheckResult : struct containts Icinga2 process-check-result action body
+type IcingaCheckResult struct {
+	Type            string   `json:"type"`
+	Filter          string   `json:"filter"`
+	ExitStatus      int      `json:"exit_status"`
+	PluginOutput    string   `json:"plugin_output"`
+	PerformanceData []string `json:"performance_data,omitempty"`
+	CheckSource     string   `json:"check_source,omitempty"`
+}
+
+func getIcingaCheckResult(result *escheck.CheckResult, host, service, source string) IcingaCheckResult {
+	output := result.Message
+	for _, l := range result.LongOutput {
+		output += "\n" + l
+	}
+
+	r := IcingaCheckResult{
+		Type:         "Service",
+		Filter:       fmt.Sprintf("host.name==%q && service.name==%q", host, service),
+		ExitStatus:   int(result.Status),
+		PluginOutput: output,
+		CheckSource:  source,
+	}
+	for _, p := range result.PerfData {
+		r.PerformanceData = append(r.PerformanceData, p.String())
+	}
+	return r
+}
+
+func submitIcingaResult(result *escheck.CheckResult) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	host := *icingaHost
+	if host == "" {
+		host = hostname
+	}
+
+	data, err := json.Marshal(getIcingaCheckResult(result, host, *icingaService, hostname))
+	if err != nil {
+		return err
+	}
+
+	actionURL, err := escheck.BuildURL(*icingaURL, nil, "v1", "actions", "process-check-result")
+	if err != nil {
+		return err
+	}
+
+	client := httpClient
+	if *icingaInsecure {
+		client = getInsecureHTTPClient()
+	}
+	header := http.Header{
+		"Accept":        {"application/json"},
+		"Content-Type":  {"application/json"},
+		"Authorization": {basicAuth(*icingaUser, *icingaPassword)},
+	}
+
+	ctx, cancel := newTimeoutContext()
+	defer cancel()
+	resp, body, err := httpRequest(ctx, client, "POST", actionURL, header, string(data))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("HTTP response code: %s %s", resp.Status, body)
+	}
+	return nil
+}
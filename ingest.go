@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	ingestCmd              = kingpin.Command("ingest", "record ingest pipeline counters of ingest nodes in --state-file or --state-redis and alert on documents failed by pipelines between runs, catching parsing breakage before it shows up as missing logs")
+	ingestPipelines        = ingestCmd.Flag("pipeline", "name or wildcard pattern of checked ingest pipeline, can be repeated or comma-separated, all pipelines when not set").Envar("CHECK_ES_PIPELINE").Strings()
+	ingestWarningFailures  = ingestCmd.Flag("warning-failures", "warning when at least this many documents failed since the previous run, 0 disables").Envar("CHECK_ES_WARNING_FAILURES").Int64()
+	ingestCriticalFailures = ingestCmd.Flag("critical-failures", "critical when at least this many documents failed since the previous run, 0 disables").Envar("CHECK_ES_CRITICAL_FAILURES").Default("1").Int64()
+)
+
+// getIngestCheck returns ingest pipeline check definition given by command
+// line flags
+func getIngestCheck(store escheck.StateStore) escheck.IngestCheck {
+	return escheck.IngestCheck{
+		Pipelines: splitList(*ingestPipelines),
+		Store:     store,
+		Warning:   *ingestWarningFailures,
+		Critical:  *ingestCriticalFailures,
+	}
+}
+
+func runIngestCheck() *escheck.CheckResult {
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		return c.Client.RunIngest(getIngestCheck(c.Store))
+	}, aggregateWorstResults)
+}
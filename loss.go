@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	lossCmd              = kingpin.Command("loss", "count the same events in --source-index and --destination-index patterns, eg.: raw filebeat-* and enriched logs-enriched-*, and alert when destination falls behind source, detecting events silently dropped by enrichment pipeline")
+	lossSourceIndex      = lossCmd.Flag("source-index", "index pattern events enter the pipeline from, can be repeated or comma-separated, eg.: filebeat-*").Envar("CHECK_ES_SOURCE_INDEX").Required().Strings()
+	lossDestinationIndex = lossCmd.Flag("destination-index", "index pattern pipeline writes events to, can be repeated or comma-separated, eg.: logs-enriched-*").Envar("CHECK_ES_DESTINATION_INDEX").Required().Strings()
+	lossDestinationQuery = lossCmd.Flag("destination-query", "query selecting the same events in destination indices, defaults to --query").Envar("CHECK_ES_DESTINATION_QUERY").String()
+	lossLag              = lossCmd.Flag("lag", "end the window this long before now so events still passing the pipeline aren't reported as lost").Envar("CHECK_ES_LAG").Default("2m").Duration()
+	lossWarning          = lossCmd.Flag("warning-loss", "warning when more percent of source events are missing in destination, 0 disables").Envar("CHECK_ES_WARNING_LOSS").Float64()
+	lossCritical         = lossCmd.Flag("critical-loss", "critical when more percent of source events are missing in destination").Envar("CHECK_ES_CRITICAL_LOSS").Default("1").Float64()
+	lossTimestampField   = lossCmd.Flag("timestamp-field", "field holding time of log entry in both source and destination indices").Envar("CHECK_ES_TIMESTAMP_FIELD").Default("@timestamp").String()
+)
+
+// getLossCheck returns pipeline loss check definition given by command line
+// flags, index options other than patterns apply to both sides
+func getLossCheck() escheck.LossCheck {
+	source, destination := getIndexOptions(), getIndexOptions()
+	source.DataStreams, source.Aliases = nil, nil
+	destination.DataStreams, destination.Aliases = nil, nil
+	source.Patterns = splitList(*lossSourceIndex)
+	destination.Patterns = splitList(*lossDestinationIndex)
+	return escheck.LossCheck{
+		Source:             source,
+		Destination:        destination,
+		Search:             getSearchOptions(),
+		Query:              *esQuery,
+		DestinationQuery:   *lossDestinationQuery,
+		TimestampField:     *lossTimestampField,
+		TimestampFormat:    *timestampFormat,
+		TimePeriod:         *timePeriod,
+		Lag:                *lossLag,
+		Warning:            *lossWarning,
+		Critical:           *lossCritical,
+		SearchTimeout:      *esTimeout,
+		ShardFailureStatus: *shardFailureStatus,
+		TimedOutStatus:     *timedOutStatus,
+		RetryPartial:       *retryPartial,
+	}
+}
+
+func runLossCheck() *escheck.CheckResult {
+	check := getLossCheck()
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		return c.Client.RunLoss(check)
+	}, aggregateWorstResults)
+}
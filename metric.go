@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	metricCmd            = kingpin.Command("metric", "compute avg, sum, min or max of numeric field over log entries matching query in time window and compare it with thresholds using --compare-operator")
+	metricField          = metricCmd.Flag("field", "numeric field to aggregate, eg.: http.response.bytes or event.duration").Envar("CHECK_ES_FIELD").Required().String()
+	metricAggregation    = metricCmd.Flag("aggregation", "metric aggregation: avg, sum, min, max or cardinality").Envar("CHECK_ES_AGGREGATION").Default("avg").Enum(escheck.MetricAggregations...)
+	metricWarning        = metricCmd.Flag("warning-value", "warning threshold for metric, 0 disables").Envar("CHECK_ES_WARNING_VALUE").Float64()
+	metricCritical       = metricCmd.Flag("critical-value", "critical threshold for metric").Envar("CHECK_ES_CRITICAL_VALUE").Required().Float64()
+	metricTimestampField = metricCmd.Flag("timestamp-field", "field holding time of log entry").Envar("CHECK_ES_TIMESTAMP_FIELD").Default("@timestamp").String()
+)
+
+// getMetricCheck returns metric check definition given by command line
+// flags
+func getMetricCheck() escheck.MetricCheck {
+	return escheck.MetricCheck{
+		Index:           getIndexOptions(),
+		Search:          getSearchOptions(),
+		Query:           *esQuery,
+		TimePeriod:      *timePeriod,
+		TimestampField:  *metricTimestampField,
+		TimestampFormat: *timestampFormat,
+		Field:           *metricField,
+		Aggregation:     *metricAggregation,
+		Warning:         *metricWarning,
+		Critical:        *metricCritical,
+		Operator:        *compareOperator,
+		SearchTimeout:   *esTimeout,
+	}
+}
+
+func runMetricCheck() *escheck.CheckResult {
+	check := getMetricCheck()
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		return c.Client.RunMetric(check)
+	}, aggregateWorstResults)
+}
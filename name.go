@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var checkName = kingpin.Flag("name", "name of the check prefixed to status message and used as perfdata label instead of count, other perfdata labels are prefixed by it, eg.: payment-errors; it also names the check in logs, --history-file and --serve").Envar("CHECK_ES_NAME").String()
+
+// commandLineCheckName returns --name or name of the command line check
+// when not set
+func commandLineCheckName() string {
+	if *checkName != "" {
+		return *checkName
+	}
+	return defaultCheckName
+}
+
+// applyCheckName prefixes message and perfdata labels of result with
+// --name
+func applyCheckName(result *escheck.CheckResult) {
+	if *checkName == "" {
+		return
+	}
+	result.Message = *checkName + ": " + result.Message
+	for i, p := range result.PerfData {
+		if p.Label == "count" {
+			result.PerfData[i].Label = *checkName
+		} else {
+			result.PerfData[i].Label = *checkName + "_" + p.Label
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	nscaHost         = kingpin.Flag("nsca-host", "NSCA server to submit result to as passive check").Envar("CHECK_ES_NSCA_HOST").String()
+	nscaPort         = kingpin.Flag("nsca-port", "NSCA server port").Envar("CHECK_ES_NSCA_PORT").Default("5667").Int()
+	nscaConfig       = kingpin.Flag("nsca-config", "send_nsca.cfg file with password and encryption_method (0 none, 1 XOR supported)").Envar("CHECK_ES_NSCA_CONFIG").String()
+	nscaHostname     = kingpin.Flag("nsca-hostname", "Nagios host name of passive check, defaults to hostname").Envar("CHECK_ES_NSCA_HOSTNAME").String()
+	nscaService      = kingpin.Flag("nsca-service", "Nagios service description of passive check").Envar("CHECK_ES_NSCA_SERVICE").Default("check-es-logs-count").String()
+	nscaOutputLength = kingpin.Flag("nsca-output-length", "plugin output buffer size of NSCA server: 512 (NSCA < 2.9) or 4096").Envar("CHECK_ES_NSCA_OUTPUT_LENGTH").Default("512").Int()
+)
+
+const (
+	nscaPacketVersion    = 3
+	nscaIVLength         = 128
+	nscaHostnameLength   = 64
+	nscaServiceLength    = 128
+	nscaEncryptionNone   = 0
+	nscaEncryptionXOR    = 1
+	nscaInitPacketLength = nscaIVLength + 4
+)
+
+// NSCAConfig : struct containts send_nsca.cfg settings
+type NSCAConfig struct {
+	Password         string
+	EncryptionMethod int
+}
+
+func readNSCAConfig(path string) (NSCAConfig, error) {
+	config := NSCAConfig{EncryptionMethod: nscaEncryptionNone}
+	if path == "" {
+		return config, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "password":
+			config.Password = strings.TrimSpace(parts[1])
+		case "encryption_method":
+			config.EncryptionMethod, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return config, fmt.Errorf("invalid encryption_method: %s", parts[1])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return config, err
+	}
+
+	if config.EncryptionMethod != nscaEncryptionNone && config.EncryptionMethod != nscaEncryptionXOR {
+		return config, fmt.Errorf("unsupported encryption_method %d, only 0 (none) and 1 (XOR) are supported", config.EncryptionMethod)
+	}
+	return config, nil
+}
+
+func putFixedString(buf []byte, s string) {
+	// leave room for terminating NUL byte
+	if len(s) > len(buf)-1 {
+		s = s[:len(buf)-1]
+	}
+	copy(buf, s)
+}
+
+// nscaDataPacket builds send_nsca data packet laid out as C struct with
+// network byte order fields:
+// int16 version, (2 bytes padding), uint32 crc32, uint32 timestamp,
+// int16 return code, host[64], service[128], output[N], padding to 4 bytes
+func nscaDataPacket(timestamp uint32, returnCode int, host, service, output string, outputLength int) []byte {
+	size := 2 + 2 + 4 + 4 + 2 + nscaHostnameLength + nscaServiceLength + outputLength
+	if size%4 != 0 {
+		size += 4 - size%4
+	}
+	packet := make([]byte, size)
+
+	binary.BigEndian.PutUint16(packet[0:], nscaPacketVersion)
+	binary.BigEndian.PutUint32(packet[8:], timestamp)
+	binary.BigEndian.PutUint16(packet[12:], uint16(returnCode))
+	offset := 14
+	putFixedString(packet[offset:offset+nscaHostnameLength], host)
+	offset += nscaHostnameLength
+	putFixedString(packet[offset:offset+nscaServiceLength], service)
+	offset += nscaServiceLength
+	putFixedString(packet[offset:offset+outputLength], output)
+
+	binary.BigEndian.PutUint32(packet[4:], crc32.ChecksumIEEE(packet))
+	return packet
+}
+
+func nscaEncrypt(packet, iv []byte, config NSCAConfig) {
+	if config.EncryptionMethod != nscaEncryptionXOR {
+		return
+	}
+	for i := range packet {
+		packet[i] ^= iv[i%len(iv)]
+	}
+	if config.Password != "" {
+		for i := range packet {
+			packet[i] ^= config.Password[i%len(config.Password)]
+		}
+	}
+}
+
+func submitNSCAResult(result *escheck.CheckResult) error {
+	config, err := readNSCAConfig(*nscaConfig)
+	if err != nil {
+		return err
+	}
+
+	host := *nscaHostname
+	if host == "" {
+		host, err = os.Hostname()
+		if err != nil {
+			return err
+		}
+	}
+
+	connTimeout := time.Second * time.Duration(*timeout)
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(*nscaHost, strconv.Itoa(*nscaPort)), connTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(connTimeout))
+
+	init := make([]byte, nscaInitPacketLength)
+	if _, err := io.ReadFull(conn, init); err != nil {
+		return fmt.Errorf("cannot read NSCA init packet: %v", err)
+	}
+	iv := init[:nscaIVLength]
+	timestamp := binary.BigEndian.Uint32(init[nscaIVLength:])
+
+	packet := nscaDataPacket(timestamp, int(result.Status), host, *nscaService, escheck.FormatPluginOutput(result, "", *nscaOutputLength-1), *nscaOutputLength)
+	nscaEncrypt(packet, iv, config)
+
+	_, err = io.Copy(conn, bytes.NewReader(packet))
+	return err
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	otlpEndpoint   = kingpin.Flag("otlp-endpoint", "OpenTelemetry collector OTLP/HTTP endpoint, eg.: http://localhost:4318").Envar("CHECK_ES_OTLP_ENDPOINT").String()
+	otlpHeaders    = kingpin.Flag("otlp-header", "HTTP header (key=value) sent to OTLP endpoint, can be repeated").Envar("CHECK_ES_OTLP_HEADER").Strings()
+	otlpAttributes = kingpin.Flag("otlp-attribute", "resource attribute (key=value) added to exported metrics, eg.: cluster=logging-eu, can be repeated").Envar("CHECK_ES_OTLP_ATTRIBUTE").Strings()
+)
+
+// OTLPMetricsRequest : struct containts OTLP/HTTP JSON metrics export request
+type OTLPMetricsRequest struct {
+	ResourceMetrics []OTLPResourceMetrics `json:"resourceMetrics"`
+}
+
+// OTLPResourceMetrics : struct containts metrics of single resource
+type OTLPResourceMetrics struct {
+	Resource struct {
+		Attributes []OTLPAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []OTLPScopeMetrics `json:"scopeMetrics"`
+}
+
+// OTLPScopeMetrics : struct containts metrics of single instrumentation scope
+type OTLPScopeMetrics struct {
+	Scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"scope"`
+	Metrics []OTLPMetric `json:"metrics"`
+}
+
+// OTLPAttribute : struct containts OTLP key value attribute
+type OTLPAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+// OTLPMetric : struct containts single OTLP gauge metric
+type OTLPMetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Gauge       struct {
+		DataPoints []OTLPDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+// OTLPDataPoint : struct containts OTLP number data point, 64-bit integers
+// are encoded as strings in OTLP JSON
+type OTLPDataPoint struct {
+	TimeUnixNano string   `json:"timeUnixNano"`
+	AsInt        string   `json:"asInt,omitempty"`
+	AsDouble     *float64 `json:"asDouble,omitempty"`
+}
+
+func newOTLPAttribute(key, value string) OTLPAttribute {
+	a := OTLPAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+func newOTLPGauge(name, description, unit string, point OTLPDataPoint) OTLPMetric {
+	m := OTLPMetric{Name: name, Description: description, Unit: unit}
+	m.Gauge.DataPoints = []OTLPDataPoint{point}
+	return m
+}
+
+// parseKeyValues parses repeated key=value flag values
+func parseKeyValues(values []string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid key=value pair: %s", v)
+		}
+		result[parts[0]] = parts[1]
+	}
+	return result, nil
+}
+
+// getOTLPResourceAttributes returns attributes of the check resource with
+// --otlp-attribute attributes
+func getOTLPResourceAttributes(attributes map[string]string) []OTLPAttribute {
+	result := []OTLPAttribute{
+		newOTLPAttribute("service.name", "check-es-logs-count"),
+		newOTLPAttribute("es.url", strings.Join(splitList(*esURLs), ",")),
+		newOTLPAttribute("es.index_pattern", strings.Join(splitList(*indexPatterns), ",")),
+		newOTLPAttribute("es.query", *esQuery),
+	}
+	for k, v := range attributes {
+		result = append(result, newOTLPAttribute(k, v))
+	}
+	return result
+}
+
+func getOTLPMetricsRequest(result *escheck.CheckResult, attributes map[string]string, t time.Time) OTLPMetricsRequest {
+	var rm OTLPResourceMetrics
+	rm.Resource.Attributes = getOTLPResourceAttributes(attributes)
+
+	ts := fmt.Sprintf("%d", t.UnixNano())
+	var sm OTLPScopeMetrics
+	sm.Scope.Name = "check-es-logs-count"
+	sm.Scope.Version = ver
+	if result.Count != nil {
+		sm.Metrics = append(sm.Metrics, newOTLPGauge("es_logs.count", "Number of matching log entries in the time window", "1",
+			OTLPDataPoint{TimeUnixNano: ts, AsInt: fmt.Sprintf("%d", *result.Count)}))
+	}
+	sm.Metrics = append(sm.Metrics, newOTLPGauge("es_logs.check.status", "Check status: 0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN", "1",
+		OTLPDataPoint{TimeUnixNano: ts, AsInt: fmt.Sprintf("%d", int(result.Status))}))
+	sm.Metrics = append(sm.Metrics, newOTLPGauge("es_logs.check.duration", "Duration of the check evaluation", "s",
+		OTLPDataPoint{TimeUnixNano: ts, AsDouble: floatPtr(result.Duration.Seconds())}))
+	rm.ScopeMetrics = []OTLPScopeMetrics{sm}
+
+	return OTLPMetricsRequest{ResourceMetrics: []OTLPResourceMetrics{rm}}
+}
+
+func exportOTLPMetrics(result *escheck.CheckResult) error {
+	attributes, err := parseKeyValues(*otlpAttributes)
+	if err != nil {
+		return err
+	}
+	headers, err := parseKeyValues(*otlpHeaders)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(getOTLPMetricsRequest(result, attributes, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	exportURL, err := escheck.BuildURL(*otlpEndpoint, nil, "v1", "metrics")
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	for k, v := range headers {
+		header.Set(k, v)
+	}
+
+	ctx, cancel := newTimeoutContext()
+	defer cancel()
+	resp, _, err := httpRequest(ctx, httpClient, "POST", exportURL, header, string(data))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP response code: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	influxMeasurement = kingpin.Flag("influx-measurement", "measurement name for influx line protocol output").Envar("CHECK_ES_INFLUX_MEASUREMENT").Default("es_logs").String()
+	selfPerfData      = kingpin.Flag("self-perfdata", "add runtime, HTTP request and retry count and the slowest HTTP response time of the plugin itself to perfdata").Envar("CHECK_ES_SELF_PERFDATA").Bool()
+	checkMKService    = kingpin.Flag("checkmk-service", "service name in checkmk local check output").Envar("CHECK_ES_CHECKMK_SERVICE").Default("es_logs_count").String()
+)
+
+// submitResult sends result to configured external systems, failures are
+// reported in long plugin output and do not change check status
+func submitResult(result *escheck.CheckResult) {
+	if *sensuEventsURL != "" {
+		if err := submitSensuEvent(result); err != nil {
+			reportSubmitError(result, "Sensu event submission", err)
+		}
+	}
+
+	if *pushgatewayURL != "" {
+		if err := pushMetrics(result, time.Now().Add(-result.Duration)); err != nil {
+			reportSubmitError(result, "Pushgateway push", err)
+		}
+	}
+
+	if *statsdAddr != "" {
+		if err := sendStatsdMetrics(result); err != nil {
+			reportSubmitError(result, "StatsD emission", err)
+		}
+	}
+
+	if *graphiteAddr != "" {
+		if err := sendGraphiteMetrics(result); err != nil {
+			reportSubmitError(result, "Graphite emission", err)
+		}
+	}
+
+	if *otlpEndpoint != "" {
+		if err := exportOTLPMetrics(result); err != nil {
+			reportSubmitError(result, "OTLP export", err)
+		}
+		if checkTrace != nil {
+			if err := exportOTLPTraces(result, time.Now()); err != nil {
+				reportSubmitError(result, "OTLP trace export", err)
+			}
+		}
+	}
+
+	if *nscaHost != "" {
+		if err := submitNSCAResult(result); err != nil {
+			reportSubmitError(result, "NSCA submission", err)
+		}
+	}
+
+	if *spoolDir != "" {
+		if err := spoolResult(result); err != nil {
+			reportSubmitError(result, "checkresult spooling", err)
+		}
+	}
+
+	if *icingaURL != "" {
+		if err := submitIcingaResult(result); err != nil {
+			reportSubmitError(result, "Icinga2 submission", err)
+		}
+	}
+
+	if *zabbixServer != "" {
+		err := submitZabbixValue(result)
+		if *zabbixOnly {
+			if err != nil {
+				fmt.Printf("Zabbix submission failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Zabbix submission succeeded: %s=%d\n", *zabbixKey, *result.Count)
+			os.Exit(0)
+		}
+		if err != nil {
+			reportSubmitError(result, "Zabbix submission", err)
+		}
+	}
+}
+
+// reportSubmitError adds failure of external system to long output and log
+func reportSubmitError(result *escheck.CheckResult, what string, err error) {
+	result.LongOutput = append(result.LongOutput, fmt.Sprintf("%s failed: %v", what, err))
+	logger.Warn(what+" failed", "error", err)
+}
+
+// setupFormatters applies output flags to built-in formatters and checks
+// --output, it is called after flags are parsed
+func setupFormatters() error {
+	escheck.RegisterFormatter("influx", &escheck.InfluxFormatter{Measurement: *influxMeasurement})
+	escheck.RegisterFormatter("checkmk", &escheck.CheckMKFormatter{Service: *checkMKService})
+	if _, ok := escheck.LookupFormatter(*outputFormat); !ok {
+		return fmt.Errorf("output parameter should be one of: %s", strings.Join(escheck.FormatterNames(), ", "))
+	}
+	return nil
+}
+
+// formatResult renders result of check in --output format
+func formatResult(name string, result *escheck.CheckResult, check escheck.Check, format string) (escheck.Formatter, string, error) {
+	f, ok := escheck.LookupFormatter(format)
+	if !ok {
+		return nil, "", fmt.Errorf("unknown output format %s", format)
+	}
+	out, err := f.Format(result, escheck.ResultMeta{Name: name, Check: check, Time: time.Now(), MaxBytes: *maxOutputBytes})
+	return f, out, err
+}
+
+// printResult prints result in requested format and exits with exit code of
+// the format
+func printResult(result *escheck.CheckResult, format string) {
+	f, out, err := formatResult("", result, getCheck(), format)
+	if err != nil {
+		fmt.Printf("UNKNOWN: %v\n", err)
+		os.Exit(*unknownExitCode)
+	}
+	fmt.Println(out)
+	os.Exit(exitCode(f, result.Status))
+}
+
+// addSelfPerfData adds --self-perfdata series to result
+func addSelfPerfData(result *escheck.CheckResult, runtime time.Duration, stats *escheck.RequestStats) {
+	if !*selfPerfData || stats == nil {
+		return
+	}
+	result.AddPerfDatum(escheck.PerfDatum{Label: "plugin_runtime", Unit: "s", Value: runtime.Seconds(), Min: floatPtr(0)})
+	result.AddPerfDatum(escheck.PerfDatum{Label: "plugin_http_requests", Value: float64(stats.Requests), Min: floatPtr(0)})
+	result.AddPerfDatum(escheck.PerfDatum{Label: "plugin_retries", Value: float64(stats.Retries), Min: floatPtr(0)})
+	result.AddPerfDatum(escheck.PerfDatum{Label: "plugin_http_latency", Unit: "s", Value: stats.MaxLatency.Seconds(), Min: floatPtr(0)})
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,214 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// AnomalyResultTypes lists Elastic ML result types compared with thresholds
+var AnomalyResultTypes = []string{"record", "bucket"}
+
+// AnomalyCheck : struct containts check of Elastic ML anomaly detection job
+// results; the highest record or bucket anomaly score in time window is
+// compared with thresholds
+type AnomalyCheck struct {
+	JobID string
+	// ResultType is record (single anomalies) or bucket (overall anomaly
+	// of time bucket)
+	ResultType string
+	// TimePeriod is time window in minutes
+	TimePeriod int
+	// Warning and Critical are anomaly scores 0-100, 0 disables warning
+	Warning  float64
+	Critical float64
+	// Top limits anomalies listed in long output
+	Top int
+}
+
+// Anomaly : struct containts record or bucket of ML results API, only one
+// of RecordScore and AnomalyScore is set depending on result type
+type Anomaly struct {
+	Timestamp           int64     `json:"timestamp"`
+	RecordScore         float64   `json:"record_score"`
+	AnomalyScore        float64   `json:"anomaly_score"`
+	IsInterim           bool      `json:"is_interim"`
+	Function            string    `json:"function"`
+	FieldName           string    `json:"field_name"`
+	ByFieldValue        string    `json:"by_field_value"`
+	OverFieldValue      string    `json:"over_field_value"`
+	PartitionFieldValue string    `json:"partition_field_value"`
+	Actual              []float64 `json:"actual"`
+	Typical             []float64 `json:"typical"`
+	EventCount          int       `json:"event_count"`
+}
+
+// anomalyResults : struct containts response of ML get records and get
+// buckets APIs
+type anomalyResults struct {
+	Count   int       `json:"count"`
+	Records []Anomaly `json:"records"`
+	Buckets []Anomaly `json:"buckets"`
+}
+
+func (check AnomalyCheck) scoreField() string {
+	if check.ResultType == "bucket" {
+		return "anomaly_score"
+	}
+	return "record_score"
+}
+
+// minScore returns the lowest score exceeding any threshold
+func (check AnomalyCheck) minScore() float64 {
+	if check.Warning > 0 && check.Warning < check.Critical {
+		return check.Warning
+	}
+	return check.Critical
+}
+
+// score returns anomaly score of result type
+func (a Anomaly) score(resultType string) float64 {
+	if resultType == "bucket" {
+		return a.AnomalyScore
+	}
+	return a.RecordScore
+}
+
+// describe returns single line summary of anomaly for long output
+func (a Anomaly) describe(resultType string) string {
+	out := fmt.Sprintf("%s score %.2f", time.Unix(0, a.Timestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339), a.score(resultType))
+	if resultType == "bucket" {
+		out += fmt.Sprintf(": %d events", a.EventCount)
+	} else {
+		out += ": " + a.Function
+		if a.FieldName != "" {
+			out += "(" + a.FieldName + ")"
+		}
+		var fields []string
+		for _, v := range []string{a.PartitionFieldValue, a.ByFieldValue, a.OverFieldValue} {
+			if v != "" {
+				fields = append(fields, v)
+			}
+		}
+		if len(fields) > 0 {
+			out += " " + strings.Join(fields, "/")
+		}
+		if len(a.Actual) > 0 && len(a.Typical) > 0 {
+			out += fmt.Sprintf(" actual %g typical %g", a.Actual[0], a.Typical[0])
+		}
+	}
+	if a.IsInterim {
+		out += " (interim)"
+	}
+	return out
+}
+
+func (c *Client) getAnomalies(ctx context.Context, baseURL string, check AnomalyCheck, from, to time.Time) (anomalyResults, error) {
+	var results anomalyResults
+	resultsURL, err := BuildURL(baseURL, nil, "_ml", "anomaly_detectors", url.PathEscape(check.JobID), "results", check.ResultType+"s")
+	if err != nil {
+		return results, err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"start":            strconv.FormatInt(from.UnixNano()/int64(time.Millisecond), 10),
+		"end":              strconv.FormatInt(to.UnixNano()/int64(time.Millisecond), 10),
+		check.scoreField(): check.minScore(),
+		"sort":             check.scoreField(),
+		"desc":             true,
+		"page":             map[string]int{"from": 0, "size": check.Top},
+	})
+	if err != nil {
+		return results, err
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	resp, respBody, err := c.esRequest(ctx, "POST", resultsURL, header, string(body))
+	if err != nil {
+		return results, err
+	}
+	if resp.StatusCode != 200 {
+		return results, esResponseError(resp.Status, respBody)
+	}
+	if err := json.Unmarshal([]byte(respBody), &results); err != nil {
+		return results, fmt.Errorf("JSON parse failed")
+	}
+	return results, nil
+}
+
+// RunAnomaly evaluates anomaly scores of ML job results, errors are
+// reported as UNKNOWN result
+func (c *Client) RunAnomaly(check AnomalyCheck) *CheckResult {
+	stats := &requestStats{}
+	result := c.runAnomaly(check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+func (c *Client) runAnomaly(check AnomalyCheck, stats *requestStats) *CheckResult {
+	if check.JobID == "" {
+		return newFailureResult(FailureInternal, "job-id parameter is required")
+	}
+	if check.ResultType != "record" && check.ResultType != "bucket" {
+		return newFailureResult(FailureInternal, fmt.Sprintf("invalid result type %s, should be one of: %s", check.ResultType, strings.Join(AnomalyResultTypes, ", ")))
+	}
+	if check.Critical <= 0 || check.Critical > 100 || check.Warning < 0 || check.Warning > 100 {
+		return newFailureResult(FailureInternal, "anomaly score thresholds should be between 0 and 100")
+	}
+	if check.Top <= 0 {
+		check.Top = 5
+	}
+
+	now := time.Now()
+	from := now.Add(-time.Duration(check.TimePeriod) * time.Minute)
+	var results anomalyResults
+	err := c.queryCluster(func(ctx context.Context, baseURL string) error {
+		var err error
+		results, err = c.getAnomalies(withRequestStats(ctx, stats), baseURL, check, from, now)
+		return err
+	})
+	if err != nil {
+		return newQueryErrorResult(err)
+	}
+
+	anomalies := results.Records
+	if check.ResultType == "bucket" {
+		anomalies = results.Buckets
+	}
+	var max float64
+	if len(anomalies) > 0 {
+		max = anomalies[0].score(check.ResultType)
+	}
+	status := nagiosplugin.OK
+	switch {
+	case max >= check.Critical:
+		status = nagiosplugin.CRITICAL
+	case check.Warning > 0 && max >= check.Warning:
+		status = nagiosplugin.WARNING
+	}
+
+	var result *CheckResult
+	if len(anomalies) == 0 {
+		result = newCheckResult(status, fmt.Sprintf("no %s anomalies of ML job %s with score of at least %.2f in the past %d minutes", check.ResultType, check.JobID, check.minScore(), check.TimePeriod))
+	} else {
+		result = newCheckResult(status, fmt.Sprintf("max %s anomaly score of ML job %s is %.2f in the past %d minutes, %d anomalies with score of at least %.2f",
+			check.ResultType, check.JobID, max, check.TimePeriod, results.Count, check.minScore()))
+	}
+	for _, a := range anomalies {
+		result.LongOutput = append(result.LongOutput, a.describe(check.ResultType))
+	}
+
+	p := PerfDatum{Label: "max_" + check.scoreField(), Value: max, Crit: floatPtr(check.Critical), Min: floatPtr(0), Max: floatPtr(100)}
+	if check.Warning > 0 {
+		p.Warn = floatPtr(check.Warning)
+	}
+	result.AddPerfDatum(p)
+	result.AddPerfDatum(PerfDatum{Label: "anomalies", Value: float64(results.Count), Min: floatPtr(0)})
+	return result
+}
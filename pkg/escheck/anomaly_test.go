@@ -0,0 +1,60 @@
+package escheck
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestRunAnomaly(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"POST /_ml/anomaly_detectors/nginx-errors/results/records": ok("ml/records.json"),
+	})
+	check := AnomalyCheck{JobID: "nginx-errors", ResultType: "record", TimePeriod: 60, Warning: 50, Critical: 75, Top: 3}
+
+	result := newTestClient(es.URL).RunAnomaly(check)
+	if result.Status != nagiosplugin.CRITICAL {
+		t.Errorf("status = %v, want CRITICAL: %s", result.Status, result.Message)
+	}
+	if want := "max record anomaly score of ML job nginx-errors is 91.35 in the past 60 minutes, 2 anomalies with score of at least 50.00"; result.Message != want {
+		t.Errorf("message = %q, want %q", result.Message, want)
+	}
+	wantLong := []string{
+		"2024-05-01T12:00:00Z score 91.35: high_count web-3 actual 1240 typical 35.4",
+		"2024-05-01T12:30:00Z score 62.10: mean(http.response.time) checkout actual 2.5 typical 0.4 (interim)",
+	}
+	if long := strings.Join(result.LongOutput, "\n"); long != strings.Join(wantLong, "\n") {
+		t.Errorf("long output = %q, want %q", long, wantLong)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(es.received("POST", "/_ml/anomaly_detectors/nginx-errors/results/records")[0].Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["record_score"] != 50.0 || body["sort"] != "record_score" || body["desc"] != true {
+		t.Errorf("request body = %v, want records sorted by record_score above warning", body)
+	}
+}
+
+func TestRunAnomalyBuckets(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"POST /_ml/anomaly_detectors/nginx-errors/results/buckets": ok("ml/buckets_empty.json"),
+		"POST /_ml/anomaly_detectors/missing/results/buckets": {
+			{status: http.StatusNotFound, file: "ml/job_not_found.json"},
+		},
+	})
+	client := newTestClient(es.URL)
+
+	result := client.RunAnomaly(AnomalyCheck{JobID: "nginx-errors", ResultType: "bucket", TimePeriod: 60, Critical: 75})
+	if result.Status != nagiosplugin.OK || result.Message != "no bucket anomalies of ML job nginx-errors with score of at least 75.00 in the past 60 minutes" {
+		t.Errorf("result = %v %q, want OK without anomalies", result.Status, result.Message)
+	}
+
+	result = client.RunAnomaly(AnomalyCheck{JobID: "missing", ResultType: "bucket", TimePeriod: 60, Critical: 75})
+	if result.Status != nagiosplugin.UNKNOWN || !strings.Contains(result.Message, "No known job with id 'missing'") {
+		t.Errorf("result = %v %q, want UNKNOWN for missing job", result.Status, result.Message)
+	}
+}
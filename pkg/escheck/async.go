@@ -0,0 +1,91 @@
+package escheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// AsyncSearchResult : struct containts _async_search API response
+type AsyncSearchResult struct {
+	ID        string      `json:"id"`
+	IsRunning bool        `json:"is_running"`
+	IsPartial bool        `json:"is_partial"`
+	Response  QueryResult `json:"response"`
+}
+
+func asyncWaitParams(pollInterval time.Duration) url.Values {
+	return url.Values{"wait_for_completion_timeout": {fmt.Sprintf("%dms", pollInterval.Milliseconds())}}
+}
+
+// asyncSearchParams adds async search submit parameters to search parameters
+func asyncSearchParams(searchParams url.Values, pollInterval time.Duration) url.Values {
+	params := asyncWaitParams(pollInterval)
+	for k, v := range searchParams {
+		params[k] = v
+	}
+	params.Set("keep_on_completion", "false")
+	return params
+}
+
+func (c *Client) asyncSearchRequest(ctx context.Context, method, rawURL, content string) (AsyncSearchResult, error) {
+	var result AsyncSearchResult
+	var header http.Header
+	if content != "" {
+		header = http.Header{"Content-Type": {"application/json"}}
+	}
+	resp, err := c.esOpenRequest(ctx, method, rawURL, header, content)
+	if err != nil {
+		return result, err
+	}
+	if resp.StatusCode != 200 {
+		body, _ := readResponse(resp, c.opts.Debugf)
+		return result, esResponseError(resp.Status, body)
+	}
+	err = c.decodeResponse(resp, &result)
+	return result, err
+}
+
+// esAsyncSearch submits async search and polls it until completion or
+// deadline of ctx, stored search is deleted afterwards
+func (c *Client) esAsyncSearch(ctx context.Context, baseURL, searchURL, content string, pollInterval time.Duration) (QueryResult, error) {
+	result, err := c.asyncSearchRequest(ctx, "POST", searchURL, content)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	if result.ID != "" {
+		defer c.deleteAsyncSearch(baseURL, result.ID)
+	}
+
+	for result.IsRunning {
+		pollURL, err := BuildURL(baseURL, asyncWaitParams(pollInterval), "_async_search", url.PathEscape(result.ID))
+		if err != nil {
+			return QueryResult{}, err
+		}
+		c.debugf("async search %s still running", result.ID)
+		result, err = c.asyncSearchRequest(ctx, "GET", pollURL, "")
+		if err != nil {
+			return QueryResult{}, err
+		}
+	}
+	return result.Response, nil
+}
+
+// deleteAsyncSearch frees stored async search, it uses own deadline as the
+// check deadline may already be expired
+func (c *Client) deleteAsyncSearch(baseURL, id string) {
+	deleteURL, err := BuildURL(baseURL, nil, "_async_search", url.PathEscape(id))
+	if err != nil {
+		return
+	}
+	ctx, cancel := c.newTimeoutContext()
+	defer cancel()
+	status, body, err := c.esDelete(ctx, deleteURL)
+	if err != nil {
+		c.debugf("async search %s cleanup failed: %v", id, err)
+	} else if status != 200 && status != 404 {
+		c.debugf("async search %s cleanup failed: %v", id, esResponseError(fmt.Sprint(status), body))
+	}
+}
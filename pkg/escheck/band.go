@@ -0,0 +1,142 @@
+package escheck
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// CountRange : struct containts range of Nagios threshold syntax, values
+// outside of Low..High breach it or, when Inside is set, values within it;
+// nil bound is unbounded
+type CountRange struct {
+	Low    *int
+	High   *int
+	Inside bool
+}
+
+// ParseCountRange parses Nagios range [@][start:]end, eg.: 500 (0:500),
+// 10:500, 10: (at least 10), ~:500 (at most 500) or @10:20 (breached
+// within 10..20)
+func ParseCountRange(spec string) (*CountRange, error) {
+	r := &CountRange{}
+	s := strings.TrimSpace(spec)
+	if strings.HasPrefix(s, "@") {
+		r.Inside = true
+		s = s[1:]
+	}
+	if s == "" {
+		return nil, fmt.Errorf("invalid range %s: no bound given", spec)
+	}
+	start, end := "0", s
+	if i := strings.Index(s, ":"); i >= 0 {
+		start, end = s[:i], s[i+1:]
+	}
+	if start != "~" {
+		low, err := strconv.Atoi(start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %s: start should be number or ~", spec)
+		}
+		r.Low = &low
+	}
+	if end != "" {
+		high, err := strconv.Atoi(end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %s: end should be number", spec)
+		}
+		r.High = &high
+	}
+	if r.Low != nil && r.High != nil && *r.Low > *r.High {
+		return nil, fmt.Errorf("invalid range %s: start is greater than end", spec)
+	}
+	if r.Low == nil && r.High == nil {
+		return nil, fmt.Errorf("invalid range %s: no bound given", spec)
+	}
+	return r, nil
+}
+
+// String renders range in Nagios syntax, eg.: for perfdata thresholds
+func (r CountRange) String() string {
+	var s string
+	if r.Inside {
+		s = "@"
+	}
+	if r.Low == nil {
+		s += "~:"
+	} else if *r.Low != 0 || r.High == nil {
+		s += strconv.Itoa(*r.Low) + ":"
+	}
+	if r.High != nil {
+		s += strconv.Itoa(*r.High)
+	}
+	return s
+}
+
+// breach returns side of range breached by value, eg.: "below minimum 10",
+// empty when value doesn't breach range
+func (r CountRange) breach(value int) string {
+	below := r.Low != nil && value < *r.Low
+	above := r.High != nil && value > *r.High
+	switch {
+	case r.Inside && !below && !above:
+		return fmt.Sprintf("within %s", strings.TrimPrefix(r.String(), "@"))
+	case r.Inside:
+		return ""
+	case below:
+		return fmt.Sprintf("below minimum %d", *r.Low)
+	case above:
+		return fmt.Sprintf("above maximum %d", *r.High)
+	}
+	return ""
+}
+
+// reference returns bound percentage of value is computed of, the maximum
+// when range has one
+func (r CountRange) reference() int {
+	if r.High != nil {
+		return *r.High
+	}
+	return *r.Low
+}
+
+// rangeStatus compares value with critical and optional warning range and
+// returns side of the breached one
+func rangeStatus(value int, critical, warning *CountRange) (nagiosplugin.Status, string) {
+	if breach := critical.breach(value); breach != "" {
+		return nagiosplugin.CRITICAL, breach
+	}
+	if warning != nil {
+		if breach := warning.breach(value); breach != "" {
+			return nagiosplugin.WARNING, breach
+		}
+	}
+	return nagiosplugin.OK, ""
+}
+
+// TotalStatus returns status of count summed over clusters according to
+// band of check or, without one, its thresholds, together with side of the
+// breached band
+func TotalStatus(check Check, total int) (nagiosplugin.Status, string) {
+	if check.Range != nil {
+		return rangeStatus(total, check.Range, check.WarningRange)
+	}
+	return CountStatus(total, check.Warning, check.Threshold, check.Operator), ""
+}
+
+// SetRangePerfData replaces thresholds of compared value, the first
+// perfdata value, with ranges; rate of band has no thresholds
+func SetRangePerfData(result *CheckResult, critical, warning *CountRange) {
+	for i := range result.PerfData {
+		p := &result.PerfData[i]
+		p.Warn, p.Crit = nil, nil
+		if i > 0 {
+			continue
+		}
+		p.CritRange = critical.String()
+		if warning != nil {
+			p.WarnRange = warning.String()
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package escheck
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestParseCountRange(t *testing.T) {
+	tests := []struct {
+		spec   string
+		want   string
+		breach map[int]string
+	}{
+		{"500", "500", map[int]string{0: "", 500: "", 501: "above maximum 500"}},
+		{"10:500", "10:500", map[int]string{9: "below minimum 10", 10: "", 501: "above maximum 500"}},
+		{"10:", "10:", map[int]string{9: "below minimum 10", 100000: ""}},
+		{"~:500", "~:500", map[int]string{0: "", 501: "above maximum 500"}},
+		{"@10:20", "@10:20", map[int]string{9: "", 15: "within 10:20", 21: ""}},
+	}
+	for _, tt := range tests {
+		r, err := ParseCountRange(tt.spec)
+		if err != nil {
+			t.Errorf("ParseCountRange(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("ParseCountRange(%q) = %s, want %s", tt.spec, got, tt.want)
+		}
+		for value, want := range tt.breach {
+			if got := r.breach(value); got != want {
+				t.Errorf("%s breach(%d) = %q, want %q", tt.spec, value, got, want)
+			}
+		}
+	}
+
+	for _, spec := range []string{"", "x", "10:x", "500:10", "~:"} {
+		if _, err := ParseCountRange(spec); err == nil {
+			t.Errorf("ParseCountRange(%q) = nil error, want invalid", spec)
+		}
+	}
+}
+
+func TestRunRange(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	check := testCheck()
+	check.Threshold, check.Warning = 0, 0
+	check.Range, _ = ParseCountRange("10:500")
+	check.WarningRange, _ = ParseCountRange("20:")
+
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.CRITICAL {
+		t.Errorf("status = %v, want CRITICAL", result.Status)
+	}
+	if !strings.HasSuffix(result.Message, ", below minimum 10") {
+		t.Errorf("message = %q, want breached side", result.Message)
+	}
+	if got := result.PerfData[0].String(); got != "count=4;20:;10:500;0;" {
+		t.Errorf("perfdata = %s", got)
+	}
+}
+
+func TestTotalStatus(t *testing.T) {
+	low, high := 100, 500
+	check := testCheck()
+	check.Range = &CountRange{Low: &low, High: &high}
+	tests := []struct {
+		total  int
+		status nagiosplugin.Status
+		breach string
+	}{
+		{40, nagiosplugin.CRITICAL, "below minimum 100"},
+		{250, nagiosplugin.OK, ""},
+		{501, nagiosplugin.CRITICAL, "above maximum 500"},
+	}
+	for _, tt := range tests {
+		if status, breach := TotalStatus(check, tt.total); status != tt.status || breach != tt.breach {
+			t.Errorf("TotalStatus(%d) = %v %q, want %v %q", tt.total, status, breach, tt.status, tt.breach)
+		}
+	}
+
+	// without band thresholds of check apply
+	check.Range = nil
+	if status, _ := TotalStatus(check, 40); status != CountStatus(40, check.Warning, check.Threshold, check.Operator) {
+		t.Errorf("TotalStatus() without band = %v, want status of thresholds", status)
+	}
+}
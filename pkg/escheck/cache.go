@@ -0,0 +1,94 @@
+package escheck
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ResultCache : interface of cache of search results shared by checks
+// running the same query with different thresholds, Load returns data saved
+// under key not older than maxAge
+type ResultCache interface {
+	Load(key string, maxAge time.Duration) ([]byte, time.Time, bool)
+	Save(key string, data []byte) error
+}
+
+// FileResultCache : struct containts directory keeping cached search results,
+// one file per key
+type FileResultCache struct {
+	Dir string
+}
+
+// Load reads cached data, age is taken from file modification time
+func (f *FileResultCache) Load(key string, maxAge time.Duration) ([]byte, time.Time, bool) {
+	path := filepath.Join(f.Dir, key+".json")
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > maxAge {
+		return nil, time.Time{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	return data, info.ModTime(), true
+}
+
+// Save writes cached data atomically, so concurrent checks never read
+// partially written file
+func (f *FileResultCache) Save(key string, data []byte) error {
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(f.Dir, key+".json"), data)
+}
+
+// cacheKey identifies search by everything it depends on except bounds of
+// the time window, which move with every run
+func (c *Client) cacheKey(indexOptions IndexOptions, searchOptions SearchOptions, queryOptions QueryOptions, timePeriod int) string {
+	queryOptions.TimeFrom = 0
+	queryOptions.TimeTo = 0
+	data, _ := json.Marshal(struct {
+		URLs       []string
+		Index      IndexOptions
+		Search     SearchOptions
+		Query      QueryOptions
+		TimePeriod int
+	}{c.opts.URLs, indexOptions, searchOptions, queryOptions, timePeriod})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// loadCachedMsg returns cached search result and its time
+func (c *Client) loadCachedMsg(key string) (Msg, time.Time, bool) {
+	var msg Msg
+	if c.opts.Cache == nil || c.opts.CacheTTL <= 0 {
+		return msg, time.Time{}, false
+	}
+	data, cached, ok := c.opts.Cache.Load(key, c.opts.CacheTTL)
+	if !ok {
+		return msg, time.Time{}, false
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.debugf("cached result %s is corrupted: %v", key, err)
+		return msg, time.Time{}, false
+	}
+	return msg, cached, true
+}
+
+// saveCachedMsg stores successful search result
+func (c *Client) saveCachedMsg(key string, msg Msg) {
+	if c.opts.Cache == nil || c.opts.CacheTTL <= 0 {
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err == nil {
+		err = c.opts.Cache.Save(key, data)
+	}
+	if err != nil {
+		c.debugf("result cache save failed: %v", err)
+	}
+}
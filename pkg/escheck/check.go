@@ -0,0 +1,1190 @@
+// Package escheck implements elasticsearch logs count check used by
+// check-es-logs-count: cluster client with failover and retries, search query
+// builder, threshold evaluation and result types. Tools embedding the check
+// create Client once and call Run with check definition for each evaluation.
+package escheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// Check : struct containts definition of logs count check, thresholds are
+// compared with Operator 'lt' or 'gt'
+type Check struct {
+	Index                IndexOptions
+	Search               SearchOptions
+	Query                string
+	TimePeriod           int
+	Warning              int
+	Threshold            int
+	Operator             string
+	CheckIndexExists     bool
+	Samples              int
+	SampleFields         []string
+	SamplesOn            string
+	SampleMaxLen         int
+	BreakdownField       string
+	BreakdownSize        int
+	Histogram            bool
+	SearchTimeout        time.Duration
+	OutputTemplate       string
+	KibanaURL            string
+	KibanaIndexPatternID string
+	ShardFailureStatus   string
+	TimedOutStatus       string
+	ShowDeprecations     bool
+	// MinUnique makes check CRITICAL when fewer unique values of field were
+	// found, eg.: hosts sending logs
+	MinUnique []UniqueCondition
+	// SumField makes thresholds compared with sum of field, eg.: bytes
+	// ingested, instead of number of entries
+	SumField string
+	// PercentileField makes thresholds compared with Percentile (eg.: 95)
+	// of field, eg.: request latency, instead of number of entries
+	PercentileField string
+	Percentile      float64
+	// TermThresholds are thresholds of count of entries with single value of
+	// BreakdownField, evaluated together with thresholds of total count
+	TermThresholds []TermThreshold
+	// FilterThresholds are thresholds of count of entries matching named
+	// queries within Query, counted by filters aggregation of the same
+	// search and evaluated together with thresholds of total count
+	FilterThresholds []FilterThreshold
+	// Trend makes thresholds compared with moving-avg (over TrendWindow
+	// buckets) or derivative of counts in TrendInterval histogram buckets,
+	// taken from the last complete bucket
+	Trend         string
+	TrendWindow   int
+	TrendInterval time.Duration
+	// SignificantFields are fields searched for values standing out in
+	// CRITICAL window compared with SignificantBackground window before it,
+	// up to SignificantSize values per field are appended to long output
+	SignificantFields     []string
+	SignificantBackground time.Duration
+	SignificantSize       int
+	// Sparkline appends histogram bucket counts drawn with unicode or ascii
+	// characters to status line, empty disables
+	Sparkline string
+	// SamplerShardSize limits breakdown and significant terms to this many
+	// best matching entries per shard, bounding cost of the aggregations on
+	// large indices at expense of exactness; 0 disables
+	SamplerShardSize int
+	// MaxLag makes check CRITICAL and WarningLag WARNING when the newest
+	// matching entry is older, so lagging pipelines are detected even when
+	// counts look fine; 0 disables
+	MaxLag     time.Duration
+	WarningLag time.Duration
+	// Profile sets profile option of search and returns profile in result
+	Profile bool
+	// BucketInterval is size of histogram buckets in long output and
+	// sparkline, 0 keeps 1h
+	BucketInterval time.Duration
+	// Align ends time window at the last whole histogram bucket, or minute
+	// without histogram, instead of now so successive runs evaluate the
+	// same bucket edges
+	Align bool
+	// TimestampFormat is elasticsearch date format of @timestamp range
+	// bounds: epoch_millis, epoch_second, ISO 8601 formats like
+	// strict_date_optional_time or custom pattern like yyyy-MM-dd HH:mm:ss,
+	// empty keeps DefaultTimestampFormat
+	TimestampFormat string
+	// FieldFilters are exact values of fields matching entries must have
+	// besides Query, eg.: log.level error
+	FieldFilters []FieldFilter
+	// MaskFields are dotted paths of sample document fields with values
+	// replaced by *** and MaskPatterns regular expressions replaced within
+	// string values, eg.: emails or tokens
+	MaskFields   []string
+	MaskPatterns []string
+	// ExplainZero makes zero count followed by index stats request telling
+	// apart missing index, empty indices and not matching documents
+	ExplainZero bool
+	// Range and WarningRange replace Threshold and Warning with band the
+	// count, sum or percentile is expected to stay within, so both too low
+	// and too high values are detected
+	Range        *CountRange
+	WarningRange *CountRange
+	// RetryPartial repeats search once when some shards failed or search
+	// timed out, so transient shard failures don't change state; partial
+	// result is kept when the retry fails
+	RetryPartial bool
+	// SampleDedup prints samples equal after numbers and hexadecimal ids are
+	// normalized once with their occurrence count
+	SampleDedup bool
+	// OpaqueID is X-Opaque-Id header of requests of the check, so checks
+	// sharing client are told apart in slow logs; empty keeps
+	// ClientOptions.OpaqueID
+	OpaqueID string
+}
+
+// TermThreshold : struct containts thresholds of count of entries with
+// Term value of breakdown field, compared with check Operator; warning 0
+// disables warning state
+type TermThreshold struct {
+	Term     string
+	Warning  int
+	Critical int
+}
+
+// FilterThreshold : struct containts thresholds of count of entries
+// matching Query, compared with check Operator; warning 0 disables warning
+// state
+type FilterThreshold struct {
+	Name     string
+	Query    string
+	Warning  int
+	Critical int
+}
+
+// UniqueCondition : struct containts minimum number of unique values of
+// field
+type UniqueCondition struct {
+	Field string
+	Min   int
+}
+
+// MessageTemplateData : struct containts fields available in output template
+type MessageTemplateData struct {
+	Status    string
+	Count     int
+	Rate      float64
+	Percent   float64
+	Query     string
+	Window    int
+	Warning   int
+	Threshold int
+	Operator  string
+}
+
+// Msg : struct containts channel message content
+type Msg struct {
+	Count     int
+	Took      int
+	TimedOut  bool
+	Shards    ShardsInfo
+	Warnings  []string
+	Resolved  *ResolvedTargets
+	Buckets   []HistogramBucket
+	Samples   []json.RawMessage
+	Breakdown []TermsBucket
+	Unique    UniqueCounts
+	Sum       float64
+	// Percentile is value of percentiles aggregation, 0 when no entry has
+	// the field
+	Percentile float64
+	// Terms are counts of TermThresholds terms, missing term has no entries
+	Terms []TermsBucket
+	// Filters are counts of FilterThresholds queries by name
+	Filters map[string]int
+	// Coverage is time range of matching entries
+	Coverage Coverage
+	Profile  json.RawMessage
+	Err      error `json:"-"`
+}
+
+// IndexShards : struct containts _cat/shards API entry
+type IndexShards struct {
+	Index string `json:"index"`
+	Shard string `json:"shard"`
+	State string `json:"state"`
+}
+
+// IndexExistsMsg : struct containts index existence check channel message content
+type IndexExistsMsg struct {
+	Missing       []string
+	Unassigned    []string
+	Indices       int
+	StartedShards int
+	Err           error
+}
+
+func (c *Client) getQueryResultCount(ctx context.Context, baseURL string, indexOptions IndexOptions, searchOptions SearchOptions, templateSource string, queryOptions QueryOptions) (msg Msg) {
+	warnings := &deprecationWarnings{}
+	ctx = withDeprecationWarnings(ctx, warnings)
+	defer func() {
+		msg.Warnings = warnings.list()
+	}()
+
+	version, err := c.getESVersion(ctx, baseURL)
+	if err != nil {
+		msg.Err = err
+		return msg
+	}
+	if version != nil && version.IsOpenSearch() && c.opts.CompatibleWith > 0 {
+		msg.Err = fmt.Errorf("compatible-with parameter is not supported by OpenSearch")
+		return msg
+	}
+	if version != nil && version.IsOpenSearch() && searchOptions.Async {
+		msg.Err = fmt.Errorf("async-search parameter is not supported by OpenSearch")
+		return msg
+	}
+	queryOptions.Version = version
+	if indexOptions.DocType != "" && version != nil && version.TypesRemoved() {
+		c.debugf("ignoring document type %s, types were removed in %s %s", indexOptions.DocType, version.DistributionName(), version)
+		indexOptions.DocType = ""
+	}
+
+	tmpl, err := getRenderedTemplate(templateSource, queryOptions)
+	if err != nil {
+		msg.Err = err
+		return msg
+	}
+
+	if indexOptions.VerifyAliases {
+		for _, alias := range indexOptions.Aliases {
+			if err := c.verifyAlias(ctx, baseURL, alias); err != nil {
+				msg.Err = err
+				return msg
+			}
+		}
+	}
+
+	end := time.Now()
+	if queryOptions.TimeTo != 0 {
+		end = time.Unix(queryOptions.TimeTo, 0)
+	}
+	indices := getIndexNames(indexOptions, time.Unix(queryOptions.TimeFrom, 0), end)
+	if indexOptions.Resolve {
+		msg.Resolved, err = c.resolveIndices(ctx, baseURL, indices)
+		if err != nil {
+			msg.Err = err
+			return msg
+		}
+	}
+
+	searchURL, err := getSearchURL(baseURL, indices, indexOptions.DocType, searchOptions)
+	if err != nil {
+		msg.Err = err
+		return msg
+	}
+	if id := pointInTimeID(ctx); id != "" {
+		searchURL, tmpl, err = pointInTimeSearch(baseURL, tmpl, id, searchOptions)
+		if err != nil {
+			msg.Err = err
+			return msg
+		}
+	}
+
+	var result QueryResult
+	if searchOptions.PerIndex > 0 && len(indices) > 1 && pointInTimeID(ctx) == "" {
+		result, err = c.esPerIndexSearch(ctx, baseURL, indices, indexOptions.DocType, searchOptions, tmpl, queryOptions, searchOptions.PerIndex)
+	} else if searchOptions.Async {
+		result, err = c.esAsyncSearch(ctx, baseURL, searchURL, tmpl, searchOptions.AsyncPollInterval)
+	} else {
+		result, err = c.esQueryPost(ctx, searchURL, tmpl)
+	}
+	if err != nil {
+		msg.Err = err
+		return msg
+	}
+
+	msg.Count = result.Hits.Total.Value
+	msg.Took = result.Took
+	msg.TimedOut = result.TimedOut
+	msg.Shards = result.Shards
+	msg.Buckets = result.Aggregations.Histogram.Buckets
+	for _, h := range result.Hits.Hits {
+		msg.Samples = append(msg.Samples, h.Source)
+	}
+	msg.Breakdown = result.Aggregations.Breakdown.Buckets
+	if queryOptions.SamplerShardSize > 0 {
+		msg.Breakdown = result.Aggregations.Sampler.Breakdown.Buckets
+	}
+	msg.Unique = result.Aggregations.Unique
+	msg.Terms = result.Aggregations.Terms.Buckets
+	msg.Coverage = result.Aggregations.Coverage
+	msg.Profile = result.Profile
+	if len(result.Aggregations.Filters.Buckets) > 0 {
+		msg.Filters = make(map[string]int)
+		for name, b := range result.Aggregations.Filters.Buckets {
+			msg.Filters[name] = b.DocCount
+		}
+	}
+	if result.Aggregations.Sum.Value != nil {
+		msg.Sum = *result.Aggregations.Sum.Value
+	}
+	// single percent is requested
+	for _, v := range result.Aggregations.Percentiles.Values {
+		if v != nil {
+			msg.Percentile = *v
+		}
+	}
+	return msg
+}
+
+func (c *Client) getIndexExists(ctx context.Context, baseURL string, indices []string) IndexExistsMsg {
+	var msg IndexExistsMsg
+	for _, index := range indices {
+		shardsURL, err := BuildURL(baseURL, url.Values{"format": {"json"}, "h": {"index,shard,state"}}, "_cat", "shards", escapeIndexNames([]string{index}))
+		if err != nil {
+			msg.Err = err
+			return msg
+		}
+
+		status, body, err := c.esGet(ctx, shardsURL)
+		if err != nil {
+			msg.Err = err
+			return msg
+		}
+		if status == 404 {
+			msg.Missing = append(msg.Missing, index)
+			continue
+		}
+		if status != 200 {
+			msg.Err = esResponseError(strconv.Itoa(status), body)
+			return msg
+		}
+
+		var shards []IndexShards
+		if err := json.Unmarshal([]byte(body), &shards); err != nil {
+			msg.Err = fmt.Errorf("JSON parse failed")
+			return msg
+		}
+		if len(shards) == 0 {
+			msg.Missing = append(msg.Missing, index)
+			continue
+		}
+
+		started := 0
+		for _, s := range shards {
+			if s.State == "STARTED" {
+				started++
+			}
+		}
+		if started == 0 {
+			msg.Unassigned = append(msg.Unassigned, index)
+			continue
+		}
+		msg.Indices++
+		msg.StartedShards += started
+	}
+	return msg
+}
+
+func (c *Client) runIndexExistsCheck(indices []string, stats *requestStats) *CheckResult {
+	var msg IndexExistsMsg
+	err := c.queryCluster(func(ctx context.Context, baseURL string) error {
+		msg = c.getIndexExists(withRequestStats(ctx, stats), baseURL, indices)
+		return msg.Err
+	})
+	if err != nil {
+		return newQueryErrorResult(err)
+	} else if len(msg.Missing) > 0 {
+		return newCheckResult(nagiosplugin.CRITICAL, fmt.Sprintf("index does not exist: %s", strings.Join(msg.Missing, ", ")))
+	} else if len(msg.Unassigned) > 0 {
+		return newCheckResult(nagiosplugin.CRITICAL, fmt.Sprintf("index has no started shards: %s", strings.Join(msg.Unassigned, ", ")))
+	}
+	return newCheckResult(nagiosplugin.OK, fmt.Sprintf("%d indices exist with %d started shards", msg.Indices, msg.StartedShards))
+}
+
+func statusFromName(name string) nagiosplugin.Status {
+	switch name {
+	case "ok":
+		return nagiosplugin.OK
+	case "warning":
+		return nagiosplugin.WARNING
+	case "critical":
+		return nagiosplugin.CRITICAL
+	}
+	return nagiosplugin.UNKNOWN
+}
+
+// CountStatus compares count against warning and critical thresholds, for
+// 'gt' operator count is expected to be greater than thresholds, for 'lt' lower;
+// warning threshold 0 disables warning state
+func CountStatus(count, warning, critical int, operator string) nagiosplugin.Status {
+	if operator == "lt" {
+		if count > critical {
+			return nagiosplugin.CRITICAL
+		}
+		if warning != 0 && count > warning {
+			return nagiosplugin.WARNING
+		}
+		return nagiosplugin.OK
+	}
+
+	if count < critical {
+		return nagiosplugin.CRITICAL
+	}
+	if warning != 0 && count < warning {
+		return nagiosplugin.WARNING
+	}
+	return nagiosplugin.OK
+}
+
+func addCountPerfData(result *CheckResult, count, warning, critical, minutes int) {
+	var warn, warnRate *float64
+	if warning != 0 {
+		warn = floatPtr(float64(warning))
+		warnRate = floatPtr(float64(warning) / float64(minutes))
+	}
+	result.AddPerfDatum(PerfDatum{Label: "count", Value: float64(count), Warn: warn, Crit: floatPtr(float64(critical)), Min: floatPtr(0)})
+	result.AddPerfDatum(PerfDatum{Label: "rate", Value: float64(count) / float64(minutes), Warn: warnRate, Crit: floatPtr(float64(critical) / float64(minutes)), Min: floatPtr(0)})
+}
+
+// percentileName returns ordinal name of percentile, eg.: 95th, 99.9th
+func percentileName(p float64) string {
+	name := strconv.FormatFloat(p, 'f', -1, 64)
+	switch {
+	case strings.HasSuffix(name, "1") && !strings.HasSuffix(name, "11"):
+		return name + "st"
+	case strings.HasSuffix(name, "2") && !strings.HasSuffix(name, "12"):
+		return name + "nd"
+	case strings.HasSuffix(name, "3") && !strings.HasSuffix(name, "13"):
+		return name + "rd"
+	}
+	return name + "th"
+}
+
+// addValuePerfData adds value of field aggregation compared with thresholds
+// and count of entries the value is computed from
+func addValuePerfData(result *CheckResult, label string, value, count, warning, critical int) {
+	var warn *float64
+	if warning != 0 {
+		warn = floatPtr(float64(warning))
+	}
+	result.AddPerfDatum(PerfDatum{Label: label, Value: float64(value), Warn: warn, Crit: floatPtr(float64(critical))})
+	result.AddPerfDatum(PerfDatum{Label: "count", Value: float64(count), Min: floatPtr(0)})
+}
+
+func addSearchStats(result *CheckResult, took int, shards ShardsInfo) {
+	result.Took = &took
+	result.Shards = &shards
+	result.LongOutput = append(result.LongOutput, fmt.Sprintf("took %dms, shards: %d total, %d successful, %d skipped, %d failed", took, shards.Total, shards.Successful, shards.Skipped, shards.Failed))
+	for _, f := range shards.Failures {
+		result.LongOutput = append(result.LongOutput, fmt.Sprintf("shard %d of %s failed on node %s: %s", f.Shard, f.Index, f.Node, formatESErrorCause(f.Reason)))
+	}
+	result.AddPerfDatum(PerfDatum{Label: "took", Unit: "ms", Value: float64(took), Min: floatPtr(0)})
+	result.AddPerfDatum(PerfDatum{Label: "shards_total", Value: float64(shards.Total), Min: floatPtr(0)})
+	result.AddPerfDatum(PerfDatum{Label: "shards_successful", Value: float64(shards.Successful), Min: floatPtr(0)})
+	result.AddPerfDatum(PerfDatum{Label: "shards_failed", Value: float64(shards.Failed), Min: floatPtr(0)})
+}
+
+func showSamples(status nagiosplugin.Status, samplesOn string) bool {
+	switch samplesOn {
+	case "always":
+		return true
+	case "ok":
+		return status == nagiosplugin.OK
+	default:
+		return status != nagiosplugin.OK
+	}
+}
+
+// getSourceField returns value of possibly dotted field name, trying flat
+// key first and then nested objects
+func getSourceField(source map[string]interface{}, field string) (interface{}, bool) {
+	if v, ok := source[field]; ok {
+		return v, true
+	}
+	for i := 0; i < len(field); i++ {
+		if field[i] != '.' {
+			continue
+		}
+		if nested, ok := source[field[:i]].(map[string]interface{}); ok {
+			if v, ok := getSourceField(nested, field[i+1:]); ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// truncateSample cuts s to maxLen characters marking the cut with ...,
+// 0 keeps s whole
+func truncateSample(s string, maxLen int) string {
+	r := []rune(s)
+	if maxLen <= 0 || len(r) <= maxLen {
+		return s
+	}
+	return string(r[:maxLen]) + "..."
+}
+
+// formatSamples returns long output lines of samples, values of fields or
+// whole documents without fields are cut to maxLen characters; with dedup
+// near-identical lines are printed once
+func formatSamples(samples []json.RawMessage, fields []string, maxLen int, dedup bool) []string {
+	var lines []string
+	for _, s := range samples {
+		if len(fields) == 0 {
+			lines = append(lines, truncateSample(string(s), maxLen))
+			continue
+		}
+
+		var source map[string]interface{}
+		if err := json.Unmarshal(s, &source); err != nil {
+			lines = append(lines, truncateSample(string(s), maxLen))
+			continue
+		}
+		var values []string
+		for _, f := range fields {
+			if v, ok := getSourceField(source, f); ok {
+				values = append(values, fmt.Sprintf("%s=%s", f, truncateSample(fmt.Sprintf("%v", v), maxLen)))
+			}
+		}
+		lines = append(lines, strings.Join(values, " "))
+	}
+
+	if !dedup {
+		return append([]string{"Sample documents:"}, lines...)
+	}
+	unique := dedupSampleLines(lines)
+	if len(unique) == len(lines) {
+		return append([]string{"Sample documents:"}, unique...)
+	}
+	return append([]string{fmt.Sprintf("Sample documents (%d unique of %d):", len(unique), len(lines))}, unique...)
+}
+
+// sampleVariablePattern matches numbers and hexadecimal ids, which tell
+// apart otherwise identical log lines, eg.: timestamps, request ids or line
+// numbers of stack traces
+var sampleVariablePattern = regexp.MustCompile(`[0-9a-fA-F]*[0-9][0-9a-fA-F]*`)
+
+// dedupSampleLines groups lines equal with variable parts
+// normalized and returns the first line of every group in order of first
+// occurrence, suffixed by group size when it occurs more than once
+func dedupSampleLines(lines []string) []string {
+	var order []string
+	first := make(map[string]string)
+	counts := make(map[string]int)
+	for _, line := range lines {
+		key := sampleVariablePattern.ReplaceAllString(line, "#")
+		if counts[key] == 0 {
+			order = append(order, key)
+			first[key] = line
+		}
+		counts[key]++
+	}
+
+	var unique []string
+	for _, key := range order {
+		if counts[key] > 1 {
+			unique = append(unique, fmt.Sprintf("%s (%d times)", first[key], counts[key]))
+		} else {
+			unique = append(unique, first[key])
+		}
+	}
+	return unique
+}
+
+func formatBreakdown(field string, buckets []TermsBucket, samplerShardSize int) []string {
+	title := fmt.Sprintf("Top %s:", field)
+	if samplerShardSize > 0 {
+		title = fmt.Sprintf("Top %s in sample of %d entries per shard:", field, samplerShardSize)
+	}
+	lines := []string{title}
+	for _, b := range buckets {
+		lines = append(lines, fmt.Sprintf("%v: %d", b.Key, b.DocCount))
+	}
+	return lines
+}
+
+func renderMessageTemplate(tmpl *template.Template, data MessageTemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func normalizeEsQuery(str string) string {
+	return strings.Replace(str, `"`, `\"`, -1)
+}
+
+func getQueryOptions(check Check, timeFrom, timeTo int64) QueryOptions {
+	opts := QueryOptions{
+		Query:            normalizeEsQuery(check.Query),
+		TimeFrom:         timeFrom,
+		TimeTo:           timeTo,
+		Samples:          check.Samples,
+		SampleFields:     check.SampleFields,
+		BreakdownField:   check.BreakdownField,
+		BreakdownSize:    check.BreakdownSize,
+		SamplerShardSize: check.SamplerShardSize,
+		UniqueFields:     uniqueFields(check.MinUnique),
+		SumField:         check.SumField,
+		PercentileField:  check.PercentileField,
+		Percentile:       check.Percentile,
+		Terms:            thresholdTerms(check.TermThresholds),
+		Filters:          thresholdFilters(check.FilterThresholds),
+		TimestampFormat:  check.TimestampFormat,
+		FieldFilters:     check.FieldFilters,
+		Coverage:         check.MaxLag > 0 || check.WarningLag > 0,
+		Profile:          check.Profile,
+		Trend:            check.Trend,
+		TrendWindow:      check.TrendWindow,
+		SearchTimeout:    check.SearchTimeout,
+	}
+	opts.Interval = check.BucketInterval
+	// buckets are fetched only when they are printed or drawn
+	opts.Histogram = check.Histogram || check.Sparkline != ""
+	// trend interval replaces histogram interval only when trend is
+	// evaluated
+	if check.Trend != "" {
+		opts.Interval = check.TrendInterval
+	}
+	return opts
+}
+
+func thresholdTerms(thresholds []TermThreshold) []string {
+	var terms []string
+	for _, t := range thresholds {
+		terms = append(terms, t.Term)
+	}
+	return terms
+}
+
+func thresholdFilters(thresholds []FilterThreshold) map[string]string {
+	if len(thresholds) == 0 {
+		return nil
+	}
+	filters := make(map[string]string)
+	for _, f := range thresholds {
+		filters[f.Name] = f.Query
+	}
+	return filters
+}
+
+// lastTrend returns trend value of the last histogram bucket complete at
+// now, nil when there is none
+func lastTrend(buckets []HistogramBucket, interval time.Duration, now time.Time) *float64 {
+	for i := len(buckets) - 1; i >= 0; i-- {
+		end := time.Unix(0, buckets[i].Key*int64(time.Millisecond)).Add(interval)
+		if end.After(now) {
+			continue
+		}
+		if buckets[i].Trend == nil {
+			return nil
+		}
+		return buckets[i].Trend.Value
+	}
+	return nil
+}
+
+// bucketIntervals are round histogram intervals picked by
+// AutoBucketInterval
+var bucketIntervals = []time.Duration{
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	3 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+}
+
+// autoBuckets is the highest number of buckets of AutoBucketInterval
+const autoBuckets = 12
+
+// AutoBucketInterval returns the shortest round histogram interval
+// splitting period into at most 12 buckets
+func AutoBucketInterval(period time.Duration) time.Duration {
+	for _, interval := range bucketIntervals {
+		if period <= interval*autoBuckets {
+			return interval
+		}
+	}
+	return bucketIntervals[len(bucketIntervals)-1]
+}
+
+// bucketTimeFormat returns layout of bucket start time precise enough for
+// interval
+func bucketTimeFormat(interval time.Duration) string {
+	if interval > 0 && interval < time.Minute {
+		return "2006-01-02 15:04:05"
+	}
+	return "2006-01-02 15:04"
+}
+
+// alignInterval returns boundary time window of aligned check ends at,
+// buckets of histogram in use or whole minute
+func alignInterval(check Check) time.Duration {
+	switch {
+	case check.Trend != "":
+		return check.TrendInterval
+	case (check.Histogram || check.Sparkline != "") && check.BucketInterval > 0:
+		return check.BucketInterval
+	}
+	return time.Minute
+}
+
+// checkWindow returns start and end of time window of check evaluated at
+// now, timeTo is 0 when window ends now
+func checkWindow(check Check, now time.Time) (timeFrom, timeTo int64, end time.Time) {
+	end = now
+	if check.Align {
+		end = now.Truncate(alignInterval(check))
+		timeTo = end.Unix()
+	}
+	timeFrom = end.Unix() - int64(60)*int64(check.TimePeriod)
+	return timeFrom, timeTo, end
+}
+
+// sparklineChars are characters of sparkline styles ordered from the lowest
+// to the highest count
+var sparklineChars = map[string][]rune{
+	"unicode": []rune("▁▂▃▄▅▆▇█"),
+	"ascii":   []rune("_.-=+*#"),
+}
+
+// sparkline returns bucket counts scaled from 0 to the highest count
+func sparkline(buckets []HistogramBucket, chars []rune) string {
+	max := 0
+	for _, b := range buckets {
+		if b.DocCount > max {
+			max = b.DocCount
+		}
+	}
+	line := make([]rune, len(buckets))
+	for i, b := range buckets {
+		level := 0
+		if max > 0 {
+			level = b.DocCount * (len(chars) - 1) / max
+		}
+		line[i] = chars[level]
+	}
+	return string(line)
+}
+
+var trendNames = map[string]string{
+	"moving-avg": "moving average",
+	"derivative": "derivative",
+}
+
+// termCount returns count of entries with term in terms aggregation buckets
+func termCount(buckets []TermsBucket, term string) int {
+	for _, b := range buckets {
+		if fmt.Sprint(b.Key) == term {
+			return b.DocCount
+		}
+	}
+	return 0
+}
+
+func uniqueFields(conditions []UniqueCondition) []string {
+	var fields []string
+	for _, c := range conditions {
+		fields = append(fields, c.Field)
+	}
+	return fields
+}
+
+// SearchRequest returns search URL and rendered request body of the check
+// without contacting elasticsearch, version given in ClientOptions is used
+// for version specific syntax
+func (c *Client) SearchRequest(check Check) (string, string, error) {
+	timeFrom, timeTo, end := checkWindow(check, time.Now())
+	indices := getIndexNames(check.Index, time.Unix(timeFrom, 0), end)
+
+	if len(c.opts.URLs) == 0 {
+		return "", "", fmt.Errorf("no elasticsearch URL given")
+	}
+	searchURL, err := getSearchURL(c.opts.URLs[0], indices, check.Index.DocType, check.Search)
+	if err != nil {
+		return "", "", err
+	}
+	queryOptions := getQueryOptions(check, timeFrom, timeTo)
+	queryOptions.Version, err = c.configuredVersion()
+	if err != nil {
+		return "", "", err
+	}
+	body, err := getRenderedTemplate(templateSource, queryOptions)
+	if err != nil {
+		return "", "", err
+	}
+	return searchURL, body, nil
+}
+
+// Run evaluates check against the cluster, errors are reported as UNKNOWN
+// result
+func (c *Client) Run(check Check) *CheckResult {
+	stats := &requestStats{opaqueID: check.OpaqueID}
+	result := c.run(check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+func (c *Client) run(check Check, stats *requestStats) *CheckResult {
+	if check.Operator != "lt" && check.Operator != "gt" {
+		return newFailureResult(FailureInternal, "compare-operator parameter should be 'lt' or 'gt'")
+	}
+
+	if c.opts.Breaker.Threshold > 0 && c.opts.Breaker.Store == nil {
+		return newFailureResult(FailureInternal, "breaker-threshold parameter requires state-file or state-redis")
+	}
+
+	if check.Search.IgnoreThrottled && check.Search.IncludeFrozen {
+		return newFailureResult(FailureInternal, "ignore-throttled and include-frozen parameters are mutually exclusive")
+	}
+
+	indexOptions := check.Index
+	timeFrom, timeTo, end := checkWindow(check, time.Now())
+
+	if check.CheckIndexExists {
+		return c.runIndexExistsCheck(getIndexNames(indexOptions, time.Unix(timeFrom, 0), end), stats)
+	}
+
+	if check.Threshold == 0 && check.Range == nil {
+		return newFailureResult(FailureInternal, "threshold cannot be equal to 0")
+	}
+	if check.WarningRange != nil && check.Range == nil {
+		return newFailureResult(FailureInternal, "warning range requires critical range")
+	}
+	if check.Range != nil && check.Trend != "" {
+		return newFailureResult(FailureInternal, "range can't be combined with trend parameter")
+	}
+	if len(check.TermThresholds) > 0 && check.BreakdownField == "" {
+		return newFailureResult(FailureInternal, "term thresholds require breakdown-field parameter")
+	}
+	if check.SumField != "" && check.PercentileField != "" {
+		return newFailureResult(FailureInternal, "sum-field and percentile-field parameters are mutually exclusive")
+	}
+	if check.Trend != "" {
+		if _, ok := trendNames[check.Trend]; !ok {
+			return newFailureResult(FailureInternal, "trend parameter should be 'moving-avg' or 'derivative'")
+		}
+		if check.SumField != "" || check.PercentileField != "" {
+			return newFailureResult(FailureInternal, "trend parameter can't be combined with sum-field or percentile-field")
+		}
+		if check.TrendInterval <= 0 || check.TrendInterval > time.Duration(check.TimePeriod)*time.Minute {
+			return newFailureResult(FailureInternal, "trend-interval parameter should be greater than 0 and not longer than time-period")
+		}
+		if check.Trend == "moving-avg" && check.TrendWindow <= 0 {
+			return newFailureResult(FailureInternal, "trend-window parameter should be greater than 0")
+		}
+	}
+	if _, ok := sparklineChars[check.Sparkline]; check.Sparkline != "" && !ok {
+		return newFailureResult(FailureInternal, "sparkline parameter should be 'unicode' or 'ascii'")
+	}
+	if check.PercentileField != "" && (check.Percentile <= 0 || check.Percentile >= 100) {
+		return newFailureResult(FailureInternal, "percentile parameter should be between 0 and 100")
+	}
+	if len(check.SignificantFields) > 0 && (check.SignificantBackground <= 0 || check.SignificantSize <= 0) {
+		return newFailureResult(FailureInternal, "significant-background and significant-size parameters should be greater than 0")
+	}
+	if check.Search.PointInTime && check.Search.Async {
+		return newFailureResult(FailureInternal, "point-in-time and async-search parameters are mutually exclusive")
+	}
+	// per-index results are merged client-side, which works for counts
+	// but not for cardinality, percentiles or pipeline aggregations
+	if check.Search.PerIndex < 0 {
+		return newFailureResult(FailureInternal, "per-index-search parameter should not be negative")
+	}
+	if check.Search.PerIndex > 0 && (len(check.MinUnique) > 0 || check.PercentileField != "" || check.Trend != "" || check.Search.Async || check.Search.PointInTime) {
+		return newFailureResult(FailureInternal, "per-index-search parameter can't be combined with min-unique, percentile-field, trend, async-search or point-in-time")
+	}
+	if _, err := timestampBound(check.TimestampFormat, time.Now()); err != nil {
+		return newFailureResult(FailureInternal, fmt.Sprintf("timestamp-format parameter: %v", err))
+	}
+
+	mask, err := newSampleMask(check.MaskFields, check.MaskPatterns)
+	if err != nil {
+		return newFailureResult(FailureInternal, fmt.Sprintf("mask-pattern parameter: %v", err))
+	}
+
+	var messageTemplate *template.Template
+	if check.OutputTemplate != "" {
+		var err error
+		messageTemplate, err = template.New("output").Parse(check.OutputTemplate)
+		if err != nil {
+			return newFailureResult(FailureInternal, fmt.Sprintf("output template: %v", err))
+		}
+	}
+
+	queryOptions := getQueryOptions(check, timeFrom, timeTo)
+	key := c.cacheKey(indexOptions, check.Search, queryOptions, check.TimePeriod)
+	msg, cached, ok := c.loadCachedMsg(key)
+	var pit string
+	if !ok && check.Search.PointInTime {
+		// significant terms search covers background window too
+		from := time.Unix(timeFrom, 0)
+		if len(check.SignificantFields) > 0 {
+			from = from.Add(-check.SignificantBackground)
+		}
+		var pitURL string
+		err := c.queryCluster(func(ctx context.Context, baseURL string) error {
+			var err error
+			pit, err = c.openPointInTime(withRequestStats(ctx, stats), baseURL, getIndexNames(indexOptions, from, end), check.Search)
+			pitURL = baseURL
+			return err
+		})
+		if err != nil {
+			return newQueryErrorResult(err)
+		}
+		defer c.closePointInTime(pitURL, pit)
+	}
+	if !ok {
+		err := c.queryCluster(func(ctx context.Context, baseURL string) error {
+			ctx = withPointInTime(ctx, pit)
+			msg = c.getQueryResultCount(
+				withRequestStats(ctx, stats),
+				baseURL,
+				indexOptions,
+				check.Search,
+				templateSource,
+				queryOptions,
+			)
+			if msg.Err == nil && check.RetryPartial && (msg.Shards.Failed > 0 || msg.TimedOut) {
+				c.debugf("search returned partial results, retrying")
+				retry := c.getQueryResultCount(withRequestStats(ctx, stats), baseURL, indexOptions, check.Search, templateSource, queryOptions)
+				if retry.Err == nil {
+					msg = retry
+				}
+			}
+			return msg.Err
+		})
+		if err != nil {
+			return newQueryErrorResult(err)
+		}
+		c.saveCachedMsg(key, msg)
+	}
+
+	value := msg.Count
+	if check.SumField != "" {
+		value = int(msg.Sum)
+	} else if check.PercentileField != "" {
+		value = int(msg.Percentile)
+	}
+	status := CountStatus(value, check.Warning, check.Threshold, check.Operator)
+	perc := float64(value) / float64(check.Threshold) * 100
+	var trend float64
+	if check.Trend != "" {
+		last := lastTrend(msg.Buckets, check.TrendInterval, end)
+		if last == nil {
+			return newCheckResult(nagiosplugin.UNKNOWN, fmt.Sprintf("no complete %s bucket with %s of counts in the past %d minutes", check.TrendInterval, trendNames[check.Trend], check.TimePeriod))
+		}
+		trend = *last
+		status = MetricStatus(trend, float64(check.Warning), float64(check.Threshold), check.Operator)
+		perc = trend / float64(check.Threshold) * 100
+	}
+	var breach string
+	if check.Range != nil {
+		status, breach = rangeStatus(value, check.Range, check.WarningRange)
+		perc = 0
+		if ref := check.Range.reference(); ref != 0 {
+			perc = float64(value) / float64(ref) * 100
+		}
+	}
+	// shorthand field filters are shown as part of the query
+	query := fieldFiltersQuery(check.Query, check.FieldFilters)
+	message := fmt.Sprintf("%d entries of '%s' (%.2f%%) found in the past %d minutes", msg.Count, query, perc, check.TimePeriod)
+	if check.SumField != "" {
+		message = fmt.Sprintf("sum of %s is %d (%.2f%%) in %d entries of '%s' found in the past %d minutes", check.SumField, value, perc, msg.Count, query, check.TimePeriod)
+	} else if check.Trend != "" {
+		message = fmt.Sprintf("%s of %s bucket counts is %s (%.2f%%) in %d entries of '%s' found in the past %d minutes", trendNames[check.Trend], check.TrendInterval, strconv.FormatFloat(trend, 'f', 2, 64), perc, msg.Count, query, check.TimePeriod)
+	} else if check.PercentileField != "" {
+		message = fmt.Sprintf("%s percentile of %s is %d (%.2f%%) in %d entries of '%s' found in the past %d minutes", percentileName(check.Percentile), check.PercentileField, value, perc, msg.Count, query, check.TimePeriod)
+	}
+	// rate makes checks of different windows comparable
+	rate := float64(msg.Count) / float64(check.TimePeriod)
+	message += fmt.Sprintf(", %.2f/min", rate)
+	if breach != "" {
+		message += ", " + breach
+	}
+	// shards of missing indices are unknown, so they are not counted in
+	// total; resolved targets tell which indices were searched
+	if check.Search.IgnoreUnavailable {
+		message += fmt.Sprintf(", %d of %d shards searched", msg.Shards.Successful, msg.Shards.Total)
+	}
+	if msg.Resolved != nil {
+		message += fmt.Sprintf(" (%s)", msg.Resolved)
+	}
+	if messageTemplate != nil {
+		var err error
+		message, err = renderMessageTemplate(messageTemplate, MessageTemplateData{
+			Status:    status.String(),
+			Count:     msg.Count,
+			Rate:      rate,
+			Percent:   perc,
+			Query:     check.Query,
+			Window:    check.TimePeriod,
+			Warning:   check.Warning,
+			Threshold: check.Threshold,
+			Operator:  check.Operator,
+		})
+		if err != nil {
+			return newFailureResult(FailureInternal, fmt.Sprintf("output template: %v", err))
+		}
+	}
+	if check.Sparkline != "" && len(msg.Buckets) > 0 {
+		message += " " + sparkline(msg.Buckets, sparklineChars[check.Sparkline])
+	}
+	var zeroLines []string
+	if check.ExplainZero && msg.Count == 0 {
+		reason, err := c.getZeroCountReason(getIndexNames(indexOptions, time.Unix(timeFrom, 0), end), stats)
+		if err != nil {
+			zeroLines = append(zeroLines, fmt.Sprintf("index stats: %v", err))
+		} else {
+			message += ", " + reason
+		}
+	}
+	for _, u := range check.MinUnique {
+		if n := msg.Unique[u.Field]; n < u.Min {
+			status = nagiosplugin.CRITICAL
+			message += fmt.Sprintf(", only %d unique %s (minimum %d)", n, u.Field, u.Min)
+		}
+	}
+	var termLines []string
+	for _, t := range check.TermThresholds {
+		n := termCount(msg.Terms, t.Term)
+		termStatus := CountStatus(n, t.Warning, t.Critical, check.Operator)
+		if termStatus != nagiosplugin.OK {
+			message += fmt.Sprintf(", %d entries of %s %s", n, check.BreakdownField, t.Term)
+		}
+		// statuses are OK, WARNING or CRITICAL here, numeric order is severity
+		if termStatus > status {
+			status = termStatus
+		}
+		termLines = append(termLines, fmt.Sprintf("%s %s: %d %s", check.BreakdownField, t.Term, n, termStatus))
+	}
+	for _, f := range check.FilterThresholds {
+		n := msg.Filters[f.Name]
+		filterStatus := CountStatus(n, f.Warning, f.Critical, check.Operator)
+		if filterStatus != nagiosplugin.OK {
+			message += fmt.Sprintf(", %d %s entries", n, f.Name)
+		}
+		if filterStatus > status {
+			status = filterStatus
+		}
+		termLines = append(termLines, fmt.Sprintf("%s (%s): %d %s", f.Name, f.Query, n, filterStatus))
+	}
+	var lag *time.Duration
+	if (check.MaxLag > 0 || check.WarningLag > 0) && msg.Coverage.Min != nil && msg.Coverage.Max != nil {
+		oldest, _ := entryAge(*msg.Coverage.Min, time.Now())
+		newest, age := entryAge(*msg.Coverage.Max, time.Now())
+		lag = &age
+		lagStatus := nagiosplugin.OK
+		if check.MaxLag > 0 && age > check.MaxLag {
+			lagStatus = nagiosplugin.CRITICAL
+		} else if check.WarningLag > 0 && age > check.WarningLag {
+			lagStatus = nagiosplugin.WARNING
+		}
+		if lagStatus != nagiosplugin.OK {
+			message += fmt.Sprintf(", newest entry is %s old", age.Round(time.Second))
+		}
+		if lagStatus > status {
+			status = lagStatus
+		}
+		termLines = append(termLines, fmt.Sprintf("entries cover %s to %s, lag %s %s", oldest.UTC().Format(time.RFC3339), newest.UTC().Format(time.RFC3339), age.Round(time.Second), lagStatus))
+	}
+	if msg.Shards.Failed > 0 && check.ShardFailureStatus != "ignore" {
+		status = statusFromName(check.ShardFailureStatus)
+		message += fmt.Sprintf(", incomplete count: %d of %d shards failed", msg.Shards.Failed, msg.Shards.Total)
+	}
+	if msg.TimedOut && check.TimedOutStatus != "ignore" {
+		status = statusFromName(check.TimedOutStatus)
+		message += ", incomplete count: search timed out and returned partial results"
+	}
+	result := newCheckResult(status, message)
+	result.Count = &msg.Count
+	if !ok {
+		// cached search was profiled already
+		result.Profile = msg.Profile
+	}
+	if check.SumField != "" {
+		addValuePerfData(result, "sum", value, msg.Count, check.Warning, check.Threshold)
+	} else if check.Trend != "" {
+		p := PerfDatum{Label: "trend", Value: trend, Crit: floatPtr(float64(check.Threshold))}
+		if check.Warning != 0 {
+			p.Warn = floatPtr(float64(check.Warning))
+		}
+		result.AddPerfDatum(p)
+		result.AddPerfDatum(PerfDatum{Label: "count", Value: float64(msg.Count), Min: floatPtr(0)})
+	} else if check.PercentileField != "" {
+		addValuePerfData(result, "p"+strconv.FormatFloat(check.Percentile, 'f', -1, 64), value, msg.Count, check.Warning, check.Threshold)
+	} else {
+		addCountPerfData(result, msg.Count, check.Warning, check.Threshold, check.TimePeriod)
+	}
+	if check.Range != nil {
+		SetRangePerfData(result, check.Range, check.WarningRange)
+	}
+	for _, u := range check.MinUnique {
+		result.AddPerfDatum(PerfDatum{Label: "unique_" + u.Field, Value: float64(msg.Unique[u.Field]), Min: floatPtr(0)})
+	}
+	if lag != nil {
+		p := PerfDatum{Label: "lag", Unit: "s", Value: lag.Seconds(), Min: floatPtr(0)}
+		if check.WarningLag > 0 {
+			p.Warn = floatPtr(check.WarningLag.Seconds())
+		}
+		if check.MaxLag > 0 {
+			p.Crit = floatPtr(check.MaxLag.Seconds())
+		}
+		result.AddPerfDatum(p)
+	}
+	for _, f := range check.FilterThresholds {
+		p := PerfDatum{Label: "count_" + f.Name, Value: float64(msg.Filters[f.Name]), Crit: floatPtr(float64(f.Critical)), Min: floatPtr(0)}
+		if f.Warning != 0 {
+			p.Warn = floatPtr(float64(f.Warning))
+		}
+		result.AddPerfDatum(p)
+	}
+	for _, t := range check.TermThresholds {
+		p := PerfDatum{Label: "count_" + t.Term, Value: float64(termCount(msg.Terms, t.Term)), Crit: floatPtr(float64(t.Critical)), Min: floatPtr(0)}
+		if t.Warning != 0 {
+			p.Warn = floatPtr(float64(t.Warning))
+		}
+		result.AddPerfDatum(p)
+	}
+	if check.KibanaURL != "" {
+		// first long output line so it survives output truncation
+		link, err := getKibanaDiscoverURL(check.KibanaURL, check.KibanaIndexPatternID, query, time.Unix(timeFrom, 0), end)
+		if err != nil {
+			return newFailureResult(FailureInternal, fmt.Sprintf("%v", err))
+		}
+		result.LongOutput = append(result.LongOutput, "Kibana: "+link)
+		result.KibanaLink = link
+	}
+	result.LongOutput = append(result.LongOutput, termLines...)
+	result.LongOutput = append(result.LongOutput, zeroLines...)
+	addSearchStats(result, msg.Took, msg.Shards)
+	if ok {
+		result.LongOutput = append(result.LongOutput, fmt.Sprintf("cached result from %s ago", time.Since(cached).Round(time.Second)))
+	}
+	if check.ShowDeprecations {
+		for _, w := range msg.Warnings {
+			result.LongOutput = append(result.LongOutput, "Deprecation warning: "+w)
+		}
+	}
+	if check.Histogram {
+		result.Buckets = msg.Buckets
+		for _, b := range msg.Buckets {
+			result.LongOutput = append(result.LongOutput, fmt.Sprintf("%s: %d", time.Unix(b.Key/1000, 0).Format(bucketTimeFormat(check.BucketInterval)), b.DocCount))
+		}
+	}
+	if check.BreakdownField != "" && len(msg.Breakdown) > 0 {
+		result.Breakdown = msg.Breakdown
+		result.LongOutput = append(result.LongOutput, formatBreakdown(check.BreakdownField, msg.Breakdown, check.SamplerShardSize)...)
+	}
+	// extra search runs only when responders need a hint, failure of it
+	// doesn't change check result
+	if len(check.SignificantFields) > 0 && result.Status == nagiosplugin.CRITICAL {
+		terms, err := c.getSignificantTerms(check, timeFrom, pit, stats)
+		if err != nil {
+			result.LongOutput = append(result.LongOutput, fmt.Sprintf("significant terms: %v", err))
+		} else {
+			result.LongOutput = append(result.LongOutput, formatSignificantTerms(check.SignificantFields, terms)...)
+		}
+	}
+	if len(msg.Samples) > 0 && showSamples(result.Status, check.SamplesOn) {
+		// masked before any output, so PII doesn't reach notifications
+		result.Samples = mask.maskSamples(msg.Samples)
+		result.LongOutput = append(result.LongOutput, formatSamples(result.Samples, check.SampleFields, check.SampleMaxLen, check.SampleDedup)...)
+	}
+	return result
+}
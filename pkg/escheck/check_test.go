@@ -0,0 +1,989 @@
+package escheck
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestRunVersions(t *testing.T) {
+	tests := []struct {
+		dir            string
+		count          int
+		status         nagiosplugin.Status
+		intervalParam  string
+		trackTotalHits bool
+	}{
+		{"es2", 1532, nagiosplugin.CRITICAL, `"interval": "1h"`, false},
+		{"es6", 87, nagiosplugin.WARNING, `"interval": "1h"`, false},
+		{"es7", 25013, nagiosplugin.CRITICAL, `"fixed_interval": "1h"`, true},
+		{"es8", 4, nagiosplugin.OK, `"fixed_interval": "1h"`, true},
+		{"opensearch2", 4, nagiosplugin.OK, `"fixed_interval": "1h"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			es := newMockES(t, map[string][]mockResponse{
+				"GET /":                ok(tt.dir + "/root.json"),
+				"POST /logs-*/_search": ok(tt.dir + "/search.json"),
+			})
+
+			check := testCheck()
+			check.Histogram = true
+			result := newTestClient(es.URL).Run(check)
+			if result.Status != tt.status {
+				t.Errorf("status = %v, want %v: %s", result.Status, tt.status, result.Message)
+			}
+			if result.Count == nil || *result.Count != tt.count {
+				t.Fatalf("count = %v, want %d", result.Count, tt.count)
+			}
+
+			searches := es.received("POST", "/logs-*/_search")
+			if len(searches) != 1 {
+				t.Fatalf("%d search requests sent, want 1", len(searches))
+			}
+			body := searches[0].Body
+			if !strings.Contains(body, tt.intervalParam) {
+				t.Errorf("search body does not contain %s:\n%s", tt.intervalParam, body)
+			}
+			if got := strings.Contains(body, "track_total_hits"); got != tt.trackTotalHits {
+				t.Errorf("track_total_hits in search body = %v, want %v", got, tt.trackTotalHits)
+			}
+		})
+	}
+}
+
+func TestRunVersionDetectedOnce(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+
+	client := newTestClient(es.URL)
+	for i := 0; i < 3; i++ {
+		client.Run(testCheck())
+	}
+	if n := len(es.received("GET", "/")); n != 1 {
+		t.Errorf("version detected %d times, want 1", n)
+	}
+}
+
+func TestRunConfiguredVersion(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"POST /logs-*/_search": ok("es6/search.json"),
+	})
+
+	client := NewClient(ClientOptions{URLs: []string{es.URL}, Timeout: defaultTestTimeout, Version: "6.8"})
+	result := client.Run(testCheck())
+	if result.Status != nagiosplugin.WARNING {
+		t.Errorf("status = %v, want WARNING: %s", result.Status, result.Message)
+	}
+}
+
+func TestRunErrorResponses(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   mockResponse
+		message    string
+		httpStatus int
+	}{
+		{
+			"query parse error",
+			mockResponse{status: http.StatusBadRequest, file: "errors/query_parse.json"},
+			"HTTP response code: 400 Bad Request, query_shard_exception: Failed to parse query [level:(error] [index logs-app]",
+			400,
+		},
+		{
+			"missing index",
+			mockResponse{status: http.StatusNotFound, file: "errors/index_not_found.json"},
+			"HTTP response code: 404 Not Found, index_not_found_exception: no such index [logs-missing] [index logs-missing]",
+			404,
+		},
+		{
+			"string error of old versions",
+			mockResponse{status: http.StatusBadRequest, file: "errors/es1_string.json"},
+			"HTTP response code: 400 Bad Request, SearchPhaseExecutionException[Failed to execute phase [query], all shards failed]",
+			400,
+		},
+		{
+			"proxy error page",
+			mockResponse{status: http.StatusServiceUnavailable, file: "errors/unavailable.html", header: http.Header{"Content-Type": {"text/html"}}},
+			"HTTP response code: 503 Service Unavailable",
+			503,
+		},
+		{
+			"truncated body",
+			mockResponse{status: http.StatusOK, file: "search/truncated.json"},
+			"JSON parse failed",
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newMockES(t, map[string][]mockResponse{
+				"GET /":                ok("es7/root.json"),
+				"POST /logs-*/_search": {tt.response},
+			})
+
+			result := newTestClient(es.URL).Run(testCheck())
+			if result.Status != nagiosplugin.UNKNOWN {
+				t.Errorf("status = %v, want UNKNOWN", result.Status)
+			}
+			if !strings.HasPrefix(result.Message, tt.message) {
+				t.Errorf("message = %q, want prefix %q", result.Message, tt.message)
+			}
+			if result.HTTPStatus != tt.httpStatus {
+				t.Errorf("HTTP status = %d, want %d", result.HTTPStatus, tt.httpStatus)
+			}
+		})
+	}
+}
+
+func TestRunShardFailures(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es7/root.json"),
+		"POST /logs-*/_search": ok("search/shard_failures.json"),
+	})
+
+	result := newTestClient(es.URL).Run(testCheck())
+	if result.Status != nagiosplugin.WARNING {
+		t.Errorf("status = %v, want WARNING", result.Status)
+	}
+	if !strings.HasSuffix(result.Message, ", incomplete count: 1 of 3 shards failed") {
+		t.Errorf("unexpected message %q", result.Message)
+	}
+	want := "shard 2 of logs-app-000012 failed on node b8n1Vd7uR2yG1cLDJ0Kk8g: circuit_breaking_exception: [parent] Data too large"
+	if len(result.LongOutput) < 2 || !strings.HasPrefix(result.LongOutput[1], want) {
+		t.Errorf("long output %q does not contain shard failure", result.LongOutput)
+	}
+
+	check := testCheck()
+	check.ShardFailureStatus = "ignore"
+	result = newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.CRITICAL {
+		t.Errorf("status with ignored shard failures = %v, want CRITICAL", result.Status)
+	}
+}
+
+func TestRunTimedOut(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es7/root.json"),
+		"POST /logs-*/_search": ok("search/timed_out.json"),
+	})
+
+	result := newTestClient(es.URL).Run(testCheck())
+	if result.Status != nagiosplugin.UNKNOWN {
+		t.Errorf("status = %v, want UNKNOWN", result.Status)
+	}
+	if !strings.HasSuffix(result.Message, "search timed out and returned partial results") {
+		t.Errorf("unexpected message %q", result.Message)
+	}
+}
+
+func TestRunFailover(t *testing.T) {
+	down := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": {{status: http.StatusServiceUnavailable, file: "errors/unavailable.html"}},
+	})
+	up := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+
+	result := newTestClient(down.URL, up.URL).Run(testCheck())
+	if result.Status != nagiosplugin.OK {
+		t.Errorf("status = %v, want OK: %s", result.Status, result.Message)
+	}
+	if n := len(up.received("POST", "/logs-*/_search")); n != 1 {
+		t.Errorf("%d searches sent to second URL, want 1", n)
+	}
+}
+
+func TestRunFailureKinds(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// accepted connections are never answered
+	defer listener.Close()
+
+	invalid := testCheck()
+	invalid.Operator = "eq"
+	tests := []struct {
+		name   string
+		client *Client
+		check  Check
+		want   Failure
+	}{
+		{"invalid check", newTestClient("http://127.0.0.1:1"), invalid, FailureInternal},
+		{"unreachable", newTestClient("http://127.0.0.1:1"), testCheck(), FailureElasticsearch},
+		{"timeout", NewClient(ClientOptions{URLs: []string{"http://" + listener.Addr().String()}, Timeout: 100 * time.Millisecond, Version: "8.11.0"}), testCheck(), FailureTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.client.Run(tt.check)
+			if result.Status != nagiosplugin.UNKNOWN || result.Failure != tt.want {
+				t.Errorf("result = %v failure %q (%s), want UNKNOWN failure %q", result.Status, result.Failure, result.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /": ok("es8/root.json"),
+		"POST /logs-*/_search": {
+			{status: http.StatusBadGateway},
+			{status: http.StatusOK, file: "es8/search.json"},
+		},
+	})
+
+	client := NewClient(ClientOptions{URLs: []string{es.URL}, Timeout: defaultTestTimeout, Retries: 1, RetryDelay: 1})
+	result := client.Run(testCheck())
+	if result.Status != nagiosplugin.OK {
+		t.Errorf("status = %v, want OK: %s", result.Status, result.Message)
+	}
+	if s := result.Requests; s == nil || s.Requests != 3 || s.Retries != 1 || s.MaxLatency <= 0 {
+		t.Errorf("request stats = %+v, want 3 requests with 1 retry", s)
+	}
+}
+
+func TestRunIndexExists(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /_cat/shards/logs-*": ok("cat/shards_unassigned.json"),
+	})
+
+	check := testCheck()
+	check.CheckIndexExists = true
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.CRITICAL || result.Message != "index has no started shards: logs-*" {
+		t.Errorf("result = %v %q, want CRITICAL for unassigned shards", result.Status, result.Message)
+	}
+}
+
+func TestRunResultCache(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	client := NewClient(ClientOptions{
+		URLs:     []string{es.URL},
+		Timeout:  defaultTestTimeout,
+		Cache:    &FileResultCache{Dir: t.TempDir()},
+		CacheTTL: time.Minute,
+	})
+
+	first := client.Run(testCheck())
+	check := testCheck()
+	check.Threshold = 10
+	second := client.Run(check)
+	if n := len(es.received("POST", "/logs-*/_search")); n != 1 {
+		t.Errorf("%d searches sent, want 1 with second run served from cache", n)
+	}
+	if first.Count == nil || second.Count == nil || *first.Count != *second.Count {
+		t.Errorf("counts = %v, %v, want the same cached count", first.Count, second.Count)
+	}
+
+	check.TimePeriod = 15
+	client.Run(check)
+	if n := len(es.received("POST", "/logs-*/_search")); n != 2 {
+		t.Errorf("%d searches sent, want different window not served from cache", n)
+	}
+}
+
+func TestRunMinUnique(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/unique.json"),
+	})
+
+	check := testCheck()
+	check.MinUnique = []UniqueCondition{{Field: "host.name", Min: 10}, {Field: "service.name", Min: 5}}
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.CRITICAL || !strings.HasSuffix(result.Message, ", only 3 unique host.name (minimum 10)") {
+		t.Errorf("result = %v %q, want CRITICAL for too few hosts", result.Status, result.Message)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !json.Valid([]byte(body)) || !strings.Contains(body, `"service.name": {`) {
+		t.Errorf("search body has no valid cardinality aggregation of service.name:\n%s", body)
+	}
+}
+
+func TestRunSumField(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/sum.json"),
+	})
+
+	check := testCheck()
+	check.SumField = "network.bytes"
+	check.Operator = "gt"
+	check.Warning, check.Threshold = 8<<30, 4<<30
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.WARNING || result.Message != "sum of network.bytes is 5368709120 (125.00%) in 40 entries of 'level:error' found in the past 60 minutes, 0.67/min" {
+		t.Errorf("result = %v %q, want WARNING for sum below warning threshold", result.Status, result.Message)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !strings.Contains(body, `"field": "network.bytes"`) {
+		t.Errorf("search body has no sum aggregation of network.bytes:\n%s", body)
+	}
+}
+
+func TestRunPercentileField(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/percentiles.json"),
+	})
+
+	check := testCheck()
+	check.PercentileField = "event.duration"
+	check.Percentile = 95
+	check.Warning, check.Threshold = 1000, 2000
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.WARNING || result.Message != "95th percentile of event.duration is 1843 (92.15%) in 40 entries of 'level:error' found in the past 60 minutes, 0.67/min" {
+		t.Errorf("result = %v %q, want WARNING for latency over warning threshold", result.Status, result.Message)
+	}
+	if result.PerfData[0].Label != "p95" {
+		t.Errorf("first perfdata = %+v, want p95", result.PerfData[0])
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !strings.Contains(body, `"percents": [95]`) {
+		t.Errorf("search body has no 95th percentile aggregation:\n%s", body)
+	}
+}
+
+func TestRunTermThresholds(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/terms.json"),
+	})
+
+	check := testCheck()
+	check.Operator = "gt"
+	check.Warning, check.Threshold = 0, 1
+	check.BreakdownField = "datacenter"
+	check.BreakdownSize = 5
+	check.TermThresholds = []TermThreshold{
+		{Term: "dc1", Critical: 50},
+		{Term: "dc2", Warning: 20, Critical: 10},
+		{Term: "dc3", Critical: 1},
+	}
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.CRITICAL || !strings.HasSuffix(result.Message, ", 12 entries of datacenter dc2, 0 entries of datacenter dc3") {
+		t.Errorf("result = %v %q, want CRITICAL for missing dc3", result.Status, result.Message)
+	}
+	if want := "datacenter dc2: 12 WARNING"; result.LongOutput[1] != want {
+		t.Errorf("long output = %q, want %q", result.LongOutput, want)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !json.Valid([]byte(body)) || !strings.Contains(body, `"include": ["dc1","dc2","dc3"]`) {
+		t.Errorf("search body does not count terms exactly:\n%s", body)
+	}
+}
+
+func TestRunFilterThresholds(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/filters.json"),
+	})
+
+	check := testCheck()
+	check.Operator = "lt"
+	check.FilterThresholds = []FilterThreshold{
+		{Name: "errors", Query: "level:error", Warning: 10, Critical: 50},
+		{Name: "timeouts", Query: `message:"timed out"`, Critical: 5},
+	}
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.WARNING || !strings.HasSuffix(result.Message, ", 31 errors entries") {
+		t.Errorf("result = %v %q, want WARNING for errors filter", result.Status, result.Message)
+	}
+	if want := `timeouts (message:"timed out"): 4 OK`; result.LongOutput[1] != want {
+		t.Errorf("long output = %q, want %q", result.LongOutput, want)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	var parsed struct {
+		Aggs struct {
+			Filters struct {
+				Filters struct {
+					Filters map[string]struct {
+						QueryString struct {
+							Query string `json:"query"`
+						} `json:"query_string"`
+					} `json:"filters"`
+				} `json:"filters"`
+			} `json:"filters"`
+		} `json:"aggs"`
+	}
+	if err := json.Unmarshal([]byte(body), &parsed); err != nil {
+		t.Fatalf("search body is not valid JSON: %v\n%s", err, body)
+	}
+	if q := parsed.Aggs.Filters.Filters.Filters["timeouts"].QueryString.Query; q != `message:"timed out"` {
+		t.Errorf("timeouts filter query = %q, want quoted phrase", q)
+	}
+}
+
+func TestRunMaxLag(t *testing.T) {
+	newest := time.Date(2023, 3, 1, 8, 45, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		maxLag time.Duration
+		status nagiosplugin.Status
+	}{
+		{"lagging", time.Hour, nagiosplugin.CRITICAL},
+		{"within lag", time.Since(newest) + time.Hour, nagiosplugin.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newMockES(t, map[string][]mockResponse{
+				"GET /":                ok("es8/root.json"),
+				"POST /logs-*/_search": ok("search/coverage.json"),
+			})
+
+			check := testCheck()
+			check.MaxLag = tt.maxLag
+			result := newTestClient(es.URL).Run(check)
+			if result.Status != tt.status {
+				t.Errorf("status = %v, want %v: %s", result.Status, tt.status, result.Message)
+			}
+			if lagging := strings.Contains(result.Message, ", newest entry is "); lagging != (tt.status == nagiosplugin.CRITICAL) {
+				t.Errorf("message = %q, want lag reported only when lagging", result.Message)
+			}
+			if !strings.HasPrefix(result.LongOutput[0], "entries cover 2023-03-01T08:00:00Z to 2023-03-01T08:45:00Z, lag ") {
+				t.Errorf("long output = %q, want coverage of entries", result.LongOutput)
+			}
+
+			body := es.received("POST", "/logs-*/_search")[0].Body
+			if !strings.Contains(body, `"stats": {`) {
+				t.Errorf("search body has no stats aggregation of @timestamp:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestRunBreakdownSampler(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/sampler.json"),
+	})
+
+	check := testCheck()
+	check.BreakdownField = "host.name"
+	check.BreakdownSize = 2
+	check.SamplerShardSize = 100
+	result := newTestClient(es.URL).Run(check)
+	want := "Top host.name in sample of 100 entries per shard:\nweb-3: 220\nweb-1: 68"
+	if long := strings.Join(result.LongOutput, "\n"); !strings.HasSuffix(long, want) {
+		t.Errorf("long output = %q, want sampled breakdown", long)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !json.Valid([]byte(body)) || !strings.Contains(body, `"shard_size": 100`) {
+		t.Errorf("search body has no sampler aggregation:\n%s", body)
+	}
+}
+
+func TestRunProfile(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/profile.json"),
+	})
+
+	check := testCheck()
+	check.Profile = true
+	result := newTestClient(es.URL).Run(check)
+	if !strings.Contains(string(result.Profile), `"time_in_nanos" : 1873452`) {
+		t.Errorf("profile = %s, want search profile", result.Profile)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !json.Valid([]byte(body)) || !strings.Contains(body, `"profile": true`) {
+		t.Errorf("search body has no profile option:\n%s", body)
+	}
+}
+
+func TestRunTrend(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/trend.json"),
+	})
+
+	check := testCheck()
+	check.Operator = "gt"
+	check.Warning, check.Threshold = 20, 10
+	check.Trend = "moving-avg"
+	check.TrendWindow = 2
+	check.TrendInterval = time.Minute
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.WARNING || result.Message != "moving average of 1m0s bucket counts is 14.00 (140.00%) in 40 entries of 'level:error' found in the past 60 minutes, 0.67/min" {
+		t.Errorf("result = %v %q, want WARNING for trend of the last bucket", result.Status, result.Message)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !json.Valid([]byte(body)) || !strings.Contains(body, `"fixed_interval": "60000ms"`) || !strings.Contains(body, `"window": 2`) {
+		t.Errorf("search body has no moving function over 1m buckets:\n%s", body)
+	}
+}
+
+func TestLastTrend(t *testing.T) {
+	minute := int64(time.Minute / time.Millisecond)
+	value := func(v float64) *MetricValue { return &MetricValue{Value: &v} }
+	buckets := []HistogramBucket{
+		{Key: 0, Trend: &MetricValue{}},
+		{Key: minute, Trend: value(3)},
+		{Key: 2 * minute, Trend: value(5)},
+	}
+	if got := lastTrend(buckets, time.Minute, time.Unix(150, 0)); got == nil || *got != 3 {
+		t.Errorf("lastTrend() = %v, want 3 from the last complete bucket", got)
+	}
+	if got := lastTrend(buckets, time.Minute, time.Unix(90, 0)); got != nil {
+		t.Errorf("lastTrend() = %v, want nil for bucket without trend", *got)
+	}
+}
+
+func TestRunSignificantTerms(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /": ok("es8/root.json"),
+		"POST /logs-*/_search": {
+			{status: http.StatusOK, file: "search/sum.json"},
+			{status: http.StatusOK, file: "search/significant.json"},
+		},
+	})
+
+	check := testCheck()
+	check.Warning, check.Threshold = 0, 30
+	check.SignificantFields = []string{"service.name", "host.name"}
+	check.SignificantBackground = 24 * time.Hour
+	check.SignificantSize = 3
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.CRITICAL {
+		t.Fatalf("status = %v, want CRITICAL: %s", result.Status, result.Message)
+	}
+	long := strings.Join(result.LongOutput, "\n")
+	if !strings.HasSuffix(long, "Significant host.name:\nweb-3: 31 entries, 120 in background") {
+		t.Errorf("long output = %q, want significant host.name values", long)
+	}
+
+	requests := es.received("POST", "/logs-*/_search")
+	if len(requests) != 2 {
+		t.Fatalf("got %d searches, want count and significant terms searches", len(requests))
+	}
+	var body struct {
+		Aggs struct {
+			Significant struct {
+				Aggs map[string]struct {
+					SignificantTerms struct {
+						Field            string `json:"field"`
+						Size             int    `json:"size"`
+						BackgroundFilter struct {
+							Range map[string]struct {
+								Gte int64 `json:"gte"`
+								Lt  int64 `json:"lt"`
+							} `json:"range"`
+						} `json:"background_filter"`
+					} `json:"significant_terms"`
+				} `json:"aggs"`
+			} `json:"significant"`
+		} `json:"aggs"`
+	}
+	if err := json.Unmarshal([]byte(requests[1].Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	agg := body.Aggs.Significant.Aggs["host.name"].SignificantTerms
+	background := agg.BackgroundFilter.Range["@timestamp"]
+	if agg.Field != "host.name" || agg.Size != 3 || background.Lt-background.Gte != (24*time.Hour).Milliseconds() {
+		t.Errorf("significant terms aggregation = %+v, want host.name with 24h background", agg)
+	}
+}
+
+func TestRunWithoutHistogram(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+
+	newTestClient(es.URL).Run(testCheck())
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !json.Valid([]byte(body)) || strings.Contains(body, `"aggs"`) {
+		t.Errorf("search body of plain count has aggregations:\n%s", body)
+	}
+}
+
+func TestRunRequestCache(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	client := newTestClient(es.URL)
+
+	client.Run(testCheck())
+	check := testCheck()
+	check.Search.RequestCache = "false"
+	client.Run(check)
+
+	reqs := es.received("POST", "/logs-*/_search")
+	if _, ok := reqs[0].Query["request_cache"]; ok {
+		t.Errorf("request_cache = %q, want index setting kept", reqs[0].Query.Get("request_cache"))
+	}
+	if got := reqs[1].Query.Get("request_cache"); got != "false" {
+		t.Errorf("request_cache = %q, want false", got)
+	}
+}
+
+func TestTimestampBound(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 7, 42, 250*int(time.Millisecond), time.UTC)
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", "1714565262250"},
+		{"epoch_second", "1714565262"},
+		{"strict_date_optional_time", `"2024-05-01T12:07:42.250Z"`},
+		{"yyyy-MM-dd HH:mm:ss", `"2024-05-01 12:07:42"`},
+		{"dd/MM/yyyy'T'HH:mm:ss.SSSXXX||epoch_millis", `"01/05/2024T12:07:42.250Z"`},
+	}
+	for _, tt := range tests {
+		if got, err := timestampBound(tt.format, ts); err != nil || got != tt.want {
+			t.Errorf("timestampBound(%q) = %s, %v, want %s", tt.format, got, err, tt.want)
+		}
+	}
+	for _, format := range []string{"basic_week_date", "yyyy-MM-dd EEE"} {
+		if _, err := timestampBound(format, ts); err == nil {
+			t.Errorf("timestampBound(%q) succeeded, want error", format)
+		}
+	}
+}
+
+func TestRunTimestampFormat(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	check := testCheck()
+	check.TimestampFormat = "strict_date_optional_time"
+
+	newTestClient(es.URL).Run(check)
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !json.Valid([]byte(body)) || !strings.Contains(body, `"format": "strict_date_optional_time"`) || strings.Contains(body, "epoch_millis") {
+		t.Errorf("search body should have ISO 8601 range bounds:\n%s", body)
+	}
+}
+
+func TestRunFieldFilters(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	check := testCheck()
+	check.FieldFilters = []FieldFilter{
+		{Field: "log.level", Values: []string{"error", "critical"}},
+		{Field: "host.name", Values: []string{"web01"}},
+	}
+
+	result := newTestClient(es.URL).Run(check)
+	if want := `entries of '(level:error) AND log.level:("error" OR "critical") AND host.name:("web01")'`; !strings.Contains(result.Message, want) {
+		t.Errorf("message = %q, want it to contain %q", result.Message, want)
+	}
+	var body struct {
+		Query struct {
+			Bool struct {
+				Must []map[string]json.RawMessage `json:"must"`
+			} `json:"bool"`
+		} `json:"query"`
+	}
+	if err := json.Unmarshal([]byte(es.received("POST", "/logs-*/_search")[0].Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	must := body.Query.Bool.Must
+	if len(must) != 4 || string(must[2]["terms"]) != `{"log.level":["error","critical"]}` || string(must[3]["term"]) != `{"host.name":"web01"}` {
+		t.Errorf("must clauses = %v, want terms and term filters after range", must)
+	}
+}
+
+func TestCheckWindow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 7, 42, 0, time.UTC)
+	check := testCheck()
+
+	if from, to, end := checkWindow(check, now); to != 0 || !end.Equal(now) || from != now.Unix()-3600 {
+		t.Errorf("checkWindow() = %d, %d, %v, want window ending now", from, to, end)
+	}
+
+	check.Align = true
+	want := time.Date(2024, 5, 1, 12, 7, 0, 0, time.UTC)
+	if from, to, _ := checkWindow(check, now); to != want.Unix() || from != want.Unix()-3600 {
+		t.Errorf("checkWindow() = %d, %d, want window ending at %v", from, to, want)
+	}
+
+	check.Histogram = true
+	check.BucketInterval = 5 * time.Minute
+	want = time.Date(2024, 5, 1, 12, 5, 0, 0, time.UTC)
+	if _, to, _ := checkWindow(check, now); to != want.Unix() {
+		t.Errorf("checkWindow() ends at %d, want %v", to, want)
+	}
+}
+
+func TestRunAlign(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	check := testCheck()
+	check.Align = true
+	check.Histogram = true
+	check.BucketInterval = time.Minute
+
+	newTestClient(es.URL).Run(check)
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !json.Valid([]byte(body)) || strings.Contains(body, `"now"`) || !strings.Contains(body, `"lt": `) {
+		t.Errorf("search body of aligned window should end before whole minute:\n%s", body)
+	}
+}
+
+func TestFormatSamples(t *testing.T) {
+	samples := []json.RawMessage{json.RawMessage(`{"message":"panic: runtime error\n\tat main.go:42","host":{"name":"web01"}}`)}
+
+	got := formatSamples(samples, []string{"message", "host.name"}, 14, true)
+	want := []string{"Sample documents:", "message=panic: runtime... host.name=web01"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("formatSamples() = %q, want %q", got, want)
+	}
+
+	got = formatSamples(samples, nil, 10, true)
+	if want := `{"message"...`; len(got) != 2 || got[1] != want {
+		t.Errorf("formatSamples() without fields = %q, want document cut to %q", got, want)
+	}
+}
+
+func TestFormatSamplesDedup(t *testing.T) {
+	samples := []json.RawMessage{
+		json.RawMessage(`{"message":"timeout after 3001 ms","trace":"a3f9c0d1"}`),
+		json.RawMessage(`{"message":"connection refused"}`),
+		json.RawMessage(`{"message":"timeout after 3017 ms","trace":"0b77e412"}`),
+		json.RawMessage(`{"message":"timeout after 2998 ms","trace":"ffe01c9a"}`),
+	}
+
+	got := formatSamples(samples, []string{"message", "trace"}, 0, true)
+	want := []string{
+		"Sample documents (2 unique of 4):",
+		"message=timeout after 3001 ms trace=a3f9c0d1 (3 times)",
+		"message=connection refused",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("formatSamples() = %q, want %q", got, want)
+	}
+
+	if got := formatSamples(samples, []string{"message"}, 0, false); len(got) != 5 || got[0] != "Sample documents:" {
+		t.Errorf("formatSamples() without dedup = %q, want every sample", got)
+	}
+}
+
+func TestMaskSamples(t *testing.T) {
+	mask, err := newSampleMask([]string{"user.token"}, []string{`[\w.]+@[\w.]+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := []json.RawMessage{json.RawMessage(`{"message":"login of jane@example.com failed","user":{"token":"abc123","id":42}}`)}
+	want := `{"message":"login of *** failed","user":{"id":42,"token":"***"}}`
+	if got := mask.maskSamples(samples); string(got[0]) != want {
+		t.Errorf("maskSamples() = %s, want %s", got[0], want)
+	}
+
+	if _, err := newSampleMask(nil, []string{"("}); err == nil {
+		t.Error("newSampleMask() of invalid pattern succeeded, want error")
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	buckets := []HistogramBucket{{DocCount: 0}, {DocCount: 7}, {DocCount: 14}, {DocCount: 3}}
+	if got := sparkline(buckets, sparklineChars["unicode"]); got != "▁▄█▂" {
+		t.Errorf("sparkline() = %q, want %q", got, "▁▄█▂")
+	}
+	if got := sparkline(buckets[:1], sparklineChars["ascii"]); got != "_" {
+		t.Errorf("sparkline() of empty bucket = %q, want %q", got, "_")
+	}
+}
+
+func TestAutoBucketInterval(t *testing.T) {
+	tests := []struct {
+		period time.Duration
+		want   time.Duration
+	}{
+		{5 * time.Minute, 30 * time.Second},
+		{time.Hour, 5 * time.Minute},
+		{24 * time.Hour, 3 * time.Hour},
+		{30 * 24 * time.Hour, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := AutoBucketInterval(tt.period); got != tt.want {
+			t.Errorf("AutoBucketInterval(%s) = %s, want %s", tt.period, got, tt.want)
+		}
+	}
+}
+
+func TestRunExplainZero(t *testing.T) {
+	tests := []struct {
+		name    string
+		indices []mockResponse
+		want    string
+	}{
+		{"missing", []mockResponse{{status: http.StatusNotFound, file: "errors/index_not_found.json"}}, ", no index exists for logs-*"},
+		{"not matching", ok("cat/indices_1.json"), ", 124000 documents in 2 indices don't match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newMockES(t, map[string][]mockResponse{
+				"GET /":                    ok("es8/root.json"),
+				"POST /logs-*/_search":     ok("search/freshness_empty.json"),
+				"GET /_cat/indices/logs-*": tt.indices,
+			})
+			check := testCheck()
+			check.ExplainZero = true
+			result := newTestClient(es.URL).Run(check)
+			if !strings.Contains(result.Message, tt.want) {
+				t.Errorf("message = %q, want it to contain %q", result.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunRequestHeaders(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	client := NewClient(ClientOptions{
+		URLs:      []string{es.URL},
+		Timeout:   defaultTestTimeout,
+		UserAgent: "check-es-logs-count/0.10",
+		OpaqueID:  "check-es-logs-count@nagios01",
+	})
+	client.Run(testCheck())
+
+	for _, req := range append(es.received("GET", "/"), es.received("POST", "/logs-*/_search")...) {
+		if got := req.Header.Get("User-Agent"); got != "check-es-logs-count/0.10" {
+			t.Errorf("User-Agent = %q, want check-es-logs-count/0.10", got)
+		}
+		if got := req.Header.Get("X-Opaque-Id"); got != "check-es-logs-count@nagios01" {
+			t.Errorf("X-Opaque-Id = %q, want check-es-logs-count@nagios01", got)
+		}
+	}
+}
+
+func TestRunCheckOpaqueID(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	client := NewClient(ClientOptions{
+		URLs:     []string{es.URL},
+		Timeout:  defaultTestTimeout,
+		OpaqueID: "check-es-logs-count@nagios01",
+	})
+	check := testCheck()
+	check.OpaqueID = "check-es-logs-count/payments@nagios01"
+	client.Run(check)
+
+	for _, req := range append(es.received("GET", "/"), es.received("POST", "/logs-*/_search")...) {
+		if got := req.Header.Get("X-Opaque-Id"); got != "check-es-logs-count/payments@nagios01" {
+			t.Errorf("X-Opaque-Id = %q, want id of check", got)
+		}
+	}
+}
+
+func TestRunFollowRedirects(t *testing.T) {
+	routes := func() map[string][]mockResponse {
+		return map[string][]mockResponse{
+			"GET /": ok("es8/root.json"),
+			"POST /logs-*/_search": {
+				{status: http.StatusFound, header: http.Header{"Location": {"/active/logs-%2A/_search"}}},
+			},
+			"POST /active/logs-*/_search": ok("es8/search.json"),
+		}
+	}
+
+	es := newMockES(t, routes())
+	client := NewClient(ClientOptions{
+		URLs:         []string{strings.Replace(es.URL, "http://", "http://user:pass@", 1)},
+		Timeout:      defaultTestTimeout,
+		MaxRedirects: 1,
+	})
+	result := client.Run(testCheck())
+	if result.Failure != "" {
+		t.Fatalf("result = %s, want redirect followed", result.Message)
+	}
+	original, redirected := es.received("POST", "/logs-*/_search")[0], es.received("POST", "/active/logs-*/_search")
+	if len(redirected) != 1 || redirected[0].Body != original.Body {
+		t.Fatalf("redirected requests = %+v, want POST with the same body", redirected)
+	}
+	if got := redirected[0].Header.Get("Authorization"); got != original.Header.Get("Authorization") || got == "" {
+		t.Errorf("Authorization = %q, want credentials kept", got)
+	}
+
+	es = newMockES(t, routes())
+	result = newTestClient(es.URL).Run(testCheck())
+	if !strings.HasPrefix(result.Message, "HTTP response code: 302 Found") {
+		t.Errorf("message = %q, want redirect not followed", result.Message)
+	}
+}
+
+func TestRunFollowRedirectsDowngrade(t *testing.T) {
+	plain := newMockES(t, map[string][]mockResponse{
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	es := newTLSMockES(t, map[string][]mockResponse{
+		"GET /": ok("es8/root.json"),
+		"POST /logs-*/_search": {
+			{status: http.StatusFound, header: http.Header{"Location": {plain.URL + "/logs-%2A/_search"}}},
+		},
+	})
+
+	client := NewClient(ClientOptions{
+		URLs:         []string{strings.Replace(es.URL, "https://", "https://user:pass@", 1)},
+		Timeout:      defaultTestTimeout,
+		MaxRedirects: 1,
+		Transport:    TransportOptions{TLSConfig: &tls.Config{InsecureSkipVerify: true}},
+	})
+	result := client.Run(testCheck())
+	if result.Status != nagiosplugin.UNKNOWN || !strings.Contains(result.Message, "refusing redirect from https to http://") {
+		t.Errorf("result = %v %q, want redirect to plain http refused", result.Status, result.Message)
+	}
+	// credentials never reach plain http target
+	for _, r := range plain.received("POST", "/logs-*/_search") {
+		t.Errorf("plain http target received request with Authorization %q", r.Header.Get("Authorization"))
+	}
+}
+
+func TestRunRetryPartial(t *testing.T) {
+	routes := func() map[string][]mockResponse {
+		return map[string][]mockResponse{
+			"GET /":                ok("es7/root.json"),
+			"POST /logs-*/_search": append(ok("search/shard_failures.json"), ok("es8/search.json")...),
+		}
+	}
+
+	es := newMockES(t, routes())
+	check := testCheck()
+	check.RetryPartial = true
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.OK {
+		t.Errorf("status = %v %q, want OK of retried search", result.Status, result.Message)
+	}
+	if n := len(es.received("POST", "/logs-*/_search")); n != 2 {
+		t.Errorf("searches = %d, want 2", n)
+	}
+
+	es = newMockES(t, routes())
+	result = newTestClient(es.URL).Run(testCheck())
+	if result.Status != nagiosplugin.WARNING {
+		t.Errorf("status = %v, want WARNING of partial result without retry", result.Status)
+	}
+}
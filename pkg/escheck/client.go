@@ -0,0 +1,683 @@
+package escheck
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errResponseTooLarge is returned when response exceeds MaxResponseBytes,
+// such request is not retried as other nodes would return the same
+var errResponseTooLarge = errors.New("response body too large")
+
+// Logf : function receiving debug messages, nil discards them
+type Logf func(format string, args ...interface{})
+
+func (f Logf) debugf(format string, args ...interface{}) {
+	if f != nil {
+		f(format, args...)
+	}
+}
+
+// Doer : interface of HTTP client sending elasticsearch requests, satisfied
+// by *http.Client
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// TransportOptions : struct containts connection settings of HTTP transport
+type TransportOptions struct {
+	ConnectTimeout time.Duration
+	Compression    bool
+	ForceHTTP1     bool
+	Resolver       string
+	IPFamily       string
+	UnixSocket     string
+	TLSConfig      *tls.Config
+}
+
+// RequestOptions : struct containts limits of single HTTP request
+type RequestOptions struct {
+	Timeout          time.Duration
+	MaxResponseBytes int64
+	Debugf           Logf
+}
+
+// BreakerOptions : struct containts circuit breaker settings, breaker is
+// disabled unless both Store and Threshold are set
+type BreakerOptions struct {
+	Store     StateStore
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// ClientOptions : struct containts elasticsearch cluster connection settings
+type ClientOptions struct {
+	URLs             []string
+	URLSelection     string
+	Sniff            bool
+	SniffInterval    time.Duration
+	Timeout          time.Duration
+	RequestTimeout   time.Duration
+	Retries          int
+	RetryDelay       time.Duration
+	MaxResponseBytes int64
+	CompressRequest  bool
+	CompatibleWith   int
+	Version          string
+	Distribution     string
+	Transport        TransportOptions
+	Breaker          BreakerOptions
+	Debugf           Logf
+	// HTTPClient sends requests instead of client built from Transport
+	// when set, eg.: to record or replay responses
+	HTTPClient Doer
+	// Discovery finds nodes to query instead of URLs, the first URL still
+	// gives scheme and credentials
+	Discovery         Discoverer
+	DiscoveryInterval time.Duration
+	// Cache shares search results of checks differing only in thresholds
+	// for CacheTTL
+	Cache    ResultCache
+	CacheTTL time.Duration
+	// Context is parent of every request, cancelling it aborts check in
+	// progress
+	Context context.Context
+	// UserAgent is sent with elasticsearch requests, empty keeps Go default
+	UserAgent string
+	// OpaqueID is sent as X-Opaque-Id header so slow logs and tasks API
+	// attribute requests to the check
+	OpaqueID string
+	// Trace is span of check execution, every request is sent with
+	// traceparent header of its own child span recorded in RequestStats
+	Trace *TraceContext
+	// MaxRedirects is number of redirects followed with the same method,
+	// body and headers, redirect responses are returned as they are when 0
+	MaxRedirects int
+	// Limiter limits requests of all clients sharing it, nil doesn't limit
+	Limiter *RequestLimiter
+}
+
+// Client : struct containts elasticsearch client, it is meant to be shared
+// between check runs so TCP connections, TLS sessions, discovered nodes and
+// detected versions are reused
+type Client struct {
+	opts       ClientOptions
+	http       Doer
+	roundRobin uint64
+
+	sniffed struct {
+		sync.Mutex
+		urls      []string
+		refreshed time.Time
+	}
+	discovered struct {
+		sync.Mutex
+		urls      []string
+		refreshed time.Time
+	}
+	versions struct {
+		sync.Mutex
+		versions map[string]*ESVersion
+	}
+}
+
+// NewClient returns client for elasticsearch cluster reachable via opts.URLs
+func NewClient(opts ClientOptions) *Client {
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{
+			Transport: NewTransport(opts.Transport),
+			// redirects are followed by followRedirects, net/http would
+			// turn POST into GET and drop credentials
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	return &Client{
+		opts: opts,
+		http: client,
+		// seeded randomly so separate one-shot runs don't all start with
+		// the same node
+		roundRobin: uint64(rand.Int63()),
+	}
+}
+
+func (c *Client) debugf(format string, args ...interface{}) {
+	c.opts.Debugf.debugf(format, args...)
+}
+
+func (c *Client) requestOptions() RequestOptions {
+	return RequestOptions{
+		Timeout:          c.opts.RequestTimeout,
+		MaxResponseBytes: c.opts.MaxResponseBytes,
+		Debugf:           c.opts.Debugf,
+	}
+}
+
+// newTimeoutContext returns context cancelled after overall timeout of the
+// check
+func (c *Client) newTimeoutContext() (context.Context, context.CancelFunc) {
+	parent := c.opts.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	return context.WithTimeout(parent, c.opts.Timeout)
+}
+
+// NewTransport returns transport with ConnectTimeout applied to dialing and
+// TLS handshake
+func NewTransport(opts TransportOptions) *http.Transport {
+	tlsConfig := opts.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ClientSessionCache == nil {
+		// resume TLS sessions when new connection to the same node is needed
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   opts.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if opts.Resolver != "" {
+		dialer.Resolver = newResolver(opts.Resolver, opts.ConnectTimeout)
+	}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if opts.IPFamily != "" && opts.IPFamily != "any" && network == "tcp" {
+			network = "tcp" + opts.IPFamily
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	if opts.UnixSocket != "" {
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", opts.UnixSocket)
+		}
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dial,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		DisableCompression:    !opts.Compression,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		// custom dialer disables HTTP/2 unless explicitly requested
+		ForceAttemptHTTP2: !opts.ForceHTTP1,
+	}
+	if opts.ForceHTTP1 {
+		// non-nil empty map disables HTTP/2 upgrade
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
+
+// newResolver returns resolver sending all DNS queries to given server
+func newResolver(server string, timeout time.Duration) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: timeout}
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// limitReader fails with errResponseTooLarge once more than remaining
+// bytes are read
+type limitReader struct {
+	r         io.Reader
+	remaining int64
+	limit     int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), fmt.Errorf("%w (over %d bytes), reduce --samples or aggregation sizes or raise --max-response-bytes", errResponseTooLarge, l.limit)
+	}
+	return n, err
+}
+
+// responseBody limits response size and releases per request timeout
+// context when closed
+type responseBody struct {
+	reader  io.Reader
+	body    io.Closer
+	parent  context.Context
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = requestError(b.parent, b.ctx, b.timeout, err)
+	}
+	return n, err
+}
+
+func (b *responseBody) Close() error {
+	err := b.body.Close()
+	b.cancel()
+	return err
+}
+
+// openRequest sends request bound to ctx and returns response with open
+// body limited to MaxResponseBytes (0 means unlimited), caller has to close
+// the body
+func openRequest(ctx context.Context, client Doer, method, rawURL string, header http.Header, body string, opts RequestOptions) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+		if header.Get("Content-Encoding") == "gzip" {
+			compressed, err := gzipString(body)
+			if err != nil {
+				return nil, err
+			}
+			reqBody = bytes.NewReader(compressed)
+		}
+	}
+	parent := ctx
+	cancel := context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reqBody)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	debugRequest(opts.Debugf, method, rawURL, req.Header, body)
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		err = requestError(parent, ctx, opts.Timeout, err)
+		opts.Debugf.debugf("< error: %v", err)
+		return nil, err
+	}
+	var reader io.Reader = resp.Body
+	if opts.MaxResponseBytes > 0 {
+		reader = &limitReader{r: resp.Body, remaining: opts.MaxResponseBytes, limit: opts.MaxResponseBytes}
+	}
+	resp.Body = &responseBody{
+		reader:  reader,
+		body:    resp.Body,
+		parent:  parent,
+		ctx:     ctx,
+		cancel:  cancel,
+		timeout: opts.Timeout,
+	}
+	return resp, nil
+}
+
+// readResponse reads and closes response body
+func readResponse(resp *http.Response, debugf Logf) (string, error) {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		debugf.debugf("< error: %v", err)
+		return "", err
+	}
+	debugResponse(debugf, resp, string(data))
+	return string(data), nil
+}
+
+// HTTPRequest sends request bound to ctx and returns response together with
+// its body, response body is always read and closed
+func HTTPRequest(ctx context.Context, client Doer, method, rawURL string, header http.Header, body string, opts RequestOptions) (*http.Response, string, error) {
+	resp, err := openRequest(ctx, client, method, rawURL, header, body, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := readResponse(resp, opts.Debugf)
+	if err != nil {
+		return nil, "", err
+	}
+	return resp, data, nil
+}
+
+// orderEndpoints returns URLs in order they should be tried according to
+// URLSelection, remaining URLs are kept as failover targets
+func (c *Client) orderEndpoints(urls []string) []string {
+	if len(urls) < 2 {
+		return urls
+	}
+
+	var start int
+	switch c.opts.URLSelection {
+	case "round-robin":
+		start = int((atomic.AddUint64(&c.roundRobin, 1) - 1) % uint64(len(urls)))
+	case "random":
+		start = rand.Intn(len(urls))
+	default:
+		return urls
+	}
+
+	ordered := make([]string, 0, len(urls))
+	ordered = append(ordered, urls[start:]...)
+	return append(ordered, urls[:start]...)
+}
+
+// EndpointError : struct containts failure of elasticsearch node itself
+// (connection error or HTTP 5xx), other node may still serve the request
+type EndpointError struct {
+	Err error
+}
+
+func (e *EndpointError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EndpointError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError : struct containts error of request exceeding per request
+// or overall timeout
+type TimeoutError struct {
+	Message string
+}
+
+func (e *TimeoutError) Error() string {
+	return e.Message
+}
+
+// queryEndpoints calls query with elasticsearch URLs in turn until one of
+// them doesn't fail with connection error, HTTP 5xx or request timeout;
+// all attempts share overall timeout, EndpointError is returned when
+// cluster couldn't be reached at all
+func (c *Client) queryEndpoints(urls []string, query func(ctx context.Context, baseURL string) error) error {
+	if len(urls) == 0 {
+		return fmt.Errorf("no elasticsearch URL given")
+	}
+
+	ctx, cancel := c.newTimeoutContext()
+	defer cancel()
+
+	var errs []string
+	for _, u := range c.orderEndpoints(urls) {
+		err := query(ctx, u)
+		if err == nil {
+			return nil
+		}
+		var endpointErr *EndpointError
+		timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+		if !timedOut && !errors.As(err, &endpointErr) {
+			return err
+		}
+		if timedOut {
+			err = &EndpointError{&TimeoutError{"connection timeout"}}
+		}
+		if len(urls) == 1 {
+			return err
+		}
+
+		errs = append(errs, fmt.Sprintf("%s: %v", RedactURL(u), err))
+		if ctx.Err() != nil {
+			break
+		}
+		c.debugf("%s failed, trying next URL: %v", RedactURL(u), err)
+	}
+	message := fmt.Sprintf("all elasticsearch URLs failed: %s", strings.Join(errs, "; "))
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &EndpointError{&TimeoutError{message}}
+	}
+	return &EndpointError{fmt.Errorf("%s", message)}
+}
+
+func gzipString(s string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// requestError reports expired per request timeout distinctly from
+// transport errors and overall deadline
+func requestError(parent, ctx context.Context, timeout time.Duration, err error) error {
+	if parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{fmt.Sprintf("request timeout after %v", timeout)}
+	}
+	return err
+}
+
+func isRedirectStatus(code int) bool {
+	switch code {
+	case 301, 302, 303, 307, 308:
+		return true
+	}
+	return false
+}
+
+// followRedirects follows redirects of resp up to MaxRedirects hops
+// repeating method, body and headers of the request, credentials of rawURL
+// are kept for redirect targets without own credentials; redirects from
+// https to plain http are refused, they would send credentials in clear
+func (c *Client) followRedirects(ctx context.Context, method, rawURL string, header http.Header, body string, resp *http.Response) (*http.Response, error) {
+	for hops := 0; isRedirectStatus(resp.StatusCode); hops++ {
+		location := resp.Header.Get("Location")
+		if location == "" {
+			return resp, nil
+		}
+		readResponse(resp, c.opts.Debugf)
+		if hops >= c.opts.MaxRedirects {
+			return nil, fmt.Errorf("stopped after %d redirects", c.opts.MaxRedirects)
+		}
+		base, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		target, err := base.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect location %s: %v", location, err)
+		}
+		if base.Scheme == "https" && target.Scheme != "https" {
+			return nil, fmt.Errorf("refusing redirect from https to %s", RedactURL(target.String()))
+		}
+		if target.User == nil {
+			target.User = base.User
+		}
+		rawURL = target.String()
+		c.debugf("following redirect to %s", RedactURL(rawURL))
+		if resp, err = openRequest(ctx, c.http, method, rawURL, header, body, c.requestOptions()); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func isRetryableStatus(code int) bool {
+	return code == 502 || code == 503 || code == 504
+}
+
+// retryBackoff returns exponential backoff delay for given attempt with
+// jitter spreading it to 50-100% of the nominal value
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	d := base << uint(attempt)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses Retry-After header given either in seconds or as HTTP
+// date, returns false if header is missing or invalid
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// esOpenRequest sends elasticsearch request retrying transient failures
+// within deadline of ctx and returns response with open body; throttled (429)
+// requests are retried as long as the server requested delay fits into the
+// remaining deadline
+func (c *Client) esOpenRequest(ctx context.Context, method, rawURL string, header http.Header, body string) (*http.Response, error) {
+	extra := http.Header{}
+	for k, v := range header {
+		extra[k] = v
+	}
+	if c.opts.UserAgent != "" {
+		extra.Set("User-Agent", c.opts.UserAgent)
+	}
+	if id := requestOpaqueID(ctx); id != "" {
+		extra.Set("X-Opaque-Id", id)
+	} else if c.opts.OpaqueID != "" {
+		extra.Set("X-Opaque-Id", c.opts.OpaqueID)
+	}
+	if c.opts.CompressRequest && body != "" {
+		extra.Set("Content-Encoding", "gzip")
+	}
+	if c.opts.CompatibleWith > 0 {
+		mediaType := fmt.Sprintf("application/vnd.elasticsearch+json; compatible-with=%d", c.opts.CompatibleWith)
+		extra.Set("Accept", mediaType)
+		if body != "" {
+			extra.Set("Content-Type", mediaType)
+		}
+	}
+	header = extra
+
+	for attempt := 0; ; attempt++ {
+		var span Span
+		if c.opts.Trace != nil {
+			span = Span{TraceID: c.opts.Trace.TraceID, SpanID: NewSpanID(), ParentID: c.opts.Trace.SpanID, Method: method, URL: RedactURL(rawURL)}
+			header = header.Clone()
+			header.Set("traceparent", fmt.Sprintf("00-%s-%s-%s", span.TraceID, span.SpanID, c.opts.Trace.Flags))
+		}
+		release, err := c.opts.Limiter.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		resp, err := openRequest(ctx, c.http, method, rawURL, header, body, c.requestOptions())
+		if err == nil && c.opts.MaxRedirects > 0 {
+			resp, err = c.followRedirects(ctx, method, rawURL, header, body, resp)
+		}
+		holdUntilClosed(resp, err, release)
+		recordRequest(ctx, attempt, time.Since(start))
+		if c.opts.Trace != nil {
+			span.Start, span.End = start, time.Now()
+			if err != nil {
+				span.Error = err.Error()
+			} else {
+				span.StatusCode = resp.StatusCode
+			}
+			recordSpan(ctx, span)
+		}
+		if err == nil {
+			c.recordWarnings(ctx, resp.Header)
+		}
+		throttled := err == nil && resp.StatusCode == http.StatusTooManyRequests
+		failed := err != nil && ctx.Err() == nil
+		retryable := failed || (err == nil && isRetryableStatus(resp.StatusCode))
+		if !throttled && (!retryable || attempt >= c.opts.Retries) {
+			if failed {
+				return nil, &EndpointError{err}
+			}
+			if err == nil && resp.StatusCode >= 500 {
+				data, _ := readResponse(resp, c.opts.Debugf)
+				return nil, &EndpointError{esResponseError(resp.Status, data)}
+			}
+			return resp, err
+		}
+		if err == nil {
+			readResponse(resp, c.opts.Debugf)
+		}
+
+		delay := retryBackoff(c.opts.RetryDelay, attempt)
+		if throttled {
+			if d, ok := retryAfter(resp.Header, time.Now()); ok {
+				delay = d
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+				return nil, fmt.Errorf("throttled by server, HTTP response code: %s", resp.Status)
+			}
+		}
+
+		c.debugf("retrying in %v (attempt %d)", delay, attempt+1)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			if throttled {
+				return nil, fmt.Errorf("throttled by server, HTTP response code: %s", resp.Status)
+			}
+			if failed {
+				return nil, err
+			}
+			return nil, &EndpointError{fmt.Errorf("HTTP response code: %s", resp.Status)}
+		}
+	}
+}
+
+// esRequest is esOpenRequest returning whole response body
+func (c *Client) esRequest(ctx context.Context, method, rawURL string, header http.Header, body string) (*http.Response, string, error) {
+	resp, err := c.esOpenRequest(ctx, method, rawURL, header, body)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := readResponse(resp, c.opts.Debugf)
+	if err != nil {
+		return nil, "", err
+	}
+	return resp, data, nil
+}
+
+func (c *Client) esGet(ctx context.Context, url string) (int, string, error) {
+	resp, body, err := c.esRequest(ctx, "GET", url, nil, "")
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, body, nil
+}
+
+func (c *Client) esDelete(ctx context.Context, url string) (int, string, error) {
+	resp, body, err := c.esRequest(ctx, "DELETE", url, nil, "")
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, body, nil
+}
@@ -0,0 +1,128 @@
+package escheck
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// CompareCheck : struct containts check comparing count of documents
+// matching query on reference cluster with count on replica, eg.: primary
+// and disaster recovery cluster fed by cross-cluster replication
+type CompareCheck struct {
+	Index          IndexOptions
+	Search         SearchOptions
+	Query          string
+	TimestampField string
+	// TimestampFormat is date format of range bounds, eg.: epoch_second,
+	// empty keeps DefaultTimestampFormat
+	TimestampFormat string
+	// TimePeriod is time window in minutes
+	TimePeriod int
+	// Delay shifts the window back so replication lag doesn't count as
+	// divergence
+	Delay time.Duration
+	// Warning and Critical are divergence from reference count in percent,
+	// warning 0 disables
+	Warning       float64
+	Critical      float64
+	SearchTimeout time.Duration
+}
+
+// Divergence returns difference of replica count from reference count in
+// percent of reference count
+func Divergence(reference, replica int) float64 {
+	if reference == 0 {
+		if replica == 0 {
+			return 0
+		}
+		return 100
+	}
+	return math.Abs(float64(replica-reference)) / float64(reference) * 100
+}
+
+// CompareCounts runs the same count on reference and replica cluster
+// concurrently over the same time window and compares results, errors are
+// reported as UNKNOWN result
+func CompareCounts(reference, replica *Client, check CompareCheck) *CheckResult {
+	stats := &requestStats{}
+	result := compareCounts(reference, replica, check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+func compareCounts(reference, replica *Client, check CompareCheck, stats *requestStats) *CheckResult {
+	if check.TimePeriod <= 0 {
+		return newFailureResult(FailureInternal, "time-period parameter should be greater than 0")
+	}
+	if check.Critical <= 0 {
+		return newFailureResult(FailureInternal, "critical divergence should be greater than 0")
+	}
+	field := check.TimestampField
+	if field == "" {
+		field = "@timestamp"
+	}
+
+	to := time.Now().Add(-check.Delay)
+	search := MetricSearch{
+		Index:           check.Index,
+		Search:          check.Search,
+		Query:           check.Query,
+		TimestampField:  field,
+		TimestampFormat: check.TimestampFormat,
+		From:            to.Add(-time.Duration(check.TimePeriod) * time.Minute),
+		To:              to,
+		SearchTimeout:   check.SearchTimeout,
+	}
+
+	clients := []*Client{reference, replica}
+	results := make([]QueryResult, len(clients))
+	errs := make([]error, len(clients))
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *Client) {
+			defer wg.Done()
+			results[i], errs[i] = c.runMetricSearch(search, stats)
+		}(i, c)
+	}
+	wg.Wait()
+	for i, name := range []string{"reference", "replica"} {
+		if errs[i] != nil {
+			r := newQueryErrorResult(errs[i])
+			r.Message = name + " cluster: " + r.Message
+			return r
+		}
+	}
+
+	refCount, replicaCount := results[0].Hits.Total.Value, results[1].Hits.Total.Value
+	divergence := Divergence(refCount, replicaCount)
+	status := nagiosplugin.OK
+	if divergence > check.Critical {
+		status = nagiosplugin.CRITICAL
+	} else if check.Warning != 0 && divergence > check.Warning {
+		status = nagiosplugin.WARNING
+	}
+
+	r := newCheckResult(status, fmt.Sprintf("replica has %d of %d entries of '%s' found on reference in the past %d minutes (%.2f%% divergence)", replicaCount, refCount, check.Query, check.TimePeriod, divergence))
+	r.Count = &refCount
+	for i, name := range []string{"reference", "replica"} {
+		shards := results[i].Shards
+		r.LongOutput = append(r.LongOutput, fmt.Sprintf("%s took %dms, shards: %d total, %d successful, %d skipped, %d failed", name, results[i].Took, shards.Total, shards.Successful, shards.Skipped, shards.Failed))
+		if shards.Failed > 0 {
+			r.Message += fmt.Sprintf(", incomplete %s count: %d of %d shards failed", name, shards.Failed, shards.Total)
+		}
+	}
+
+	divergencePerf := PerfDatum{Label: "divergence", Unit: "%", Value: divergence, Crit: floatPtr(check.Critical), Min: floatPtr(0)}
+	if check.Warning != 0 {
+		divergencePerf.Warn = floatPtr(check.Warning)
+	}
+	r.AddPerfDatum(divergencePerf)
+	r.AddPerfDatum(PerfDatum{Label: "count_reference", Value: float64(refCount), Min: floatPtr(0)})
+	r.AddPerfDatum(PerfDatum{Label: "count_replica", Value: float64(replicaCount), Min: floatPtr(0)})
+	return r
+}
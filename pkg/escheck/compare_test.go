@@ -0,0 +1,67 @@
+package escheck
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestCompareCounts(t *testing.T) {
+	reference := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	tests := []struct {
+		name    string
+		replica string
+		status  nagiosplugin.Status
+		message string
+	}{
+		{"in sync", "es8", nagiosplugin.OK, "replica has 4 of 4 entries of 'level:error' found on reference in the past 60 minutes (0.00% divergence)"},
+		{"diverged", "es7", nagiosplugin.CRITICAL, "replica has 25013 of 4 entries of 'level:error' found on reference in the past 60 minutes (625225.00% divergence)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replica := newMockES(t, map[string][]mockResponse{
+				"GET /":                ok(tt.replica + "/root.json"),
+				"POST /logs-*/_search": ok(tt.replica + "/search.json"),
+			})
+
+			result := CompareCounts(newTestClient(reference.URL), newTestClient(replica.URL), CompareCheck{
+				Index:      IndexOptions{Patterns: []string{"logs-*"}},
+				Query:      "level:error",
+				TimePeriod: 60,
+				Delay:      time.Minute,
+				Critical:   5,
+			})
+			if result.Status != tt.status || result.Message != tt.message {
+				t.Errorf("result = %v %q, want %v %q", result.Status, result.Message, tt.status, tt.message)
+			}
+		})
+	}
+
+	// delayed window ends at fixed time instead of now
+	bodies := reference.received("POST", "/logs-*/_search")
+	if strings.Contains(bodies[0].Body, `"now"`) {
+		t.Errorf("search body is not bound to delayed window:\n%s", bodies[0].Body)
+	}
+}
+
+func TestCompareCountsFailure(t *testing.T) {
+	reference := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+
+	result := CompareCounts(newTestClient(reference.URL), newTestClient("http://127.0.0.1:1"), CompareCheck{
+		Index:      IndexOptions{Patterns: []string{"logs-*"}},
+		Query:      "level:error",
+		TimePeriod: 60,
+		Critical:   5,
+	})
+	if result.Status != nagiosplugin.UNKNOWN || !strings.HasPrefix(result.Message, "replica cluster: ") {
+		t.Errorf("result = %v %q, want UNKNOWN for unreachable replica", result.Status, result.Message)
+	}
+}
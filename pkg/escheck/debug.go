@@ -0,0 +1,71 @@
+package escheck
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// sensitiveHeaders are never printed in debug output
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// RedactURL hides password of credentials embedded in URL
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+func formatDebugHeaders(header http.Header) string {
+	var keys []string
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, k := range keys {
+		value := strings.Join(header[k], ", ")
+		if sensitiveHeaders[http.CanonicalHeaderKey(k)] {
+			value = "<redacted>"
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s", k, value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func debugRequest(debugf Logf, method, rawURL string, header http.Header, body string) {
+	if debugf == nil {
+		return
+	}
+	debugf("> %s %s", method, RedactURL(rawURL))
+	if len(header) > 0 {
+		debugf("%s", formatDebugHeaders(header))
+	}
+	if body != "" {
+		debugf("%s", body)
+	}
+}
+
+func debugResponse(debugf Logf, resp *http.Response, body string) {
+	if debugf == nil || resp == nil {
+		return
+	}
+	debugf("< %s %s", resp.Proto, resp.Status)
+	if len(resp.Header) > 0 {
+		debugf("%s", formatDebugHeaders(resp.Header))
+	}
+	debugf("%s", body)
+}
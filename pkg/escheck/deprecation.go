@@ -0,0 +1,65 @@
+package escheck
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// deprecationWarnings collects unique Warning header messages of requests
+// made with the same context
+type deprecationWarnings struct {
+	sync.Mutex
+	messages []string
+}
+
+type deprecationWarningsKey struct{}
+
+func withDeprecationWarnings(ctx context.Context, w *deprecationWarnings) context.Context {
+	return context.WithValue(ctx, deprecationWarningsKey{}, w)
+}
+
+// parseWarningHeader extracts text from Warning header value in RFC 7234
+// format: 299 Elasticsearch-7.17.0-hash "message" "date"
+func parseWarningHeader(value string) string {
+	start := strings.Index(value, `"`)
+	if start < 0 {
+		return value
+	}
+	if text, err := strconv.QuotedPrefix(value[start:]); err == nil {
+		if unquoted, err := strconv.Unquote(text); err == nil {
+			return unquoted
+		}
+	}
+	return value
+}
+
+// recordWarnings logs Warning headers of response and stores them in
+// collector attached to ctx
+func (c *Client) recordWarnings(ctx context.Context, header http.Header) {
+	values := header.Values("Warning")
+	if len(values) == 0 {
+		return
+	}
+	w, _ := ctx.Value(deprecationWarningsKey{}).(*deprecationWarnings)
+	for _, v := range values {
+		message := parseWarningHeader(v)
+		c.debugf("elasticsearch warning: %s", message)
+		if w == nil {
+			continue
+		}
+		w.Lock()
+		if !containsString(w.messages, message) {
+			w.messages = append(w.messages, message)
+		}
+		w.Unlock()
+	}
+}
+
+func (w *deprecationWarnings) list() []string {
+	w.Lock()
+	defer w.Unlock()
+	return append([]string{}, w.messages...)
+}
@@ -0,0 +1,313 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Discoverer : interface of service discovery returning addresses
+// (host:port) of elasticsearch nodes, scheme and credentials are taken from
+// the first configured URL
+type Discoverer interface {
+	Discover(ctx context.Context) ([]string, error)
+}
+
+// ConsulDiscovery : struct containts Consul catalog query returning nodes of
+// service passing health checks
+type ConsulDiscovery struct {
+	// Address is Consul HTTP API URL, eg.: http://127.0.0.1:8500
+	Address    string
+	Service    string
+	Tag        string
+	Datacenter string
+	Token      string
+	HTTPClient Doer
+	Request    RequestOptions
+}
+
+// ConsulServiceEntry : struct containts entry of Consul health service API
+// response
+type ConsulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+// Discover returns addresses of healthy service instances, service address
+// falls back to node address when not registered
+func (d *ConsulDiscovery) Discover(ctx context.Context) ([]string, error) {
+	params := url.Values{"passing": {"true"}}
+	if d.Tag != "" {
+		params.Set("tag", d.Tag)
+	}
+	if d.Datacenter != "" {
+		params.Set("dc", d.Datacenter)
+	}
+	serviceURL, err := BuildURL(d.Address, params, "v1", "health", "service", url.PathEscape(d.Service))
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if d.Token != "" {
+		header.Set("X-Consul-Token", d.Token)
+	}
+	resp, body, err := HTTPRequest(ctx, d.HTTPClient, "GET", serviceURL, header, "", d.Request)
+	if err != nil {
+		return nil, fmt.Errorf("consul: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("consul: HTTP response code: %s", resp.Status)
+	}
+
+	var entries []ConsulServiceEntry
+	if err := json.Unmarshal([]byte(body), &entries); err != nil {
+		return nil, fmt.Errorf("consul: JSON parse failed")
+	}
+	var addresses []string
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		addresses = append(addresses, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("consul: no healthy instances of service %s", d.Service)
+	}
+	return addresses, nil
+}
+
+// SRVDiscovery : struct containts DNS SRV record name resolved to node
+// addresses
+type SRVDiscovery struct {
+	// Name is full SRV record name, eg.: _es._tcp.logging.internal
+	Name string
+	// Server is DNS server (host:port) used instead of system resolver
+	Server string
+}
+
+// Discover returns targets of SRV records ordered by priority and weight
+func (d *SRVDiscovery) Discover(ctx context.Context) ([]string, error) {
+	resolver := net.DefaultResolver
+	if d.Server != "" {
+		resolver = newResolver(d.Server, 0)
+	}
+	_, records, err := resolver.LookupSRV(ctx, "", "", d.Name)
+	if err != nil {
+		return nil, fmt.Errorf("SRV lookup failed: %v", err)
+	}
+
+	var addresses []string
+	for _, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		if host == "" {
+			// "." target means service is explicitly not available
+			continue
+		}
+		addresses = append(addresses, net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("SRV record %s has no targets", d.Name)
+	}
+	return addresses, nil
+}
+
+// KubernetesDiscovery : struct containts Kubernetes service whose ready pods
+// are found via EndpointSlice API, cluster DNS is used when API is not
+// configured or fails (eg.: missing RBAC permissions)
+type KubernetesDiscovery struct {
+	Namespace string
+	Service   string
+	// Port is name or number of the pod port, the first port of the service
+	// when empty
+	Port string
+	// APIServer is Kubernetes API URL, empty means DNS only
+	APIServer string
+	// TokenFile is read on every discovery as service account tokens rotate
+	TokenFile     string
+	ClusterDomain string
+	HTTPClient    Doer
+	Request       RequestOptions
+}
+
+// EndpointSliceList : struct containts discovery.k8s.io/v1 EndpointSlice list
+type EndpointSliceList struct {
+	Items []struct {
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+		} `json:"endpoints"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"items"`
+}
+
+// Discover returns addresses of ready pods of the service
+func (d *KubernetesDiscovery) Discover(ctx context.Context) ([]string, error) {
+	if d.APIServer != "" {
+		addresses, err := d.discoverAPI(ctx)
+		if err == nil {
+			return addresses, nil
+		}
+		d.Request.Debugf.debugf("kubernetes API discovery failed, falling back to DNS: %v", err)
+		addresses, dnsErr := d.discoverDNS(ctx)
+		if dnsErr != nil {
+			return nil, fmt.Errorf("kubernetes: %v; DNS fallback: %v", err, dnsErr)
+		}
+		return addresses, nil
+	}
+	return d.discoverDNS(ctx)
+}
+
+func (d *KubernetesDiscovery) discoverAPI(ctx context.Context) ([]string, error) {
+	params := url.Values{"labelSelector": {"kubernetes.io/service-name=" + d.Service}}
+	slicesURL, err := BuildURL(d.APIServer, params, "apis", "discovery.k8s.io", "v1", "namespaces", url.PathEscape(d.Namespace), "endpointslices")
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"Accept": {"application/json"}}
+	if d.TokenFile != "" {
+		token, err := os.ReadFile(d.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, body, err := HTTPRequest(ctx, d.HTTPClient, "GET", slicesURL, header, "", d.Request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("HTTP response code: %s", resp.Status)
+	}
+	var slices EndpointSliceList
+	if err := json.Unmarshal([]byte(body), &slices); err != nil {
+		return nil, fmt.Errorf("JSON parse failed")
+	}
+
+	var addresses []string
+	for _, s := range slices.Items {
+		port := 0
+		for _, p := range s.Ports {
+			if d.Port == "" || d.Port == p.Name || d.Port == strconv.Itoa(p.Port) {
+				port = p.Port
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, e := range s.Endpoints {
+			// unknown readiness is to be interpreted as ready
+			if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+				continue
+			}
+			for _, a := range e.Addresses {
+				addresses = append(addresses, net.JoinHostPort(a, strconv.Itoa(port)))
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("service %s/%s has no ready endpoints", d.Namespace, d.Service)
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+// discoverDNS resolves named port via SRV records, which list every pod of
+// headless service, otherwise addresses of service name are used with
+// numeric port or 9200
+func (d *KubernetesDiscovery) discoverDNS(ctx context.Context) ([]string, error) {
+	domain := d.ClusterDomain
+	if domain == "" {
+		domain = "cluster.local"
+	}
+	name := fmt.Sprintf("%s.%s.svc.%s", d.Service, d.Namespace, domain)
+
+	if _, err := strconv.Atoi(d.Port); d.Port != "" && err != nil {
+		return (&SRVDiscovery{Name: fmt.Sprintf("_%s._tcp.%s", d.Port, name)}).Discover(ctx)
+	}
+	port := d.Port
+	if port == "" {
+		port = "9200"
+	}
+	hosts, err := net.DefaultResolver.LookupHost(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []string
+	for _, h := range hosts {
+		addresses = append(addresses, net.JoinHostPort(h, port))
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+// seedURLs returns configured URLs or, with Discovery, URLs of discovered
+// nodes; discovered nodes are cached for DiscoveryInterval and the last
+// known list is used when discovery fails
+func (c *Client) seedURLs() ([]string, error) {
+	if c.opts.Discovery == nil {
+		return c.opts.URLs, nil
+	}
+	if len(c.opts.URLs) == 0 {
+		return nil, fmt.Errorf("no elasticsearch URL given")
+	}
+	seed, err := url.Parse(c.opts.URLs[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid elasticsearch URL: %v", err)
+	}
+
+	c.discovered.Lock()
+	defer c.discovered.Unlock()
+	if len(c.discovered.urls) > 0 && time.Since(c.discovered.refreshed) < c.opts.DiscoveryInterval {
+		return c.discovered.urls, nil
+	}
+
+	ctx, cancel := c.newTimeoutContext()
+	defer cancel()
+	addresses, err := c.opts.Discovery.Discover(ctx)
+	if err != nil {
+		if len(c.discovered.urls) > 0 {
+			c.debugf("discovery failed, using previously discovered nodes: %v", err)
+			return c.discovered.urls, nil
+		}
+		return nil, &EndpointError{err}
+	}
+
+	var urls []string
+	for _, address := range addresses {
+		u, err := publishAddressURL(seed, address)
+		if err != nil {
+			c.debugf("skipping discovered address %s: %v", address, err)
+			continue
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		return nil, &EndpointError{fmt.Errorf("discovery returned no usable address")}
+	}
+	c.debugf("discovered nodes: %v", urls)
+	c.discovered.urls = urls
+	c.discovered.refreshed = time.Now()
+	return urls, nil
+}
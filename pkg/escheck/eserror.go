@@ -0,0 +1,101 @@
+package escheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ESErrorCause : struct containts elasticsearch error cause
+type ESErrorCause struct {
+	Type      string         `json:"type"`
+	Reason    string         `json:"reason"`
+	Index     string         `json:"index"`
+	CausedBy  *ESErrorCause  `json:"caused_by"`
+	RootCause []ESErrorCause `json:"root_cause"`
+}
+
+// ESErrorResponse : struct containts elasticsearch error response, error is
+// either object or plain string on ancient versions
+type ESErrorResponse struct {
+	Error  json.RawMessage `json:"error"`
+	Status int             `json:"status"`
+}
+
+// formatESError extracts root cause type and reason from elasticsearch error
+// body, returns empty string if body isn't elasticsearch error
+func formatESError(body string) string {
+	var resp ESErrorResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil || len(resp.Error) == 0 {
+		return ""
+	}
+
+	var reason string
+	if err := json.Unmarshal(resp.Error, &reason); err == nil {
+		return reason
+	}
+
+	var cause ESErrorCause
+	if err := json.Unmarshal(resp.Error, &cause); err != nil {
+		return ""
+	}
+	if len(cause.RootCause) > 0 {
+		root := cause.RootCause[0]
+		// search phase failures carry useful reason in caused_by
+		if root.Reason == "" && cause.CausedBy != nil {
+			root = *cause.CausedBy
+		}
+		message := formatESErrorCause(root)
+		if cause.CausedBy != nil && cause.CausedBy.Type != root.Type {
+			message += fmt.Sprintf(" (caused by %s)", formatESErrorCause(*cause.CausedBy))
+		}
+		return message
+	}
+	return formatESErrorCause(cause)
+}
+
+func formatESErrorCause(cause ESErrorCause) string {
+	var parts []string
+	if cause.Type != "" {
+		parts = append(parts, cause.Type)
+	}
+	if cause.Reason != "" {
+		parts = append(parts, cause.Reason)
+	}
+	message := strings.Join(parts, ": ")
+	if cause.Index != "" {
+		message += fmt.Sprintf(" [index %s]", cause.Index)
+	}
+	return message
+}
+
+// ResponseError : struct containts unexpected HTTP status of elasticsearch
+// response and root cause reported by elasticsearch
+type ResponseError struct {
+	Status string
+	Reason string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("HTTP response code: %s, %s", e.Status, e.Reason)
+	}
+	return fmt.Sprintf("HTTP response code: %s", e.Status)
+}
+
+// StatusCode returns numeric HTTP status, eg.: 404 of "404 Not Found"
+func (e *ResponseError) StatusCode() int {
+	fields := strings.Fields(e.Status)
+	if len(fields) == 0 {
+		return 0
+	}
+	code, _ := strconv.Atoi(fields[0])
+	return code
+}
+
+// esResponseError returns error for unexpected HTTP status including root
+// cause reported by elasticsearch
+func esResponseError(status, body string) error {
+	return &ResponseError{Status: status, Reason: formatESError(body)}
+}
@@ -0,0 +1,70 @@
+package escheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ShorthandFields maps shorthand filter names to fields of common log
+// schemas, logstash default template indexes exact values in keyword
+// subfields
+var ShorthandFields = map[string]map[string]string{
+	"ecs": {
+		"level":     "log.level",
+		"host":      "host.name",
+		"program":   "process.name",
+		"namespace": "kubernetes.namespace",
+	},
+	"logstash": {
+		"level":     "level.keyword",
+		"host":      "host.keyword",
+		"program":   "program.keyword",
+		"namespace": "kubernetes.namespace.keyword",
+	},
+}
+
+// FieldFilter : struct containts exact values of field, entries match when
+// field has any of them
+type FieldFilter struct {
+	Field  string
+	Values []string
+}
+
+// clause returns term query of single value or terms query of f
+func (f FieldFilter) clause() map[string]interface{} {
+	if len(f.Values) == 1 {
+		return map[string]interface{}{"term": map[string]interface{}{f.Field: f.Values[0]}}
+	}
+	return map[string]interface{}{"terms": map[string]interface{}{f.Field: f.Values}}
+}
+
+// fieldFilterClauses returns JSON encoded term queries of filters
+func fieldFilterClauses(filters []FieldFilter) ([]string, error) {
+	var clauses []string
+	for _, f := range filters {
+		data, err := json.Marshal(f.clause())
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, string(data))
+	}
+	return clauses, nil
+}
+
+// fieldFiltersQuery returns lucene query matching the same entries as query
+// with filters, eg.: for Kibana links
+func fieldFiltersQuery(query string, filters []FieldFilter) string {
+	if len(filters) == 0 {
+		return query
+	}
+	parts := []string{"(" + query + ")"}
+	for _, f := range filters {
+		var values []string
+		for _, v := range f.Values {
+			values = append(values, fmt.Sprintf("%q", v))
+		}
+		parts = append(parts, fmt.Sprintf("%s:(%s)", f.Field, strings.Join(values, " OR ")))
+	}
+	return strings.Join(parts, " AND ")
+}
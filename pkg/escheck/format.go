@@ -0,0 +1,313 @@
+package escheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// Formatter : interface of check result renderer, new output formats are
+// added by registering Formatter under its name
+type Formatter interface {
+	Format(result *CheckResult, meta ResultMeta) (string, error)
+	// ExitCode returns exit code of the process printing result
+	ExitCode(status nagiosplugin.Status) int
+}
+
+// ResultMeta : struct containts description of evaluated check rendered
+// together with result
+type ResultMeta struct {
+	// Name is name of the check, empty for single check given on command
+	// line
+	Name  string
+	Check Check
+	// Time is when check was evaluated
+	Time time.Time
+	// MaxBytes limits size of plugin output, 0 disables
+	MaxBytes int
+}
+
+var formatters = struct {
+	sync.RWMutex
+	byName map[string]Formatter
+}{byName: map[string]Formatter{
+	"nagios":     &NagiosFormatter{},
+	"checkmk":    &CheckMKFormatter{},
+	"json":       &JSONFormatter{},
+	"influx":     &InfluxFormatter{Measurement: "es_logs"},
+	"prometheus": &PrometheusFormatter{},
+}}
+
+// RegisterFormatter makes formatter available under name, formatter
+// registered earlier under the same name is replaced
+func RegisterFormatter(name string, f Formatter) {
+	formatters.Lock()
+	defer formatters.Unlock()
+	formatters.byName[name] = f
+}
+
+// LookupFormatter returns formatter registered under name
+func LookupFormatter(name string) (Formatter, bool) {
+	formatters.RLock()
+	defer formatters.RUnlock()
+	f, ok := formatters.byName[name]
+	return f, ok
+}
+
+// FormatterNames returns sorted names of registered formatters
+func FormatterNames() []string {
+	formatters.RLock()
+	defer formatters.RUnlock()
+	var names []string
+	for name := range formatters.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// statusExitCode returns exit code following Nagios plugin convention
+func statusExitCode(status nagiosplugin.Status) int {
+	return int(status)
+}
+
+// NagiosFormatter : struct containts Nagios plugin output renderer:
+// "[name ]STATUS: message | perfdata" followed by long output
+type NagiosFormatter struct{}
+
+// Format renders result as Nagios plugin output
+func (f *NagiosFormatter) Format(result *CheckResult, meta ResultMeta) (string, error) {
+	prefix := result.Status.String() + ": "
+	if meta.Name != "" {
+		prefix = meta.Name + " " + prefix
+	}
+	return FormatPluginOutput(result, prefix, meta.MaxBytes), nil
+}
+
+// ExitCode returns Nagios plugin exit code of status
+func (f *NagiosFormatter) ExitCode(status nagiosplugin.Status) int {
+	return statusExitCode(status)
+}
+
+// CheckMKFormatter : struct containts Checkmk local check renderer:
+// "status service perfdata message"
+type CheckMKFormatter struct {
+	// Service is service name used when check has no name
+	Service string
+}
+
+var checkMKServiceEscaper = strings.NewReplacer(" ", "_", "\"", "")
+
+// Format renders result as Checkmk local check line, long output is
+// appended as further lines of service details
+func (f *CheckMKFormatter) Format(result *CheckResult, meta ResultMeta) (string, error) {
+	service := meta.Name
+	if service == "" {
+		service = f.Service
+	}
+	if service == "" {
+		service = "es_logs_count"
+	}
+
+	perfData := "-"
+	var values []string
+	for _, p := range result.PerfData {
+		// metric names cannot be quoted in local check output
+		p.Label = checkMKServiceEscaper.Replace(strings.Replace(p.Label, "'", "", -1))
+		values = append(values, strings.TrimSuffix(p.String(), ";"))
+	}
+	if len(values) > 0 {
+		perfData = strings.Join(values, "|")
+	}
+
+	out := fmt.Sprintf("%d %s %s %s", int(result.Status), checkMKServiceEscaper.Replace(service), perfData, sanitizeOutput(result.Message))
+	for _, l := range result.LongOutput {
+		out += `\n` + sanitizeOutput(l)
+	}
+	return out, nil
+}
+
+// ExitCode is always 0, Checkmk agent reports state from output
+func (f *CheckMKFormatter) ExitCode(status nagiosplugin.Status) int {
+	return 0
+}
+
+// JSONResult : struct containts machine-readable check result
+type JSONResult struct {
+	Name       string            `json:"name,omitempty"`
+	Status     string            `json:"status"`
+	ExitCode   int               `json:"exit_code"`
+	Message    string            `json:"message"`
+	Failure    Failure           `json:"failure,omitempty"`
+	Count      *int              `json:"count,omitempty"`
+	Warning    int               `json:"warning_threshold,omitempty"`
+	Critical   int               `json:"critical_threshold,omitempty"`
+	Operator   string            `json:"compare_operator"`
+	TimePeriod int               `json:"time_period_minutes"`
+	Query      string            `json:"query"`
+	DurationMs int64             `json:"duration_ms"`
+	LastRun    *time.Time        `json:"last_run,omitempty"`
+	TookMs     *int              `json:"took_ms,omitempty"`
+	Shards     *ShardsInfo       `json:"shards,omitempty"`
+	PerfData   []PerfDatum       `json:"perfdata,omitempty"`
+	Buckets    []JSONBucket      `json:"buckets,omitempty"`
+	Samples    []json.RawMessage `json:"samples,omitempty"`
+	Breakdown  []JSONTerm        `json:"breakdown,omitempty"`
+}
+
+// JSONTerm : struct containts terms breakdown entry in JSON output
+type JSONTerm struct {
+	Key   interface{} `json:"key"`
+	Count int         `json:"count"`
+}
+
+// JSONBucket : struct containts histogram bucket in JSON output
+type JSONBucket struct {
+	Time  time.Time `json:"time"`
+	Count int       `json:"count"`
+}
+
+// NewJSONResult converts result of check to JSON output structure
+func NewJSONResult(result *CheckResult, check Check) JSONResult {
+	out := JSONResult{
+		Status:     result.Status.String(),
+		ExitCode:   int(result.Status),
+		Message:    result.Message,
+		Failure:    result.Failure,
+		Count:      result.Count,
+		Warning:    check.Warning,
+		Critical:   check.Threshold,
+		Operator:   check.Operator,
+		TimePeriod: check.TimePeriod,
+		Query:      check.Query,
+		DurationMs: int64(result.Duration / time.Millisecond),
+		TookMs:     result.Took,
+		Shards:     result.Shards,
+		PerfData:   result.PerfData,
+		Samples:    result.Samples,
+	}
+	for _, b := range result.Breakdown {
+		out.Breakdown = append(out.Breakdown, JSONTerm{Key: b.Key, Count: b.DocCount})
+	}
+	for _, b := range result.Buckets {
+		out.Buckets = append(out.Buckets, JSONBucket{Time: time.Unix(b.Key/1000, 0).UTC(), Count: b.DocCount})
+	}
+	return out
+}
+
+// JSONFormatter : struct containts renderer of JSONResult
+type JSONFormatter struct{}
+
+// Format renders result as single line JSON document
+func (f *JSONFormatter) Format(result *CheckResult, meta ResultMeta) (string, error) {
+	out := NewJSONResult(result, meta.Check)
+	out.Name = meta.Name
+	data, err := json.Marshal(out)
+	if err != nil {
+		return "", fmt.Errorf("JSON encoding failed")
+	}
+	return string(data), nil
+}
+
+// ExitCode returns Nagios plugin exit code of status
+func (f *JSONFormatter) ExitCode(status nagiosplugin.Status) int {
+	return statusExitCode(status)
+}
+
+var influxTagEscaper = strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ")
+
+// InfluxFormatter : struct containts InfluxDB line protocol renderer for
+// telegraf exec input
+type InfluxFormatter struct {
+	Measurement string
+}
+
+// Format renders result as single line of InfluxDB line protocol, perfdata
+// values become fields, check name, query and index pattern become tags
+func (f *InfluxFormatter) Format(result *CheckResult, meta ResultMeta) (string, error) {
+	tags := map[string]string{
+		"check": meta.Name,
+		"query": meta.Check.Query,
+		"index": strings.Join(meta.Check.Index.Patterns, ","),
+	}
+	line := influxTagEscaper.Replace(f.Measurement)
+
+	var keys []string
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if tags[k] == "" {
+			continue
+		}
+		line += "," + influxTagEscaper.Replace(k) + "=" + influxTagEscaper.Replace(tags[k])
+	}
+
+	fields := []string{fmt.Sprintf("status=%di", int(result.Status))}
+	for _, p := range result.PerfData {
+		fields = append(fields, influxTagEscaper.Replace(p.Label)+"="+strconv.FormatFloat(p.Value, 'f', -1, 64))
+	}
+	fields = append(fields, fmt.Sprintf("duration=%s", strconv.FormatFloat(result.Duration.Seconds(), 'f', -1, 64)))
+
+	return fmt.Sprintf("%s %s %d", line, strings.Join(fields, ","), meta.Time.UnixNano()), nil
+}
+
+// ExitCode is always 0, telegraf exec input discards output of commands
+// with non-zero exit code
+func (f *InfluxFormatter) ExitCode(status nagiosplugin.Status) int {
+	return 0
+}
+
+var prometheusLabelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+// PrometheusLabels returns labels identifying check in Prometheus metrics
+func PrometheusLabels(name string, check Check) string {
+	labels := fmt.Sprintf(`query="%s",index="%s"`,
+		prometheusLabelEscaper.Replace(check.Query),
+		prometheusLabelEscaper.Replace(strings.Join(check.Index.Patterns, ",")))
+	if name != "" {
+		labels = fmt.Sprintf(`check="%s",`, prometheusLabelEscaper.Replace(name)) + labels
+	}
+	return labels
+}
+
+func writeMetric(w *strings.Builder, name, help, labels string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	fmt.Fprintf(w, "%s{%s} %v\n", name, labels, value)
+}
+
+// FormatPrometheusMetrics renders result in Prometheus text exposition
+// format
+func FormatPrometheusMetrics(result *CheckResult, labels string, lastRun time.Time) string {
+	var out strings.Builder
+	if result.Count != nil {
+		writeMetric(&out, "es_logs_count", "Number of matching log entries in the time window.", labels, float64(*result.Count))
+	}
+	writeMetric(&out, "es_logs_check_status", "Check status: 0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN.", labels, float64(result.Status))
+	writeMetric(&out, "es_logs_check_duration_seconds", "Duration of the last evaluation.", labels, result.Duration.Seconds())
+	writeMetric(&out, "es_logs_check_last_run_timestamp_seconds", "Unix time of the last evaluation.", labels, float64(lastRun.Unix()))
+	return out.String()
+}
+
+// PrometheusFormatter : struct containts Prometheus text exposition format
+// renderer, eg.: for node_exporter textfile collector
+type PrometheusFormatter struct{}
+
+// Format renders result as Prometheus metrics, trailing newline is trimmed
+// as output is printed line by line
+func (f *PrometheusFormatter) Format(result *CheckResult, meta ResultMeta) (string, error) {
+	return strings.TrimSuffix(FormatPrometheusMetrics(result, PrometheusLabels(meta.Name, meta.Check), meta.Time), "\n"), nil
+}
+
+// ExitCode is always 0, metrics carry check status
+func (f *PrometheusFormatter) ExitCode(status nagiosplugin.Status) int {
+	return 0
+}
@@ -0,0 +1,79 @@
+package escheck
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func testResult() *CheckResult {
+	count := 120
+	result := &CheckResult{
+		Status:     nagiosplugin.CRITICAL,
+		Message:    "120 entries of 'level:error' found in the past 60 minutes",
+		Count:      &count,
+		Duration:   1500 * time.Millisecond,
+		LongOutput: []string{"took 12ms"},
+	}
+	result.AddPerfDatum(PerfDatum{Label: "count", Value: 120, Warn: floatPtr(50), Crit: floatPtr(100), Min: floatPtr(0)})
+	return result
+}
+
+func TestFormatters(t *testing.T) {
+	meta := ResultMeta{Name: "app errors", Check: testCheck(), Time: time.Unix(1700000000, 0)}
+	tests := []struct {
+		format   string
+		want     string
+		exitCode int
+	}{
+		{"nagios", "app errors CRITICAL: 120 entries of 'level:error' found in the past 60 minutes | count=120;50;100;0;\ntook 12ms", 2},
+		{"checkmk", `2 app_errors count=120;50;100;0 120 entries of 'level:error' found in the past 60 minutes\ntook 12ms`, 0},
+		{"influx", `es_logs,check=app\ errors,index=logs-*,query=level:error status=2i,count=120,duration=1.5 1700000000000000000`, 0},
+		{"prometheus", `es_logs_count{check="app errors",query="level:error",index="logs-*"} 120`, 0},
+		{"json", `"name":"app errors","status":"CRITICAL","exit_code":2`, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			f, ok := LookupFormatter(tt.format)
+			if !ok {
+				t.Fatalf("formatter %s not registered", tt.format)
+			}
+			out, err := f.Format(testResult(), meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("Format() = %q, want it to contain %q", out, tt.want)
+			}
+			if code := f.ExitCode(nagiosplugin.CRITICAL); code != tt.exitCode {
+				t.Errorf("ExitCode() = %d, want %d", code, tt.exitCode)
+			}
+		})
+	}
+}
+
+type upperFormatter struct{}
+
+func (upperFormatter) Format(result *CheckResult, meta ResultMeta) (string, error) {
+	return strings.ToUpper(result.Message), nil
+}
+
+func (upperFormatter) ExitCode(status nagiosplugin.Status) int {
+	return int(status)
+}
+
+func TestRegisterFormatter(t *testing.T) {
+	RegisterFormatter("upper", upperFormatter{})
+	f, ok := LookupFormatter("upper")
+	if !ok {
+		t.Fatal("registered formatter not found")
+	}
+	if out, _ := f.Format(testResult(), ResultMeta{}); !strings.HasPrefix(out, "120 ENTRIES") {
+		t.Errorf("Format() = %q, want output of registered formatter", out)
+	}
+	if names := strings.Join(FormatterNames(), ","); !strings.Contains(names, "upper") {
+		t.Errorf("FormatterNames() = %s, want registered formatter listed", names)
+	}
+}
@@ -0,0 +1,186 @@
+package escheck
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// FreshnessCheck : struct containts check of age of the newest document
+// matching query
+type FreshnessCheck struct {
+	Index          IndexOptions
+	Search         SearchOptions
+	Query          string
+	TimestampField string
+	// TimestampFormat is date format of range bounds, eg.: epoch_second,
+	// empty keeps DefaultTimestampFormat
+	TimestampFormat string
+	// Lookback limits how far back the newest document is searched, older
+	// or no document makes the check CRITICAL
+	Lookback time.Duration
+	Warning  time.Duration
+	Critical time.Duration
+	// GroupBy evaluates age of the newest document of every value of field,
+	// eg.: host.name, fetched in pages of GroupSize values; values without
+	// entries in Lookback are not known
+	GroupBy       string
+	GroupSize     int
+	SearchTimeout time.Duration
+	// ShardFailureStatus and TimedOutStatus are names of status reported
+	// instead of age status when search is incomplete, like in Check; the
+	// newest entry may be on failed shard, ignore evaluates age anyway,
+	// empty reports UNKNOWN
+	ShardFailureStatus string
+	TimedOutStatus     string
+}
+
+// maxSilentListed limits groups listed in status line, all of them are in
+// long output
+const maxSilentListed = 5
+
+// ageStatus returns state of age compared with thresholds
+func (check FreshnessCheck) ageStatus(age time.Duration) nagiosplugin.Status {
+	if age > check.Critical {
+		return nagiosplugin.CRITICAL
+	}
+	if check.Warning > 0 && age > check.Warning {
+		return nagiosplugin.WARNING
+	}
+	return nagiosplugin.OK
+}
+
+// entryAge returns age of entry with timestamp in epoch milliseconds
+func entryAge(value float64, now time.Time) (time.Time, time.Duration) {
+	newest := time.Unix(0, int64(value)*int64(time.Millisecond))
+	age := now.Sub(newest)
+	if age < 0 {
+		// clock skew between elasticsearch clients and us
+		age = 0
+	}
+	return newest, age
+}
+
+// RunFreshness evaluates age of the newest document matching query, errors
+// are reported as UNKNOWN result
+func (c *Client) RunFreshness(check FreshnessCheck) *CheckResult {
+	stats := &requestStats{}
+	result := c.runFreshness(check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+func (c *Client) runFreshness(check FreshnessCheck, stats *requestStats) *CheckResult {
+	if check.Critical <= 0 {
+		return newFailureResult(FailureInternal, "critical age should be greater than 0")
+	}
+	if check.Lookback < check.Critical {
+		return newFailureResult(FailureInternal, "lookback should not be shorter than critical age")
+	}
+	if check.GroupBy != "" && check.GroupSize <= 0 {
+		return newFailureResult(FailureInternal, "group-size parameter should be greater than 0")
+	}
+	field := check.TimestampField
+	if field == "" {
+		field = "@timestamp"
+	}
+
+	now := time.Now()
+	result, err := c.runMetricSearch(MetricSearch{
+		Index:           check.Index,
+		Search:          check.Search,
+		Query:           check.Query,
+		TimestampField:  field,
+		TimestampFormat: check.TimestampFormat,
+		From:            now.Add(-check.Lookback),
+		Aggregation:     "max",
+		Field:           field,
+		GroupBy:         check.GroupBy,
+		GroupSize:       check.GroupSize,
+		SearchTimeout:   check.SearchTimeout,
+	}, stats)
+	if err != nil {
+		return newQueryErrorResult(err)
+	}
+
+	if result.Aggregations.Metric.Value == nil {
+		r := newCheckResult(nagiosplugin.CRITICAL, fmt.Sprintf("no entries of '%s' found in the past %s", check.Query, check.Lookback))
+		check.applyPartialStatus(r, result)
+		addSearchStats(r, result.Took, result.Shards)
+		return r
+	}
+
+	newest, age := entryAge(*result.Aggregations.Metric.Value, now)
+	status := check.ageStatus(age)
+
+	r := newCheckResult(status, fmt.Sprintf("newest entry of '%s' is %s old (%s)", check.Query, age.Round(time.Second), newest.UTC().Format(time.RFC3339)))
+	silent := 0
+	if check.GroupBy != "" {
+		silent = addGroupFreshness(r, check, result.Aggregations.Groups.Buckets, now)
+		if result.Aggregations.Groups.Truncated {
+			r.Message += fmt.Sprintf(", incomplete groups: %s values after the first %d were not fetched", check.GroupBy, len(result.Aggregations.Groups.Buckets))
+		}
+	}
+	check.applyPartialStatus(r, result)
+	agePerf := PerfDatum{Label: "age", Unit: "s", Value: age.Seconds(), Crit: floatPtr(check.Critical.Seconds()), Min: floatPtr(0)}
+	if check.Warning > 0 {
+		agePerf.Warn = floatPtr(check.Warning.Seconds())
+	}
+	r.AddPerfDatum(agePerf)
+	if check.GroupBy != "" {
+		r.AddPerfDatum(PerfDatum{Label: "groups", Value: float64(len(result.Aggregations.Groups.Buckets)), Min: floatPtr(0)})
+		r.AddPerfDatum(PerfDatum{Label: "silent", Value: float64(silent), Min: floatPtr(0)})
+	}
+	addSearchStats(r, result.Took, result.Shards)
+	return r
+}
+
+// applyPartialStatus replaces status of r with status configured for
+// incomplete search, stale entry may only look stale
+func (check FreshnessCheck) applyPartialStatus(r *CheckResult, result QueryResult) {
+	if result.Shards.Failed > 0 && check.ShardFailureStatus != "ignore" {
+		r.Status = statusFromName(check.ShardFailureStatus)
+		r.Message += fmt.Sprintf(", incomplete search: %d of %d shards failed", result.Shards.Failed, result.Shards.Total)
+	}
+	if result.TimedOut && check.TimedOutStatus != "ignore" {
+		r.Status = statusFromName(check.TimedOutStatus)
+		r.Message += ", incomplete search: search timed out and returned partial results"
+	}
+}
+
+// addGroupFreshness evaluates age of the newest entry of each group, groups
+// older than thresholds are appended to status line and make result status
+// worse; number of such groups is returned
+func addGroupFreshness(r *CheckResult, check FreshnessCheck, groups []GroupBucket, now time.Time) int {
+	var silent []string
+	var lines []string
+	for _, g := range groups {
+		if g.Metric.Value == nil {
+			continue
+		}
+		newest, age := entryAge(*g.Metric.Value, now)
+		status := check.ageStatus(age)
+		if status != nagiosplugin.OK {
+			silent = append(silent, fmt.Sprintf("%v (%s)", g.Key, age.Round(time.Second)))
+		}
+		// statuses are OK, WARNING or CRITICAL here, numeric order is severity
+		if status > r.Status {
+			r.Status = status
+		}
+		lines = append(lines, fmt.Sprintf("%s %v: newest entry %s old (%s) %s", check.GroupBy, g.Key, age.Round(time.Second), newest.UTC().Format(time.RFC3339), status))
+	}
+	if len(silent) > 0 {
+		listed := silent
+		if len(listed) > maxSilentListed {
+			listed = listed[:maxSilentListed]
+		}
+		r.Message += fmt.Sprintf(", %d of %d %s values silent: %s", len(silent), len(groups), check.GroupBy, strings.Join(listed, ", "))
+		if len(silent) > len(listed) {
+			r.Message += fmt.Sprintf(" and %d more", len(silent)-len(listed))
+		}
+	}
+	r.LongOutput = append(r.LongOutput, lines...)
+	return len(silent)
+}
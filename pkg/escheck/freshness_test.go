@@ -0,0 +1,208 @@
+package escheck
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func testFreshnessCheck() FreshnessCheck {
+	return FreshnessCheck{
+		Index:    IndexOptions{Patterns: []string{"logs-*"}},
+		Query:    "level:error",
+		Lookback: 24 * time.Hour,
+		Warning:  time.Minute,
+		Critical: 5 * time.Minute,
+	}
+}
+
+func TestRunFreshness(t *testing.T) {
+	tests := []struct {
+		file    string
+		status  nagiosplugin.Status
+		message string
+	}{
+		{"search/freshness.json", nagiosplugin.CRITICAL, "newest entry of 'level:error' is "},
+		{"search/freshness_empty.json", nagiosplugin.CRITICAL, "no entries of 'level:error' found in the past 24h0m0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			es := newMockES(t, map[string][]mockResponse{
+				"GET /":                ok("es8/root.json"),
+				"POST /logs-*/_search": ok(tt.file),
+			})
+
+			result := newTestClient(es.URL).RunFreshness(testFreshnessCheck())
+			if result.Status != tt.status || !strings.HasPrefix(result.Message, tt.message) {
+				t.Errorf("result = %v %q, want %v %q", result.Status, result.Message, tt.status, tt.message)
+			}
+
+			body := es.received("POST", "/logs-*/_search")[0].Body
+			if !strings.Contains(body, `"max":{"field":"@timestamp"}`) {
+				t.Errorf("search body has no max aggregation of @timestamp:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestRunFreshnessPerfData(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/freshness.json"),
+	})
+
+	check := testFreshnessCheck()
+	check.Lookback = 100000 * time.Hour
+	check.Critical = check.Lookback
+	check.Warning = 0
+	result := newTestClient(es.URL).RunFreshness(check)
+	if result.Status != nagiosplugin.OK {
+		t.Errorf("status = %v, want OK: %s", result.Status, result.Message)
+	}
+	newest := time.Date(2023, 3, 1, 8, 0, 0, 0, time.UTC)
+	for _, p := range result.PerfData {
+		if p.Label == "age" && (p.Value < time.Since(newest).Seconds()-60 || p.Warn != nil) {
+			t.Errorf("age perfdata = %+v, want age of %s without warning threshold", p, newest)
+		}
+	}
+}
+
+func TestRunFreshnessGroupBy(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /": ok("es8/root.json"),
+		"POST /logs-*/_search": {
+			{status: http.StatusOK, file: "search/freshness_groups.json"},
+			{status: http.StatusOK, file: "search/freshness_groups_last.json"},
+		},
+	})
+
+	// web-1 wrote on 2023-03-01, web-2 on 2023-02-01
+	check := testFreshnessCheck()
+	check.Lookback = 100000 * time.Hour
+	check.Warning = time.Since(time.Date(2023, 2, 25, 0, 0, 0, 0, time.UTC))
+	check.Critical = time.Since(time.Date(2023, 2, 15, 0, 0, 0, 0, time.UTC))
+	check.GroupBy = "host.name"
+	check.GroupSize = 10
+	result := newTestClient(es.URL).RunFreshness(check)
+	if result.Status != nagiosplugin.CRITICAL || !strings.Contains(result.Message, ", 1 of 2 host.name values silent: web-2 (") {
+		t.Errorf("result = %v %q, want CRITICAL for silent web-2", result.Status, result.Message)
+	}
+	if !strings.HasSuffix(result.LongOutput[0], "(2023-03-01T08:00:00Z) OK") {
+		t.Errorf("long output = %q, want web-1 OK", result.LongOutput)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !strings.Contains(body, `"groups":{"aggs":{"metric":{"max":{"field":"@timestamp"}}},"composite":{"size":10,"sources":[{"group":{"terms":{"field":"host.name"}}}]}}`) {
+		t.Errorf("search body has no composite aggregation of host.name:\n%s", body)
+	}
+}
+
+func TestRunFreshnessGroupPages(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /": ok("es8/root.json"),
+		"POST /logs-*/_search": {
+			{status: http.StatusOK, file: "search/freshness_groups.json"},
+			{status: http.StatusOK, file: "search/freshness_groups_2.json"},
+			{status: http.StatusOK, file: "search/freshness_groups_last.json"},
+		},
+	})
+
+	// web-3 of the second page wrote on 2023-01-01
+	check := testFreshnessCheck()
+	check.Lookback = 100000 * time.Hour
+	check.Warning = 0
+	check.Critical = time.Since(time.Date(2023, 2, 15, 0, 0, 0, 0, time.UTC))
+	check.GroupBy = "host.name"
+	check.GroupSize = 2
+	result := newTestClient(es.URL).RunFreshness(check)
+	if result.Status != nagiosplugin.CRITICAL || !strings.Contains(result.Message, ", 2 of 3 host.name values silent: web-2 (") || !strings.Contains(result.Message, "web-3 (") {
+		t.Errorf("result = %v %q, want CRITICAL for silent web-2 and web-3 of all 3 values", result.Status, result.Message)
+	}
+	if len(result.LongOutput) < 3 || !strings.HasPrefix(result.LongOutput[2], "host.name web-3: ") {
+		t.Errorf("long output = %q, want line of every value", result.LongOutput)
+	}
+	for _, p := range result.PerfData {
+		if p.Label == "groups" && p.Value != 3 {
+			t.Errorf("groups perfdata = %v, want 3", p.Value)
+		}
+	}
+}
+
+func TestRunFreshnessPartial(t *testing.T) {
+	tests := []struct {
+		name               string
+		file               string
+		shardFailureStatus string
+		timedOutStatus     string
+		status             nagiosplugin.Status
+		message            string
+	}{
+		// newest entry may be on the failed shard
+		{"stale on failed shard", "search/freshness_partial.json", "warning", "", nagiosplugin.WARNING, ", incomplete search: 1 of 3 shards failed"},
+		{"none on failed shard", "search/shard_failures.json", "", "", nagiosplugin.UNKNOWN, ", incomplete search: 1 of 3 shards failed"},
+		{"ignored failed shard", "search/freshness_partial.json", "ignore", "", nagiosplugin.CRITICAL, "Z)"},
+		{"timed out", "search/timed_out.json", "warning", "critical", nagiosplugin.CRITICAL, ", incomplete search: search timed out and returned partial results"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newMockES(t, map[string][]mockResponse{
+				"GET /":                ok("es8/root.json"),
+				"POST /logs-*/_search": ok(tt.file),
+			})
+
+			check := testFreshnessCheck()
+			check.ShardFailureStatus = tt.shardFailureStatus
+			check.TimedOutStatus = tt.timedOutStatus
+			result := newTestClient(es.URL).RunFreshness(check)
+			if result.Status != tt.status || !strings.HasSuffix(result.Message, tt.message) {
+				t.Errorf("result = %v %q, want %v ending with %q", result.Status, result.Message, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestRunFreshnessGroupPagesTimedOut(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /": ok("es8/root.json"),
+		"POST /logs-*/_search": {
+			{status: http.StatusOK, file: "search/freshness_groups.json"},
+			{status: http.StatusOK, file: "search/timed_out.json"},
+		},
+	})
+
+	// groups of timed out page may be missing
+	check := testFreshnessCheck()
+	check.Lookback = 100000 * time.Hour
+	check.Critical = 90000 * time.Hour
+	check.GroupBy = "host.name"
+	check.GroupSize = 2
+	check.TimedOutStatus = "unknown"
+	result := newTestClient(es.URL).RunFreshness(check)
+	if result.Status != nagiosplugin.UNKNOWN || !strings.HasSuffix(result.Message, ", incomplete search: search timed out and returned partial results") {
+		t.Errorf("result = %v %q, want UNKNOWN of timed out page", result.Status, result.Message)
+	}
+}
+
+func TestRunFreshnessGroupPagesTruncated(t *testing.T) {
+	// every page points to another one
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/freshness_groups.json"),
+	})
+
+	check := testFreshnessCheck()
+	check.Lookback = 100000 * time.Hour
+	check.Warning = 0
+	check.Critical = 90000 * time.Hour
+	check.GroupBy = "host.name"
+	check.GroupSize = 2
+	result := newTestClient(es.URL).RunFreshness(check)
+	want := fmt.Sprintf(", incomplete groups: host.name values after the first %d were not fetched", 2*maxGroupPages)
+	if !strings.HasSuffix(result.Message, want) {
+		t.Errorf("message = %q, want it to end with %q", result.Message, want)
+	}
+}
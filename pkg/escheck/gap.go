@@ -0,0 +1,141 @@
+package escheck
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// GapCheck : struct containts check of the longest period without
+// documents matching query in time window, gaps are measured in whole
+// histogram buckets
+type GapCheck struct {
+	Index          IndexOptions
+	Search         SearchOptions
+	Query          string
+	TimestampField string
+	// TimestampFormat is date format of range bounds, eg.: epoch_second,
+	// empty keeps DefaultTimestampFormat
+	TimestampFormat string
+	// TimePeriod is time window in minutes
+	TimePeriod int
+	// Interval of histogram buckets, the resolution of gaps
+	Interval      time.Duration
+	Warning       time.Duration
+	Critical      time.Duration
+	SearchTimeout time.Duration
+}
+
+// Gap : struct containts period without documents
+type Gap struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Duration returns length of gap
+func (g Gap) Duration() time.Duration {
+	return g.End.Sub(g.Start)
+}
+
+// longestGap returns the longest run of empty buckets clipped to window
+// from..now
+func longestGap(buckets []HistogramBucket, interval time.Duration, from, now time.Time) Gap {
+	if len(buckets) == 0 {
+		return Gap{Start: from, End: now}
+	}
+	var longest, current Gap
+	for _, b := range buckets {
+		start := time.Unix(0, b.Key*int64(time.Millisecond))
+		if b.DocCount > 0 {
+			current = Gap{}
+			continue
+		}
+		if current.Start.IsZero() {
+			current.Start = start
+			if current.Start.Before(from) {
+				current.Start = from
+			}
+		}
+		current.End = start.Add(interval)
+		if current.End.After(now) {
+			current.End = now
+		}
+		if current.Duration() > longest.Duration() {
+			longest = current
+		}
+	}
+	return longest
+}
+
+// RunGap evaluates the longest gap without matching documents, errors are
+// reported as UNKNOWN result
+func (c *Client) RunGap(check GapCheck) *CheckResult {
+	stats := &requestStats{}
+	result := c.runGap(check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+func (c *Client) runGap(check GapCheck, stats *requestStats) *CheckResult {
+	if check.TimePeriod <= 0 {
+		return newFailureResult(FailureInternal, "time-period parameter should be greater than 0")
+	}
+	if check.Interval <= 0 {
+		return newFailureResult(FailureInternal, "interval should be greater than 0")
+	}
+	if check.Critical < check.Interval {
+		return newFailureResult(FailureInternal, "max-gap parameter should not be shorter than interval")
+	}
+	field := check.TimestampField
+	if field == "" {
+		field = "@timestamp"
+	}
+
+	now := time.Now()
+	from := now.Add(-time.Duration(check.TimePeriod) * time.Minute)
+	result, err := c.runMetricSearch(MetricSearch{
+		Index:           check.Index,
+		Search:          check.Search,
+		Query:           check.Query,
+		TimestampField:  field,
+		TimestampFormat: check.TimestampFormat,
+		From:            from,
+		Interval:        check.Interval,
+		SearchTimeout:   check.SearchTimeout,
+	}, stats)
+	if err != nil {
+		return newQueryErrorResult(err)
+	}
+
+	gap := longestGap(result.Aggregations.Histogram.Buckets, check.Interval, from, now)
+	status := nagiosplugin.OK
+	if gap.Duration() >= check.Critical {
+		status = nagiosplugin.CRITICAL
+	} else if check.Warning > 0 && gap.Duration() >= check.Warning {
+		status = nagiosplugin.WARNING
+	}
+
+	var r *CheckResult
+	if gap.Duration() == 0 {
+		r = newCheckResult(status, fmt.Sprintf("entries of '%s' found in every %s of the past %d minutes", check.Query, check.Interval, check.TimePeriod))
+	} else {
+		r = newCheckResult(status, fmt.Sprintf("longest gap without entries of '%s' in the past %d minutes is %s from %s to %s", check.Query, check.TimePeriod,
+			gap.Duration().Round(time.Second), gap.Start.UTC().Format(time.RFC3339), gap.End.UTC().Format(time.RFC3339)))
+	}
+	if result.Shards.Failed > 0 {
+		r.Message += fmt.Sprintf(", incomplete search: %d of %d shards failed", result.Shards.Failed, result.Shards.Total)
+	}
+	count := result.Hits.Total.Value
+	r.Count = &count
+	r.Buckets = result.Aggregations.Histogram.Buckets
+
+	gapPerf := PerfDatum{Label: "gap", Unit: "s", Value: gap.Duration().Seconds(), Crit: floatPtr(check.Critical.Seconds()), Min: floatPtr(0)}
+	if check.Warning > 0 {
+		gapPerf.Warn = floatPtr(check.Warning.Seconds())
+	}
+	r.AddPerfDatum(gapPerf)
+	r.AddPerfDatum(PerfDatum{Label: "count", Value: float64(count), Min: floatPtr(0)})
+	addSearchStats(r, result.Took, result.Shards)
+	return r
+}
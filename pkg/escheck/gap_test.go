@@ -0,0 +1,64 @@
+package escheck
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestLongestGap(t *testing.T) {
+	from := time.Date(2024, 5, 1, 10, 0, 30, 0, time.UTC)
+	now := from.Add(10 * time.Minute)
+	bucket := func(minute, count int) HistogramBucket {
+		key := time.Date(2024, 5, 1, 10, minute, 0, 0, time.UTC)
+		return HistogramBucket{Key: key.UnixNano() / int64(time.Millisecond), DocCount: count}
+	}
+	at := func(minute, second int) time.Time {
+		return time.Date(2024, 5, 1, 10, minute, second, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name    string
+		buckets []HistogramBucket
+		want    Gap
+	}{
+		{"no gap", []HistogramBucket{bucket(0, 1), bucket(1, 3), bucket(2, 2)}, Gap{}},
+		{"longest run", []HistogramBucket{bucket(0, 1), bucket(1, 0), bucket(2, 1), bucket(3, 0), bucket(4, 0), bucket(5, 4)}, Gap{at(3, 0), at(5, 0)}},
+		{"clipped to window", []HistogramBucket{bucket(0, 0), bucket(1, 0), bucket(2, 5), bucket(10, 0)}, Gap{at(0, 30), at(2, 0)}},
+		{"ongoing", []HistogramBucket{bucket(8, 1), bucket(9, 0), bucket(10, 0)}, Gap{at(9, 0), at(10, 30)}},
+		{"no buckets", nil, Gap{from, now}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := longestGap(tt.buckets, time.Minute, from, now)
+			if !got.Start.Equal(tt.want.Start) || !got.End.Equal(tt.want.End) {
+				t.Errorf("longestGap() = %s - %s, want %s - %s", got.Start, got.End, tt.want.Start, tt.want.End)
+			}
+		})
+	}
+}
+
+func TestRunGap(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/freshness_empty.json"),
+	})
+
+	result := newTestClient(es.URL).RunGap(GapCheck{
+		Index:      IndexOptions{Patterns: []string{"logs-*"}},
+		Query:      "level:error",
+		TimePeriod: 30,
+		Interval:   time.Minute,
+		Critical:   10 * time.Minute,
+	})
+	if result.Status != nagiosplugin.CRITICAL || !strings.HasPrefix(result.Message, "longest gap without entries of 'level:error' in the past 30 minutes is 30m0s") {
+		t.Errorf("result = %v %q, want CRITICAL for gap over the whole window", result.Status, result.Message)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !strings.Contains(body, `"fixed_interval":"60000ms"`) {
+		t.Errorf("search body has no 1m histogram:\n%s", body)
+	}
+}
@@ -0,0 +1,204 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// IndexSize : struct containts document count and store size of index
+type IndexSize struct {
+	Docs       int64 `json:"docs"`
+	StoreBytes int64 `json:"store_bytes"`
+}
+
+// catIndex : struct containts _cat/indices API entry, numbers are returned
+// as strings
+type catIndex struct {
+	Index     string `json:"index"`
+	DocsCount string `json:"docs.count"`
+	StoreSize string `json:"store.size"`
+}
+
+// GrowthCheck : struct containts check of growth of target indices between
+// runs, sizes are kept in Store
+type GrowthCheck struct {
+	Index IndexOptions
+	Store StateStore
+	// thresholds are in documents per minute, 0 disables; growth lower than
+	// Min or higher than Max is alerted
+	WarningMin  float64
+	CriticalMin float64
+	WarningMax  float64
+	CriticalMax float64
+	// CriticalNoGrowth makes check CRITICAL when no document at all was
+	// added, eg.: for low volume indices rate thresholds don't fit
+	CriticalNoGrowth bool
+}
+
+// growthTargets returns index expressions covering all indices of index
+// options regardless of date
+func growthTargets(opts IndexOptions) []string {
+	if len(opts.DataStreams) > 0 || len(opts.Aliases) > 0 {
+		return append(append([]string{}, opts.DataStreams...), opts.Aliases...)
+	}
+	var targets []string
+	for _, p := range opts.Patterns {
+		if opts.DateSuffix && !strings.HasSuffix(p, "*") {
+			p += "-*"
+		}
+		targets = append(targets, p)
+	}
+	return targets
+}
+
+// catIndicesURL returns _cat/indices URL of document count and store size
+// of targets
+func catIndicesURL(baseURL string, targets []string) (string, error) {
+	return BuildURL(baseURL, url.Values{"format": {"json"}, "h": {"index,docs.count,store.size"}, "bytes": {"b"}}, "_cat", "indices", escapeIndexNames(targets))
+}
+
+func (c *Client) getIndexSizes(ctx context.Context, baseURL string, targets []string) (map[string]IndexSize, error) {
+	indicesURL, err := catIndicesURL(baseURL, targets)
+	if err != nil {
+		return nil, err
+	}
+	status, body, err := c.esGet(ctx, indicesURL)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, esResponseError(strconv.Itoa(status), body)
+	}
+	return parseIndexSizes(body)
+}
+
+// parseIndexSizes decodes _cat/indices response, closed indices are left
+// out
+func parseIndexSizes(body string) (map[string]IndexSize, error) {
+	var indices []catIndex
+	if err := json.Unmarshal([]byte(body), &indices); err != nil {
+		return nil, fmt.Errorf("JSON parse failed")
+	}
+	sizes := make(map[string]IndexSize)
+	for _, i := range indices {
+		// closed indices have no stats
+		docs, err := strconv.ParseInt(i.DocsCount, 10, 64)
+		if err != nil {
+			continue
+		}
+		store, _ := strconv.ParseInt(i.StoreSize, 10, 64)
+		sizes[i.Index] = IndexSize{Docs: docs, StoreBytes: store}
+	}
+	return sizes, nil
+}
+
+// growthStatus returns state of growth rate compared with thresholds
+func growthStatus(rate float64, check GrowthCheck) nagiosplugin.Status {
+	if (check.CriticalMin != 0 && rate < check.CriticalMin) || (check.CriticalMax != 0 && rate > check.CriticalMax) {
+		return nagiosplugin.CRITICAL
+	}
+	if (check.WarningMin != 0 && rate < check.WarningMin) || (check.WarningMax != 0 && rate > check.WarningMax) {
+		return nagiosplugin.WARNING
+	}
+	return nagiosplugin.OK
+}
+
+// RunGrowth evaluates growth of target indices since the previous run,
+// errors are reported as UNKNOWN result
+func (c *Client) RunGrowth(check GrowthCheck) *CheckResult {
+	stats := &requestStats{}
+	result := c.runGrowth(check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+func (c *Client) runGrowth(check GrowthCheck, stats *requestStats) *CheckResult {
+	if check.Store == nil {
+		return newFailureResult(FailureInternal, "growth check requires state-file or state-redis parameter")
+	}
+	targets := growthTargets(check.Index)
+	if len(targets) == 0 {
+		return newFailureResult(FailureInternal, "index-pattern parameter is required")
+	}
+
+	var sizes map[string]IndexSize
+	err := c.queryCluster(func(ctx context.Context, baseURL string) error {
+		var err error
+		sizes, err = c.getIndexSizes(withRequestStats(ctx, stats), baseURL, targets)
+		return err
+	})
+	if err != nil {
+		return newQueryErrorResult(err)
+	}
+	now := time.Now()
+
+	ctx, cancel := c.newTimeoutContext()
+	defer cancel()
+	state, err := check.Store.Load(ctx)
+	if err != nil {
+		c.debugf("%v", err)
+	}
+	previous, since := state.Indices, state.IndicesTime
+	state.Indices, state.IndicesTime = sizes, now
+	if err := check.Store.Save(ctx, state); err != nil {
+		return newFailureResult(FailureInternal, fmt.Sprintf("state save failed: %v", err))
+	}
+
+	var total IndexSize
+	for _, s := range sizes {
+		total.Docs += s.Docs
+		total.StoreBytes += s.StoreBytes
+	}
+	if previous == nil || since.IsZero() {
+		return newCheckResult(nagiosplugin.OK, fmt.Sprintf("recorded %d documents in %d indices, growth is evaluated from the next run", total.Docs, len(sizes)))
+	}
+
+	// indices deleted since the previous run (eg.: by ILM) are left out,
+	// new ones grew from zero
+	var growth IndexSize
+	var names []string
+	for name := range sizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var long []string
+	for _, name := range names {
+		docs := sizes[name].Docs - previous[name].Docs
+		growth.Docs += docs
+		growth.StoreBytes += sizes[name].StoreBytes - previous[name].StoreBytes
+		if docs != 0 {
+			long = append(long, fmt.Sprintf("%s %+d documents", name, docs))
+		}
+	}
+
+	elapsed := now.Sub(since)
+	rate := float64(growth.Docs) / elapsed.Minutes()
+	status := growthStatus(rate, check)
+	if check.CriticalNoGrowth && growth.Docs <= 0 {
+		status = nagiosplugin.CRITICAL
+	}
+	result := newCheckResult(status, fmt.Sprintf("%d documents (%.1f/min) added to %d indices in the past %s", growth.Docs, rate, len(sizes), elapsed.Round(time.Second)))
+	result.LongOutput = long
+
+	perf := PerfDatum{Label: "growth_rate", Value: rate}
+	if check.WarningMax != 0 {
+		perf.Warn = floatPtr(check.WarningMax)
+	}
+	if check.CriticalMax != 0 {
+		perf.Crit = floatPtr(check.CriticalMax)
+	}
+	result.AddPerfDatum(perf)
+	result.AddPerfDatum(PerfDatum{Label: "growth", Value: float64(growth.Docs)})
+	result.AddPerfDatum(PerfDatum{Label: "growth_bytes", Unit: "B", Value: float64(growth.StoreBytes)})
+	result.AddPerfDatum(PerfDatum{Label: "docs", Value: float64(total.Docs), Min: floatPtr(0)})
+	result.AddPerfDatum(PerfDatum{Label: "store_size", Unit: "B", Value: float64(total.StoreBytes), Min: floatPtr(0)})
+	return result
+}
@@ -0,0 +1,67 @@
+package escheck
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestRunGrowth(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /_cat/indices/logs-*": append(ok("cat/indices_1.json"), ok("cat/indices_2.json")...),
+	})
+	store := &FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}
+	check := GrowthCheck{
+		Index:       IndexOptions{Patterns: []string{"logs"}, DateSuffix: true},
+		Store:       store,
+		CriticalMin: 1,
+		WarningMax:  1000,
+	}
+	client := newTestClient(es.URL)
+
+	result := client.RunGrowth(check)
+	if result.Status != nagiosplugin.OK || !strings.HasPrefix(result.Message, "recorded 124000 documents in 2 indices") {
+		t.Fatalf("first run result = %v %q, want recorded sizes", result.Status, result.Message)
+	}
+
+	// pretend the previous run was 2 minutes ago
+	state, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.IndicesTime = state.IndicesTime.Add(-2 * time.Minute)
+	if err := store.Save(context.Background(), state); err != nil {
+		t.Fatal(err)
+	}
+
+	result = client.RunGrowth(check)
+	if result.Status != nagiosplugin.WARNING || !strings.HasPrefix(result.Message, "6000 documents (") {
+		t.Errorf("second run result = %v %q, want WARNING for growth over maximum", result.Status, result.Message)
+	}
+	if len(result.LongOutput) != 1 || result.LongOutput[0] != "logs-2024.05.02 +6000 documents" {
+		t.Errorf("long output = %q, want growth of logs-2024.05.02 only", result.LongOutput)
+	}
+}
+
+func TestRunGrowthNoGrowth(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /_cat/indices/logs-*": ok("cat/indices_1.json"),
+	})
+	store := &FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}
+	check := GrowthCheck{
+		Index:            IndexOptions{Patterns: []string{"logs"}, DateSuffix: true},
+		Store:            store,
+		CriticalNoGrowth: true,
+	}
+	client := newTestClient(es.URL)
+
+	client.RunGrowth(check)
+	result := client.RunGrowth(check)
+	if result.Status != nagiosplugin.CRITICAL || !strings.HasPrefix(result.Message, "0 documents (") {
+		t.Errorf("second run result = %v %q, want CRITICAL without growth", result.Status, result.Message)
+	}
+}
@@ -0,0 +1,147 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// ClusterHealth : struct containts _cluster/health API response
+type ClusterHealth struct {
+	ClusterName             string  `json:"cluster_name"`
+	Status                  string  `json:"status"`
+	TimedOut                bool    `json:"timed_out"`
+	NumberOfNodes           int     `json:"number_of_nodes"`
+	NumberOfDataNodes       int     `json:"number_of_data_nodes"`
+	ActivePrimaryShards     int     `json:"active_primary_shards"`
+	ActiveShards            int     `json:"active_shards"`
+	RelocatingShards        int     `json:"relocating_shards"`
+	InitializingShards      int     `json:"initializing_shards"`
+	UnassignedShards        int     `json:"unassigned_shards"`
+	NumberOfPendingTasks    int     `json:"number_of_pending_tasks"`
+	ActiveShardsPercent     float64 `json:"active_shards_percent_as_number"`
+	TaskMaxWaitingInQueueMs int     `json:"task_max_waiting_in_queue_millis"`
+}
+
+// HealthThreshold : struct containts warning and critical upper limits of
+// _cluster/health value, 0 disables
+type HealthThreshold struct {
+	Warning  int
+	Critical int
+}
+
+// status returns state of value exceeding threshold
+func (t HealthThreshold) status(value int) nagiosplugin.Status {
+	if t.Critical != 0 && value > t.Critical {
+		return nagiosplugin.CRITICAL
+	}
+	if t.Warning != 0 && value > t.Warning {
+		return nagiosplugin.WARNING
+	}
+	return nagiosplugin.OK
+}
+
+// HealthCheck : struct containts check of _cluster/health; yellow status
+// is WARNING, red CRITICAL
+type HealthCheck struct {
+	Unassigned   HealthThreshold
+	Relocating   HealthThreshold
+	Initializing HealthThreshold
+	PendingTasks HealthThreshold
+}
+
+func (c *Client) getClusterHealth(ctx context.Context, baseURL string) (ClusterHealth, error) {
+	var health ClusterHealth
+	healthURL, err := BuildURL(baseURL, nil, "_cluster", "health")
+	if err != nil {
+		return health, err
+	}
+	status, body, err := c.esGet(ctx, healthURL)
+	if err != nil {
+		return health, err
+	}
+	// 408 is returned with health body when wait condition is not met
+	if status != 200 && status != 408 {
+		return health, esResponseError(strconv.Itoa(status), body)
+	}
+	if err := json.Unmarshal([]byte(body), &health); err != nil {
+		return health, fmt.Errorf("JSON parse failed")
+	}
+	if health.Status == "" {
+		return health, fmt.Errorf("cluster health has no status")
+	}
+	return health, nil
+}
+
+// RunHealth evaluates cluster health, errors are reported as UNKNOWN
+// result
+func (c *Client) RunHealth(check HealthCheck) *CheckResult {
+	stats := &requestStats{}
+	result := c.runHealth(check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+func (c *Client) runHealth(check HealthCheck, stats *requestStats) *CheckResult {
+	var health ClusterHealth
+	err := c.queryCluster(func(ctx context.Context, baseURL string) error {
+		var err error
+		health, err = c.getClusterHealth(withRequestStats(ctx, stats), baseURL)
+		return err
+	})
+	if err != nil {
+		return newQueryErrorResult(err)
+	}
+
+	result := newCheckResult(nagiosplugin.OK, fmt.Sprintf("cluster %s is %s: %d nodes, %d unassigned, %d relocating, %d initializing shards, %d pending tasks",
+		health.ClusterName, health.Status, health.NumberOfNodes, health.UnassignedShards, health.RelocatingShards, health.InitializingShards, health.NumberOfPendingTasks))
+	switch health.Status {
+	case "green":
+	case "yellow":
+		result.Status = nagiosplugin.WARNING
+		result.LongOutput = append(result.LongOutput, "cluster status is yellow: some replica shards are not allocated")
+	case "red":
+		result.Status = nagiosplugin.CRITICAL
+		result.LongOutput = append(result.LongOutput, "cluster status is red: some primary shards are not allocated")
+	default:
+		result.Status = nagiosplugin.UNKNOWN
+		result.LongOutput = append(result.LongOutput, fmt.Sprintf("unknown cluster status %s", health.Status))
+	}
+
+	for _, v := range []struct {
+		label     string
+		value     int
+		threshold HealthThreshold
+	}{
+		{"unassigned_shards", health.UnassignedShards, check.Unassigned},
+		{"relocating_shards", health.RelocatingShards, check.Relocating},
+		{"initializing_shards", health.InitializingShards, check.Initializing},
+		{"pending_tasks", health.NumberOfPendingTasks, check.PendingTasks},
+	} {
+		status := v.threshold.status(v.value)
+		if status != nagiosplugin.OK {
+			result.LongOutput = append(result.LongOutput, fmt.Sprintf("%s %d exceeds %s threshold", v.label, v.value, status))
+		}
+		// thresholds never return UNKNOWN, so numeric order is severity
+		if status > result.Status {
+			result.Status = status
+		}
+
+		p := PerfDatum{Label: v.label, Value: float64(v.value), Min: floatPtr(0)}
+		if v.threshold.Warning != 0 {
+			p.Warn = floatPtr(float64(v.threshold.Warning))
+		}
+		if v.threshold.Critical != 0 {
+			p.Crit = floatPtr(float64(v.threshold.Critical))
+		}
+		result.AddPerfDatum(p)
+	}
+	result.AddPerfDatum(PerfDatum{Label: "nodes", Value: float64(health.NumberOfNodes), Min: floatPtr(0)})
+	result.AddPerfDatum(PerfDatum{Label: "data_nodes", Value: float64(health.NumberOfDataNodes), Min: floatPtr(0)})
+	result.AddPerfDatum(PerfDatum{Label: "active_shards", Value: float64(health.ActiveShards), Min: floatPtr(0)})
+	result.AddPerfDatum(PerfDatum{Label: "active_shards_percent", Unit: "%", Value: health.ActiveShardsPercent, Min: floatPtr(0), Max: floatPtr(100)})
+	return result
+}
@@ -0,0 +1,39 @@
+package escheck
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestRunHealth(t *testing.T) {
+	tests := []struct {
+		name   string
+		check  HealthCheck
+		status nagiosplugin.Status
+		long   string
+	}{
+		{"yellow", HealthCheck{}, nagiosplugin.WARNING, "cluster status is yellow: some replica shards are not allocated"},
+		{"pending tasks", HealthCheck{PendingTasks: HealthThreshold{Warning: 10, Critical: 30}}, nagiosplugin.CRITICAL, "pending_tasks 31 exceeds CRITICAL threshold"},
+		{"unassigned below critical", HealthCheck{Unassigned: HealthThreshold{Critical: 10}}, nagiosplugin.WARNING, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newMockES(t, map[string][]mockResponse{
+				"GET /_cluster/health": ok("cluster/health_yellow.json"),
+			})
+
+			result := newTestClient(es.URL).RunHealth(tt.check)
+			if result.Status != tt.status {
+				t.Errorf("status = %v, want %v: %s", result.Status, tt.status, result.Message)
+			}
+			if want := "cluster logs-prod is yellow: 5 nodes, 6 unassigned, 2 relocating, 4 initializing shards, 31 pending tasks"; result.Message != want {
+				t.Errorf("message = %q, want %q", result.Message, want)
+			}
+			if long := strings.Join(result.LongOutput, "\n"); !strings.Contains(long, tt.long) {
+				t.Errorf("long output = %q, want %q", long, tt.long)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// PipelineStats : struct containts cumulative counts of documents processed
+// and failed by ingest pipeline on single node
+type PipelineStats struct {
+	Count  int64 `json:"count"`
+	Failed int64 `json:"failed"`
+}
+
+// nodesIngestStats : struct containts ingest section of _nodes/stats API
+// response
+type nodesIngestStats struct {
+	Nodes map[string]struct {
+		Name   string `json:"name"`
+		Ingest struct {
+			Pipelines map[string]PipelineStats `json:"pipelines"`
+		} `json:"ingest"`
+	} `json:"nodes"`
+}
+
+// IngestCheck : struct containts check of documents failed by ingest
+// pipelines between runs, counters are kept in Store
+type IngestCheck struct {
+	// Pipelines are names or wildcard patterns of checked pipelines, empty
+	// checks all pipelines
+	Pipelines []string
+	Store     StateStore
+	// Warning and Critical are numbers of documents failed since the
+	// previous run, 0 disables
+	Warning  int64
+	Critical int64
+}
+
+// matchPipeline returns true if pipeline is checked
+func (check IngestCheck) matchPipeline(name string) bool {
+	if len(check.Pipelines) == 0 {
+		return true
+	}
+	for _, p := range check.Pipelines {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getPipelineStats returns pipeline counters keyed by node ID and pipeline
+// name separated by slash, counters of nodes restart from zero
+func (c *Client) getPipelineStats(ctx context.Context, baseURL string) (map[string]PipelineStats, map[string]string, error) {
+	statsURL, err := BuildURL(baseURL, url.Values{"filter_path": {"nodes.*.name,nodes.*.ingest.pipelines.*.count,nodes.*.ingest.pipelines.*.failed"}}, "_nodes", "stats", "ingest")
+	if err != nil {
+		return nil, nil, err
+	}
+	status, body, err := c.esGet(ctx, statsURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status != 200 {
+		return nil, nil, esResponseError(strconv.Itoa(status), body)
+	}
+	var resp nodesIngestStats
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		return nil, nil, fmt.Errorf("JSON parse failed")
+	}
+	counters := make(map[string]PipelineStats)
+	pipelines := make(map[string]string)
+	for id, node := range resp.Nodes {
+		for name, s := range node.Ingest.Pipelines {
+			key := id + "/" + name
+			counters[key] = s
+			pipelines[key] = name
+		}
+	}
+	return counters, pipelines, nil
+}
+
+// ingestStatus returns state of failed documents compared with thresholds
+func ingestStatus(failed int64, check IngestCheck) nagiosplugin.Status {
+	if check.Critical != 0 && failed >= check.Critical {
+		return nagiosplugin.CRITICAL
+	}
+	if check.Warning != 0 && failed >= check.Warning {
+		return nagiosplugin.WARNING
+	}
+	return nagiosplugin.OK
+}
+
+// RunIngest evaluates documents failed by ingest pipelines since the
+// previous run, errors are reported as UNKNOWN result
+func (c *Client) RunIngest(check IngestCheck) *CheckResult {
+	stats := &requestStats{}
+	result := c.runIngest(check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+func (c *Client) runIngest(check IngestCheck, stats *requestStats) *CheckResult {
+	if check.Store == nil {
+		return newFailureResult(FailureInternal, "ingest check requires state-file or state-redis parameter")
+	}
+
+	var counters map[string]PipelineStats
+	var pipelines map[string]string
+	err := c.queryCluster(func(ctx context.Context, baseURL string) error {
+		var err error
+		counters, pipelines, err = c.getPipelineStats(withRequestStats(ctx, stats), baseURL)
+		return err
+	})
+	if err != nil {
+		return newQueryErrorResult(err)
+	}
+	for key, name := range pipelines {
+		if !check.matchPipeline(name) {
+			delete(counters, key)
+		}
+	}
+	now := time.Now()
+
+	ctx, cancel := c.newTimeoutContext()
+	defer cancel()
+	state, err := check.Store.Load(ctx)
+	if err != nil {
+		c.debugf("%v", err)
+	}
+	previous, since := state.Pipelines, state.PipelinesTime
+	state.Pipelines, state.PipelinesTime = counters, now
+	if err := check.Store.Save(ctx, state); err != nil {
+		return newFailureResult(FailureInternal, fmt.Sprintf("state save failed: %v", err))
+	}
+
+	checked := make(map[string]bool)
+	for key := range counters {
+		checked[pipelines[key]] = true
+	}
+	if len(checked) == 0 {
+		return newCheckResult(nagiosplugin.UNKNOWN, "no ingest pipeline matched")
+	}
+	if previous == nil || since.IsZero() {
+		return newCheckResult(nagiosplugin.OK, fmt.Sprintf("recorded counters of %d ingest pipelines, failures are evaluated from the next run", len(checked)))
+	}
+
+	// counters of restarted nodes start again from zero
+	delta := make(map[string]PipelineStats)
+	for key, s := range counters {
+		d := s
+		if p, ok := previous[key]; ok && s.Count >= p.Count && s.Failed >= p.Failed {
+			d = PipelineStats{Count: s.Count - p.Count, Failed: s.Failed - p.Failed}
+		}
+		name := pipelines[key]
+		delta[name] = PipelineStats{Count: delta[name].Count + d.Count, Failed: delta[name].Failed + d.Failed}
+	}
+
+	var names []string
+	for name := range delta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var total PipelineStats
+	var failing int
+	var long []string
+	for _, name := range names {
+		d := delta[name]
+		total.Count += d.Count
+		total.Failed += d.Failed
+		if d.Failed > 0 {
+			failing++
+			long = append(long, fmt.Sprintf("%s: %d of %d documents failed", name, d.Failed, d.Count))
+		}
+	}
+
+	elapsed := now.Sub(since)
+	result := newCheckResult(ingestStatus(total.Failed, check), fmt.Sprintf("%d of %d documents failed in %d of %d ingest pipelines in the past %s", total.Failed, total.Count, failing, len(names), elapsed.Round(time.Second)))
+	result.LongOutput = long
+
+	perf := PerfDatum{Label: "failed", Value: float64(total.Failed), Min: floatPtr(0)}
+	if check.Warning != 0 {
+		perf.Warn = floatPtr(float64(check.Warning))
+	}
+	if check.Critical != 0 {
+		perf.Crit = floatPtr(float64(check.Critical))
+	}
+	result.AddPerfDatum(perf)
+	result.AddPerfDatum(PerfDatum{Label: "ingested", Value: float64(total.Count), Min: floatPtr(0)})
+	result.AddPerfDatum(PerfDatum{Label: "failed_rate", Value: float64(total.Failed) / elapsed.Minutes(), Min: floatPtr(0)})
+	return result
+}
@@ -0,0 +1,48 @@
+package escheck
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestRunIngest(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /_nodes/stats/ingest": append(ok("nodes/ingest_stats_1.json"), ok("nodes/ingest_stats_2.json")...),
+	})
+	store := &FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}
+	check := IngestCheck{
+		Pipelines: []string{"logs-*"},
+		Store:     store,
+		Warning:   1,
+		Critical:  100,
+	}
+	client := newTestClient(es.URL)
+
+	result := client.RunIngest(check)
+	if result.Status != nagiosplugin.OK || !strings.HasPrefix(result.Message, "recorded counters of 2 ingest pipelines") {
+		t.Fatalf("first run result = %v %q, want recorded counters", result.Status, result.Message)
+	}
+
+	state, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.PipelinesTime = state.PipelinesTime.Add(-5 * time.Minute)
+	if err := store.Save(context.Background(), state); err != nil {
+		t.Fatal(err)
+	}
+
+	// es-ingest-1 restarted between runs, its counters start from zero
+	result = client.RunIngest(check)
+	if result.Status != nagiosplugin.WARNING || !strings.HasPrefix(result.Message, "45 of 2700 documents failed in 1 of 2 ingest pipelines") {
+		t.Errorf("second run result = %v %q, want WARNING for failed documents", result.Status, result.Message)
+	}
+	if len(result.LongOutput) != 1 || result.LongOutput[0] != "logs-nginx: 45 of 1800 documents failed" {
+		t.Errorf("long output = %q, want failures of logs-nginx only", result.LongOutput)
+	}
+}
@@ -0,0 +1,45 @@
+package escheck
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var risonEscaper = strings.NewReplacer("!", "!!", "'", "!'")
+
+// risonString quotes string in rison notation used by Kibana URL state
+func risonString(s string) string {
+	return "'" + risonEscaper.Replace(s) + "'"
+}
+
+// getKibanaDiscoverURL builds Discover URL pre-filled with lucene query
+// and absolute time range of the check window
+func getKibanaDiscoverURL(baseURL, indexPatternID, query string, from, to time.Time) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Kibana URL: %v", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid Kibana URL: %s", baseURL)
+	}
+
+	g := fmt.Sprintf("(time:(from:%s,to:%s))",
+		risonString(from.UTC().Format(time.RFC3339)),
+		risonString(to.UTC().Format(time.RFC3339)))
+	a := fmt.Sprintf("(query:(language:lucene,query:%s))", risonString(query))
+	if indexPatternID != "" {
+		a = fmt.Sprintf("(index:%s,query:(language:lucene,query:%s))", risonString(indexPatternID), risonString(query))
+	}
+
+	u = u.JoinPath("app", "discover")
+	u.Fragment = ""
+	return fmt.Sprintf("%s#/?_g=%s&_a=%s", u.String(), escapeFragmentValue(g), escapeFragmentValue(a)), nil
+}
+
+// escapeFragmentValue escapes URL state value, spaces are encoded as %20
+// because Kibana doesn't decode '+' in hash part of the URL
+func escapeFragmentValue(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
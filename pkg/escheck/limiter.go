@@ -0,0 +1,100 @@
+package escheck
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestLimiter : struct containts limits of elasticsearch requests shared
+// by all clients of the process, so batch and daemon modes evaluating many
+// checks don't overload the monitored cluster; nil limiter doesn't limit
+type RequestLimiter struct {
+	// slots holds token of every request in flight, nil is unlimited
+	slots    chan struct{}
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRequestLimiter returns limiter of at most maxConcurrent requests in
+// flight and qps requests started per second, 0 disables either limit
+func NewRequestLimiter(maxConcurrent int, qps float64) *RequestLimiter {
+	l := &RequestLimiter{}
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	if qps > 0 {
+		l.interval = time.Duration(float64(time.Second) / qps)
+	}
+	return l
+}
+
+// reserve returns how long request has to wait for its turn within qps
+// limit
+func (l *RequestLimiter) reserve() time.Duration {
+	if l.interval == 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return wait
+}
+
+// acquire waits until request may be sent and returns function releasing
+// its slot, ctx cancellation stops waiting
+func (l *RequestLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if wait := l.reserve(); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-l.slots }) }, nil
+}
+
+// releaseOnClose : struct containts response body releasing limiter slot
+// of its request once it is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b releaseOnClose) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// holdUntilClosed keeps limiter slot of request until resp body is read and
+// closed, or releases it right away when request failed
+func holdUntilClosed(resp *http.Response, err error, release func()) {
+	if err != nil || resp == nil || resp.Body == nil {
+		release()
+		return
+	}
+	resp.Body = releaseOnClose{ReadCloser: resp.Body, release: release}
+}
@@ -0,0 +1,71 @@
+package escheck
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRequestLimiterConcurrency(t *testing.T) {
+	l := NewRequestLimiter(2, 0)
+	ctx := context.Background()
+	first, err := l.acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(blocked); err != context.DeadlineExceeded {
+		t.Fatalf("third request acquired = %v, want to wait for free slot", err)
+	}
+	first()
+	first()
+	if _, err := l.acquire(ctx); err != nil {
+		t.Errorf("request after release = %v, want slot of released request", err)
+	}
+}
+
+func TestRequestLimiterQPS(t *testing.T) {
+	l := NewRequestLimiter(0, 50)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := l.acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 requests at 50 qps took %v, want at least 40ms", elapsed)
+	}
+
+	var unlimited *RequestLimiter
+	if _, err := unlimited.acquire(context.Background()); err != nil {
+		t.Errorf("nil limiter = %v, want no limit", err)
+	}
+}
+
+func TestRunRequestLimiter(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+
+	// single slot is released after every response, otherwise the second
+	// run would wait for it until timeout
+	client := NewClient(ClientOptions{
+		URLs:       []string{es.URL},
+		Timeout:    defaultTestTimeout,
+		RetryDelay: time.Millisecond,
+		Limiter:    NewRequestLimiter(1, 0),
+	})
+	for i := 0; i < 2; i++ {
+		if result := client.Run(testCheck()); result.Count == nil || *result.Count != 4 {
+			t.Fatalf("run %d: count = %v, want 4: %s", i, result.Count, result.Message)
+		}
+	}
+}
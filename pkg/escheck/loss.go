@@ -0,0 +1,165 @@
+package escheck
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// LossCheck : struct containts check comparing count of events in source
+// indices with count of the same events in destination indices, eg.: raw
+// filebeat-* and enriched logs-enriched-*, to detect events silently dropped
+// by pipeline between them
+type LossCheck struct {
+	Source      IndexOptions
+	Destination IndexOptions
+	Search      SearchOptions
+	Query       string
+	// DestinationQuery selects the same events in destination indices when
+	// enrichment changes their fields, empty uses Query
+	DestinationQuery string
+	TimestampField   string
+	// TimestampFormat is date format of range bounds, eg.: epoch_second,
+	// empty keeps DefaultTimestampFormat
+	TimestampFormat string
+	// TimePeriod is time window in minutes
+	TimePeriod int
+	// Lag shifts the window back so events still passing the pipeline
+	// don't count as lost
+	Lag time.Duration
+	// Warning and Critical are percentages of source events missing in
+	// destination, warning 0 disables
+	Warning       float64
+	Critical      float64
+	SearchTimeout time.Duration
+	// ShardFailureStatus and TimedOutStatus are names of status reported
+	// instead of loss status when either count is incomplete, like in
+	// Check; ignore evaluates loss anyway, empty reports UNKNOWN
+	ShardFailureStatus string
+	TimedOutStatus     string
+	// RetryPartial repeats search of either side once when some shards
+	// failed or search timed out
+	RetryPartial bool
+}
+
+// Loss returns percentage of source events missing in destination, events
+// duplicated in destination don't make it negative
+func Loss(source, destination int) float64 {
+	if source == 0 || destination >= source {
+		return 0
+	}
+	return float64(source-destination) / float64(source) * 100
+}
+
+// RunLoss counts events in source and destination indices concurrently over
+// the same window and compares the counts, errors are reported as UNKNOWN
+// result
+func (c *Client) RunLoss(check LossCheck) *CheckResult {
+	stats := &requestStats{}
+	result := c.runLoss(check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+// runLossSearch runs count of one side, repeated once when it is partial
+// and retry is set; partial result is kept when the retry fails
+func (c *Client) runLossSearch(s MetricSearch, retry bool, stats *requestStats) (QueryResult, error) {
+	result, err := c.runMetricSearch(s, stats)
+	if err == nil && retry && (result.Shards.Failed > 0 || result.TimedOut) {
+		c.debugf("search of %s returned partial results, retrying", escapeIndexNames(s.Index.Patterns))
+		if again, err := c.runMetricSearch(s, stats); err == nil {
+			result = again
+		}
+	}
+	return result, err
+}
+
+func (c *Client) runLoss(check LossCheck, stats *requestStats) *CheckResult {
+	if len(check.Source.Patterns) == 0 || len(check.Destination.Patterns) == 0 {
+		return newFailureResult(FailureInternal, "source-index and destination-index parameters are required")
+	}
+	if check.TimePeriod <= 0 {
+		return newFailureResult(FailureInternal, "time-period parameter should be greater than 0")
+	}
+	if check.Critical <= 0 {
+		return newFailureResult(FailureInternal, "critical loss should be greater than 0")
+	}
+	destinationQuery := check.DestinationQuery
+	if destinationQuery == "" {
+		destinationQuery = check.Query
+	}
+	field := check.TimestampField
+	if field == "" {
+		field = "@timestamp"
+	}
+
+	to := time.Now().Add(-check.Lag)
+	searches := []MetricSearch{
+		{Index: check.Source, Query: check.Query},
+		{Index: check.Destination, Query: destinationQuery},
+	}
+	results := make([]QueryResult, len(searches))
+	errs := make([]error, len(searches))
+	var wg sync.WaitGroup
+	for i, s := range searches {
+		s.Search = check.Search
+		s.TimestampField = field
+		s.TimestampFormat = check.TimestampFormat
+		s.From = to.Add(-time.Duration(check.TimePeriod) * time.Minute)
+		s.To = to
+		s.SearchTimeout = check.SearchTimeout
+		wg.Add(1)
+		go func(i int, s MetricSearch) {
+			defer wg.Done()
+			results[i], errs[i] = c.runLossSearch(s, check.RetryPartial, stats)
+		}(i, s)
+	}
+	wg.Wait()
+	for i, name := range []string{"source", "destination"} {
+		if errs[i] != nil {
+			r := newQueryErrorResult(errs[i])
+			r.Message = name + " indices: " + r.Message
+			return r
+		}
+	}
+
+	sourceCount, destinationCount := results[0].Hits.Total.Value, results[1].Hits.Total.Value
+	loss := Loss(sourceCount, destinationCount)
+	status := nagiosplugin.OK
+	if loss > check.Critical {
+		status = nagiosplugin.CRITICAL
+	} else if check.Warning != 0 && loss > check.Warning {
+		status = nagiosplugin.WARNING
+	}
+
+	message := fmt.Sprintf("destination has %d of %d entries of '%s' found in source in the past %d minutes ending %s ago (%.2f%% loss)", destinationCount, sourceCount, check.Query, check.TimePeriod, check.Lag, loss)
+	var long []string
+	// incomplete count looks like lost events, so it replaces loss status
+	for i, name := range []string{"source", "destination"} {
+		shards := results[i].Shards
+		long = append(long, fmt.Sprintf("%s took %dms, shards: %d total, %d successful, %d skipped, %d failed", name, results[i].Took, shards.Total, shards.Successful, shards.Skipped, shards.Failed))
+		if shards.Failed > 0 && check.ShardFailureStatus != "ignore" {
+			status = statusFromName(check.ShardFailureStatus)
+			message += fmt.Sprintf(", incomplete %s count: %d of %d shards failed", name, shards.Failed, shards.Total)
+		}
+		if results[i].TimedOut && check.TimedOutStatus != "ignore" {
+			status = statusFromName(check.TimedOutStatus)
+			message += fmt.Sprintf(", incomplete %s count: search timed out and returned partial results", name)
+		}
+	}
+
+	r := newCheckResult(status, message)
+	r.Count = &destinationCount
+	r.LongOutput = long
+
+	lossPerf := PerfDatum{Label: "loss", Unit: "%", Value: loss, Crit: floatPtr(check.Critical), Min: floatPtr(0), Max: floatPtr(100)}
+	if check.Warning != 0 {
+		lossPerf.Warn = floatPtr(check.Warning)
+	}
+	r.AddPerfDatum(lossPerf)
+	r.AddPerfDatum(PerfDatum{Label: "count_source", Value: float64(sourceCount), Min: floatPtr(0)})
+	r.AddPerfDatum(PerfDatum{Label: "count_destination", Value: float64(destinationCount), Min: floatPtr(0)})
+	return r
+}
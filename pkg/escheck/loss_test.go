@@ -0,0 +1,98 @@
+package escheck
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestLoss(t *testing.T) {
+	tests := []struct {
+		source, destination int
+		want                float64
+	}{
+		{200, 150, 25},
+		{200, 200, 0},
+		{200, 260, 0},
+		{0, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := Loss(tt.source, tt.destination); got != tt.want {
+			t.Errorf("Loss(%d, %d) = %v, want %v", tt.source, tt.destination, got, tt.want)
+		}
+	}
+}
+
+func TestRunLoss(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		destination string
+		status      nagiosplugin.Status
+		message     string
+		// searches of each side, partial ones are retried once
+		sourceSearches      int
+		destinationSearches int
+	}{
+		{"no loss", "search/metric.json", "search/cardinality.json", nagiosplugin.OK, "destination has 318 of 318 entries of 'level:error' found in source in the past 60 minutes ending 2m0s ago (0.00% loss)", 1, 1},
+		{"failed destination shard", "search/metric.json", "search/shard_failures.json", nagiosplugin.UNKNOWN, "destination has 310 of 318 entries of 'level:error' found in source in the past 60 minutes ending 2m0s ago (2.52% loss), incomplete destination count: 1 of 3 shards failed", 1, 2},
+		{"timed out source", "search/timed_out.json", "search/terms.json", nagiosplugin.CRITICAL, "destination has 132 of 120 entries of 'level:error' found in source in the past 60 minutes ending 2m0s ago (0.00% loss), incomplete source count: search timed out and returned partial results", 2, 1},
+		{"dropped", "es7/search.json", "search/ratio.json", nagiosplugin.CRITICAL, "destination has 16000 of 25013 entries of 'level:error' found in source in the past 60 minutes ending 2m0s ago (36.03% loss)", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newMockES(t, map[string][]mockResponse{
+				"GET /":                         ok("es8/root.json"),
+				"POST /filebeat-*/_search":      ok(tt.source),
+				"POST /logs-enriched-*/_search": ok(tt.destination),
+			})
+
+			result := newTestClient(es.URL).RunLoss(LossCheck{
+				Source:      IndexOptions{Patterns: []string{"filebeat-*"}},
+				Destination: IndexOptions{Patterns: []string{"logs-enriched-*"}},
+				Query:       "level:error",
+				TimePeriod:  60,
+				Lag:         2 * time.Minute,
+				Warning:     1,
+				Critical:    5,
+				// shard failures are reported as UNKNOWN
+				TimedOutStatus: "critical",
+				RetryPartial:   true,
+			})
+			if result.Status != tt.status || result.Message != tt.message {
+				t.Errorf("result = %v %q, want %v %q", result.Status, result.Message, tt.status, tt.message)
+			}
+
+			// both windows end at the same lagged time instead of now
+			source, destination := es.received("POST", "/filebeat-*/_search"), es.received("POST", "/logs-enriched-*/_search")
+			if len(source) != tt.sourceSearches || len(destination) != tt.destinationSearches || strings.Contains(source[0].Body, `"now"`) {
+				t.Fatalf("got %d source and %d destination searches, want %d and %d lagged searches", len(source), len(destination), tt.sourceSearches, tt.destinationSearches)
+			}
+		})
+	}
+}
+
+func TestRunLossDestinationQuery(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                         ok("es8/root.json"),
+		"POST /filebeat-*/_search":      ok("es8/search.json"),
+		"POST /logs-enriched-*/_search": ok("es8/search.json"),
+	})
+
+	newTestClient(es.URL).RunLoss(LossCheck{
+		Source:           IndexOptions{Patterns: []string{"filebeat-*"}},
+		Destination:      IndexOptions{Patterns: []string{"logs-enriched-*"}},
+		Query:            "message:timeout",
+		DestinationQuery: "event.original:timeout",
+		TimePeriod:       60,
+		Critical:         5,
+	})
+	if body := es.received("POST", "/logs-enriched-*/_search")[0].Body; !strings.Contains(body, "event.original:timeout") {
+		t.Errorf("destination search body doesn't use destination query:\n%s", body)
+	}
+	if body := es.received("POST", "/filebeat-*/_search")[0].Body; !strings.Contains(body, "message:timeout") {
+		t.Errorf("source search body doesn't use query:\n%s", body)
+	}
+}
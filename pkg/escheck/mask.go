@@ -0,0 +1,98 @@
+package escheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// maskedValue replaces masked values of sampled documents
+const maskedValue = "***"
+
+// sampleMask : struct containts rules masking sampled documents, values of
+// fields are replaced whole and matches of patterns within string values
+type sampleMask struct {
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// newSampleMask compiles masking rules, nil mask is returned without rules
+func newSampleMask(fields, patterns []string) (*sampleMask, error) {
+	if len(fields) == 0 && len(patterns) == 0 {
+		return nil, nil
+	}
+	m := &sampleMask{fields: make(map[string]bool)}
+	for _, f := range fields {
+		m.fields[f] = true
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mask pattern %s: %v", p, err)
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	return m, nil
+}
+
+// maskString replaces matches of patterns in s
+func (m *sampleMask) maskString(s string) string {
+	for _, re := range m.patterns {
+		s = re.ReplaceAllString(s, maskedValue)
+	}
+	return s
+}
+
+// maskValue masks decoded JSON value v found at dotted path
+func (m *sampleMask) maskValue(path string, v interface{}) interface{} {
+	if m.fields[path] {
+		return maskedValue
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, nested := range v {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			v[k] = m.maskValue(p, nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = m.maskValue(path, nested)
+		}
+	case string:
+		return m.maskString(v)
+	}
+	return v
+}
+
+// mask returns masked copy of sampled document, documents which can't be
+// decoded are replaced by JSON string of their text with patterns masked
+func (m *sampleMask) mask(doc json.RawMessage) json.RawMessage {
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	var source interface{}
+	var data []byte
+	err := decoder.Decode(&source)
+	if err == nil {
+		data, err = json.Marshal(m.maskValue("", source))
+	}
+	if err != nil {
+		data, _ = json.Marshal(m.maskString(string(doc)))
+	}
+	return data
+}
+
+// maskSamples returns masked copies of sampled documents
+func (m *sampleMask) maskSamples(samples []json.RawMessage) []json.RawMessage {
+	if m == nil {
+		return samples
+	}
+	masked := make([]json.RawMessage, len(samples))
+	for i, s := range samples {
+		masked[i] = m.mask(s)
+	}
+	return masked
+}
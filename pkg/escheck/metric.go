@@ -0,0 +1,380 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// MetricSearch : struct containts search of documents matching query since
+// From with single value metric aggregation named "metric" and optional
+// date_histogram named "histogram"
+type MetricSearch struct {
+	Index          IndexOptions
+	Search         SearchOptions
+	Query          string
+	TimestampField string
+	From           time.Time
+	// To ends the window, zero means now
+	To time.Time
+	// TimestampFormat is date format of range bounds, eg.: epoch_second,
+	// empty keeps DefaultTimestampFormat
+	TimestampFormat string
+	// Aggregation is metric aggregation type, eg.: max, avg, sum; empty
+	// skips metric aggregation
+	Aggregation string
+	Field       string
+	// PrecisionThreshold is precision_threshold of cardinality
+	// aggregation, 0 keeps elasticsearch default
+	PrecisionThreshold int
+	// Interval of histogram buckets, 0 skips histogram
+	Interval time.Duration
+	// GroupBy adds composite aggregation named "groups" of values of field,
+	// each with the metric aggregation, fetched in pages of GroupSize
+	// values until all of them are known
+	GroupBy   string
+	GroupSize int
+	// GroupAfter is after_key of the previous page of groups, later pages
+	// carry only groups aggregation
+	GroupAfter    map[string]interface{}
+	SearchTimeout time.Duration
+	// Filter adds filter aggregation named "matching" counting documents
+	// also matching query string
+	Filter string
+}
+
+// getMetricSearchBody renders search request body of s
+func getMetricSearchBody(s MetricSearch, version *ESVersion) (string, error) {
+	format := s.TimestampFormat
+	if format == "" {
+		format = DefaultTimestampFormat
+	}
+	from, err := timestampBound(format, s.From)
+	if err != nil {
+		return "", err
+	}
+	var to interface{} = "now"
+	var boundsMax interface{} = "now"
+	if !s.To.IsZero() {
+		rangeTo, err := timestampBound(format, s.To)
+		if err != nil {
+			return "", err
+		}
+		to = json.RawMessage(rangeTo)
+		boundsMax = s.To.UnixNano() / int64(time.Millisecond)
+	}
+	body := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": []interface{}{
+					map[string]interface{}{
+						"query_string": map[string]interface{}{
+							"analyze_wildcard": true,
+							"query":            s.Query,
+						},
+					},
+					map[string]interface{}{
+						"range": map[string]interface{}{
+							s.TimestampField: map[string]interface{}{
+								"lte":    to,
+								"gte":    json.RawMessage(from),
+								"format": format,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	aggs := map[string]interface{}{}
+	if s.Aggregation != "" {
+		aggregation := map[string]interface{}{"field": s.Field}
+		if s.Aggregation == "cardinality" && s.PrecisionThreshold > 0 {
+			aggregation["precision_threshold"] = s.PrecisionThreshold
+		}
+		aggs["metric"] = map[string]interface{}{s.Aggregation: aggregation}
+		if s.GroupBy != "" {
+			composite := map[string]interface{}{
+				"size": s.GroupSize,
+				"sources": []interface{}{
+					map[string]interface{}{
+						"group": map[string]interface{}{
+							"terms": map[string]interface{}{"field": s.GroupBy},
+						},
+					},
+				},
+			}
+			if s.GroupAfter != nil {
+				composite["after"] = s.GroupAfter
+			}
+			aggs["groups"] = map[string]interface{}{
+				"composite": composite,
+				"aggs": map[string]interface{}{
+					"metric": map[string]interface{}{s.Aggregation: aggregation},
+				},
+			}
+		}
+	}
+	if s.Filter != "" {
+		aggs["matching"] = map[string]interface{}{
+			"filter": map[string]interface{}{
+				"query_string": map[string]interface{}{
+					"analyze_wildcard": true,
+					"query":            s.Filter,
+				},
+			},
+		}
+	}
+	if s.Interval > 0 {
+		// interval was deprecated in 7.2 and removed in 8.0
+		intervalParam := "interval"
+		if version != nil && version.AtLeast(7, 2) {
+			intervalParam = "fixed_interval"
+		}
+		aggs["histogram"] = map[string]interface{}{
+			"date_histogram": map[string]interface{}{
+				"field":         s.TimestampField,
+				intervalParam:   fmt.Sprintf("%dms", s.Interval.Milliseconds()),
+				"time_zone":     "UTC",
+				"min_doc_count": 0,
+				"extended_bounds": map[string]interface{}{
+					"min": s.From.UnixNano() / int64(time.Millisecond),
+					"max": boundsMax,
+				},
+			},
+		}
+	}
+	if s.GroupAfter != nil {
+		// the other aggregations were returned with the first page
+		aggs = map[string]interface{}{"groups": aggs["groups"]}
+	}
+	body["aggs"] = aggs
+	if s.SearchTimeout > 0 {
+		body["timeout"] = fmt.Sprintf("%dms", s.SearchTimeout.Milliseconds())
+	}
+	if version != nil && version.AtLeast(7, 0) {
+		body["track_total_hits"] = true
+	}
+	data, err := json.Marshal(body)
+	return string(data), err
+}
+
+// searchMetric runs metric search against single node
+func (c *Client) searchMetric(ctx context.Context, baseURL string, s MetricSearch) (QueryResult, error) {
+	version, err := c.getESVersion(ctx, baseURL)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	if version != nil && version.IsOpenSearch() && s.Search.Async {
+		return QueryResult{}, fmt.Errorf("async-search parameter is not supported by OpenSearch")
+	}
+	if s.GroupBy != "" && version != nil && !version.AtLeast(6, 1) {
+		return QueryResult{}, fmt.Errorf("group-by parameter requires Elasticsearch 6.1 or later, cluster runs %s", version)
+	}
+	if s.Index.DocType != "" && version != nil && version.TypesRemoved() {
+		s.Index.DocType = ""
+	}
+
+	body, err := getMetricSearchBody(s, version)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	to := s.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	searchURL, err := getSearchURL(baseURL, getIndexNames(s.Index, s.From, to), s.Index.DocType, s.Search)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	if s.Search.Async {
+		return c.esAsyncSearch(ctx, baseURL, searchURL, body, s.Search.AsyncPollInterval)
+	}
+	return c.esQueryPost(ctx, searchURL, body)
+}
+
+// runMetricSearch runs metric search against the cluster, groups of GroupBy
+// are paged within the same deadline
+func (c *Client) runMetricSearch(s MetricSearch, stats *requestStats) (QueryResult, error) {
+	var result QueryResult
+	// pages of groups share deadline of single search
+	err := c.queryCluster(func(ctx context.Context, baseURL string) error {
+		var err error
+		result, err = c.searchMetricPages(withRequestStats(ctx, stats), baseURL, s)
+		return err
+	})
+	return result, err
+}
+
+// maxGroupPages limits pages of groups fetched by single metric search,
+// groups after them are reported as truncated
+const maxGroupPages = 100
+
+// searchMetricPages runs metric search against single node and fetches
+// following pages of groups of GroupBy up to maxGroupPages
+func (c *Client) searchMetricPages(ctx context.Context, baseURL string, s MetricSearch) (QueryResult, error) {
+	result, err := c.searchMetric(ctx, baseURL, s)
+	if err != nil || s.GroupBy == "" {
+		return result, err
+	}
+
+	groups := &result.Aggregations.Groups
+	page := *groups
+	for pages := 1; len(page.Buckets) > 0 && page.AfterKey != nil; pages++ {
+		if pages == maxGroupPages {
+			// page shorter than GroupSize is the last one
+			groups.Truncated = len(page.Buckets) >= s.GroupSize
+			break
+		}
+		s.GroupAfter = page.AfterKey
+		next, err := c.searchMetric(ctx, baseURL, s)
+		if err != nil {
+			return QueryResult{}, err
+		}
+		page = next.Aggregations.Groups
+		groups.Buckets = append(groups.Buckets, page.Buckets...)
+		// failed shards or timeout of any page make the result partial
+		result.Took += next.Took
+		result.TimedOut = result.TimedOut || next.TimedOut
+		if next.Shards.Failed > result.Shards.Failed {
+			result.Shards = next.Shards
+		}
+	}
+	groups.AfterKey = nil
+	for i, b := range groups.Buckets {
+		if key, ok := b.Key.(map[string]interface{}); ok {
+			groups.Buckets[i].Key = key["group"]
+		}
+	}
+	return result, nil
+}
+
+// MetricCheck : struct containts check comparing metric aggregation of
+// field over documents matching query in time window with thresholds
+type MetricCheck struct {
+	Index  IndexOptions
+	Search SearchOptions
+	Query  string
+	// TimePeriod is time window in minutes
+	TimePeriod     int
+	TimestampField string
+	Field          string
+	// TimestampFormat is date format of range bounds, eg.: epoch_second,
+	// empty keeps DefaultTimestampFormat
+	TimestampFormat string
+	// Aggregation is avg, sum, min, max or cardinality (approximate count of
+	// unique values)
+	Aggregation        string
+	PrecisionThreshold int
+	// Warning and Critical are compared with metric according to Operator
+	// like in Check, warning 0 disables
+	Warning       float64
+	Critical      float64
+	Operator      string
+	SearchTimeout time.Duration
+}
+
+// MetricAggregations are supported aggregations of MetricCheck
+var MetricAggregations = []string{"avg", "sum", "min", "max", "cardinality"}
+
+// MetricStatus returns status of metric value compared with thresholds,
+// see CountStatus
+func MetricStatus(value, warning, critical float64, operator string) nagiosplugin.Status {
+	if operator == "lt" {
+		if value > critical {
+			return nagiosplugin.CRITICAL
+		}
+		if warning != 0 && value > warning {
+			return nagiosplugin.WARNING
+		}
+		return nagiosplugin.OK
+	}
+
+	if value < critical {
+		return nagiosplugin.CRITICAL
+	}
+	if warning != 0 && value < warning {
+		return nagiosplugin.WARNING
+	}
+	return nagiosplugin.OK
+}
+
+// RunMetric evaluates metric check, errors are reported as UNKNOWN result
+func (c *Client) RunMetric(check MetricCheck) *CheckResult {
+	stats := &requestStats{}
+	result := c.runMetric(check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+func (c *Client) runMetric(check MetricCheck, stats *requestStats) *CheckResult {
+	if check.Field == "" {
+		return newFailureResult(FailureInternal, "field parameter is required")
+	}
+	supported := false
+	for _, a := range MetricAggregations {
+		supported = supported || a == check.Aggregation
+	}
+	if !supported {
+		return newFailureResult(FailureInternal, fmt.Sprintf("aggregation parameter should be one of: %s", strings.Join(MetricAggregations, ", ")))
+	}
+	if check.Operator != "lt" && check.Operator != "gt" {
+		return newFailureResult(FailureInternal, "compare-operator parameter should be 'lt' or 'gt'")
+	}
+	if check.TimePeriod <= 0 {
+		return newFailureResult(FailureInternal, "time-period parameter should be greater than 0")
+	}
+	field := check.TimestampField
+	if field == "" {
+		field = "@timestamp"
+	}
+
+	result, err := c.runMetricSearch(MetricSearch{
+		Index:              check.Index,
+		Search:             check.Search,
+		Query:              check.Query,
+		TimestampField:     field,
+		TimestampFormat:    check.TimestampFormat,
+		From:               time.Now().Add(-time.Duration(check.TimePeriod) * time.Minute),
+		Aggregation:        check.Aggregation,
+		Field:              check.Field,
+		PrecisionThreshold: check.PrecisionThreshold,
+		SearchTimeout:      check.SearchTimeout,
+	}, stats)
+	if err != nil {
+		return newQueryErrorResult(err)
+	}
+
+	count := result.Hits.Total.Value
+	if result.Aggregations.Metric.Value == nil {
+		r := newCheckResult(nagiosplugin.UNKNOWN, fmt.Sprintf("no %s of %s in %d entries of '%s' found in the past %d minutes", check.Aggregation, check.Field, count, check.Query, check.TimePeriod))
+		r.Count = &count
+		addSearchStats(r, result.Took, result.Shards)
+		return r
+	}
+
+	value := *result.Aggregations.Metric.Value
+	message := fmt.Sprintf("%s of %s is %s over %d entries of '%s' in the past %d minutes", check.Aggregation, check.Field, strconv.FormatFloat(value, 'f', -1, 64), count, check.Query, check.TimePeriod)
+	if check.Aggregation == "cardinality" {
+		message = fmt.Sprintf("%s unique values of %s in %d entries of '%s' in the past %d minutes", strconv.FormatFloat(value, 'f', -1, 64), check.Field, count, check.Query, check.TimePeriod)
+	}
+	r := newCheckResult(MetricStatus(value, check.Warning, check.Critical, check.Operator), message)
+	r.Count = &count
+	if result.Shards.Failed > 0 {
+		r.Message += fmt.Sprintf(", incomplete search: %d of %d shards failed", result.Shards.Failed, result.Shards.Total)
+	}
+	metric := PerfDatum{Label: check.Aggregation, Value: value, Crit: floatPtr(check.Critical)}
+	if check.Warning != 0 {
+		metric.Warn = floatPtr(check.Warning)
+	}
+	r.AddPerfDatum(metric)
+	r.AddPerfDatum(PerfDatum{Label: "count", Value: float64(count), Min: floatPtr(0)})
+	addSearchStats(r, result.Took, result.Shards)
+	return r
+}
@@ -0,0 +1,202 @@
+package escheck
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func testMetricCheck() MetricCheck {
+	return MetricCheck{
+		Index:       IndexOptions{Patterns: []string{"logs-*"}},
+		Query:       "service:api",
+		TimePeriod:  15,
+		Field:       "event.duration",
+		Aggregation: "avg",
+		Warning:     500,
+		Critical:    1000,
+		Operator:    "lt",
+	}
+}
+
+func TestRunMetric(t *testing.T) {
+	tests := []struct {
+		name     string
+		warning  float64
+		critical float64
+		operator string
+		status   nagiosplugin.Status
+	}{
+		{"below critical", 500, 1000, "lt", nagiosplugin.WARNING},
+		{"above critical", 0, 700, "lt", nagiosplugin.CRITICAL},
+		{"above minimum", 800, 100, "gt", nagiosplugin.WARNING},
+		{"ok", 800, 1000, "lt", nagiosplugin.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newMockES(t, map[string][]mockResponse{
+				"GET /":                ok("es8/root.json"),
+				"POST /logs-*/_search": ok("search/metric.json"),
+			})
+
+			check := testMetricCheck()
+			check.Warning, check.Critical, check.Operator = tt.warning, tt.critical, tt.operator
+			result := newTestClient(es.URL).RunMetric(check)
+			if result.Status != tt.status {
+				t.Errorf("status = %v, want %v: %s", result.Status, tt.status, result.Message)
+			}
+			if want := "avg of event.duration is 742.5 over 318 entries of 'service:api' in the past 15 minutes"; result.Message != want {
+				t.Errorf("message = %q, want %q", result.Message, want)
+			}
+
+			body := es.received("POST", "/logs-*/_search")[0].Body
+			if !strings.Contains(body, `"avg":{"field":"event.duration"}`) {
+				t.Errorf("search body has no avg aggregation of event.duration:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestRunMetricNoValue(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/freshness_empty.json"),
+	})
+
+	result := newTestClient(es.URL).RunMetric(testMetricCheck())
+	if result.Status != nagiosplugin.UNKNOWN || !strings.HasPrefix(result.Message, "no avg of event.duration") {
+		t.Errorf("result = %v %q, want UNKNOWN without value", result.Status, result.Message)
+	}
+}
+
+func TestRunMetricCardinality(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/cardinality.json"),
+	})
+
+	check := testMetricCheck()
+	check.Field = "host.name"
+	check.Aggregation = "cardinality"
+	check.PrecisionThreshold = 1000
+	check.Warning, check.Critical, check.Operator = 0, 40, "gt"
+	result := newTestClient(es.URL).RunMetric(check)
+	if result.Status != nagiosplugin.CRITICAL || result.Message != "38 unique values of host.name in 318 entries of 'service:api' in the past 15 minutes" {
+		t.Errorf("result = %v %q, want CRITICAL for fewer than 40 hosts", result.Status, result.Message)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !strings.Contains(body, `"cardinality":{"field":"host.name","precision_threshold":1000}`) {
+		t.Errorf("search body has no cardinality aggregation of host.name:\n%s", body)
+	}
+}
+
+func TestMetricSearchBodyEpochSecond(t *testing.T) {
+	from := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	body, err := getMetricSearchBody(MetricSearch{
+		Query:           "*",
+		TimestampField:  "event.created",
+		TimestampFormat: "epoch_second",
+		From:            from,
+		To:              from.Add(15 * time.Minute),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"event.created":{"format":"epoch_second","gte":1714564800,"lte":1714565700}`
+	if !strings.Contains(body, want) {
+		t.Errorf("search body = %s, want range %s", body, want)
+	}
+}
+
+func TestRunMetricSearchGroupPages(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /": ok("es8/root.json"),
+		"POST /logs-*/_search": {
+			{status: http.StatusOK, file: "search/freshness_groups.json"},
+			{status: http.StatusOK, file: "search/freshness_groups_last.json"},
+		},
+	})
+
+	result, err := newTestClient(es.URL).runMetricSearch(MetricSearch{
+		Index:          IndexOptions{Patterns: []string{"logs-*"}},
+		Query:          "*",
+		TimestampField: "@timestamp",
+		From:           time.Now().Add(-time.Hour),
+		Aggregation:    "max",
+		Field:          "@timestamp",
+		GroupBy:        "host.name",
+		GroupSize:      2,
+	}, &requestStats{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []interface{}
+	for _, b := range result.Aggregations.Groups.Buckets {
+		keys = append(keys, b.Key)
+	}
+	if len(keys) != 2 || keys[0] != "web-1" || keys[1] != "web-2" || result.Aggregations.Metric.Value == nil {
+		t.Errorf("group keys = %v, metric = %v, want web-1 and web-2 with metric of the first page", keys, result.Aggregations.Metric.Value)
+	}
+
+	// groups are paged by after_key until empty page, later pages don't
+	// repeat the other aggregations
+	searches := es.received("POST", "/logs-*/_search")
+	if len(searches) != 2 {
+		t.Fatalf("got %d searches, want 2 pages", len(searches))
+	}
+	if !strings.Contains(searches[0].Body, `"groups":{"aggs":{"metric":{"max":{"field":"@timestamp"}}},"composite":{"size":2,"sources":[{"group":{"terms":{"field":"host.name"}}}]}}`) {
+		t.Errorf("first page body has no composite aggregation of host.name:\n%s", searches[0].Body)
+	}
+	if body := searches[1].Body; !strings.Contains(body, `"after":{"group":"web-2"}`) || strings.Count(body, `"max":{"field":"@timestamp"}`) != 1 {
+		t.Errorf("second page body doesn't continue after web-2 with groups only:\n%s", body)
+	}
+}
+
+func TestMetricSearchGroupByVersion(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /": ok("es2/root.json"),
+	})
+
+	_, err := newTestClient(es.URL).runMetricSearch(MetricSearch{
+		Index:          IndexOptions{Patterns: []string{"logs-*"}},
+		Query:          "*",
+		TimestampField: "@timestamp",
+		Aggregation:    "max",
+		Field:          "@timestamp",
+		GroupBy:        "host.name",
+		GroupSize:      2,
+	}, &requestStats{})
+	if err == nil || !strings.Contains(err.Error(), "requires Elasticsearch 6.1") {
+		t.Errorf("error = %v, want group-by unsupported by elasticsearch 2", err)
+	}
+}
+
+func TestRunMetricSearchGroupPagesLimit(t *testing.T) {
+	// every page points to another one
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/freshness_groups.json"),
+	})
+
+	result, err := newTestClient(es.URL).runMetricSearch(MetricSearch{
+		Index:          IndexOptions{Patterns: []string{"logs-*"}},
+		Query:          "*",
+		TimestampField: "@timestamp",
+		From:           time.Now().Add(-time.Hour),
+		Aggregation:    "max",
+		Field:          "@timestamp",
+		GroupBy:        "host.name",
+		GroupSize:      2,
+	}, &requestStats{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := result.Aggregations.Groups
+	if n := len(es.received("POST", "/logs-*/_search")); n != maxGroupPages || !groups.Truncated || len(groups.Buckets) != 2*maxGroupPages {
+		t.Errorf("got %d searches and %d groups, truncated %v, want %d pages reported as truncated", n, len(groups.Buckets), groups.Truncated, maxGroupPages)
+	}
+}
@@ -0,0 +1,152 @@
+package escheck
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockResponse : struct containts recorded response replayed by mock
+// elasticsearch server, body is read from testdata file
+type mockResponse struct {
+	status int
+	file   string
+	header http.Header
+}
+
+// mockRequest : struct containts request received by mock server
+type mockRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   string
+}
+
+// mockES : struct containts httptest server replaying responses keyed by
+// "METHOD /path"; responses of a route are returned in turn, the last one is
+// repeated
+type mockES struct {
+	*httptest.Server
+	t *testing.T
+
+	mu       sync.Mutex
+	routes   map[string][]mockResponse
+	requests []mockRequest
+}
+
+func newMockES(t *testing.T, routes map[string][]mockResponse) *mockES {
+	t.Helper()
+	m := &mockES{t: t, routes: routes}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// newTLSMockES returns mock server like newMockES serving https
+func newTLSMockES(t *testing.T, routes map[string][]mockResponse) *mockES {
+	t.Helper()
+	m := &mockES{t: t, routes: routes}
+	m.Server = httptest.NewTLSServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// ok returns 200 response with body of testdata file
+func ok(file string) []mockResponse {
+	return []mockResponse{{status: http.StatusOK, file: file}}
+}
+
+func (m *mockES) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	key := r.Method + " " + r.URL.Path
+
+	m.mu.Lock()
+	m.requests = append(m.requests, mockRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   string(body),
+	})
+	responses, found := m.routes[key]
+	var resp mockResponse
+	if found {
+		resp = responses[0]
+		if len(responses) > 1 {
+			m.routes[key] = responses[1:]
+		}
+	}
+	m.mu.Unlock()
+
+	if !found {
+		m.t.Errorf("unexpected request %s", key)
+		http.Error(w, "no route", http.StatusNotImplemented)
+		return
+	}
+
+	for k, v := range resp.header {
+		w.Header()[k] = v
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(resp.status)
+	if resp.file != "" {
+		w.Write(readTestdata(m.t, resp.file))
+	}
+}
+
+// received returns requests of given method and path
+func (m *mockES) received(method, path string) []mockRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var requests []mockRequest
+	for _, r := range m.requests {
+		if r.Method == method && r.Path == path {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+func readTestdata(t *testing.T, file string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+const defaultTestTimeout = 5 * time.Second
+
+func newTestClient(urls ...string) *Client {
+	return NewClient(ClientOptions{
+		URLs:       urls,
+		Timeout:    defaultTestTimeout,
+		RetryDelay: time.Millisecond,
+	})
+}
+
+// testCheck returns check alerting when more than 100 errors were logged in
+// the past hour
+func testCheck() Check {
+	return Check{
+		Index:              IndexOptions{Patterns: []string{"logs-*"}},
+		Query:              "level:error",
+		TimePeriod:         60,
+		Warning:            50,
+		Threshold:          100,
+		Operator:           "lt",
+		ShardFailureStatus: "warning",
+		TimedOutStatus:     "unknown",
+		SamplesOn:          "non-ok",
+	}
+}
@@ -0,0 +1,160 @@
+package escheck
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// esPerIndexSearch runs search of every index separately, at most
+// concurrency of them at once, and merges their results; the first failed
+// search fails all of them
+func (c *Client) esPerIndexSearch(ctx context.Context, baseURL string, indices []string, docType string, opts SearchOptions, content string, queryOptions QueryOptions, concurrency int) (QueryResult, error) {
+	results := make([]QueryResult, len(indices))
+	errs := make([]error, len(indices))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, index := range indices {
+		searchURL, err := getSearchURL(baseURL, []string{index}, docType, opts)
+		if err != nil {
+			return QueryResult{}, err
+		}
+		wg.Add(1)
+		go func(i int, searchURL string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = c.esQueryPost(ctx, searchURL, content)
+		}(i, searchURL)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return QueryResult{}, fmt.Errorf("search of %s: %w", indices[i], err)
+		}
+	}
+	c.debugf("merged results of %d per-index searches", len(indices))
+	return mergeQueryResults(results, queryOptions), nil
+}
+
+// mergeQueryResults sums counts and aggregations of per-index searches;
+// samples of later indices, which hold newer entries, go first and
+// breakdown is cut to the top BreakdownSize values again
+func mergeQueryResults(results []QueryResult, queryOptions QueryOptions) QueryResult {
+	var merged QueryResult
+	merged.Hits.Total.Relation = "eq"
+	buckets := make(map[int64]int)
+	var keys []int64
+	breakdown := newTermsMerger()
+	sampled := newTermsMerger()
+	terms := newTermsMerger()
+	for i := range results {
+		r := results[i]
+		if r.Took > merged.Took {
+			merged.Took = r.Took
+		}
+		merged.TimedOut = merged.TimedOut || r.TimedOut
+		merged.Shards.Total += r.Shards.Total
+		merged.Shards.Successful += r.Shards.Successful
+		merged.Shards.Skipped += r.Shards.Skipped
+		merged.Shards.Failed += r.Shards.Failed
+		merged.Shards.Failures = append(merged.Shards.Failures, r.Shards.Failures...)
+
+		merged.Hits.Total.Value += r.Hits.Total.Value
+		if r.Hits.Total.Relation == "gte" {
+			merged.Hits.Total.Relation = "gte"
+		}
+
+		for _, b := range r.Aggregations.Histogram.Buckets {
+			if _, ok := buckets[b.Key]; !ok {
+				keys = append(keys, b.Key)
+			}
+			buckets[b.Key] += b.DocCount
+		}
+		breakdown.add(r.Aggregations.Breakdown.Buckets)
+		sampled.add(r.Aggregations.Sampler.Breakdown.Buckets)
+		terms.add(r.Aggregations.Terms.Buckets)
+
+		for name, b := range r.Aggregations.Filters.Buckets {
+			if merged.Aggregations.Filters.Buckets == nil {
+				merged.Aggregations.Filters.Buckets = make(map[string]struct {
+					DocCount int `json:"doc_count"`
+				})
+			}
+			f := merged.Aggregations.Filters.Buckets[name]
+			f.DocCount += b.DocCount
+			merged.Aggregations.Filters.Buckets[name] = f
+		}
+		if v := r.Aggregations.Sum.Value; v != nil {
+			sum := *v
+			if merged.Aggregations.Sum.Value != nil {
+				sum += *merged.Aggregations.Sum.Value
+			}
+			merged.Aggregations.Sum.Value = &sum
+		}
+		mergeCoverage(&merged.Aggregations.Coverage, r.Aggregations.Coverage)
+	}
+
+	for i := len(results) - 1; i >= 0; i-- {
+		for _, h := range results[i].Hits.Hits {
+			if len(merged.Hits.Hits) < queryOptions.Samples {
+				merged.Hits.Hits = append(merged.Hits.Hits, h)
+			}
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, k := range keys {
+		merged.Aggregations.Histogram.Buckets = append(merged.Aggregations.Histogram.Buckets, HistogramBucket{Key: k, DocCount: buckets[k]})
+	}
+	merged.Aggregations.Breakdown.Buckets = breakdown.top(queryOptions.BreakdownSize)
+	merged.Aggregations.Sampler.Breakdown.Buckets = sampled.top(queryOptions.BreakdownSize)
+	merged.Aggregations.Terms.Buckets = terms.top(0)
+	return merged
+}
+
+// mergeCoverage widens coverage c by time range of other
+func mergeCoverage(c *Coverage, other Coverage) {
+	if other.Min != nil && (c.Min == nil || *other.Min < *c.Min) {
+		c.Min, c.MinAsString = other.Min, other.MinAsString
+	}
+	if other.Max != nil && (c.Max == nil || *other.Max > *c.Max) {
+		c.Max, c.MaxAsString = other.Max, other.MaxAsString
+	}
+}
+
+// termsMerger : struct containts document counts of terms buckets summed by
+// key in order of first occurrence
+type termsMerger struct {
+	keys   []interface{}
+	counts map[interface{}]int
+}
+
+func newTermsMerger() *termsMerger {
+	return &termsMerger{counts: make(map[interface{}]int)}
+}
+
+func (m *termsMerger) add(buckets []TermsBucket) {
+	for _, b := range buckets {
+		if _, ok := m.counts[b.Key]; !ok {
+			m.keys = append(m.keys, b.Key)
+		}
+		m.counts[b.Key] += b.DocCount
+	}
+}
+
+// top returns buckets with the most documents first, at most size of them,
+// 0 returns all
+func (m *termsMerger) top(size int) []TermsBucket {
+	var buckets []TermsBucket
+	for _, k := range m.keys {
+		buckets = append(buckets, TermsBucket{Key: k, DocCount: m.counts[k]})
+	}
+	sort.SliceStable(buckets, func(i, j int) bool { return buckets[i].DocCount > buckets[j].DocCount })
+	if size > 0 && len(buckets) > size {
+		buckets = buckets[:size]
+	}
+	return buckets
+}
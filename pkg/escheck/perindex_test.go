@@ -0,0 +1,78 @@
+package escheck
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestRunPerIndexSearch(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-a/_search": ok("es7/search.json"),
+		"POST /logs-b/_search": ok("search/terms.json"),
+	})
+
+	check := testCheck()
+	check.Index.Patterns = []string{"logs-a", "logs-b"}
+	check.Histogram = true
+	check.BreakdownField = "service.name"
+	check.BreakdownSize = 2
+	check.Search.PerIndex = 2
+	result := newTestClient(es.URL).Run(check)
+	if result.Count == nil || *result.Count != 25145 {
+		t.Fatalf("count = %v, want sum of per-index counts: %s", result.Count, result.Message)
+	}
+	if len(result.Breakdown) != 2 || fmt.Sprint(result.Breakdown[0].Key) != "api" || fmt.Sprint(result.Breakdown[1].Key) != "dc1" {
+		t.Errorf("breakdown = %+v, want top 2 values of both indices", result.Breakdown)
+	}
+	if n := len(es.received("POST", "/logs-a/_search")) + len(es.received("POST", "/logs-b/_search")); n != 2 {
+		t.Errorf("got %d searches, want one per index", n)
+	}
+}
+
+func TestMergeQueryResults(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	var older, newer QueryResult
+	older.Hits.Total = HitsTotal{Value: 10, Relation: "eq"}
+	older.Shards = ShardsInfo{Total: 2, Successful: 2}
+	older.Aggregations.Histogram.Buckets = []HistogramBucket{{Key: 0, DocCount: 6}, {Key: 60000, DocCount: 4}}
+	older.Aggregations.Sum.Value = value(1.5)
+	older.Aggregations.Coverage = Coverage{Min: value(1000), Max: value(5000)}
+	newer.Hits.Total = HitsTotal{Value: 3, Relation: "gte"}
+	newer.TimedOut = true
+	newer.Shards = ShardsInfo{Total: 2, Successful: 1, Failed: 1}
+	newer.Aggregations.Histogram.Buckets = []HistogramBucket{{Key: 60000, DocCount: 3}}
+	newer.Aggregations.Sum.Value = value(2)
+	newer.Aggregations.Coverage = Coverage{Min: value(4000), Max: value(9000)}
+
+	merged := mergeQueryResults([]QueryResult{older, newer}, QueryOptions{})
+	if merged.Hits.Total.Value != 13 || merged.Hits.Total.Relation != "gte" || !merged.TimedOut {
+		t.Errorf("hits.total = %+v timed out %t, want 13 gte timed out", merged.Hits.Total, merged.TimedOut)
+	}
+	if merged.Shards.Total != 4 || merged.Shards.Failed != 1 {
+		t.Errorf("shards = %+v, want sum of both searches", merged.Shards)
+	}
+	if b := merged.Aggregations.Histogram.Buckets; len(b) != 2 || b[0].DocCount != 6 || b[1].DocCount != 7 {
+		t.Errorf("histogram = %+v, want buckets summed by key", b)
+	}
+	if s := merged.Aggregations.Sum.Value; s == nil || *s != 3.5 {
+		t.Errorf("sum = %v, want 3.5", s)
+	}
+	if c := merged.Aggregations.Coverage; *c.Min != 1000 || *c.Max != 9000 {
+		t.Errorf("coverage = %v..%v, want 1000..9000", *c.Min, *c.Max)
+	}
+}
+
+func TestRunPerIndexSearchUnsupported(t *testing.T) {
+	check := testCheck()
+	check.Search.PerIndex = 4
+	check.PercentileField = "duration"
+	check.Percentile = 99
+	result := newTestClient("http://es.invalid:9200").Run(check)
+	if result.Status != nagiosplugin.UNKNOWN || !strings.Contains(result.Message, "per-index-search parameter can't be combined") {
+		t.Errorf("result = %v %s, want UNKNOWN about percentiles of merged searches", result.Status, result.Message)
+	}
+}
@@ -0,0 +1,120 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// pointInTimeKeepAlive is how long point in time is kept between searches
+// of single check run, every search extends it
+const pointInTimeKeepAlive = "1m"
+
+type pointInTimeKey struct{}
+
+// withPointInTime makes searches of ctx run against point in time id
+// instead of current state of indices
+func withPointInTime(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, pointInTimeKey{}, id)
+}
+
+// pointInTimeID returns point in time of ctx, empty when searches should see
+// current state of indices
+func pointInTimeID(ctx context.Context) string {
+	id, _ := ctx.Value(pointInTimeKey{}).(string)
+	return id
+}
+
+// openPointInTime opens point in time of indices, so count, retry and
+// significant terms searches of check run see the same snapshot even during
+// heavy ingestion
+func (c *Client) openPointInTime(ctx context.Context, baseURL string, indices []string, opts SearchOptions) (string, error) {
+	version, err := c.getESVersion(ctx, baseURL)
+	if err != nil {
+		return "", err
+	}
+	if version != nil && version.IsOpenSearch() {
+		return "", fmt.Errorf("point-in-time parameter is not supported by OpenSearch")
+	}
+	if version != nil && !version.AtLeast(7, 10) {
+		return "", fmt.Errorf("point-in-time parameter requires Elasticsearch 7.10 or later, cluster runs %s", version)
+	}
+
+	// index options are given when opening, searches of point in time
+	// reject them
+	params := url.Values{"keep_alive": {pointInTimeKeepAlive}}
+	params.Set("ignore_unavailable", fmt.Sprintf("%t", opts.IgnoreUnavailable))
+	if opts.Routing != "" {
+		params.Set("routing", opts.Routing)
+	}
+	if opts.Preference != "" {
+		params.Set("preference", opts.Preference)
+	}
+	pitURL, err := BuildURL(baseURL, params, escapeIndexNames(indices), "_pit")
+	if err != nil {
+		return "", err
+	}
+	resp, body, err := c.esRequest(ctx, "POST", pitURL, nil, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", esResponseError(resp.Status, body)
+	}
+	var pit struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(body), &pit); err != nil || pit.ID == "" {
+		return "", fmt.Errorf("JSON parse failed")
+	}
+	c.debugf("opened point in time of %s", escapeIndexNames(indices))
+	return pit.ID, nil
+}
+
+// closePointInTime frees point in time, it uses own deadline as the check
+// deadline may already be expired
+func (c *Client) closePointInTime(baseURL, id string) {
+	closeURL, err := BuildURL(baseURL, nil, "_pit")
+	if err != nil {
+		return
+	}
+	data, _ := json.Marshal(map[string]string{"id": id})
+	ctx, cancel := c.newTimeoutContext()
+	defer cancel()
+	resp, body, err := c.esRequest(ctx, "DELETE", closeURL, http.Header{"Content-Type": {"application/json"}}, string(data))
+	if err != nil {
+		c.debugf("point in time cleanup failed: %v", err)
+	} else if resp.StatusCode != 200 && resp.StatusCode != 404 {
+		c.debugf("point in time cleanup failed: %v", esResponseError(resp.Status, body))
+	}
+}
+
+// pointInTimeSearch returns URL and body of search of point in time id
+// replacing search of indices, index options were given when it was opened
+func pointInTimeSearch(baseURL, body, id string, opts SearchOptions) (string, string, error) {
+	params := url.Values{}
+	if opts.RestTotalHitsAsInt {
+		params.Set("rest_total_hits_as_int", "true")
+	}
+	if opts.RequestCache != "" {
+		params.Set("request_cache", opts.RequestCache)
+	}
+	searchURL, err := BuildURL(baseURL, params, "_search")
+	if err != nil {
+		return "", "", err
+	}
+
+	var search map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &search); err != nil {
+		return "", "", fmt.Errorf("search body is not JSON object: %v", err)
+	}
+	pit, _ := json.Marshal(map[string]string{"id": id, "keep_alive": pointInTimeKeepAlive})
+	search["pit"] = pit
+	data, err := json.Marshal(search)
+	return searchURL, string(data), err
+}
@@ -0,0 +1,78 @@
+package escheck
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestRunPointInTime(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":             ok("es8/root.json"),
+		"POST /logs-*/_pit": ok("pit/open.json"),
+		"POST /_search": {
+			{status: http.StatusOK, file: "search/sum.json"},
+			{status: http.StatusOK, file: "search/significant.json"},
+		},
+		"DELETE /_pit": ok("pit/close.json"),
+	})
+
+	check := testCheck()
+	check.Warning, check.Threshold = 0, 30
+	check.SignificantFields = []string{"host.name"}
+	check.SignificantBackground = 24 * time.Hour
+	check.SignificantSize = 3
+	check.Search.IgnoreUnavailable = true
+	check.Search.PointInTime = true
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.CRITICAL {
+		t.Fatalf("status = %v, want CRITICAL: %s", result.Status, result.Message)
+	}
+	if long := strings.Join(result.LongOutput, "\n"); !strings.Contains(long, "Significant host.name:") {
+		t.Errorf("long output = %q, want significant terms searched within point in time", long)
+	}
+
+	open := es.received("POST", "/logs-*/_pit")
+	if len(open) != 1 || open[0].Query.Get("keep_alive") != pointInTimeKeepAlive || open[0].Query.Get("ignore_unavailable") != "true" {
+		t.Fatalf("open point in time requests = %+v, want one with keep alive and index options", open)
+	}
+	id := "46ToAwMDaWR5BXV1aWQyKwZub2RlXzMAAAAAAAAAACoBYwADaWR4BXV1aWQxAgZub2RlXzEAAAAAAAAAAAEBYQADaWR5BXV1aWQyKgZub2RlXzIAAAAAAAAAAAwBYgACBXV1aWQyAAAFdXVpZDEAAQltYXRjaF9hbGw_gAAAAA=="
+	searches := es.received("POST", "/_search")
+	if len(searches) != 2 {
+		t.Fatalf("got %d searches, want count and significant terms searches of point in time", len(searches))
+	}
+	for _, s := range searches {
+		var body struct {
+			PIT struct {
+				ID        string `json:"id"`
+				KeepAlive string `json:"keep_alive"`
+			} `json:"pit"`
+		}
+		if err := json.Unmarshal([]byte(s.Body), &body); err != nil || body.PIT.ID != id || body.PIT.KeepAlive != pointInTimeKeepAlive {
+			t.Errorf("search body %s, want point in time %s", s.Body, id)
+		}
+		if s.Query.Get("ignore_unavailable") != "" {
+			t.Errorf("search query %v, index options are rejected by search of point in time", s.Query)
+		}
+	}
+	if closed := es.received("DELETE", "/_pit"); len(closed) != 1 || !strings.Contains(closed[0].Body, id) {
+		t.Errorf("close point in time requests = %+v, want one closing %s", closed, id)
+	}
+}
+
+func TestRunPointInTimeUnsupported(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /": ok("es6/root.json"),
+	})
+
+	check := testCheck()
+	check.Search.PointInTime = true
+	result := newTestClient(es.URL).Run(check)
+	if result.Status != nagiosplugin.UNKNOWN || !strings.Contains(result.Message, "requires Elasticsearch 7.10 or later") {
+		t.Errorf("result = %v %s, want UNKNOWN about unsupported version", result.Status, result.Message)
+	}
+}
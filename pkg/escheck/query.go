@@ -0,0 +1,972 @@
+package escheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// IndexOptions : struct containts index naming settings
+type IndexOptions struct {
+	Patterns      []string
+	DataStreams   []string
+	Aliases       []string
+	VerifyAliases bool
+	Resolve       bool
+	DocType       string
+	DateSuffix    bool
+	DateFormat    string
+	Rotation      string
+	UTC           bool
+}
+
+// QueryOptions : struct containts search request body settings
+type QueryOptions struct {
+	Query          string
+	TimeFrom       int64
+	TimeTo         int64
+	Samples        int
+	SampleFields   []string
+	BreakdownField string
+	BreakdownSize  int
+	// SamplerShardSize wraps breakdown in sampler aggregation of the best
+	// matching documents per shard, 0 disables
+	SamplerShardSize int
+	UniqueFields     []string
+	SumField         string
+	PercentileField  string
+	Percentile       float64
+	// Terms are values of BreakdownField counted exactly
+	Terms []string
+	// Filters maps names to queries counted by filters aggregation
+	Filters map[string]string
+	// TimestampFormat is elasticsearch date format of time window bounds,
+	// empty keeps DefaultTimestampFormat
+	TimestampFormat string
+	// FieldFilters are exact values of fields matching entries must have
+	// besides Query
+	FieldFilters []FieldFilter
+	// Coverage adds stats aggregation of @timestamp
+	Coverage bool
+	// Profile makes elasticsearch return profile of search execution
+	Profile bool
+	// Histogram adds date_histogram of Interval buckets, without any
+	// aggregation plain count query is sent
+	Histogram bool
+	// Trend is moving-avg or derivative pipeline aggregation of histogram
+	// of Interval buckets, TrendWindow is moving average window in buckets
+	Trend         string
+	TrendWindow   int
+	Interval      time.Duration
+	SearchTimeout time.Duration
+	Version       *ESVersion
+}
+
+// TemplateESQuery : struct containts elasticsearch query data
+type TemplateESQuery struct {
+	TimeFrom         int64
+	TimeTo           int64
+	HistogramMax     int64
+	RangeFrom        string
+	RangeTo          string
+	TimestampFormat  string
+	FieldFilters     []string
+	Query            string
+	Size             int
+	SourceIncludes   string
+	BreakdownField   string
+	BreakdownSize    int
+	SamplerShardSize int
+	UniqueFields     []string
+	SumField         string
+	// PercentileField is JSON encoded field, Percentile its percent
+	PercentileField string
+	Percentile      float64
+	// Terms is JSON encoded list of breakdown field values counted
+	// exactly regardless of breakdown size
+	Terms     string
+	TermsSize int
+	// Filters is JSON encoded object of named query_string filters
+	Filters        string
+	Coverage       bool
+	Profile        bool
+	TrackTotalHits bool
+	// Aggs is set when any aggregation is requested
+	Aggs          bool
+	Histogram     bool
+	IntervalParam string
+	Interval      string
+	Trend         string
+	TrendWindow   int
+	Timeout       string
+}
+
+// SearchOptions : struct containts search URL parameters
+type SearchOptions struct {
+	IgnoreUnavailable  bool
+	AllowNoIndices     bool
+	IgnoreThrottled    bool
+	IncludeFrozen      bool
+	Routing            string
+	Preference         string
+	RestTotalHitsAsInt bool
+	Async              bool
+	AsyncPollInterval  time.Duration
+	// RequestCache is true or false overriding index request cache setting
+	// for the search, empty keeps index setting
+	RequestCache string
+	// PointInTime runs all searches of check run against point in time
+	// opened before the first one
+	PointInTime bool
+	// PerIndex searches every index separately with this many concurrent
+	// searches and merges their results, 0 searches all indices at once
+	PerIndex int
+}
+
+// QueryResult : struct containts elasticsearch query result
+type QueryResult struct {
+	Took     int        `json:"took"`
+	TimedOut bool       `json:"timed_out"`
+	Shards   ShardsInfo `json:"_shards"`
+	Hits     struct {
+		Total HitsTotal `json:"total"`
+		Hits  []struct {
+			Index  string          `json:"_index"`
+			Source json.RawMessage `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations struct {
+		Histogram struct {
+			Buckets []HistogramBucket `json:"buckets"`
+		} `json:"histogram"`
+		Breakdown struct {
+			Buckets []TermsBucket `json:"buckets"`
+		} `json:"breakdown"`
+		Sampler struct {
+			Breakdown struct {
+				Buckets []TermsBucket `json:"buckets"`
+			} `json:"breakdown"`
+		} `json:"sampler"`
+		Unique UniqueCounts `json:"unique"`
+		Terms  struct {
+			Buckets []TermsBucket `json:"buckets"`
+		} `json:"terms"`
+		Filters struct {
+			Buckets map[string]struct {
+				DocCount int `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"filters"`
+		Sum         MetricValue `json:"sum"`
+		Percentiles struct {
+			Values map[string]*float64 `json:"values"`
+		} `json:"percentiles"`
+		Metric      MetricValue      `json:"metric"`
+		Significant SignificantTerms `json:"significant"`
+		Groups      struct {
+			Buckets  []GroupBucket          `json:"buckets"`
+			AfterKey map[string]interface{} `json:"after_key"`
+			// Truncated is set when not all pages of groups were fetched
+			Truncated bool `json:"-"`
+		} `json:"groups"`
+		Coverage Coverage `json:"coverage"`
+		Matching struct {
+			DocCount int `json:"doc_count"`
+		} `json:"matching"`
+	} `json:"aggregations"`
+	Profile json.RawMessage `json:"profile"`
+}
+
+// Coverage : struct containts stats aggregation of @timestamp, Min and Max
+// are null when no document matched
+type Coverage struct {
+	Min         *float64 `json:"min"`
+	Max         *float64 `json:"max"`
+	MinAsString string   `json:"min_as_string"`
+	MaxAsString string   `json:"max_as_string"`
+}
+
+// GroupBucket : struct containts composite aggregation bucket with "metric"
+// sub-aggregation, Key is value of the grouped field once all pages were
+// fetched
+type GroupBucket struct {
+	Key      interface{} `json:"key"`
+	DocCount int         `json:"doc_count"`
+	Metric   MetricValue `json:"metric"`
+}
+
+// MetricValue : struct containts single value metric aggregation result,
+// Value is null when no document has the field
+type MetricValue struct {
+	Value         *float64 `json:"value"`
+	ValueAsString string   `json:"value_as_string"`
+}
+
+// UniqueCounts maps fields to counts of their unique values returned by
+// cardinality aggregations wrapped in "unique" filter aggregation
+type UniqueCounts map[string]int
+
+// UnmarshalJSON decodes sub-aggregations of "unique" aggregation skipping
+// its doc_count
+func (u *UniqueCounts) UnmarshalJSON(data []byte) error {
+	var aggs map[string]json.RawMessage
+	if err := json.Unmarshal(data, &aggs); err != nil {
+		return err
+	}
+	counts := make(UniqueCounts)
+	for name, raw := range aggs {
+		if name == "doc_count" {
+			continue
+		}
+		var value struct {
+			Value int `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		counts[name] = value.Value
+	}
+	*u = counts
+	return nil
+}
+
+// TermsBucket : struct containts terms aggregation bucket
+type TermsBucket struct {
+	Key      interface{} `json:"key"`
+	DocCount int         `json:"doc_count"`
+}
+
+// HistogramBucket : struct containts date_histogram aggregation bucket
+type HistogramBucket struct {
+	Key      int64 `json:"key"`
+	DocCount int   `json:"doc_count"`
+	// Trend is value of pipeline aggregation of bucket counts, null in
+	// buckets it can't be computed for
+	Trend *MetricValue `json:"trend,omitempty"`
+}
+
+// ShardsInfo : struct containts elasticsearch shards statistics
+type ShardsInfo struct {
+	Total      int            `json:"total"`
+	Successful int            `json:"successful"`
+	Skipped    int            `json:"skipped"`
+	Failed     int            `json:"failed"`
+	Failures   []ShardFailure `json:"failures,omitempty"`
+}
+
+// ShardFailure : struct containts reason of single shard search failure
+type ShardFailure struct {
+	Shard  int          `json:"shard"`
+	Index  string       `json:"index"`
+	Node   string       `json:"node"`
+	Reason ESErrorCause `json:"reason"`
+}
+
+// ResolvedTargets : struct containts _resolve/index API result
+type ResolvedTargets struct {
+	Indices []struct {
+		Name string `json:"name"`
+	} `json:"indices"`
+	Aliases []struct {
+		Name string `json:"name"`
+	} `json:"aliases"`
+	DataStreams []struct {
+		Name string `json:"name"`
+	} `json:"data_streams"`
+}
+
+var (
+	rotationDateFormats = map[string]string{
+		"hourly":  "YYYY.MM.dd.HH",
+		"daily":   "YYYY.MM.dd",
+		"weekly":  "xxxx.ww",
+		"monthly": "YYYY.MM",
+	}
+)
+
+var (
+	templateSource = `
+	{
+		"size": {{ .Size }},
+		{{- if .Timeout }}
+		"timeout": "{{ .Timeout }}",
+		{{- end }}
+		{{- if .TrackTotalHits }}
+		"track_total_hits": true,
+		{{- end }}
+		{{- if .Profile }}
+		"profile": true,
+		{{- end }}
+		{{- if .Size }}
+		"sort": [
+			{
+				"@timestamp": {
+					"order": "desc"
+				}
+			}
+		],
+		{{- end }}
+		"query": {
+			"bool": {
+				"must": [
+					{
+						"query_string": {
+							"analyze_wildcard": true,
+							"query": "{{ .Query }}"
+						}
+					},
+					{
+						"range": {
+							"@timestamp": {
+								{{- if .TimeTo }}
+								"lt": {{ .RangeTo }},
+								{{- else }}
+								"lte": "now",
+								{{- end }}
+								"gte": {{ .RangeFrom }},
+								"format": "{{ .TimestampFormat }}"
+							}
+						}
+					}
+					{{- range .FieldFilters }},
+					{{ . }}
+					{{- end }}
+				],
+				"must_not": []
+			}
+		},
+		"_source": {
+			"includes": {{ .SourceIncludes }},
+			"excludes": []
+		}
+		{{- if .Aggs }},
+		"aggs": {
+			{{- $sep := "" }}
+			{{- if .Histogram }}
+			"histogram": {
+				"date_histogram": {
+					"field": "@timestamp",
+					"{{ .IntervalParam }}": "{{ .Interval }}",
+					"time_zone": "UTC",
+					"min_doc_count": 0,
+					"extended_bounds": {
+						"min": {{ .TimeFrom }},
+						"max": {{ if .TimeTo }}{{ .HistogramMax }}{{ else }}"now"{{ end }}
+					}
+				}
+				{{- if eq .Trend "moving-avg" }},
+				"aggs": {
+					"trend": {
+						"moving_fn": {
+							"buckets_path": "_count",
+							"window": {{ .TrendWindow }},
+							"script": "MovingFunctions.unweightedAvg(values)"
+						}
+					}
+				}
+				{{- else if eq .Trend "derivative" }},
+				"aggs": {
+					"trend": {
+						"derivative": {
+							"buckets_path": "_count"
+						}
+					}
+				}
+				{{- end }}
+			}
+			{{- $sep = "," }}
+			{{- end }}
+			{{- if and .BreakdownField .SamplerShardSize }}{{ $sep }}
+			"sampler": {
+				"sampler": {
+					"shard_size": {{ .SamplerShardSize }}
+				},
+				"aggs": {
+					"breakdown": {
+						"terms": {
+							"field": {{ .BreakdownField }},
+							"size": {{ .BreakdownSize }}
+						}
+					}
+				}
+			}
+			{{- $sep = "," }}
+			{{- else if .BreakdownField }}{{ $sep }}
+			"breakdown": {
+				"terms": {
+					"field": {{ .BreakdownField }},
+					"size": {{ .BreakdownSize }}
+				}
+			}
+			{{- $sep = "," }}
+			{{- end }}
+			{{- if .Terms }}{{ $sep }}
+			"terms": {
+				"terms": {
+					"field": {{ .BreakdownField }},
+					"include": {{ .Terms }},
+					"size": {{ .TermsSize }}
+				}
+			}
+			{{- $sep = "," }}
+			{{- end }}
+			{{- if .Filters }}{{ $sep }}
+			"filters": {
+				"filters": {
+					"filters": {{ .Filters }}
+				}
+			}
+			{{- $sep = "," }}
+			{{- end }}
+			{{- if .Coverage }}{{ $sep }}
+			"coverage": {
+				"stats": {
+					"field": "@timestamp"
+				}
+			}
+			{{- $sep = "," }}
+			{{- end }}
+			{{- if .SumField }}{{ $sep }}
+			"sum": {
+				"sum": {
+					"field": {{ .SumField }}
+				}
+			}
+			{{- $sep = "," }}
+			{{- end }}
+			{{- if .PercentileField }}{{ $sep }}
+			"percentiles": {
+				"percentiles": {
+					"field": {{ .PercentileField }},
+					"percents": [{{ .Percentile }}]
+				}
+			}
+			{{- $sep = "," }}
+			{{- end }}
+			{{- if .UniqueFields }}{{ $sep }}
+			"unique": {
+				"filter": {
+					"match_all": {}
+				},
+				"aggs": {
+					{{- range $i, $field := .UniqueFields }}{{ if $i }},{{ end }}
+					{{ $field }}: {
+						"cardinality": {
+							"field": {{ $field }}
+						}
+					}
+					{{- end }}
+				}
+			}
+			{{- $sep = "," }}
+			{{- end }}
+		}
+		{{- end }}
+	}
+	`
+)
+
+func getRenderedTemplate(templateSource string, opts QueryOptions) (string, error) {
+	includes := opts.SampleFields
+	if includes == nil {
+		includes = []string{}
+	}
+	sourceIncludes, err := json.Marshal(includes)
+	if err != nil {
+		return "", err
+	}
+
+	timestampFormat := opts.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = DefaultTimestampFormat
+	}
+	rangeFrom, err := timestampBound(timestampFormat, time.Unix(opts.TimeFrom, 0))
+	if err != nil {
+		return "", err
+	}
+	rangeTo, err := timestampBound(timestampFormat, time.Unix(opts.TimeTo, 0))
+	if err != nil {
+		return "", err
+	}
+
+	// the last histogram bucket ends at TimeTo, which is excluded from
+	// window
+	t := TemplateESQuery{
+		TimeFrom:         opts.TimeFrom * 1000,
+		TimeTo:           opts.TimeTo * 1000,
+		HistogramMax:     opts.TimeTo*1000 - 1,
+		RangeFrom:        rangeFrom,
+		RangeTo:          rangeTo,
+		TimestampFormat:  timestampFormat,
+		Query:            opts.Query,
+		Size:             opts.Samples,
+		SourceIncludes:   string(sourceIncludes),
+		BreakdownSize:    opts.BreakdownSize,
+		SamplerShardSize: opts.SamplerShardSize,
+		IntervalParam:    "interval",
+		Interval:         "1h",
+		Trend:            opts.Trend,
+		TrendWindow:      opts.TrendWindow,
+		Coverage:         opts.Coverage,
+		Profile:          opts.Profile,
+		Histogram:        opts.Histogram || opts.Trend != "",
+	}
+	if opts.SearchTimeout > 0 {
+		t.Timeout = fmt.Sprintf("%dms", opts.SearchTimeout.Milliseconds())
+	}
+	t.FieldFilters, err = fieldFilterClauses(opts.FieldFilters)
+	if err != nil {
+		return "", err
+	}
+	if opts.Interval > 0 {
+		t.Interval = fmt.Sprintf("%dms", opts.Interval.Milliseconds())
+	}
+	if opts.Version != nil {
+		// hits.total is capped at 10000 since 7.0 unless tracked explicitly
+		t.TrackTotalHits = opts.Version.AtLeast(7, 0)
+		// interval was deprecated in 7.2 and removed in 8.0
+		if opts.Version.AtLeast(7, 2) {
+			t.IntervalParam = "fixed_interval"
+		}
+	}
+	if opts.BreakdownField != "" {
+		field, err := json.Marshal(opts.BreakdownField)
+		if err != nil {
+			return "", err
+		}
+		t.BreakdownField = string(field)
+	}
+	if len(opts.Terms) > 0 {
+		if opts.BreakdownField == "" {
+			return "", fmt.Errorf("breakdown-field parameter is required to count terms")
+		}
+		terms, err := json.Marshal(opts.Terms)
+		if err != nil {
+			return "", err
+		}
+		t.Terms = string(terms)
+		t.TermsSize = len(opts.Terms)
+	}
+	if len(opts.Filters) > 0 {
+		filters := make(map[string]interface{})
+		for name, query := range opts.Filters {
+			filters[name] = map[string]interface{}{
+				"query_string": map[string]interface{}{
+					"analyze_wildcard": true,
+					"query":            query,
+				},
+			}
+		}
+		data, err := json.Marshal(filters)
+		if err != nil {
+			return "", err
+		}
+		t.Filters = string(data)
+	}
+	if opts.SumField != "" {
+		field, err := json.Marshal(opts.SumField)
+		if err != nil {
+			return "", err
+		}
+		t.SumField = string(field)
+	}
+	if opts.PercentileField != "" {
+		field, err := json.Marshal(opts.PercentileField)
+		if err != nil {
+			return "", err
+		}
+		t.PercentileField = string(field)
+		t.Percentile = opts.Percentile
+	}
+	for _, f := range opts.UniqueFields {
+		field, err := json.Marshal(f)
+		if err != nil {
+			return "", err
+		}
+		t.UniqueFields = append(t.UniqueFields, string(field))
+	}
+
+	t.Aggs = t.Histogram || t.BreakdownField != "" || t.Filters != "" || t.Coverage || t.SumField != "" || t.PercentileField != "" || len(t.UniqueFields) > 0
+
+	tmpl, err := template.New("TemplateESQuery").Parse(templateSource)
+	if err != nil {
+		return "", err
+	}
+
+	var tpl bytes.Buffer
+	err = tmpl.Execute(&tpl, t)
+	if err != nil {
+		return "", err
+	}
+
+	return tpl.String(), nil
+}
+
+func (c *Client) esQueryPost(ctx context.Context, url, content string) (QueryResult, error) {
+	header := http.Header{"Content-Type": {"application/json"}}
+	resp, err := c.esOpenRequest(ctx, "POST", url, header, content)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	if resp.StatusCode != 200 {
+		body, _ := readResponse(resp, c.opts.Debugf)
+		return QueryResult{}, esResponseError(resp.Status, body)
+	}
+	return c.parseResult(resp)
+}
+
+// BuildURL appends already escaped path segments to elasticsearch base URL,
+// keeping any path prefix of the base URL (ES behind a reverse proxy)
+func BuildURL(baseURL string, params url.Values, segments ...string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid elasticsearch URL: %v", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid elasticsearch URL: %s", baseURL)
+	}
+
+	u = u.JoinPath(segments...)
+	if len(params) > 0 {
+		u.RawQuery = params.Encode()
+	}
+	return u.String(), nil
+}
+
+func (c *Client) verifyAlias(ctx context.Context, baseURL, alias string) error {
+	aliasURL, err := BuildURL(baseURL, nil, "_alias", url.PathEscape(alias))
+	if err != nil {
+		return err
+	}
+
+	status, body, err := c.esGet(ctx, aliasURL)
+	if err != nil {
+		return err
+	}
+	if status == 404 {
+		return fmt.Errorf("alias '%s' does not exist", alias)
+	}
+	if status != 200 {
+		return fmt.Errorf("alias '%s' verification failed, %v", alias, esResponseError(strconv.Itoa(status), body))
+	}
+
+	var indices map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &indices); err != nil {
+		return fmt.Errorf("JSON parse failed")
+	}
+	if len(indices) == 0 {
+		return fmt.Errorf("alias '%s' does not resolve to any index", alias)
+	}
+	return nil
+}
+
+func (c *Client) resolveIndices(ctx context.Context, baseURL string, indices []string) (*ResolvedTargets, error) {
+	resolveURL, err := BuildURL(baseURL, nil, "_resolve", "index", escapeIndexNames(indices))
+	if err != nil {
+		return nil, err
+	}
+
+	status, body, err := c.esGet(ctx, resolveURL)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("resolve targets failed, %v", esResponseError(strconv.Itoa(status), body))
+	}
+
+	var resolved ResolvedTargets
+	if err := json.Unmarshal([]byte(body), &resolved); err != nil {
+		return nil, fmt.Errorf("JSON parse failed")
+	}
+	return &resolved, nil
+}
+
+// String returns human readable summary of resolved targets
+func (r ResolvedTargets) String() string {
+	var parts []string
+	if len(r.Indices) > 0 {
+		var names []string
+		for _, i := range r.Indices {
+			names = append(names, i.Name)
+		}
+		parts = append(parts, "indices: "+strings.Join(names, ", "))
+	}
+	if len(r.Aliases) > 0 {
+		var names []string
+		for _, a := range r.Aliases {
+			names = append(names, a.Name)
+		}
+		parts = append(parts, "aliases: "+strings.Join(names, ", "))
+	}
+	if len(r.DataStreams) > 0 {
+		var names []string
+		for _, d := range r.DataStreams {
+			names = append(names, d.Name)
+		}
+		parts = append(parts, "data streams: "+strings.Join(names, ", "))
+	}
+	if len(parts) == 0 {
+		return "no targets resolved"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func formatIndexDate(format string, t time.Time) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(format); {
+		rest := format[i:]
+		switch {
+		case strings.HasPrefix(rest, "YYYY"), strings.HasPrefix(rest, "yyyy"):
+			fmt.Fprintf(&buf, "%04d", t.Year())
+			i += 4
+		case strings.HasPrefix(rest, "xxxx"):
+			year, _ := t.ISOWeek()
+			fmt.Fprintf(&buf, "%04d", year)
+			i += 4
+		case strings.HasPrefix(rest, "ww"):
+			_, week := t.ISOWeek()
+			fmt.Fprintf(&buf, "%02d", week)
+			i += 2
+		case strings.HasPrefix(rest, "MM"):
+			fmt.Fprintf(&buf, "%02d", int(t.Month()))
+			i += 2
+		case strings.HasPrefix(rest, "dd"), strings.HasPrefix(rest, "DD"):
+			fmt.Fprintf(&buf, "%02d", t.Day())
+			i += 2
+		case strings.HasPrefix(rest, "HH"):
+			fmt.Fprintf(&buf, "%02d", t.Hour())
+			i += 2
+		default:
+			buf.WriteByte(format[i])
+			i++
+		}
+	}
+	return buf.String()
+}
+
+func rotationPeriodStart(t time.Time, rotation string) time.Time {
+	switch rotation {
+	case "hourly":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case "weekly":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "monthly":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+func nextRotationPeriod(t time.Time, rotation string) time.Time {
+	switch rotation {
+	case "hourly":
+		return t.Add(time.Hour)
+	case "weekly":
+		return t.AddDate(0, 0, 7)
+	case "monthly":
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// getIndexNames returns index names for every rotation period overlapping
+// the time window between from and to
+func getIndexNames(opts IndexOptions, from, to time.Time) []string {
+	if len(opts.DataStreams) > 0 {
+		return opts.DataStreams
+	}
+
+	if len(opts.Aliases) > 0 {
+		return opts.Aliases
+	}
+
+	if opts.UTC {
+		from, to = from.UTC(), to.UTC()
+	} else {
+		from, to = from.Local(), to.Local()
+	}
+
+	// date math resolves to index of the current period only, windows
+	// crossing rotation periods are searched by wildcard instead
+	multiPeriod := !rotationPeriodStart(from, opts.Rotation).Equal(rotationPeriodStart(to, opts.Rotation))
+
+	if !opts.DateSuffix {
+		if !multiPeriod {
+			return opts.Patterns
+		}
+		var indices []string
+		for _, p := range opts.Patterns {
+			if isDateMathIndex(p) {
+				p = dateMathWildcard(p)
+			}
+			indices = append(indices, p)
+		}
+		return indices
+	}
+
+	format := opts.DateFormat
+	if format == "" {
+		format = rotationDateFormats[opts.Rotation]
+	}
+
+	var indices []string
+	seen := make(map[string]bool)
+	for _, p := range opts.Patterns {
+		if isDateMathIndex(p) {
+			if multiPeriod {
+				p = dateMathWildcard(p)
+			}
+			if !seen[p] {
+				seen[p] = true
+				indices = append(indices, p)
+			}
+			continue
+		}
+		for t := rotationPeriodStart(from, opts.Rotation); !t.After(to); t = nextRotationPeriod(t, opts.Rotation) {
+			index := p + "-" + formatIndexDate(format, t)
+			if !seen[index] {
+				seen[index] = true
+				indices = append(indices, index)
+			}
+		}
+	}
+	return indices
+}
+
+// isDateMathIndex reports whether index is an elasticsearch date math
+// expression like <logstash-{now/d}>, which is resolved by the server
+func isDateMathIndex(index string) bool {
+	if i := strings.Index(index, ":"); i >= 0 && !strings.Contains(index[:i], "<") {
+		index = index[i+1:]
+	}
+	return strings.HasPrefix(index, "<") && strings.HasSuffix(index, ">")
+}
+
+// dateMathWildcard replaces date math of index expression with wildcard,
+// eg.: <logstash-{now/d{yyyy.MM.dd}}> becomes logstash-*
+func dateMathWildcard(index string) string {
+	var cluster string
+	if i := strings.Index(index, ":"); i >= 0 && !strings.Contains(index[:i], "<") {
+		cluster, index = index[:i+1], index[i+1:]
+	}
+	index = strings.TrimSuffix(strings.TrimPrefix(index, "<"), ">")
+
+	var b strings.Builder
+	depth := 0
+	for _, r := range index {
+		switch {
+		case r == '{':
+			if depth == 0 && !strings.HasSuffix(b.String(), "*") {
+				b.WriteByte('*')
+			}
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return cluster + b.String()
+}
+
+func escapeIndexNames(indices []string) string {
+	var escaped []string
+	for _, i := range indices {
+		// remote cluster separator (europe:logstash-*) is a legal path
+		// character but gets mangled by some proxies, escape it as well
+		escaped = append(escaped, strings.Replace(url.PathEscape(i), ":", "%3A", -1))
+	}
+	return strings.Join(escaped, ",")
+}
+
+func getSearchParams(opts SearchOptions) url.Values {
+	params := url.Values{}
+	params.Set("ignore_unavailable", fmt.Sprintf("%t", opts.IgnoreUnavailable))
+	params.Set("allow_no_indices", fmt.Sprintf("%t", opts.AllowNoIndices))
+	if opts.IgnoreThrottled {
+		params.Set("ignore_throttled", "true")
+	} else if opts.IncludeFrozen {
+		params.Set("ignore_throttled", "false")
+	}
+	if opts.Routing != "" {
+		params.Set("routing", opts.Routing)
+	}
+	if opts.Preference != "" {
+		params.Set("preference", opts.Preference)
+	}
+	if opts.RestTotalHitsAsInt {
+		params.Set("rest_total_hits_as_int", "true")
+	}
+	if opts.RequestCache != "" {
+		params.Set("request_cache", opts.RequestCache)
+	}
+	return params
+}
+
+func getSearchURL(baseURL string, indices []string, docType string, opts SearchOptions) (string, error) {
+	segments := []string{escapeIndexNames(indices)}
+	if docType != "" {
+		segments = append(segments, url.PathEscape(docType))
+	}
+	endpoint := "_search"
+	searchParams := getSearchParams(opts)
+	if opts.Async {
+		endpoint = "_async_search"
+		searchParams = asyncSearchParams(searchParams, opts.AsyncPollInterval)
+	}
+	return BuildURL(baseURL, searchParams, append(segments, endpoint)...)
+}
+
+// parseResult decodes search response straight from the body without
+// buffering it
+func (c *Client) parseResult(resp *http.Response) (QueryResult, error) {
+	var result QueryResult
+	err := c.decodeResponse(resp, &result)
+	return result, err
+}
+
+// decodeResponse decodes JSON response body into v and closes the body
+func (c *Client) decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	var dump bytes.Buffer
+	if c.opts.Debugf != nil {
+		body = io.TeeReader(body, &dump)
+	}
+
+	err := decodeJSON(body, v)
+	if c.opts.Debugf != nil {
+		debugResponse(c.opts.Debugf, resp, dump.String())
+	}
+	return err
+}
+
+// decodeJSON decodes JSON document read from r into v, malformed documents
+// fail with JSON parse failed error
+func decodeJSON(r io.Reader, v interface{}) error {
+	err := json.NewDecoder(r).Decode(v)
+	if err == nil {
+		// drain trailing whitespace so connection can be reused
+		_, err = io.Copy(io.Discard, r)
+	}
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("JSON parse failed")
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package escheck
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeSearchResponse(t *testing.T) {
+	tests := []struct {
+		file      string
+		total     int
+		relation  string
+		buckets   int
+		samples   int
+		breakdown int
+		failed    int
+	}{
+		{"es2/search.json", 1532, "eq", 1, 0, 0, 0},
+		{"es6/search.json", 87, "eq", 2, 1, 0, 0},
+		{"es7/search.json", 25013, "eq", 1, 0, 2, 0},
+		{"es8/search.json", 4, "eq", 1, 0, 0, 0},
+		{"search/timed_out.json", 120, "gte", 0, 0, 0, 0},
+		{"search/shard_failures.json", 310, "eq", 0, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			var result QueryResult
+			if err := decodeJSON(bytes.NewReader(readTestdata(t, tt.file)), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Hits.Total.Value != tt.total || result.Hits.Total.Relation != tt.relation {
+				t.Errorf("hits.total = %+v, want %d %s", result.Hits.Total, tt.total, tt.relation)
+			}
+			if n := len(result.Aggregations.Histogram.Buckets); n != tt.buckets {
+				t.Errorf("%d histogram buckets, want %d", n, tt.buckets)
+			}
+			if n := len(result.Hits.Hits); n != tt.samples {
+				t.Errorf("%d hits, want %d", n, tt.samples)
+			}
+			if n := len(result.Aggregations.Breakdown.Buckets); n != tt.breakdown {
+				t.Errorf("%d breakdown buckets, want %d", n, tt.breakdown)
+			}
+			if n := len(result.Shards.Failures); n != tt.failed || result.Shards.Failed != tt.failed {
+				t.Errorf("%d shard failures (failed %d), want %d", n, result.Shards.Failed, tt.failed)
+			}
+		})
+	}
+}
+
+func TestDecodeMalformedResponse(t *testing.T) {
+	var result QueryResult
+	err := decodeJSON(bytes.NewReader(readTestdata(t, "search/truncated.json")), &result)
+	if err == nil || err.Error() != "JSON parse failed" {
+		t.Errorf("error = %v, want JSON parse failed", err)
+	}
+}
+
+// doerFunc : adapter allowing ordinary functions as Doer
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHTTPClientOption(t *testing.T) {
+	var paths []string
+	client := NewClient(ClientOptions{
+		URLs:    []string{"http://es.invalid:9200"},
+		Timeout: defaultTestTimeout,
+		Version: "8.11",
+		HTTPClient: doerFunc(func(req *http.Request) (*http.Response, error) {
+			paths = append(paths, req.URL.Path)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Status:     "200 OK",
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(string(readTestdata(t, "es8/search.json")))),
+				Request:    req,
+			}, nil
+		}),
+	})
+
+	result := client.Run(testCheck())
+	if result.Count == nil || *result.Count != 4 {
+		t.Errorf("count = %v, want 4: %s", result.Count, result.Message)
+	}
+	if len(paths) != 1 || paths[0] != "/logs-*/_search" {
+		t.Errorf("requested paths %q, want only search", paths)
+	}
+}
+
+func TestGetIndexNames(t *testing.T) {
+	from := time.Date(2024, 3, 9, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		opts   IndexOptions
+		window time.Duration
+		want   []string
+	}{
+		{"single day", IndexOptions{Patterns: []string{"logs"}, DateSuffix: true, Rotation: "daily"}, time.Hour, []string{"logs-2024.03.09"}},
+		{"multiple days", IndexOptions{Patterns: []string{"logs"}, DateSuffix: true, Rotation: "daily"}, 50 * time.Hour, []string{"logs-2024.03.09", "logs-2024.03.10", "logs-2024.03.11", "logs-2024.03.12"}},
+		{"hourly", IndexOptions{Patterns: []string{"logs"}, DateSuffix: true, Rotation: "hourly"}, 90 * time.Minute, []string{"logs-2024.03.09.22", "logs-2024.03.09.23"}},
+		{"date math within day", IndexOptions{Patterns: []string{"<logs-{now/d}>"}}, time.Hour, []string{"<logs-{now/d}>"}},
+		{"date math across days", IndexOptions{Patterns: []string{"<logs-{now/d{yyyy.MM.dd}}>", "europe:<app-{now/d}-v2>"}}, 48 * time.Hour, []string{"logs-*", "europe:app-*-v2"}},
+		{"date math with date suffix", IndexOptions{Patterns: []string{"<logs-{now/d}>", "audit"}, DateSuffix: true, Rotation: "daily"}, 26 * time.Hour, []string{"logs-*", "audit-2024.03.09", "audit-2024.03.10", "audit-2024.03.11"}},
+		{"wildcard", IndexOptions{Patterns: []string{"logs-*"}}, 72 * time.Hour, []string{"logs-*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.UTC = true
+			got := getIndexNames(tt.opts, from, from.Add(tt.window))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("indices = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
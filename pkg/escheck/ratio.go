@@ -0,0 +1,95 @@
+package escheck
+
+import (
+	"fmt"
+	"time"
+)
+
+// RatioCheck : struct containts check comparing percentage of documents
+// matching query among documents matching total query in time window with
+// thresholds, eg.: 5xx responses of all access log lines
+type RatioCheck struct {
+	Index  IndexOptions
+	Search SearchOptions
+	Query  string
+	// TotalQuery selects documents the percentage is computed of, empty
+	// matches all documents
+	TotalQuery     string
+	TimestampField string
+	// TimestampFormat is date format of range bounds, eg.: epoch_second,
+	// empty keeps DefaultTimestampFormat
+	TimestampFormat string
+	// TimePeriod is time window in minutes
+	TimePeriod int
+	// Warning and Critical are percentages compared according to Operator
+	// like in Check, warning 0 disables
+	Warning       float64
+	Critical      float64
+	Operator      string
+	SearchTimeout time.Duration
+}
+
+// RunRatio evaluates ratio check, errors are reported as UNKNOWN result
+func (c *Client) RunRatio(check RatioCheck) *CheckResult {
+	stats := &requestStats{}
+	result := c.runRatio(check, stats)
+	result.Requests = stats.get()
+	return result
+}
+
+func (c *Client) runRatio(check RatioCheck, stats *requestStats) *CheckResult {
+	if check.Query == "" {
+		return newFailureResult(FailureInternal, "query parameter is required")
+	}
+	if check.Operator != "lt" && check.Operator != "gt" {
+		return newFailureResult(FailureInternal, "compare-operator parameter should be 'lt' or 'gt'")
+	}
+	if check.TimePeriod <= 0 {
+		return newFailureResult(FailureInternal, "time-period parameter should be greater than 0")
+	}
+	totalQuery := check.TotalQuery
+	if totalQuery == "" {
+		totalQuery = "*"
+	}
+	field := check.TimestampField
+	if field == "" {
+		field = "@timestamp"
+	}
+
+	// both counts come from the same search, so they cover the same
+	// documents
+	result, err := c.runMetricSearch(MetricSearch{
+		Index:           check.Index,
+		Search:          check.Search,
+		Query:           totalQuery,
+		TimestampField:  field,
+		TimestampFormat: check.TimestampFormat,
+		From:            time.Now().Add(-time.Duration(check.TimePeriod) * time.Minute),
+		SearchTimeout:   check.SearchTimeout,
+		Filter:          check.Query,
+	}, stats)
+	if err != nil {
+		return newQueryErrorResult(err)
+	}
+
+	total, count := result.Hits.Total.Value, result.Aggregations.Matching.DocCount
+	var percent float64
+	if total > 0 {
+		percent = float64(count) / float64(total) * 100
+	}
+	r := newCheckResult(MetricStatus(percent, check.Warning, check.Critical, check.Operator),
+		fmt.Sprintf("%d entries of '%s' are %.3f%% of %d entries of '%s' found in the past %d minutes", count, check.Query, percent, total, totalQuery, check.TimePeriod))
+	r.Count = &count
+	if result.Shards.Failed > 0 {
+		r.Message += fmt.Sprintf(", incomplete search: %d of %d shards failed", result.Shards.Failed, result.Shards.Total)
+	}
+	p := PerfDatum{Label: "ratio", Unit: "%", Value: percent, Crit: floatPtr(check.Critical), Min: floatPtr(0), Max: floatPtr(100)}
+	if check.Warning != 0 {
+		p.Warn = floatPtr(check.Warning)
+	}
+	r.AddPerfDatum(p)
+	r.AddPerfDatum(PerfDatum{Label: "count", Value: float64(count), Min: floatPtr(0)})
+	r.AddPerfDatum(PerfDatum{Label: "total", Value: float64(total), Min: floatPtr(0)})
+	addSearchStats(r, result.Took, result.Shards)
+	return r
+}
@@ -0,0 +1,36 @@
+package escheck
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+func TestRunRatio(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("search/ratio.json"),
+	})
+	check := RatioCheck{
+		Index:      IndexOptions{Patterns: []string{"logs-*"}},
+		Query:      "http.response.status_code:[500 TO 599]",
+		TimePeriod: 15,
+		Warning:    0.1,
+		Critical:   0.5,
+		Operator:   "lt",
+	}
+
+	result := newTestClient(es.URL).RunRatio(check)
+	if result.Status != nagiosplugin.WARNING {
+		t.Errorf("status = %v, want WARNING: %s", result.Status, result.Message)
+	}
+	if want := "24 entries of 'http.response.status_code:[500 TO 599]' are 0.150% of 16000 entries of '*' found in the past 15 minutes"; result.Message != want {
+		t.Errorf("message = %q, want %q", result.Message, want)
+	}
+
+	body := es.received("POST", "/logs-*/_search")[0].Body
+	if !strings.Contains(body, `"matching":{"filter":{"query_string":{"analyze_wildcard":true,"query":"http.response.status_code:[500 TO 599]"}}}`) {
+		t.Errorf("search body has no filter aggregation of query:\n%s", body)
+	}
+}
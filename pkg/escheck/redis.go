@@ -0,0 +1,186 @@
+package escheck
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisStateStore : struct containts Redis key keeping state, so every
+// instance of the check behind load balancer or on several monitoring hosts
+// shares the same circuit breaker
+type RedisStateStore struct {
+	// URL is redis://[user:password@]host:port[/db], rediss:// uses TLS
+	URL string
+	Key string
+	// TTL expires state nobody updates anymore, 0 keeps it forever
+	TTL       time.Duration
+	TLSConfig *tls.Config
+}
+
+// Load reads state key, missing key means fresh state
+func (s *RedisStateStore) Load(ctx context.Context) (*State, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return &State{}, err
+	}
+	defer conn.close()
+
+	reply, err := conn.do("GET", s.Key)
+	if err != nil {
+		return &State{}, fmt.Errorf("redis: %v", err)
+	}
+	if reply == nil {
+		return &State{}, nil
+	}
+	return decodeState([]byte(*reply), "redis key "+s.Key)
+}
+
+// Save writes state key, state is replaced as a whole so no locking is
+// needed
+func (s *RedisStateStore) Save(ctx context.Context, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	args := []string{"SET", s.Key, string(data)}
+	if s.TTL > 0 {
+		args = append(args, "PX", strconv.FormatInt(s.TTL.Milliseconds(), 10))
+	}
+	if _, err := conn.do(args...); err != nil {
+		return fmt.Errorf("redis: %v", err)
+	}
+	return nil
+}
+
+// redisConn : struct containts connection speaking RESP protocol, only
+// commands needed by RedisStateStore are supported
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dial connects to Redis and authenticates, connection deadline is taken
+// from ctx
+func (s *RedisStateStore) dial(ctx context.Context) (*redisConn, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %v", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("redis URL should start with redis:// or rediss://")
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	var conn net.Conn
+	if u.Scheme == "rediss" {
+		config := &tls.Config{}
+		if s.TLSConfig != nil {
+			config = s.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = u.Hostname()
+		}
+		conn, err = (&tls.Dialer{Config: config}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %v", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if u.User != nil {
+		args := []string{"AUTH"}
+		if user := u.User.Username(); user != "" && user != "default" {
+			args = append(args, user)
+		}
+		password, _ := u.User.Password()
+		if _, err := c.do(append(args, password)...); err != nil {
+			c.close()
+			return nil, fmt.Errorf("redis: %v", err)
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" && db != "0" {
+		if _, err := strconv.Atoi(db); err != nil {
+			c.close()
+			return nil, fmt.Errorf("invalid redis database %s", db)
+		}
+		if _, err := c.do("SELECT", db); err != nil {
+			c.close()
+			return nil, fmt.Errorf("redis: %v", err)
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) close() {
+	c.conn.Close()
+}
+
+// do sends command and returns its reply, nil for null bulk string
+func (c *redisConn) do(args ...string) (*string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (*string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("malformed reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		value := line[1:]
+		return &value, nil
+	case '-':
+		return nil, fmt.Errorf("%s", line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed reply")
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		value := string(data[:size])
+		return &value, nil
+	}
+	return nil, fmt.Errorf("unexpected reply type %q", line[0])
+}
@@ -0,0 +1,218 @@
+package escheck
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// PerfDatum : struct containts single performance data value, unset
+// thresholds are nil
+type PerfDatum struct {
+	Label string   `json:"label"`
+	Unit  string   `json:"unit,omitempty"`
+	Value float64  `json:"value"`
+	Warn  *float64 `json:"warn,omitempty"`
+	Crit  *float64 `json:"crit,omitempty"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	// WarnRange and CritRange are thresholds in Nagios range syntax used
+	// instead of Warn and Crit, eg.: 10:500
+	WarnRange string `json:"warn_range,omitempty"`
+	CritRange string `json:"crit_range,omitempty"`
+}
+
+// Failure : kind of failure which prevented check from being evaluated
+type Failure string
+
+// failures are reported with UNKNOWN status, callers may map them to other
+// states
+const (
+	// FailureInternal is invalid check definition or plugin error
+	FailureInternal Failure = "internal"
+	// FailureElasticsearch is unreachable cluster or error response
+	FailureElasticsearch Failure = "elasticsearch"
+	// FailureTimeout is request exceeding per request or overall timeout
+	FailureTimeout Failure = "timeout"
+)
+
+// CheckResult : struct containts check result passed to output formats
+type CheckResult struct {
+	Status  nagiosplugin.Status
+	Message string
+	// Failure is set when check couldn't be evaluated
+	Failure Failure
+	// HTTPStatus is response code of failed elasticsearch request
+	HTTPStatus int
+	// Requests is set by Client.Run
+	Requests   *RequestStats
+	Count      *int
+	Took       *int
+	Shards     *ShardsInfo
+	Buckets    []HistogramBucket
+	Samples    []json.RawMessage
+	Breakdown  []TermsBucket
+	Duration   time.Duration
+	PerfData   []PerfDatum
+	LongOutput []string
+	// Profile is search profile returned when Check.Profile is set
+	Profile json.RawMessage
+	// KibanaLink is Discover link of matching entries when Check.KibanaURL
+	// is set
+	KibanaLink string
+}
+
+// String renders performance data value in Nagios plugin format:
+// 'label'=value[UOM];[warn];[crit];[min];[max]
+func (p PerfDatum) String() string {
+	label := p.Label
+	if strings.ContainsAny(label, " '=") {
+		label = "'" + strings.Replace(label, "'", "''", -1) + "'"
+	}
+	warn, crit := formatPerfValue(p.Warn), formatPerfValue(p.Crit)
+	if p.WarnRange != "" {
+		warn = p.WarnRange
+	}
+	if p.CritRange != "" {
+		crit = p.CritRange
+	}
+	return fmt.Sprintf("%s=%s%s;%s;%s;%s;%s", label, formatPerfValue(&p.Value), p.Unit, warn, crit, formatPerfValue(p.Min), formatPerfValue(p.Max))
+}
+
+func formatPerfValue(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+// FormatPluginOutput renders message, perfdata and long output the way
+// Nagios expects plugin output: "prefix message | perfdata\nlong output".
+// If maxBytes is positive, message and long output are truncated to fit
+// while prefix and perfdata block are kept valid.
+func FormatPluginOutput(result *CheckResult, prefix string, maxBytes int) string {
+	perfData := result.PerfData
+	message := sanitizeOutput(result.Message)
+	if maxBytes > 0 {
+		// drop whole perfdata values rather than emitting a broken block
+		for len(perfData) > 0 && len(prefix)+len(formatPerfData(perfData)) > maxBytes {
+			perfData = perfData[:len(perfData)-1]
+		}
+		budget := maxBytes - len(prefix) - len(formatPerfData(perfData))
+		message = truncateString(message, budget)
+	}
+
+	output := prefix + message + formatPerfData(perfData)
+	for i, l := range result.LongOutput {
+		line := "\n" + sanitizeOutput(l)
+		if maxBytes > 0 {
+			reserve := 0
+			if i < len(result.LongOutput)-1 {
+				reserve = len(truncatedMarker)
+			}
+			if len(output)+len(line)+reserve > maxBytes {
+				if len(output)+len(truncatedMarker) <= maxBytes {
+					output += truncatedMarker
+				}
+				break
+			}
+		}
+		output += line
+	}
+	return output
+}
+
+// sanitizeOutput makes text safe for Nagios status and long output lines:
+// pipes would start perfdata, so they are replaced, control characters
+// (including newlines) become spaces and invalid UTF-8 is replaced
+func sanitizeOutput(s string) string {
+	s = strings.ToValidUTF8(s, "?")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '|':
+			return '/'
+		case r == '\t' || r == '\n' || r == '\r':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+}
+
+const truncatedMarker = "\n(output truncated)"
+
+func formatPerfData(perfData []PerfDatum) string {
+	if len(perfData) == 0 {
+		return ""
+	}
+	var perf []string
+	for _, p := range perfData {
+		perf = append(perf, p.String())
+	}
+	return " | " + strings.Join(perf, " ")
+}
+
+// truncateString shortens s to at most n bytes including "..." suffix,
+// without splitting multi-byte characters
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n < 3 {
+		return ""
+	}
+	cut := n - 3
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
+
+func newCheckResult(status nagiosplugin.Status, message string) *CheckResult {
+	return &CheckResult{
+		Status:  status,
+		Message: message,
+	}
+}
+
+// newFailureResult returns UNKNOWN result of check failing with kind of
+// failure
+func newFailureResult(failure Failure, message string) *CheckResult {
+	return &CheckResult{
+		Status:  nagiosplugin.UNKNOWN,
+		Message: message,
+		Failure: failure,
+	}
+}
+
+// newQueryErrorResult returns UNKNOWN result of failed elasticsearch query,
+// timeouts are told apart from other failures
+func newQueryErrorResult(err error) *CheckResult {
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return newFailureResult(FailureTimeout, err.Error())
+	}
+	result := newFailureResult(FailureElasticsearch, err.Error())
+	var responseErr *ResponseError
+	if errors.As(err, &responseErr) {
+		result.HTTPStatus = responseErr.StatusCode()
+	}
+	return result
+}
+
+// AddPerfDatum appends performance data value to the result
+func (r *CheckResult) AddPerfDatum(p PerfDatum) {
+	r.PerfData = append(r.PerfData, p)
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
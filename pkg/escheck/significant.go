@@ -0,0 +1,219 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SignificantBucket : struct containts significant_terms aggregation
+// bucket, DocCount is count in the window, BgCount in the background
+type SignificantBucket struct {
+	Key      interface{} `json:"key"`
+	DocCount int         `json:"doc_count"`
+	BgCount  int         `json:"bg_count"`
+	Score    float64     `json:"score"`
+}
+
+// SignificantTerms maps fields to buckets of their significant_terms
+// aggregations wrapped in "significant" filter or sampler aggregation
+type SignificantTerms map[string][]SignificantBucket
+
+// UnmarshalJSON decodes sub-aggregations of "significant" aggregation
+// skipping its doc_count
+func (s *SignificantTerms) UnmarshalJSON(data []byte) error {
+	var aggs map[string]json.RawMessage
+	if err := json.Unmarshal(data, &aggs); err != nil {
+		return err
+	}
+	terms := make(SignificantTerms)
+	for name, raw := range aggs {
+		if name == "doc_count" {
+			continue
+		}
+		var value struct {
+			Buckets []SignificantBucket `json:"buckets"`
+		}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		terms[name] = value.Buckets
+	}
+	*s = terms
+	return nil
+}
+
+// significantSearch : struct containts search of values of fields standing
+// out in documents matching query since From compared with documents of
+// background window from BackgroundFrom to From
+type significantSearch struct {
+	Index  IndexOptions
+	Search SearchOptions
+	Query  string
+	Fields []string
+	Size   int
+	// SamplerShardSize replaces match_all filter wrapping aggregations with
+	// sampler of the best matching documents per shard, 0 disables
+	SamplerShardSize int
+	TimestampFormat  string
+	FieldFilters     []FieldFilter
+	From             time.Time
+	BackgroundFrom   time.Time
+	SearchTimeout    time.Duration
+}
+
+// getSignificantSearchBody renders search request body of s
+func getSignificantSearchBody(s significantSearch) (string, error) {
+	format := s.TimestampFormat
+	if format == "" {
+		format = DefaultTimestampFormat
+	}
+	from, err := timestampBound(format, s.From)
+	if err != nil {
+		return "", err
+	}
+	backgroundFrom, err := timestampBound(format, s.BackgroundFrom)
+	if err != nil {
+		return "", err
+	}
+	aggs := map[string]interface{}{}
+	for _, field := range s.Fields {
+		aggs[field] = map[string]interface{}{
+			"significant_terms": map[string]interface{}{
+				"field": field,
+				"size":  s.Size,
+				"background_filter": map[string]interface{}{
+					"range": map[string]interface{}{
+						"@timestamp": map[string]interface{}{
+							"gte":    json.RawMessage(backgroundFrom),
+							"lt":     json.RawMessage(from),
+							"format": format,
+						},
+					},
+				},
+			},
+		}
+	}
+	wrapper := map[string]interface{}{
+		"filter": map[string]interface{}{"match_all": map[string]interface{}{}},
+		"aggs":   aggs,
+	}
+	if s.SamplerShardSize > 0 {
+		wrapper = map[string]interface{}{
+			"sampler": map[string]interface{}{"shard_size": s.SamplerShardSize},
+			"aggs":    aggs,
+		}
+	}
+	must := []interface{}{
+		map[string]interface{}{
+			"query_string": map[string]interface{}{
+				"analyze_wildcard": true,
+				"query":            s.Query,
+			},
+		},
+		map[string]interface{}{
+			"range": map[string]interface{}{
+				"@timestamp": map[string]interface{}{
+					"gte":    json.RawMessage(from),
+					"lte":    "now",
+					"format": format,
+				},
+			},
+		},
+	}
+	for _, f := range s.FieldFilters {
+		must = append(must, f.clause())
+	}
+	body := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": must,
+			},
+		},
+		"aggs": map[string]interface{}{
+			"significant": wrapper,
+		},
+	}
+	if s.SearchTimeout > 0 {
+		body["timeout"] = fmt.Sprintf("%dms", s.SearchTimeout.Milliseconds())
+	}
+	data, err := json.Marshal(body)
+	return string(data), err
+}
+
+// searchSignificantTerms runs significant terms search against single node,
+// indices of both background and check window are searched
+func (c *Client) searchSignificantTerms(ctx context.Context, baseURL string, s significantSearch) (SignificantTerms, error) {
+	version, err := c.getESVersion(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if s.Index.DocType != "" && version != nil && version.TypesRemoved() {
+		s.Index.DocType = ""
+	}
+	body, err := getSignificantSearchBody(s)
+	if err != nil {
+		return nil, err
+	}
+	// significant terms are a hint for responders, not worth waiting for
+	// async search
+	s.Search.Async = false
+	searchURL, err := getSearchURL(baseURL, getIndexNames(s.Index, s.BackgroundFrom, time.Now()), s.Index.DocType, s.Search)
+	if err != nil {
+		return nil, err
+	}
+	if id := pointInTimeID(ctx); id != "" {
+		if searchURL, body, err = pointInTimeSearch(baseURL, body, id, s.Search); err != nil {
+			return nil, err
+		}
+	}
+	result, err := c.esQueryPost(ctx, searchURL, body)
+	if err != nil {
+		return nil, err
+	}
+	return result.Aggregations.Significant, nil
+}
+
+// getSignificantTerms runs significant terms search of check against the
+// cluster, within point in time pit of the count search when opened
+func (c *Client) getSignificantTerms(check Check, timeFrom int64, pit string, stats *requestStats) (SignificantTerms, error) {
+	from := time.Unix(timeFrom, 0)
+	s := significantSearch{
+		Index:            check.Index,
+		Search:           check.Search,
+		Query:            check.Query,
+		Fields:           check.SignificantFields,
+		Size:             check.SignificantSize,
+		SamplerShardSize: check.SamplerShardSize,
+		TimestampFormat:  check.TimestampFormat,
+		FieldFilters:     check.FieldFilters,
+		From:             from,
+		BackgroundFrom:   from.Add(-check.SignificantBackground),
+		SearchTimeout:    check.SearchTimeout,
+	}
+	var terms SignificantTerms
+	err := c.queryCluster(func(ctx context.Context, baseURL string) error {
+		var err error
+		terms, err = c.searchSignificantTerms(withRequestStats(withPointInTime(ctx, pit), stats), baseURL, s)
+		return err
+	})
+	return terms, err
+}
+
+// formatSignificantTerms returns long output lines of significant terms in
+// order of fields
+func formatSignificantTerms(fields []string, terms SignificantTerms) []string {
+	var lines []string
+	for _, field := range fields {
+		if len(terms[field]) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("Significant %s:", field))
+		for _, b := range terms[field] {
+			lines = append(lines, fmt.Sprintf("%v: %d entries, %d in background", b.Key, b.DocCount, b.BgCount))
+		}
+	}
+	return lines
+}
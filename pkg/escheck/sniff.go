@@ -0,0 +1,131 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NodesInfo : struct containts _nodes/http API response
+type NodesInfo struct {
+	Nodes map[string]struct {
+		Roles []string `json:"roles"`
+		HTTP  struct {
+			PublishAddress string `json:"publish_address"`
+		} `json:"http"`
+	} `json:"nodes"`
+}
+
+// publishAddressURL converts node publish_address ("host/ip:port" or
+// "ip:port") to URL using scheme and credentials of seed URL
+func publishAddressURL(seed *url.URL, address string) (string, error) {
+	host := address
+	if i := strings.Index(address, "/"); i >= 0 {
+		_, port, err := net.SplitHostPort(address[i+1:])
+		if err != nil {
+			return "", err
+		}
+		host = net.JoinHostPort(address[:i], port)
+	} else if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", err
+	}
+
+	u := url.URL{Scheme: seed.Scheme, User: seed.User, Host: host}
+	return u.String(), nil
+}
+
+// isMasterOnlyNode is true for dedicated master nodes which shouldn't
+// serve search requests
+func isMasterOnlyNode(roles []string) bool {
+	return len(roles) == 1 && roles[0] == "master"
+}
+
+func (c *Client) sniffNodes(ctx context.Context, baseURL string) ([]string, error) {
+	seed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid elasticsearch URL: %v", err)
+	}
+	nodesURL, err := BuildURL(baseURL, nil, "_nodes", "http")
+	if err != nil {
+		return nil, err
+	}
+
+	status, body, err := c.esGet(ctx, nodesURL)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("nodes sniffing failed, %v", esResponseError(strconv.Itoa(status), body))
+	}
+
+	var info NodesInfo
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		return nil, fmt.Errorf("JSON parse failed")
+	}
+
+	var urls []string
+	for _, node := range info.Nodes {
+		if node.HTTP.PublishAddress == "" || isMasterOnlyNode(node.Roles) {
+			continue
+		}
+		u, err := publishAddressURL(seed, node.HTTP.PublishAddress)
+		if err != nil {
+			c.debugf("skipping node with publish address %s: %v", node.HTTP.PublishAddress, err)
+			continue
+		}
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls, nil
+}
+
+// getEndpoints returns elasticsearch URLs to query, with Sniff these are
+// sniffed nodes followed by seed nodes not sniffed; sniffed nodes are cached
+// for SniffInterval
+func (c *Client) getEndpoints() ([]string, error) {
+	seeds, err := c.seedURLs()
+	if err != nil || !c.opts.Sniff {
+		return seeds, err
+	}
+
+	c.sniffed.Lock()
+	defer c.sniffed.Unlock()
+
+	if len(c.sniffed.urls) == 0 || time.Since(c.sniffed.refreshed) >= c.opts.SniffInterval {
+		var nodes []string
+		err := c.queryEndpoints(seeds, func(ctx context.Context, baseURL string) error {
+			var err error
+			nodes, err = c.sniffNodes(ctx, baseURL)
+			return err
+		})
+		if err != nil {
+			c.debugf("nodes sniffing failed: %v", err)
+		} else if len(nodes) > 0 {
+			c.sniffed.urls = nodes
+			c.sniffed.refreshed = time.Now()
+		}
+	}
+
+	endpoints := append([]string{}, c.sniffed.urls...)
+	for _, seed := range seeds {
+		if !containsString(endpoints, seed) {
+			endpoints = append(endpoints, seed)
+		}
+	}
+	return endpoints, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
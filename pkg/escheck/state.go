@@ -0,0 +1,156 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State : struct containts data persisted between check runs
+type State struct {
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	BreakerOpenUntil    time.Time `json:"breaker_open_until"`
+	// Indices are sizes of indices recorded by growth check at IndicesTime
+	Indices     map[string]IndexSize `json:"indices,omitempty"`
+	IndicesTime time.Time            `json:"indices_time,omitempty"`
+	// Statuses are last states of checks by name, state changes are
+	// notified across separate runs
+	Statuses map[string]string `json:"statuses,omitempty"`
+	// Pipelines are ingest pipeline counters by node and pipeline recorded
+	// by ingest check at PipelinesTime
+	Pipelines     map[string]PipelineStats `json:"pipelines,omitempty"`
+	PipelinesTime time.Time                `json:"pipelines_time,omitempty"`
+}
+
+// StateStore : interface of storage keeping State between check runs, Load
+// returns fresh state when nothing was saved yet
+type StateStore interface {
+	Load(ctx context.Context) (*State, error)
+	Save(ctx context.Context, state *State) error
+}
+
+// FileStateStore : struct containts path of local file keeping state
+type FileStateStore struct {
+	Path string
+}
+
+// Load reads state file, missing file means fresh state
+func (s *FileStateStore) Load(ctx context.Context) (*State, error) {
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return &State{}, err
+	}
+	return decodeState(data, "state file "+s.Path)
+}
+
+// decodeState parses saved state, corrupted state is replaced by fresh one
+func decodeState(data []byte, source string) (*State, error) {
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return &State{}, fmt.Errorf("%s is corrupted: %v", source, err)
+	}
+	return state, nil
+}
+
+// Save writes state atomically so concurrent or killed runs never leave
+// partially written file
+func (s *FileStateStore) Save(ctx context.Context, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, data)
+}
+
+// writeFileAtomic replaces file with data via temporary file in the same
+// directory
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkCircuitBreaker returns error while breaker is open
+func (c *Client) checkCircuitBreaker() error {
+	b := c.opts.Breaker
+	if b.Threshold <= 0 || b.Store == nil {
+		return nil
+	}
+	ctx, cancel := c.newTimeoutContext()
+	defer cancel()
+	state, err := b.Store.Load(ctx)
+	if err != nil {
+		c.debugf("%v", err)
+		return nil
+	}
+	if time.Now().Before(state.BreakerOpenUntil) {
+		return fmt.Errorf("circuit breaker open after %d consecutive connection failures, next attempt at %s", state.ConsecutiveFailures, state.BreakerOpenUntil.Format("15:04:05"))
+	}
+	return nil
+}
+
+// recordCircuitBreaker counts consecutive failures to reach elasticsearch
+// and opens breaker for Cooldown once threshold is reached
+func (c *Client) recordCircuitBreaker(queryErr error) {
+	b := c.opts.Breaker
+	if b.Threshold <= 0 || b.Store == nil {
+		return
+	}
+	if c.opts.Context != nil && c.opts.Context.Err() != nil {
+		// aborted check tells nothing about reachability of elasticsearch
+		return
+	}
+	ctx, cancel := c.newTimeoutContext()
+	defer cancel()
+	state, err := b.Store.Load(ctx)
+	if err != nil {
+		c.debugf("%v", err)
+	}
+
+	var endpointErr *EndpointError
+	if errors.As(queryErr, &endpointErr) {
+		state.ConsecutiveFailures++
+		if state.ConsecutiveFailures >= b.Threshold {
+			state.BreakerOpenUntil = time.Now().Add(b.Cooldown)
+		}
+	} else {
+		state.ConsecutiveFailures = 0
+		state.BreakerOpenUntil = time.Time{}
+	}
+
+	if err := b.Store.Save(ctx, state); err != nil {
+		c.debugf("state save failed: %v", err)
+	}
+}
+
+// queryCluster runs query against elasticsearch endpoints guarded by
+// circuit breaker
+func (c *Client) queryCluster(query func(ctx context.Context, baseURL string) error) error {
+	if err := c.checkCircuitBreaker(); err != nil {
+		return err
+	}
+	endpoints, err := c.getEndpoints()
+	if err == nil {
+		err = c.queryEndpoints(endpoints, query)
+	}
+	c.recordCircuitBreaker(err)
+	return err
+}
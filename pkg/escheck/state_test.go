@@ -0,0 +1,164 @@
+package escheck
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+)
+
+// fakeRedis : struct containts in-memory server answering commands used by
+// RedisStateStore
+type fakeRedis struct {
+	addr     string
+	password string
+	mu       sync.Mutex
+	data     map[string]string
+	commands [][]string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	r := &fakeRedis{addr: listener.Addr().String(), password: password, data: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := r.password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.commands = append(r.commands, args)
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			if args[len(args)-1] == r.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			if value, ok := r.data[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			r.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		r.mu.Unlock()
+		io.WriteString(conn, reply)
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestRedisStateStore(t *testing.T) {
+	redis := newFakeRedis(t, "secret")
+	store := &RedisStateStore{URL: "redis://:secret@" + redis.addr + "/2", Key: "check:state", TTL: time.Hour}
+	ctx := context.Background()
+
+	state, err := store.Load(ctx)
+	if err != nil || state.ConsecutiveFailures != 0 {
+		t.Fatalf("Load() of missing key = %+v, %v, want fresh state", state, err)
+	}
+	until := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.Save(ctx, &State{ConsecutiveFailures: 3, BreakerOpenUntil: until}); err != nil {
+		t.Fatal(err)
+	}
+	state, err = store.Load(ctx)
+	if err != nil || state.ConsecutiveFailures != 3 || !state.BreakerOpenUntil.Equal(until) {
+		t.Errorf("Load() = %+v, %v, want saved state", state, err)
+	}
+
+	for _, c := range redis.commands {
+		if c[0] == "SET" && (c[1] != "check:state" || strings.Join(c[3:], " ") != "PX 3600000") {
+			t.Errorf("SET command = %q, want key with TTL", c)
+		}
+	}
+	if strings.Join(redis.commands[1], " ") != "SELECT 2" {
+		t.Errorf("second command = %q, want SELECT 2", redis.commands[1])
+	}
+
+	store.URL = "redis://:wrong@" + redis.addr
+	if _, err := store.Load(ctx); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Load() with wrong password error = %v, want WRONGPASS", err)
+	}
+}
+
+func TestRunCircuitBreaker(t *testing.T) {
+	store := &FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}
+	client := NewClient(ClientOptions{
+		URLs:    []string{"http://127.0.0.1:1"},
+		Timeout: defaultTestTimeout,
+		Breaker: BreakerOptions{Store: store, Threshold: 2, Cooldown: time.Minute},
+	})
+
+	for i := 0; i < 2; i++ {
+		client.Run(testCheck())
+	}
+	result := client.Run(testCheck())
+	if result.Status != nagiosplugin.UNKNOWN || !strings.HasPrefix(result.Message, "circuit breaker open after 2 consecutive connection failures") {
+		t.Errorf("result = %v %q, want open circuit breaker", result.Status, result.Message)
+	}
+	state, err := store.Load(context.Background())
+	if err != nil || state.ConsecutiveFailures != 2 {
+		t.Errorf("saved state = %+v, %v, want 2 consecutive failures", state, err)
+	}
+}
@@ -0,0 +1,68 @@
+package escheck
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RequestStats : struct containts HTTP requests made to evaluate check, it
+// tells monitoring-side degradation (slow DNS, saturated poller) apart from
+// slow cluster
+type RequestStats struct {
+	Requests int
+	Retries  int
+	// MaxLatency is the longest time to response headers of single request
+	MaxLatency time.Duration
+	// Spans are requests traced when ClientOptions.Trace is set
+	Spans []Span
+}
+
+// requestStats collects RequestStats of requests made with the same context
+type requestStats struct {
+	sync.Mutex
+	stats RequestStats
+	// opaqueID overrides X-Opaque-Id header of client for the requests
+	opaqueID string
+}
+
+type requestStatsKey struct{}
+
+func withRequestStats(ctx context.Context, s *requestStats) context.Context {
+	return context.WithValue(ctx, requestStatsKey{}, s)
+}
+
+// recordRequest stores latency of request, attempt is 0 for the first try
+func recordRequest(ctx context.Context, attempt int, latency time.Duration) {
+	s, _ := ctx.Value(requestStatsKey{}).(*requestStats)
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.stats.Requests++
+	if attempt > 0 {
+		s.stats.Retries++
+	}
+	if latency > s.stats.MaxLatency {
+		s.stats.MaxLatency = latency
+	}
+}
+
+// requestOpaqueID returns X-Opaque-Id of check requests with ctx are made
+// for, empty when client's one applies
+func requestOpaqueID(ctx context.Context) string {
+	s, _ := ctx.Value(requestStatsKey{}).(*requestStats)
+	if s == nil {
+		return ""
+	}
+	return s.opaqueID
+}
+
+func (s *requestStats) get() *RequestStats {
+	s.Lock()
+	defer s.Unlock()
+	stats := s.stats
+	stats.Spans = append([]Span(nil), s.stats.Spans...)
+	return &stats
+}
@@ -0,0 +1,102 @@
+package escheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultTimestampFormat is elasticsearch date format of time window
+// bounds unless other is configured
+const DefaultTimestampFormat = "epoch_millis"
+
+// isoTimestampFormats are built-in elasticsearch formats accepting ISO 8601
+// timestamps with milliseconds in UTC
+var isoTimestampFormats = map[string]bool{
+	"strict_date_optional_time":       true,
+	"date_optional_time":              true,
+	"strict_date_optional_time_nanos": true,
+	"strict_date_time":                true,
+	"date_time":                       true,
+}
+
+// javaDateLetters maps runs of java DateTimeFormatter pattern letters to go
+// time layout elements
+var javaDateLetters = map[string]string{
+	"yyyy": "2006",
+	"uuuu": "2006",
+	"yy":   "06",
+	"MM":   "01",
+	"dd":   "02",
+	"HH":   "15",
+	"mm":   "04",
+	"ss":   "05",
+	"SSS":  "000",
+	"XXX":  "Z07:00",
+	"XX":   "Z0700",
+	"X":    "Z07",
+	"Z":    "-0700",
+	"ZZ":   "-0700",
+}
+
+// javaDateLayout converts java DateTimeFormatter pattern used by
+// elasticsearch custom date formats to go time layout
+func javaDateLayout(pattern string) (string, error) {
+	var layout strings.Builder
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(pattern[i+1:], '\'')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated quote in timestamp format %s", pattern)
+			}
+			layout.WriteString(pattern[i+1 : i+1+end])
+			i += end + 2
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(pattern) && pattern[j] == c {
+				j++
+			}
+			element, ok := javaDateLetters[pattern[i:j]]
+			if !ok {
+				return "", fmt.Errorf("unsupported %s in timestamp format %s", pattern[i:j], pattern)
+			}
+			layout.WriteString(element)
+			i = j
+		default:
+			layout.WriteByte(c)
+			i++
+		}
+	}
+	return layout.String(), nil
+}
+
+// timestampBound returns JSON encoded range bound of t in elasticsearch
+// date format, bounds are rendered in the first of || separated
+// alternatives
+func timestampBound(format string, t time.Time) (string, error) {
+	format = strings.SplitN(format, "||", 2)[0]
+	var bound interface{}
+	switch {
+	case format == "" || format == "epoch_millis":
+		bound = t.UnixNano() / int64(time.Millisecond)
+	case format == "epoch_second":
+		bound = t.Unix()
+	case isoTimestampFormats[format]:
+		bound = t.UTC().Format("2006-01-02T15:04:05.000Z")
+	case strings.Contains(format, "_"):
+		// other built-in formats are named with underscores, which custom
+		// patterns don't use
+		return "", fmt.Errorf("unsupported timestamp format %s", format)
+	default:
+		layout, err := javaDateLayout(format)
+		if err != nil {
+			return "", err
+		}
+		bound = t.UTC().Format(layout)
+	}
+	data, err := json.Marshal(bound)
+	return string(data), err
+}
@@ -0,0 +1,81 @@
+package escheck
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// traceparentPattern matches version 00 of W3C trace context traceparent
+// header
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// TraceContext : struct containts W3C trace context span, elasticsearch
+// requests are sent in child spans of it
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+	Flags   string
+}
+
+// Traceparent returns traceparent header value of span
+func (t *TraceContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%s", t.TraceID, t.SpanID, t.Flags)
+}
+
+// ParseTraceparent parses traceparent header value, eg.: passed by caller
+// of the check
+func ParseTraceparent(value string) (*TraceContext, error) {
+	m := traceparentPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil || m[1] == strings.Repeat("0", 32) || m[2] == strings.Repeat("0", 16) {
+		return nil, fmt.Errorf("invalid traceparent: %s", value)
+	}
+	return &TraceContext{TraceID: m[1], SpanID: m[2], Flags: m[3]}, nil
+}
+
+// NewTraceContext returns sampled span of new trace
+func NewTraceContext() *TraceContext {
+	return &TraceContext{TraceID: randomID(16), SpanID: NewSpanID(), Flags: "01"}
+}
+
+// NewSpanID returns random span ID
+func NewSpanID() string {
+	return randomID(8)
+}
+
+func randomID(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Span : struct containts single elasticsearch request traced as child span
+// of ClientOptions.Trace
+type Span struct {
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Method   string
+	URL      string
+	Start    time.Time
+	// End is when response headers were received like in MaxLatency
+	End time.Time
+	// StatusCode is HTTP response code, 0 when request failed
+	StatusCode int
+	Error      string
+}
+
+// recordSpan stores span of request made with ctx
+func recordSpan(ctx context.Context, span Span) {
+	s, _ := ctx.Value(requestStatsKey{}).(*requestStats)
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.stats.Spans = append(s.stats.Spans, span)
+}
@@ -0,0 +1,58 @@
+package escheck
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || tc.SpanID != "00f067aa0ba902b7" || tc.Flags != "01" {
+		t.Errorf("trace context = %+v", tc)
+	}
+	for _, value := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(value); err == nil {
+			t.Errorf("ParseTraceparent(%q) = nil error, want invalid", value)
+		}
+	}
+}
+
+func TestRunTrace(t *testing.T) {
+	es := newMockES(t, map[string][]mockResponse{
+		"GET /":                ok("es8/root.json"),
+		"POST /logs-*/_search": ok("es8/search.json"),
+	})
+	trace := NewTraceContext()
+	client := NewClient(ClientOptions{
+		URLs:    []string{es.URL},
+		Timeout: defaultTestTimeout,
+		Trace:   trace,
+	})
+	result := client.Run(testCheck())
+
+	if len(result.Requests.Spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(result.Requests.Spans))
+	}
+	reqs := append(es.received("GET", "/"), es.received("POST", "/logs-*/_search")...)
+	for i, span := range result.Requests.Spans {
+		if span.TraceID != trace.TraceID || span.ParentID != trace.SpanID || span.StatusCode != 200 {
+			t.Errorf("span %d = %+v", i, span)
+		}
+		want := "00-" + trace.TraceID + "-" + span.SpanID + "-01"
+		if got := reqs[i].Header.Get("traceparent"); got != want {
+			t.Errorf("traceparent = %q, want %q", got, want)
+		}
+	}
+	if !strings.Contains(result.Requests.Spans[1].URL, "/logs-%2A/_search?") {
+		t.Errorf("span URL = %q", result.Requests.Spans[1].URL)
+	}
+}
@@ -0,0 +1,170 @@
+package escheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// openSearchCompatVersion is elasticsearch version OpenSearch was forked from
+var openSearchCompatVersion = ESVersion{Major: 7, Minor: 10}
+
+// ESVersion : struct containts major and minor version of the cluster
+type ESVersion struct {
+	Major        int
+	Minor        int
+	Distribution string
+}
+
+// ClusterInfo : struct containts elasticsearch root endpoint response
+type ClusterInfo struct {
+	Version struct {
+		Number       string `json:"number"`
+		Distribution string `json:"distribution"`
+	} `json:"version"`
+}
+
+// HitsTotal : struct containts total hits, decoded both from integer (ES < 7)
+// and {"value": N, "relation": "eq"} object (ES >= 7)
+type HitsTotal struct {
+	Value    int    `json:"value"`
+	Relation string `json:"relation"`
+}
+
+// UnmarshalJSON accepts both hits.total formats
+func (t *HitsTotal) UnmarshalJSON(data []byte) error {
+	var value int
+	if err := json.Unmarshal(data, &value); err == nil {
+		t.Value = value
+		t.Relation = "eq"
+		return nil
+	}
+	type hitsTotal HitsTotal
+	return json.Unmarshal(data, (*hitsTotal)(t))
+}
+
+func parseESVersion(number string) (ESVersion, error) {
+	parts := strings.SplitN(number, ".", 3)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return ESVersion{}, fmt.Errorf("invalid elasticsearch version: %s", number)
+	}
+	v := ESVersion{Major: major}
+	if len(parts) > 1 {
+		// pre-release suffixes like 8.0.0-rc1 are only in patch part
+		if v.Minor, err = strconv.Atoi(parts[1]); err != nil {
+			return ESVersion{}, fmt.Errorf("invalid elasticsearch version: %s", number)
+		}
+	}
+	return v, nil
+}
+
+// IsOpenSearch reports whether cluster runs OpenSearch fork
+func (v ESVersion) IsOpenSearch() bool {
+	return v.Distribution == "opensearch"
+}
+
+// AtLeast reports whether version is equal or newer than elasticsearch
+// major.minor, OpenSearch is compared as elasticsearch 7.10 it was forked from
+func (v ESVersion) AtLeast(major, minor int) bool {
+	if v.IsOpenSearch() {
+		v = openSearchCompatVersion
+	}
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// TypesRemoved reports whether document types in URL are rejected, this
+// happened in elasticsearch 8 and OpenSearch 2
+func (v ESVersion) TypesRemoved() bool {
+	if v.IsOpenSearch() {
+		return v.Major >= 2
+	}
+	return v.Major >= 8
+}
+
+func (v ESVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// configuredVersion returns version given by Version and Distribution
+// options, nil if version should be detected
+func (c *Client) configuredVersion() (*ESVersion, error) {
+	if c.opts.Version == "" {
+		return nil, nil
+	}
+	v, err := parseESVersion(c.opts.Version)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.Distribution == "opensearch" {
+		v.Distribution = "opensearch"
+	}
+	return &v, nil
+}
+
+// getESVersion returns configured version or version reported by GET /, nil
+// if it can't be determined (eg. missing monitor privilege); detected
+// versions are cached per URL so each node is probed only once
+func (c *Client) getESVersion(ctx context.Context, baseURL string) (*ESVersion, error) {
+	if c.opts.Version != "" {
+		return c.configuredVersion()
+	}
+
+	c.versions.Lock()
+	defer c.versions.Unlock()
+	v, ok := c.versions.versions[baseURL]
+	if !ok {
+		var err error
+		v, err = c.detectESVersion(ctx, baseURL)
+		if err != nil {
+			c.debugf("version detection failed: %v", err)
+			return nil, nil
+		}
+		if c.versions.versions == nil {
+			c.versions.versions = make(map[string]*ESVersion)
+		}
+		c.versions.versions[baseURL] = v
+	}
+
+	distribution := c.opts.Distribution
+	if distribution != "" && distribution != "auto" && v.DistributionName() != distribution {
+		return nil, fmt.Errorf("expected %s cluster, %s %s found", distribution, v.DistributionName(), v)
+	}
+	return v, nil
+}
+
+func (c *Client) detectESVersion(ctx context.Context, baseURL string) (*ESVersion, error) {
+	rootURL, err := BuildURL(baseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	status, body, err := c.esGet(ctx, rootURL)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, esResponseError(strconv.Itoa(status), body)
+	}
+
+	var info ClusterInfo
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		return nil, fmt.Errorf("JSON parse failed")
+	}
+	v, err := parseESVersion(info.Version.Number)
+	if err != nil {
+		return nil, err
+	}
+	v.Distribution = info.Version.Distribution
+	c.debugf("detected %s version %s", v.DistributionName(), v)
+	return &v, nil
+}
+
+// DistributionName returns human readable cluster distribution
+func (v ESVersion) DistributionName() string {
+	if v.Distribution == "" {
+		return "elasticsearch"
+	}
+	return v.Distribution
+}
@@ -0,0 +1,53 @@
+package escheck
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// explainZeroCount tells apart missing index, empty indices and indices
+// with documents not matching the search, which all make zero count
+func (c *Client) explainZeroCount(ctx context.Context, baseURL string, indices []string) (string, error) {
+	indicesURL, err := catIndicesURL(baseURL, indices)
+	if err != nil {
+		return "", err
+	}
+	status, body, err := c.esGet(ctx, indicesURL)
+	if err != nil {
+		return "", err
+	}
+	if status != 200 && status != 404 {
+		return "", esResponseError(strconv.Itoa(status), body)
+	}
+	var sizes map[string]IndexSize
+	if status == 200 {
+		if sizes, err = parseIndexSizes(body); err != nil {
+			return "", err
+		}
+	}
+	if len(sizes) == 0 {
+		return fmt.Sprintf("no index exists for %s", strings.Join(indices, ", ")), nil
+	}
+
+	var docs int64
+	for _, s := range sizes {
+		docs += s.Docs
+	}
+	if docs == 0 {
+		return fmt.Sprintf("all %d indices are empty", len(sizes)), nil
+	}
+	return fmt.Sprintf("%d documents in %d indices don't match", docs, len(sizes)), nil
+}
+
+// getZeroCountReason runs explainZeroCount against the cluster
+func (c *Client) getZeroCountReason(indices []string, stats *requestStats) (string, error) {
+	var reason string
+	err := c.queryCluster(func(ctx context.Context, baseURL string) error {
+		var err error
+		reason, err = c.explainZeroCount(withRequestStats(ctx, stats), baseURL, indices)
+		return err
+	})
+	return reason, err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var profileFile = kingpin.Flag("profile", "set profile option of count searches and append JSON line with query, index pattern and elasticsearch profile of every search to this file, to find monitoring queries loading coordinating nodes").Envar("CHECK_ES_PROFILE").String()
+
+// ProfileEntry : struct containts single line of --profile file
+type ProfileEntry struct {
+	Time    time.Time       `json:"time"`
+	Cluster string          `json:"cluster,omitempty"`
+	Query   string          `json:"query"`
+	Index   string          `json:"index"`
+	TookMs  *int            `json:"took_ms,omitempty"`
+	Profile json.RawMessage `json:"profile"`
+}
+
+// profileMu serializes writes of concurrently evaluated checks
+var profileMu sync.Mutex
+
+// recordProfile appends search profile of result to --profile file, results
+// without profile (failed or cached searches) are skipped
+func recordProfile(check escheck.Check, cluster string, result *escheck.CheckResult) {
+	if *profileFile == "" || len(result.Profile) == 0 {
+		return
+	}
+	data, err := json.Marshal(ProfileEntry{
+		Time:    time.Now().UTC(),
+		Cluster: cluster,
+		Query:   check.Query,
+		Index:   strings.Join(check.Index.Patterns, ","),
+		TookMs:  result.Took,
+		Profile: result.Profile,
+	})
+	if err == nil {
+		profileMu.Lock()
+		defer profileMu.Unlock()
+		var f *os.File
+		if f, err = os.OpenFile(*profileFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+			_, err = f.Write(append(data, '\n'))
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		logger.Warn("profile file write failed", "file", *profileFile, "error", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	pushgatewayURL      = kingpin.Flag("pushgateway-url", "Prometheus Pushgateway URL to push count, status and duration to after each run").Envar("CHECK_ES_PUSHGATEWAY_URL").String()
+	pushgatewayJob      = kingpin.Flag("pushgateway-job", "job label for Pushgateway grouping key").Envar("CHECK_ES_PUSHGATEWAY_JOB").Default("check_es_logs_count").String()
+	pushgatewayInstance = kingpin.Flag("pushgateway-instance", "instance label for Pushgateway grouping key, defaults to hostname").Envar("CHECK_ES_PUSHGATEWAY_INSTANCE").String()
+)
+
+func pushMetrics(result *escheck.CheckResult, lastRun time.Time) error {
+	instance := *pushgatewayInstance
+	if instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		instance = hostname
+	}
+
+	pushURL, err := escheck.BuildURL(*pushgatewayURL, nil, "metrics", "job", url.PathEscape(*pushgatewayJob), "instance", url.PathEscape(instance))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newTimeoutContext()
+	defer cancel()
+	header := http.Header{"Content-Type": {"text/plain; version=0.0.4"}}
+	resp, _, err := httpRequest(ctx, httpClient, "PUT", pushURL, header, escheck.FormatPrometheusMetrics(result, getPrometheusLabels(), lastRun))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP response code: %s", resp.Status)
+	}
+	return nil
+}
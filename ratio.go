@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	ratioCmd            = kingpin.Command("ratio", "compute percentage of log entries matching query among entries matching --total-query in time window and compare it with thresholds using --compare-operator, eg.: 5xx responses of all access log lines")
+	ratioTotalQuery     = ratioCmd.Flag("total-query", "query selecting entries the percentage is computed of").Envar("CHECK_ES_TOTAL_QUERY").Default("*").String()
+	ratioWarning        = ratioCmd.Flag("warning-percent", "warning threshold for percentage, 0 disables").Envar("CHECK_ES_WARNING_PERCENT").Float64()
+	ratioCritical       = ratioCmd.Flag("critical-percent", "critical threshold for percentage, eg.: 0.1 with --compare-operator lt").Envar("CHECK_ES_CRITICAL_PERCENT").Required().Float64()
+	ratioTimestampField = ratioCmd.Flag("timestamp-field", "field holding time of log entry").Envar("CHECK_ES_TIMESTAMP_FIELD").Default("@timestamp").String()
+)
+
+// getRatioCheck returns percent-of-total check definition given by command
+// line flags
+func getRatioCheck() escheck.RatioCheck {
+	return escheck.RatioCheck{
+		Index:           getIndexOptions(),
+		Search:          getSearchOptions(),
+		Query:           *esQuery,
+		TotalQuery:      *ratioTotalQuery,
+		TimestampField:  *ratioTimestampField,
+		TimestampFormat: *timestampFormat,
+		TimePeriod:      *timePeriod,
+		Warning:         *ratioWarning,
+		Critical:        *ratioCritical,
+		Operator:        *compareOperator,
+		SearchTimeout:   *esTimeout,
+	}
+}
+
+func runRatioCheck() *escheck.CheckResult {
+	check := getRatioCheck()
+	return evaluate(func(c ClusterClient) *escheck.CheckResult {
+		return c.Client.RunRatio(check)
+	}, aggregateWorstResults)
+}
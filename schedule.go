@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule returns time of the next evaluation after t
+type schedule interface {
+	next(t time.Time) time.Time
+}
+
+// intervalSchedule : evaluation every fixed duration
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule : struct containts standard 5 field cron expression (minute,
+// hour, day of month, month, day of week) as bit sets of allowed values
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// day of month and day of week are OR-ed when both are restricted
+	domStar, dowStar bool
+}
+
+// cronField : allowed range of cron expression field
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseSchedule parses duration (eg.: 90s, 5m) or cron expression (eg.:
+// '*/5 * * * *'), empty value means fallback duration
+func parseSchedule(value string, fallback time.Duration) (schedule, error) {
+	if value == "" {
+		value = fallback.String()
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("interval %s must be positive", value)
+		}
+		return intervalSchedule(d), nil
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("interval %s is neither duration nor cron expression with 5 fields", value)
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %s: %v", value, err)
+		}
+		sets[i] = set
+	}
+	// both 0 and 7 mean Sunday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cronSchedule{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     sets[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses comma separated list of *, values and ranges with
+// optional step, eg.: 1-5,*/15
+func parseCronField(value string, field cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(value, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid %s step: %s", field.name, part)
+			}
+			part = part[:i]
+		}
+
+		low, high := field.min, field.max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid %s: %s", field.name, part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid %s: %s", field.name, part)
+				}
+			} else if step > 1 {
+				high = field.max
+			}
+		}
+		if low < field.min || high > field.max || low > high {
+			return 0, fmt.Errorf("%s out of range %d-%d: %s", field.name, field.min, field.max, part)
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (s *cronSchedule) matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// expressions like 30 of February never match, give up after 5 years
+	limit := t.AddDate(5, 0, 0)
+	for ; t.Before(limit); t = t.Add(time.Minute) {
+		if s.matches(t) {
+			return t
+		}
+	}
+	return limit
+}
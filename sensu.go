@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	sensuEventsURL = kingpin.Flag("sensu-events-url", "Sensu Go agent events API (http://127.0.0.1:3031/events) or backend events API URL to submit enriched event to").Envar("CHECK_ES_SENSU_EVENTS_URL").String()
+	sensuAPIKey    = kingpin.Flag("sensu-api-key", "Sensu Go backend API key (token) for event submission").Envar("CHECK_ES_SENSU_API_KEY").String()
+	sensuCheckName = kingpin.Flag("sensu-check-name", "check name used in Sensu output and events").Envar("CHECK_ES_SENSU_CHECK_NAME").Default("check-es-logs-count").String()
+	sensuEntity    = kingpin.Flag("sensu-entity", "entity name, required when submitting to backend events API").Envar("CHECK_ES_SENSU_ENTITY").String()
+)
+
+// SensuEvent : struct containts Sensu Go event submitted to events API
+type SensuEvent struct {
+	Entity  *SensuEntity  `json:"entity,omitempty"`
+	Check   SensuCheck    `json:"check"`
+	Metrics *SensuMetrics `json:"metrics,omitempty"`
+}
+
+// SensuEntity : struct containts Sensu Go event entity
+type SensuEntity struct {
+	EntityClass string        `json:"entity_class"`
+	Metadata    SensuMetadata `json:"metadata"`
+}
+
+// SensuMetadata : struct containts Sensu Go object metadata
+type SensuMetadata struct {
+	Name        string            `json:"name"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// SensuCheck : struct containts Sensu Go event check
+type SensuCheck struct {
+	Metadata SensuMetadata `json:"metadata"`
+	Status   int           `json:"status"`
+	Output   string        `json:"output"`
+	Interval int           `json:"interval,omitempty"`
+}
+
+// SensuMetrics : struct containts Sensu Go event metrics
+type SensuMetrics struct {
+	Points []SensuMetricPoint `json:"points"`
+}
+
+// SensuMetricPoint : struct containts Sensu Go metric point
+type SensuMetricPoint struct {
+	Name      string  `json:"name"`
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// formatSensuOutput renders result in Sensu plugin convention:
+// "<check name> <STATUS>: <message> | <perfdata>" followed by long output
+func formatSensuOutput(result *escheck.CheckResult) string {
+	return escheck.FormatPluginOutput(result, fmt.Sprintf("%s %s: ", *sensuCheckName, result.Status), 0)
+}
+
+// sensuFormatter : struct containts Sensu plugin output renderer, check
+// name is --sensu-check-name unless batch check is rendered
+type sensuFormatter struct{}
+
+func init() {
+	escheck.RegisterFormatter("sensu", sensuFormatter{})
+}
+
+func (sensuFormatter) Format(result *escheck.CheckResult, meta escheck.ResultMeta) (string, error) {
+	if meta.Name == "" {
+		return formatSensuOutput(result), nil
+	}
+	return escheck.FormatPluginOutput(result, fmt.Sprintf("%s %s: ", meta.Name, result.Status), 0), nil
+}
+
+func (sensuFormatter) ExitCode(status nagiosplugin.Status) int {
+	return int(status)
+}
+
+func getSensuEvent(result *escheck.CheckResult) SensuEvent {
+	event := SensuEvent{
+		Check: SensuCheck{
+			Metadata: SensuMetadata{
+				Name: *sensuCheckName,
+				Annotations: map[string]string{
+					"es_query":               *esQuery,
+					"es_time_period_minutes": fmt.Sprintf("%d", *timePeriod),
+					"es_threshold":           fmt.Sprintf("%d", windowThreshold(*countThresholds, 0)),
+					"es_compare_operator":    *compareOperator,
+				},
+			},
+			Status: int(result.Status),
+			Output: formatSensuOutput(result),
+		},
+	}
+	if result.Count != nil {
+		event.Check.Metadata.Annotations["es_count"] = fmt.Sprintf("%d", *result.Count)
+	}
+	if *sensuEntity != "" {
+		event.Entity = &SensuEntity{
+			EntityClass: "proxy",
+			Metadata:    SensuMetadata{Name: *sensuEntity},
+		}
+	}
+
+	if len(result.PerfData) > 0 {
+		now := time.Now().Unix()
+		event.Metrics = &SensuMetrics{}
+		for _, p := range result.PerfData {
+			event.Metrics.Points = append(event.Metrics.Points, SensuMetricPoint{
+				Name:      "es_logs." + p.Label,
+				Value:     p.Value,
+				Timestamp: now,
+			})
+		}
+	}
+	return event
+}
+
+func submitSensuEvent(result *escheck.CheckResult) error {
+	data, err := json.Marshal(getSensuEvent(result))
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	if *sensuAPIKey != "" {
+		header.Set("Authorization", "Key "+*sensuAPIKey)
+	}
+
+	ctx, cancel := newTimeoutContext()
+	defer cancel()
+	resp, _, err := httpRequest(ctx, httpClient, "POST", *sensuEventsURL, header, string(data))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP response code: %s", resp.Status)
+	}
+	return nil
+}
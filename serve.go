@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	serveCmd     = kingpin.Command("serve", "run as daemon evaluating checks on schedule and serving results over HTTP, see --serve")
+	serveCmdAddr = serveCmd.Arg("address", "listen address, eg.: :8080").String()
+	serveAddr    = kingpin.Flag("serve", "run as daemon serving check results over HTTP on this address, eg.: :8080; checks of --batch file (or the command line check named default) are evaluated on their own interval and GET /check?name=NAME returns the latest result, without name all checks are aggregated; HTTP status is 200 for OK and 503 otherwise; SIGHUP reloads --batch file").Envar("CHECK_ES_SERVE").String()
+)
+
+// defaultCheckName is name of the command line check without --name served
+// when --batch is not set
+const defaultCheckName = "default"
+
+// scheduledCheck : struct containts check evaluated on schedule and its
+// latest result
+type scheduledCheck struct {
+	name     string
+	check    escheck.Check
+	interval string
+	schedule schedule
+	// stop ends scheduler loop of the check
+	stop chan struct{}
+
+	mu      sync.RWMutex
+	result  *escheck.CheckResult
+	lastRun time.Time
+	// running is start of evaluation in progress
+	running time.Time
+}
+
+// latest returns copy of the latest result, nil until first evaluation
+// finishes
+func (c *scheduledCheck) latest() (*escheck.CheckResult, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.result == nil {
+		return nil, c.lastRun
+	}
+	result := *c.result
+	return &result, c.lastRun
+}
+
+// sameDefinition reports whether checks evaluate the same query on the same
+// schedule
+func (c *scheduledCheck) sameDefinition(other *scheduledCheck) bool {
+	return c.interval == other.interval && reflect.DeepEqual(c.check, other.check)
+}
+
+// CheckServer : struct containts named checks evaluated by scheduler and
+// served over HTTP from cache
+type CheckServer struct {
+	mu     sync.RWMutex
+	checks []*scheduledCheck
+	byName map[string]*scheduledCheck
+	// sem limits number of checks evaluated at the same time
+	sem chan struct{}
+}
+
+// loadScheduledChecks returns checks of --batch file or the command line
+// check when --batch is not set
+func loadScheduledChecks() ([]*scheduledCheck, error) {
+	batchChecks := []BatchCheck{{Name: commandLineCheckName()}}
+	if *batchFile != "" {
+		var err error
+		if batchChecks, err = loadBatchChecks(*batchFile); err != nil {
+			return nil, err
+		}
+	}
+
+	defaults := getCheck()
+	var checks []*scheduledCheck
+	for _, b := range batchChecks {
+		sched, err := parseSchedule(b.Interval, *scrapeInterval)
+		if err != nil {
+			return nil, fmt.Errorf("check %s: %v", b.Name, err)
+		}
+		checks = append(checks, &scheduledCheck{
+			name:     b.Name,
+			check:    b.apply(defaults),
+			interval: b.Interval,
+			schedule: sched,
+			stop:     make(chan struct{}),
+		})
+	}
+	return checks, nil
+}
+
+func newCheckServer() (*CheckServer, error) {
+	checks, err := loadScheduledChecks()
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := *batchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	s := &CheckServer{sem: make(chan struct{}, concurrency)}
+	s.setChecks(checks)
+	return s, nil
+}
+
+func (s *CheckServer) setChecks(checks []*scheduledCheck) {
+	byName := make(map[string]*scheduledCheck)
+	for _, c := range checks {
+		byName[c.name] = c
+	}
+	s.mu.Lock()
+	s.checks, s.byName = checks, byName
+	s.mu.Unlock()
+}
+
+// getChecks returns current checks, the slice is replaced on reload so it
+// can be used without holding the lock
+func (s *CheckServer) getChecks() ([]*scheduledCheck, map[string]*scheduledCheck) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.checks, s.byName
+}
+
+func (s *CheckServer) evaluate(c *scheduledCheck) {
+	s.sem <- struct{}{}
+	defer func() { <-s.sem }()
+
+	start := time.Now()
+	c.mu.Lock()
+	c.running = start
+	c.mu.Unlock()
+
+	result := evaluateCheck(c.check)
+	result.Duration = time.Since(start)
+	recordResult(c.name, result)
+
+	c.mu.Lock()
+	c.result = result
+	c.lastRun = start
+	c.running = time.Time{}
+	c.mu.Unlock()
+}
+
+// loop evaluates check right away, or when it is due if result was carried
+// over from previous configuration, and then according to its schedule
+// until the check is stopped
+func (s *CheckServer) loop(c *scheduledCheck, immediate bool) {
+	next := time.Now()
+	if _, lastRun := c.latest(); !immediate && !lastRun.IsZero() {
+		next = c.schedule.next(lastRun)
+	}
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-c.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.evaluate(c)
+		next = c.schedule.next(time.Now())
+	}
+}
+
+// start launches scheduler of every check
+func (s *CheckServer) start() {
+	checks, _ := s.getChecks()
+	for _, c := range checks {
+		go s.loop(c, true)
+	}
+}
+
+// reload replaces checks with current content of --batch file, on error the
+// running checks are kept; latest results of checks with the same name are
+// carried over and unchanged checks keep their schedule
+func (s *CheckServer) reload() (int, error) {
+	checks, err := loadScheduledChecks()
+	if err != nil {
+		return 0, err
+	}
+
+	_, old := s.getChecks()
+	for _, c := range checks {
+		if prev, ok := old[c.name]; ok {
+			c.result, c.lastRun = prev.latest()
+		}
+	}
+	s.setChecks(checks)
+
+	for _, prev := range old {
+		close(prev.stop)
+	}
+	for _, c := range checks {
+		prev, ok := old[c.name]
+		go s.loop(c, !ok || !c.sameDefinition(prev))
+	}
+	return len(checks), nil
+}
+
+// reloadOnSignal reloads checks on every SIGHUP
+func (s *CheckServer) reloadOnSignal() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		sdNotify("RELOADING=1")
+		n, err := s.reload()
+		if err != nil {
+			logger.Error("reload failed, keeping previous configuration", "error", err)
+		} else {
+			logger.Info("reloaded checks", "checks", n)
+		}
+		sdNotify("READY=1")
+	}
+}
+
+// aggregate combines latest results of all checks, checks not evaluated yet
+// are UNKNOWN
+func (s *CheckServer) aggregate() *escheck.CheckResult {
+	checks, _ := s.getChecks()
+	names := make([]string, len(checks))
+	results := make([]*escheck.CheckResult, len(checks))
+	for i, c := range checks {
+		names[i] = c.name
+		result, _ := c.latest()
+		if result == nil {
+			result = &escheck.CheckResult{Status: nagiosplugin.UNKNOWN, Message: "no evaluation finished yet"}
+		}
+		results[i] = result
+	}
+	return aggregateBatchResults(names, results)
+}
+
+// healthy fails when evaluation of some check is stuck
+func (s *CheckServer) healthy() error {
+	checks, _ := s.getChecks()
+	for _, c := range checks {
+		c.mu.RLock()
+		running := c.running
+		c.mu.RUnlock()
+		if err := stuckEvaluation(running); err != nil {
+			return fmt.Errorf("check %s: %v", c.name, err)
+		}
+	}
+	return nil
+}
+
+// ready fails until every check finished its first evaluation
+func (s *CheckServer) ready() error {
+	checks, _ := s.getChecks()
+	for _, c := range checks {
+		if result, _ := c.latest(); result == nil {
+			return fmt.Errorf("check %s: no evaluation finished yet", c.name)
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves latest result of check given by name parameter as JSON
+// or, with format=nagios, as plugin output
+func (s *CheckServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	checks, byName := s.getChecks()
+	name := r.URL.Query().Get("name")
+	if name == "" && len(checks) == 1 {
+		name = checks[0].name
+	}
+
+	var result *escheck.CheckResult
+	var check escheck.Check
+	var lastRun time.Time
+	if name == "" {
+		result = s.aggregate()
+	} else {
+		c, ok := byName[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown check: %s", name), http.StatusNotFound)
+			return
+		}
+		if result, lastRun = c.latest(); result == nil {
+			http.Error(w, "no evaluation finished yet", http.StatusServiceUnavailable)
+			return
+		}
+		check = c.check
+	}
+
+	code := http.StatusOK
+	if result.Status != nagiosplugin.OK {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("X-Check-Status", result.Status.String())
+	w.Header().Set("X-Check-Exit-Code", strconv.Itoa(int(result.Status)))
+	if !lastRun.IsZero() {
+		w.Header().Set("Last-Modified", lastRun.UTC().Format(http.TimeFormat))
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "nagios":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		fmt.Fprintln(w, escheck.FormatPluginOutput(result, result.Status.String()+": ", *maxOutputBytes))
+	default:
+		out := escheck.NewJSONResult(result, check)
+		out.Name = name
+		if !lastRun.IsZero() {
+			out.LastRun = &lastRun
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			http.Error(w, "JSON encoding failed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		fmt.Fprintln(w, string(data))
+	}
+}
+
+func runServer(addr string) error {
+	s, err := newCheckServer()
+	if err != nil {
+		return err
+	}
+	s.start()
+	go s.reloadOnSignal()
+
+	mux := http.NewServeMux()
+	mux.Handle("/check", s)
+	registerAdminHandlers(mux, s.healthy, s.ready)
+	return listenAndServe(addr, mux, s.healthy)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	shorthandSchema = kingpin.Flag("shorthand-schema", "log schema of fields filtered by --level, --host, --program and --namespace: ecs (log.level, host.name, process.name, kubernetes.namespace) or logstash (level, host, program and kubernetes.namespace keyword subfields)").Envar("CHECK_ES_SHORTHAND_SCHEMA").Default("ecs").Enum("ecs", "logstash")
+	levelFilter     = kingpin.Flag("level", "count only entries of log level, can be repeated or comma-separated, eg.: --level error").Envar("CHECK_ES_LEVEL").Strings()
+	hostFilter      = kingpin.Flag("host", "count only entries of host, can be repeated or comma-separated, eg.: --host web01").Envar("CHECK_ES_HOST").Strings()
+	programFilter   = kingpin.Flag("program", "count only entries of program, can be repeated or comma-separated, eg.: --program nginx").Envar("CHECK_ES_PROGRAM").Strings()
+	namespaceFilter = kingpin.Flag("namespace", "count only entries of kubernetes namespace, can be repeated or comma-separated, eg.: --namespace prod").Envar("CHECK_ES_NAMESPACE").Strings()
+)
+
+// getFieldFilters returns term filters of shorthand flags on fields of
+// --shorthand-schema
+func getFieldFilters() []escheck.FieldFilter {
+	fields := escheck.ShorthandFields[*shorthandSchema]
+	var filters []escheck.FieldFilter
+	for _, f := range []struct {
+		name   string
+		values []string
+	}{
+		{"level", *levelFilter},
+		{"host", *hostFilter},
+		{"program", *programFilter},
+		{"namespace", *namespaceFilter},
+	} {
+		if values := splitList(f.values); len(values) > 0 {
+			filters = append(filters, escheck.FieldFilter{Field: fields[f.name], Values: values})
+		}
+	}
+	return filters
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+)
+
+// interruptContext is cancelled once SIGTERM or SIGINT arrives during single
+// check run, requests in flight are aborted
+var interruptContext, interruptCancel = context.WithCancel(context.Background())
+
+// interruptGrace is how long interrupted check may take to abort requests
+// before UNKNOWN result is reported anyway
+const interruptGrace = 200 * time.Millisecond
+
+// runInterruptible runs check until it finishes or SIGTERM or SIGINT arrives,
+// eg.: when Nagios kills check exceeding its timeout; interrupted check ends
+// with UNKNOWN result telling how long it ran, second returned value reports
+// interruption
+func runInterruptible(run func() *escheck.CheckResult) (*escheck.CheckResult, bool) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	start := time.Now()
+	done := make(chan *escheck.CheckResult, 1)
+	go func() {
+		done <- run()
+	}()
+
+	select {
+	case result := <-done:
+		return result, false
+	case sig := <-signals:
+		interruptCancel()
+		select {
+		case <-done:
+		case <-time.After(interruptGrace):
+		}
+		elapsed := time.Since(start)
+		return &escheck.CheckResult{
+			Status:   nagiosplugin.UNKNOWN,
+			Message:  fmt.Sprintf("check interrupted by %s after %.1fs", signalName(sig), elapsed.Seconds()),
+			Duration: elapsed,
+		}, true
+	}
+}
+
+func signalName(sig os.Signal) string {
+	switch sig {
+	case syscall.SIGTERM:
+		return "SIGTERM"
+	case syscall.SIGINT:
+		return "SIGINT"
+	}
+	return sig.String()
+}
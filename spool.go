@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	spoolDir      = kingpin.Flag("spool-dir", "write result of every run as Nagios checkresult file to this directory, eg.: check_result_path of Nagios or directory collected later for passive submission").Envar("CHECK_ES_SPOOL_DIR").String()
+	spoolHostname = kingpin.Flag("spool-hostname", "Nagios host name of spooled check results, defaults to hostname").Envar("CHECK_ES_SPOOL_HOSTNAME").String()
+	spoolService  = kingpin.Flag("spool-service", "Nagios service description of spooled check results").Envar("CHECK_ES_SPOOL_SERVICE").Default("check-es-logs-count").String()
+)
+
+// checkResultEscaper escapes plugin output to single line of checkresult
+// file the way Nagios unescapes it
+var checkResultEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// formatCheckResultFile renders result finished at finish in Nagios
+// checkresult file format
+func formatCheckResultFile(result *escheck.CheckResult, host, service string, finish time.Time) string {
+	start := finish.Add(-result.Duration)
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Passive Check Result File ###\nfile_time=%d\n\n", finish.Unix())
+	fmt.Fprintf(&b, "### Nagios Service Check Result ###\n# Time: %s\n", finish.Format(time.ANSIC))
+	fmt.Fprintf(&b, "host_name=%s\nservice_description=%s\n", host, service)
+	b.WriteString("check_type=1\ncheck_options=0\nscheduled_check=0\nreschedule_check=0\nlatency=0.000000\n")
+	fmt.Fprintf(&b, "start_time=%d.%06d\nfinish_time=%d.%06d\n", start.Unix(), start.Nanosecond()/1000, finish.Unix(), finish.Nanosecond()/1000)
+	fmt.Fprintf(&b, "early_timeout=0\nexited_ok=1\nreturn_code=%d\n", int(result.Status))
+	fmt.Fprintf(&b, "output=%s\n", checkResultEscaper.Replace(escheck.FormatPluginOutput(result, result.Status.String()+": ", 0)))
+	return b.String()
+}
+
+// createSpoolFile creates checkresult file with 7 characters long name
+// starting with c, Nagios skips other files of check_result_path
+func createSpoolFile(dir string) (*os.File, error) {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	for attempt := 0; attempt < 100; attempt++ {
+		name := []byte("c")
+		for i := 0; i < 6; i++ {
+			name = append(name, letters[rand.Intn(len(letters))])
+		}
+		f, err := os.OpenFile(filepath.Join(dir, string(name)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !errors.Is(err, os.ErrExist) {
+			return f, err
+		}
+	}
+	return nil, fmt.Errorf("cannot create unique checkresult file in %s", dir)
+}
+
+// spoolResult writes result to --spool-dir, the .ok file telling Nagios
+// the result is complete is created after the result is written
+func spoolResult(result *escheck.CheckResult) error {
+	host := *spoolHostname
+	if host == "" {
+		var err error
+		if host, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+
+	f, err := createSpoolFile(*spoolDir)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(formatCheckResultFile(result, host, *spoolService, time.Now())); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	ok, err := os.Create(f.Name() + ".ok")
+	if err != nil {
+		return err
+	}
+	return ok.Close()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+)
+
+func TestFormatCheckResultFile(t *testing.T) {
+	result := &escheck.CheckResult{
+		Status:     nagiosplugin.WARNING,
+		Message:    `60 entries of 'path:C:\logs | grep' found`,
+		Duration:   1500 * time.Millisecond,
+		PerfData:   []escheck.PerfDatum{{Label: "count", Value: 60, Min: floatPtr(0)}},
+		LongOutput: []string{"api: 40", "worker: 20"},
+	}
+	finish := time.Date(2024, 5, 1, 12, 0, 0, 500000000, time.UTC)
+
+	// pipes of message would start perfdata, so they are replaced; newlines
+	// of long output and backslashes are escaped to keep output single line
+	want := "### Passive Check Result File ###\n" +
+		"file_time=1714564800\n" +
+		"\n" +
+		"### Nagios Service Check Result ###\n" +
+		"# Time: Wed May  1 12:00:00 2024\n" +
+		"host_name=web-1\n" +
+		"service_description=payment errors\n" +
+		"check_type=1\n" +
+		"check_options=0\n" +
+		"scheduled_check=0\n" +
+		"reschedule_check=0\n" +
+		"latency=0.000000\n" +
+		"start_time=1714564799.000000\n" +
+		"finish_time=1714564800.500000\n" +
+		"early_timeout=0\n" +
+		"exited_ok=1\n" +
+		"return_code=1\n" +
+		`output=WARNING: 60 entries of 'path:C:\\logs / grep' found | count=60;;;0;\napi: 40\nworker: 20` + "\n"
+	if got := formatCheckResultFile(result, "web-1", "payment errors", finish); got != want {
+		t.Errorf("formatCheckResultFile() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSpoolResult(t *testing.T) {
+	defer func(dir, host, service string) {
+		*spoolDir, *spoolHostname, *spoolService = dir, host, service
+	}(*spoolDir, *spoolHostname, *spoolService)
+	*spoolDir, *spoolHostname, *spoolService = t.TempDir(), "web-1", "check-es-logs-count"
+
+	for i := 0; i < 2; i++ {
+		if err := spoolResult(&escheck.CheckResult{Status: nagiosplugin.CRITICAL, Message: "no entries"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every result has its own file with .ok marker next to it
+	files, err := filepath.Glob(filepath.Join(*spoolDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("spool files = %v, want 2 results with .ok markers", files)
+	}
+	name := regexp.MustCompile(`^c[a-zA-Z0-9]{6}$`)
+	for _, f := range files {
+		base := filepath.Base(f)
+		if filepath.Ext(base) == ".ok" {
+			if _, err := os.Stat(f[:len(f)-len(".ok")]); err != nil {
+				t.Errorf("marker %s has no result: %v", base, err)
+			}
+			continue
+		}
+		if !name.MatchString(base) {
+			t.Errorf("result file %s, want name c followed by 6 characters", base)
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(`(?m)^host_name=web-1\nservice_description=check-es-logs-count\n`).Match(data) || !regexp.MustCompile(`(?m)^return_code=2\noutput=CRITICAL: no entries\n\z`).Match(data) {
+			t.Errorf("result file %s =\n%s\nwant CRITICAL result of web-1", base, data)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+)
+
+// getStateStore returns store of state between check runs, nil when neither
+// --state-file nor --state-redis is given; label separates state of
+// --cluster clusters
+func getStateStore(urls []string, label string) escheck.StateStore {
+	if *stateRedis != "" {
+		key := *stateKey
+		if key == "" {
+			sum := sha256.Sum256([]byte(strings.Join(urls, ",")))
+			key = "check-es-logs-count:state:" + hex.EncodeToString(sum[:8])
+		}
+		if label != "" {
+			key += ":" + label
+		}
+		return &escheck.RedisStateStore{URL: *stateRedis, Key: key}
+	}
+	if *stateFile != "" {
+		path := *stateFile
+		if label != "" {
+			path += "." + label
+		}
+		return &escheck.FileStateStore{Path: path}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	statsdAddr   = kingpin.Flag("statsd-addr", "StatsD/DogStatsD address (host:port) to emit count and duration to").Envar("CHECK_ES_STATSD_ADDR").String()
+	statsdPrefix = kingpin.Flag("statsd-prefix", "StatsD metric name prefix").Envar("CHECK_ES_STATSD_PREFIX").Default("es_logs").String()
+	statsdTags   = kingpin.Flag("statsd-tag", "DogStatsD tag (key:value) added to every metric, can be repeated").Envar("CHECK_ES_STATSD_TAG").Strings()
+)
+
+// formatStatsdMetrics renders count and status gauges and duration timer,
+// one metric per line
+func formatStatsdMetrics(result *escheck.CheckResult, prefix string, tags []string) string {
+	suffix := ""
+	if len(tags) > 0 {
+		suffix = "|#" + strings.Join(tags, ",")
+	}
+
+	var lines []string
+	if result.Count != nil {
+		lines = append(lines, fmt.Sprintf("%s.count:%d|g%s", prefix, *result.Count, suffix))
+	}
+	lines = append(lines, fmt.Sprintf("%s.status:%d|g%s", prefix, int(result.Status), suffix))
+	lines = append(lines, fmt.Sprintf("%s.duration:%d|ms%s", prefix, int64(result.Duration/time.Millisecond), suffix))
+	return strings.Join(lines, "\n")
+}
+
+func sendStatsdMetrics(result *escheck.CheckResult) error {
+	conn, err := net.DialTimeout("udp", *statsdAddr, time.Second*time.Duration(*timeout))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(formatStatsdMetrics(result, *statsdPrefix, splitList(*statsdTags))))
+	return err
+}
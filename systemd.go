@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends state to systemd notification socket, it does nothing unless
+// run as systemd service with Type=notify
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		// abstract socket namespace
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns systemd WatchdogSec of the service, 0 when
+// watchdog is disabled or meant for other process
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// runWatchdog pings systemd watchdog twice per WatchdogSec as long as healthy
+// returns nil, so systemd restarts the service when evaluation gets stuck
+func runWatchdog(healthy func() error) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := healthy(); err != nil {
+			logger.Warn("skipping systemd watchdog ping", "error", err)
+			continue
+		}
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			logger.Warn("systemd watchdog ping failed", "error", err)
+		}
+	}
+}
+
+// listenAndServe serves handler on addr and notifies systemd once the
+// listener is open
+func listenAndServe(addr string, handler http.Handler, healthy func() error) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if err := sdNotify("READY=1"); err != nil {
+		logger.Warn("systemd notification failed", "error", err)
+	}
+	logger.Info("listening", "address", listener.Addr().String())
+	go runWatchdog(healthy)
+	return http.Serve(listener, handler)
+}
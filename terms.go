@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	termThresholds = kingpin.Flag("term-threshold", "thresholds of count of entries with single value of --breakdown-field given as term=[warning:]critical, repeatable, compared with --compare-operator like total count; in --config file given as map of terms to thresholds, eg.: --breakdown-field datacenter --term-threshold dc1=100 --term-threshold dc2=200:50").Envar("CHECK_ES_TERM_THRESHOLD").Strings()
+)
+
+// termThresholdList is set up in main from --term-threshold flags
+var termThresholdList []escheck.TermThreshold
+
+// parseNamedThreshold parses name=[warning:]critical thresholds given by
+// flag, name is everything before the last '='
+func parseNamedThreshold(flag, spec string) (name string, warning, critical int, err error) {
+	i := strings.LastIndex(spec, "=")
+	if i <= 0 {
+		return "", 0, 0, fmt.Errorf("%s %s should be given as name=[warning:]critical", flag, spec)
+	}
+	values := strings.SplitN(spec[i+1:], ":", 2)
+	if len(values) == 2 {
+		if warning, err = strconv.Atoi(values[0]); err != nil {
+			return "", 0, 0, fmt.Errorf("%s %s: invalid warning threshold", flag, spec)
+		}
+	}
+	if critical, err = strconv.Atoi(values[len(values)-1]); err != nil {
+		return "", 0, 0, fmt.Errorf("%s %s: invalid critical threshold", flag, spec)
+	}
+	return spec[:i], warning, critical, nil
+}
+
+// parseTermThreshold parses term=[warning:]critical thresholds
+func parseTermThreshold(spec string) (escheck.TermThreshold, error) {
+	term, warning, critical, err := parseNamedThreshold("term-threshold", spec)
+	return escheck.TermThreshold{Term: term, Warning: warning, Critical: critical}, err
+}
+
+// setupTermThresholds parses --term-threshold flags
+func setupTermThresholds() error {
+	// terms may contain commas, so values are not split
+	for _, spec := range *termThresholds {
+		t, err := parseTermThreshold(spec)
+		if err != nil {
+			return err
+		}
+		termThresholdList = append(termThresholdList, t)
+	}
+	if len(termThresholdList) > 0 && *breakdownField == "" {
+		return fmt.Errorf("term-threshold parameter requires breakdown-field")
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	trace       = kingpin.Flag("trace", "send W3C traceparent header with elasticsearch requests so APM traces of the cluster can be tied to check execution, spans are exported to --otlp-endpoint").Envar("CHECK_ES_TRACE").Bool()
+	traceparent = kingpin.Flag("traceparent", "traceparent of caller the check execution is traced as child span of, implies --trace, eg.: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01").Envar("CHECK_ES_TRACEPARENT").String()
+)
+
+// checkTrace is span of check execution when tracing is enabled, it is set
+// up in main
+var checkTrace *escheck.TraceContext
+
+// traceParentID is span ID of --traceparent caller
+var traceParentID string
+
+// setupTrace starts span of check execution in trace of --traceparent or
+// in new trace with --trace
+func setupTrace() error {
+	checkTrace, traceParentID = nil, ""
+	if *traceparent != "" {
+		parent, err := escheck.ParseTraceparent(*traceparent)
+		if err != nil {
+			return fmt.Errorf("traceparent parameter: %v", err)
+		}
+		checkTrace = &escheck.TraceContext{TraceID: parent.TraceID, SpanID: escheck.NewSpanID(), Flags: parent.Flags}
+		traceParentID = parent.SpanID
+	} else if *trace {
+		checkTrace = escheck.NewTraceContext()
+	}
+	return nil
+}
+
+// OTLPTracesRequest : struct containts OTLP/HTTP JSON traces export request
+type OTLPTracesRequest struct {
+	ResourceSpans []OTLPResourceSpans `json:"resourceSpans"`
+}
+
+// OTLPResourceSpans : struct containts spans of single resource
+type OTLPResourceSpans struct {
+	Resource struct {
+		Attributes []OTLPAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []OTLPScopeSpans `json:"scopeSpans"`
+}
+
+// OTLPScopeSpans : struct containts spans of single instrumentation scope
+type OTLPScopeSpans struct {
+	Scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"scope"`
+	Spans []OTLPSpan `json:"spans"`
+}
+
+// OTLPSpan : struct containts single OTLP span, trace and span IDs are hex
+// encoded in OTLP JSON
+type OTLPSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []OTLPAttribute `json:"attributes,omitempty"`
+	Status            struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+// OTLP span kinds and status codes
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+// getOTLPTracesRequest returns span of check execution ending at end with
+// child spans of its elasticsearch requests
+func getOTLPTracesRequest(result *escheck.CheckResult, attributes map[string]string, end time.Time) OTLPTracesRequest {
+	var rs OTLPResourceSpans
+	rs.Resource.Attributes = getOTLPResourceAttributes(attributes)
+
+	check := OTLPSpan{
+		TraceID:           checkTrace.TraceID,
+		SpanID:            checkTrace.SpanID,
+		ParentSpanID:      traceParentID,
+		Name:              "check-es-logs-count",
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: fmt.Sprintf("%d", end.Add(-result.Duration).UnixNano()),
+		EndTimeUnixNano:   fmt.Sprintf("%d", end.UnixNano()),
+		Attributes:        []OTLPAttribute{newOTLPAttribute("check.status", result.Status.String())},
+	}
+	check.Status.Code = otlpStatusOK
+	if result.Status == nagiosplugin.UNKNOWN {
+		check.Status.Code = otlpStatusError
+		check.Status.Message = result.Message
+	}
+
+	var ss OTLPScopeSpans
+	ss.Scope.Name = "check-es-logs-count"
+	ss.Scope.Version = ver
+	ss.Spans = []OTLPSpan{check}
+	if result.Requests != nil {
+		for _, s := range result.Requests.Spans {
+			ss.Spans = append(ss.Spans, getOTLPRequestSpan(s))
+		}
+	}
+	rs.ScopeSpans = []OTLPScopeSpans{ss}
+
+	return OTLPTracesRequest{ResourceSpans: []OTLPResourceSpans{rs}}
+}
+
+// getOTLPRequestSpan returns client span of elasticsearch request
+func getOTLPRequestSpan(s escheck.Span) OTLPSpan {
+	name := s.Method
+	if u, err := url.Parse(s.URL); err == nil {
+		name += " " + u.Path
+	}
+	span := OTLPSpan{
+		TraceID:           s.TraceID,
+		SpanID:            s.SpanID,
+		ParentSpanID:      s.ParentID,
+		Name:              name,
+		Kind:              otlpSpanKindClient,
+		StartTimeUnixNano: fmt.Sprintf("%d", s.Start.UnixNano()),
+		EndTimeUnixNano:   fmt.Sprintf("%d", s.End.UnixNano()),
+		Attributes: []OTLPAttribute{
+			newOTLPAttribute("http.request.method", s.Method),
+			newOTLPAttribute("url.full", s.URL),
+		},
+	}
+	span.Status.Code = otlpStatusOK
+	switch {
+	case s.Error != "":
+		span.Status.Code = otlpStatusError
+		span.Status.Message = s.Error
+	case s.StatusCode >= 400:
+		span.Status.Code = otlpStatusError
+		fallthrough
+	default:
+		span.Attributes = append(span.Attributes, newOTLPAttribute("http.response.status_code", strconv.Itoa(s.StatusCode)))
+	}
+	return span
+}
+
+func exportOTLPTraces(result *escheck.CheckResult, end time.Time) error {
+	// sampled flag of caller decides whether the trace is recorded
+	if flags, err := strconv.ParseUint(checkTrace.Flags, 16, 8); err != nil || flags&1 == 0 {
+		return nil
+	}
+	attributes, err := parseKeyValues(*otlpAttributes)
+	if err != nil {
+		return err
+	}
+	headers, err := parseKeyValues(*otlpHeaders)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(getOTLPTracesRequest(result, attributes, end))
+	if err != nil {
+		return err
+	}
+
+	exportURL, err := escheck.BuildURL(*otlpEndpoint, nil, "v1", "traces")
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	for k, v := range headers {
+		header.Set(k, v)
+	}
+
+	ctx, cancel := newTimeoutContext()
+	defer cancel()
+	resp, _, err := httpRequest(ctx, httpClient, "POST", exportURL, header, string(data))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP response code: %s", resp.Status)
+	}
+	return nil
+}
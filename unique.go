@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	minUnique = kingpin.Flag("min-unique", "additionally require at least N unique values of field among matching entries, given as field=N, repeatable; fewer makes the check CRITICAL, eg.: --min-unique host.name=10").Envar("CHECK_ES_MIN_UNIQUE").Strings()
+)
+
+// minUniqueConditions are set up in main from --min-unique flags
+var minUniqueConditions []escheck.UniqueCondition
+
+// parseUniqueCondition parses field=N condition
+func parseUniqueCondition(spec string) (escheck.UniqueCondition, error) {
+	i := strings.LastIndex(spec, "=")
+	if i <= 0 {
+		return escheck.UniqueCondition{}, fmt.Errorf("min-unique %s should be given as field=N", spec)
+	}
+	min, err := strconv.Atoi(spec[i+1:])
+	if err != nil || min <= 0 {
+		return escheck.UniqueCondition{}, fmt.Errorf("min-unique %s: N should be positive integer", spec)
+	}
+	return escheck.UniqueCondition{Field: spec[:i], Min: min}, nil
+}
+
+// setupMinUnique parses --min-unique flags
+func setupMinUnique() error {
+	for _, spec := range splitList(*minUnique) {
+		c, err := parseUniqueCondition(spec)
+		if err != nil {
+			return err
+		}
+		minUniqueConditions = append(minUniqueConditions, c)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	webhookURLs      = kingpin.Flag("webhook-url", "POST JSON event with status, count, breakdown and Kibana link to this URL when state of check changes, can be repeated; states of separate runs (--batch, one-shot) are remembered in --state-file or --state-redis").Envar("CHECK_ES_WEBHOOK_URL").Strings()
+	slackWebhookURLs = kingpin.Flag("slack-webhook-url", "Slack-compatible incoming webhook URL notified when state of check changes, can be repeated").Envar("CHECK_ES_SLACK_WEBHOOK_URL").Strings()
+)
+
+// WebhookEvent : struct containts state change of check posted to
+// --webhook-url
+type WebhookEvent struct {
+	Time           time.Time             `json:"time"`
+	Check          string                `json:"check"`
+	Status         string                `json:"status"`
+	PreviousStatus string                `json:"previous_status"`
+	Message        string                `json:"message"`
+	Count          *int                  `json:"count,omitempty"`
+	Breakdown      []escheck.TermsBucket `json:"breakdown,omitempty"`
+	KibanaLink     string                `json:"kibana_link,omitempty"`
+}
+
+// SlackMessage : struct containts Slack incoming webhook payload
+type SlackMessage struct {
+	Text string `json:"text"`
+}
+
+// checkStatuses keeps last states of checks by name so only state changes
+// are notified
+var checkStatuses = struct {
+	sync.Mutex
+	statuses map[string]string
+}{statuses: make(map[string]string)}
+
+// swapStatus records status of check and returns the previous one, states
+// are persisted in state store when configured so separate runs see state
+// changes too; checks seen for the first time were OK
+func swapStatus(name, status string) (string, error) {
+	checkStatuses.Lock()
+	defer checkStatuses.Unlock()
+
+	store := getStateStore(splitList(*esURLs), "")
+	if store == nil {
+		previous, ok := checkStatuses.statuses[name]
+		checkStatuses.statuses[name] = status
+		if !ok {
+			previous = nagiosplugin.OK.String()
+		}
+		return previous, nil
+	}
+
+	ctx, cancel := newTimeoutContext()
+	defer cancel()
+	state, err := store.Load(ctx)
+	if err != nil {
+		return "", err
+	}
+	previous, ok := state.Statuses[name]
+	if !ok {
+		previous = nagiosplugin.OK.String()
+	}
+	if previous == status {
+		return previous, nil
+	}
+	if state.Statuses == nil {
+		state.Statuses = make(map[string]string)
+	}
+	state.Statuses[name] = status
+	return previous, store.Save(ctx, state)
+}
+
+// notifyStateChange posts result to webhooks when state of check changed
+// since its previous run
+func notifyStateChange(name string, result *escheck.CheckResult) {
+	if len(*webhookURLs) == 0 && len(*slackWebhookURLs) == 0 {
+		return
+	}
+	status := result.Status.String()
+	previous, err := swapStatus(name, status)
+	if err != nil {
+		logger.Warn("check state lookup failed", "check", name, "error", err)
+		return
+	}
+	if previous == status {
+		return
+	}
+
+	event := WebhookEvent{
+		Time:           time.Now().UTC(),
+		Check:          name,
+		Status:         status,
+		PreviousStatus: previous,
+		Message:        result.Message,
+		Count:          result.Count,
+		Breakdown:      result.Breakdown,
+		KibanaLink:     result.KibanaLink,
+	}
+	for _, u := range splitList(*webhookURLs) {
+		if err := postWebhook(u, event); err != nil {
+			logger.Warn("webhook notification failed", "url", escheck.RedactURL(u), "error", err)
+		}
+	}
+	for _, u := range splitList(*slackWebhookURLs) {
+		if err := postWebhook(u, getSlackMessage(event)); err != nil {
+			logger.Warn("Slack notification failed", "error", err)
+		}
+	}
+}
+
+// getSlackMessage formats event as Slack message with breakdown and link
+// on separate lines
+func getSlackMessage(event WebhookEvent) SlackMessage {
+	lines := []string{fmt.Sprintf("*%s* %s -> %s: %s", event.Check, event.PreviousStatus, event.Status, event.Message)}
+	for _, b := range event.Breakdown {
+		lines = append(lines, fmt.Sprintf("• %v: %d", b.Key, b.DocCount))
+	}
+	if event.KibanaLink != "" {
+		lines = append(lines, fmt.Sprintf("<%s|Kibana>", event.KibanaLink))
+	}
+	return SlackMessage{Text: strings.Join(lines, "\n")}
+}
+
+func postWebhook(webhookURL string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newTimeoutContext()
+	defer cancel()
+	resp, _, err := httpRequest(ctx, httpClient, "POST", webhookURL, http.Header{"Content-Type": {"application/json"}}, string(data))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP response code: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+)
+
+// webhookReceiver : struct containts httptest server recording bodies of
+// webhook requests
+type webhookReceiver struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	r := &webhookReceiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" || req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("webhook request %s with content type %q, want JSON POST", req.Method, req.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.bodies = append(r.bodies, string(body))
+		r.mu.Unlock()
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+// setupWebhookTest points webhook flags at receivers and restores flags
+// and remembered states when test ends
+func setupWebhookTest(t *testing.T, generic, slack *webhookReceiver) {
+	savedURLs, savedSlack, savedTimeout, savedClient := *webhookURLs, *slackWebhookURLs, *timeout, httpClient
+	t.Cleanup(func() {
+		*webhookURLs, *slackWebhookURLs, *timeout, httpClient = savedURLs, savedSlack, savedTimeout, savedClient
+		checkStatuses.Lock()
+		checkStatuses.statuses = make(map[string]string)
+		checkStatuses.Unlock()
+	})
+	*webhookURLs, *slackWebhookURLs = []string{generic.URL}, []string{slack.URL}
+	*timeout = 5
+	httpClient = &http.Client{}
+}
+
+func TestNotifyStateChangePayload(t *testing.T) {
+	generic, slack := newWebhookReceiver(t), newWebhookReceiver(t)
+	setupWebhookTest(t, generic, slack)
+
+	count := 120
+	notifyStateChange("payments", &escheck.CheckResult{
+		Status:     nagiosplugin.CRITICAL,
+		Message:    "120 entries of 'level:error' found in the past 5 minutes",
+		Count:      &count,
+		Breakdown:  []escheck.TermsBucket{{Key: "api", DocCount: 100}},
+		KibanaLink: "https://kibana/app/discover",
+	})
+
+	bodies := generic.received()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d webhook requests, want 1", len(bodies))
+	}
+	var event WebhookEvent
+	if err := json.Unmarshal([]byte(bodies[0]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Check != "payments" || event.Status != "CRITICAL" || event.PreviousStatus != "OK" || event.Count == nil || *event.Count != 120 || len(event.Breakdown) != 1 || event.KibanaLink != "https://kibana/app/discover" || event.Time.IsZero() {
+		t.Errorf("webhook event = %s, want CRITICAL state change of payments", bodies[0])
+	}
+
+	bodies = slack.received()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d Slack requests, want 1", len(bodies))
+	}
+	var message SlackMessage
+	if err := json.Unmarshal([]byte(bodies[0]), &message); err != nil {
+		t.Fatal(err)
+	}
+	want := "*payments* OK -> CRITICAL: 120 entries of 'level:error' found in the past 5 minutes\n• api: 100\n<https://kibana/app/discover|Kibana>"
+	if message.Text != want {
+		t.Errorf("Slack text = %q, want %q", message.Text, want)
+	}
+}
+
+func TestNotifyStateChangeTransitions(t *testing.T) {
+	generic, slack := newWebhookReceiver(t), newWebhookReceiver(t)
+	setupWebhookTest(t, generic, slack)
+
+	// the first OK is no change from assumed OK, repeated states aren't
+	// notified again
+	statuses := []nagiosplugin.Status{nagiosplugin.OK, nagiosplugin.CRITICAL, nagiosplugin.CRITICAL, nagiosplugin.OK, nagiosplugin.OK}
+	for _, s := range statuses {
+		notifyStateChange("payments", &escheck.CheckResult{Status: s})
+	}
+	// states of checks are remembered separately
+	notifyStateChange("checkout", &escheck.CheckResult{Status: nagiosplugin.WARNING})
+
+	var got []string
+	for _, body := range generic.received() {
+		var event WebhookEvent
+		if err := json.Unmarshal([]byte(body), &event); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, event.Check+" "+event.PreviousStatus+"->"+event.Status)
+	}
+	want := []string{"payments OK->CRITICAL", "payments CRITICAL->OK", "checkout OK->WARNING"}
+	if len(got) != len(want) {
+		t.Fatalf("webhook events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("webhook event %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if n := len(slack.received()); n != len(want) {
+		t.Errorf("got %d Slack requests, want %d", n, len(want))
+	}
+}
+
+func TestPostWebhookError(t *testing.T) {
+	saved, savedClient := *timeout, httpClient
+	defer func() { *timeout, httpClient = saved, savedClient }()
+	*timeout = 5
+	httpClient = &http.Client{}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer failing.Close()
+	if err := postWebhook(failing.URL, SlackMessage{Text: "x"}); err == nil {
+		t.Error("postWebhook() to HTTP 410 endpoint succeeded, want error")
+	}
+}
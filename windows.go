@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+)
+
+// timePeriod is the first --time-period in minutes, set up in main
+var timePeriod = new(int)
+
+// windowPeriods are all --time-period windows in minutes, set up in main
+var windowPeriods []int
+
+// setupTimePeriods parses --time-period flags given as minutes or
+// duration of whole minutes
+func setupTimePeriods() error {
+	windowPeriods = nil
+	for _, spec := range *timePeriods {
+		minutes, err := strconv.Atoi(spec)
+		if err != nil {
+			d, derr := time.ParseDuration(spec)
+			if derr != nil || d%time.Minute != 0 {
+				return fmt.Errorf("time-period %s should be given as minutes or duration of whole minutes, eg.: 5 or 1h", spec)
+			}
+			minutes = int(d / time.Minute)
+		}
+		if minutes <= 0 {
+			return fmt.Errorf("time-period %s should be greater than 0", spec)
+		}
+		windowPeriods = append(windowPeriods, minutes)
+	}
+	if len(windowPeriods) > 0 {
+		*timePeriod = windowPeriods[0]
+	}
+	if len(*countThresholds) > len(windowPeriods) || len(*warningThresholds) > len(windowPeriods) {
+		return fmt.Errorf("threshold and warning-threshold can be given at most once per time-period")
+	}
+	return nil
+}
+
+// windowThreshold returns threshold of i-th time window, windows without
+// own threshold share the last one given
+func windowThreshold(thresholds []int, i int) int {
+	if len(thresholds) == 0 {
+		return 0
+	}
+	if i >= len(thresholds) {
+		i = len(thresholds) - 1
+	}
+	return thresholds[i]
+}
+
+// windowLabel returns short name of time window of minutes, eg.: 5m or 1h
+func windowLabel(minutes int) string {
+	if minutes%60 == 0 {
+		return fmt.Sprintf("%dh", minutes/60)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// runWindowChecks evaluates check over every --time-period window with
+// thresholds of its position and combines the results
+func runWindowChecks(check escheck.Check) *escheck.CheckResult {
+	results := make([]*escheck.CheckResult, len(windowPeriods))
+	for i, minutes := range windowPeriods {
+		c := check
+		c.TimePeriod = minutes
+		c.BucketInterval = bucketIntervalFor(minutes)
+		c.Threshold = windowThreshold(*countThresholds, i)
+		c.Warning = windowThreshold(*warningThresholds, i)
+		results[i] = evaluateCheck(c)
+	}
+	return aggregateWindowResults(results)
+}
+
+// aggregateWindowResults combines per-window results into one with the
+// worst status, message and long output of every window prefixed by its
+// label and perfdata suffixed by it; count is the one of the first window
+// and samples are those of the worst window having them
+func aggregateWindowResults(results []*escheck.CheckResult) *escheck.CheckResult {
+	aggregate := &escheck.CheckResult{Status: nagiosplugin.OK}
+	if len(results) > 0 {
+		aggregate.Count = results[0].Count
+	}
+	var states []string
+	samplesSeverity := -1
+	for i, r := range results {
+		label := windowLabel(windowPeriods[i])
+		if statusSeverity[r.Status] > statusSeverity[aggregate.Status] {
+			aggregate.Status = r.Status
+		}
+		if len(r.Samples) > 0 && statusSeverity[r.Status] > samplesSeverity {
+			aggregate.Samples = r.Samples
+			samplesSeverity = statusSeverity[r.Status]
+		}
+		if r.Count != nil {
+			states = append(states, fmt.Sprintf("%s %d (%.2f/min) %s", label, *r.Count, float64(*r.Count)/float64(windowPeriods[i]), r.Status))
+		} else {
+			states = append(states, fmt.Sprintf("%s %s", label, r.Status))
+		}
+		aggregate.LongOutput = append(aggregate.LongOutput, fmt.Sprintf("%s %s: %s", label, r.Status, r.Message))
+		for _, line := range r.LongOutput {
+			aggregate.LongOutput = append(aggregate.LongOutput, label+" "+line)
+		}
+		for _, p := range r.PerfData {
+			p.Label += "_" + label
+			aggregate.AddPerfDatum(p)
+		}
+	}
+	aggregate.Requests = mergeRequestStats(results)
+	aggregate.Message = fmt.Sprintf("%d time windows of '%s': %s", len(results), *esQuery, strings.Join(states, ", "))
+	return aggregate
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/olorin/nagiosplugin"
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+)
+
+func TestSetupTimePeriods(t *testing.T) {
+	defer func(periods []string, thresholds, warnings []int, first int) {
+		*timePeriods, *countThresholds, *warningThresholds, *timePeriod = periods, thresholds, warnings, first
+		windowPeriods = nil
+	}(*timePeriods, *countThresholds, *warningThresholds, *timePeriod)
+
+	tests := []struct {
+		periods    []string
+		thresholds []int
+		want       []int
+		wantErr    bool
+	}{
+		{[]string{"5", "1h", "90m"}, []int{10, 100}, []int{5, 60, 90}, false},
+		{[]string{"90s"}, nil, nil, true},
+		{[]string{"0"}, nil, nil, true},
+		{[]string{"5"}, []int{10, 100}, nil, true},
+	}
+	for _, tt := range tests {
+		*timePeriods, *countThresholds, *warningThresholds = tt.periods, tt.thresholds, nil
+		err := setupTimePeriods()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("setupTimePeriods(%v) = %v, want error %v", tt.periods, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (!reflect.DeepEqual(windowPeriods, tt.want) || *timePeriod != tt.want[0]) {
+			t.Errorf("setupTimePeriods(%v) = %v (time period %d), want %v", tt.periods, windowPeriods, *timePeriod, tt.want)
+		}
+	}
+}
+
+func TestWindowThreshold(t *testing.T) {
+	thresholds := []int{10, 100}
+	for i, want := range []int{10, 100, 100} {
+		if got := windowThreshold(thresholds, i); got != want {
+			t.Errorf("windowThreshold(%v, %d) = %d, want %d", thresholds, i, got, want)
+		}
+	}
+	if got := windowThreshold(nil, 1); got != 0 {
+		t.Errorf("windowThreshold(nil, 1) = %d, want 0", got)
+	}
+}
+
+func TestAggregateWindowResults(t *testing.T) {
+	defer func(saved []int) { windowPeriods = saved }(windowPeriods)
+	windowPeriods = []int{5, 60}
+
+	short, long := 3, 120
+	results := []*escheck.CheckResult{
+		{Status: nagiosplugin.OK, Message: "3 entries", Count: &short, LongOutput: []string{"Sample documents (1 unique of 1):"}, Samples: []json.RawMessage{json.RawMessage(`{"id":1}`)}},
+		{Status: nagiosplugin.CRITICAL, Message: "120 entries", Count: &long, LongOutput: []string{"Sample documents (1 unique of 1):"}, Samples: []json.RawMessage{json.RawMessage(`{"id":2}`)}},
+	}
+	result := aggregateWindowResults(results)
+	if result.Status != nagiosplugin.CRITICAL || result.Count == nil || *result.Count != 3 {
+		t.Errorf("result = %v count %v, want CRITICAL with count of the first window", result.Status, result.Count)
+	}
+	if len(result.Samples) != 1 || string(result.Samples[0]) != `{"id":2}` {
+		t.Errorf("samples = %s, want samples of CRITICAL window", result.Samples)
+	}
+	want := []string{
+		"5m OK: 3 entries",
+		"5m Sample documents (1 unique of 1):",
+		"1h CRITICAL: 120 entries",
+		"1h Sample documents (1 unique of 1):",
+	}
+	if !reflect.DeepEqual(result.LongOutput, want) {
+		t.Errorf("long output = %q, want %q", result.LongOutput, want)
+	}
+}
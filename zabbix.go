@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/r0bj/check-es-logs-count/pkg/escheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	zabbixServer = kingpin.Flag("zabbix-server", "Zabbix server or proxy address (host[:port]) to push logs count to with sender protocol").Envar("CHECK_ES_ZABBIX_SERVER").String()
+	zabbixHost   = kingpin.Flag("zabbix-host", "Zabbix host name the item belongs to").Envar("CHECK_ES_ZABBIX_HOST").String()
+	zabbixKey    = kingpin.Flag("zabbix-key", "Zabbix trapper item key").Envar("CHECK_ES_ZABBIX_KEY").Default("es.logs.count").String()
+	zabbixOnly   = kingpin.Flag("zabbix-only", "only push value to Zabbix, exit 0 on success instead of Nagios exit codes").Envar("CHECK_ES_ZABBIX_ONLY").Bool()
+)
+
+const zabbixDefaultPort = "10051"
+
+// ZabbixRequest : struct containts Zabbix sender protocol request
+type ZabbixRequest struct {
+	Request string       `json:"request"`
+	Data    []ZabbixItem `json:"data"`
+	Clock   int64        `json:"clock"`
+}
+
+// ZabbixItem : struct containts single Zabbix trapper item value
+type ZabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+// ZabbixResponse : struct containts Zabbix server response
+type ZabbixResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// zabbixPacket wraps JSON payload into Zabbix protocol header:
+// "ZBXD", flags 0x01 and little endian 8 byte payload length
+func zabbixPacket(payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("ZBXD")
+	buf.WriteByte(0x01)
+	binary.Write(&buf, binary.LittleEndian, uint64(len(payload)))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func readZabbixResponse(r io.Reader) (ZabbixResponse, error) {
+	var response ZabbixResponse
+
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return response, fmt.Errorf("cannot read response header: %v", err)
+	}
+	if string(header[:4]) != "ZBXD" {
+		return response, fmt.Errorf("invalid response header")
+	}
+
+	length := binary.LittleEndian.Uint64(header[5:])
+	if length > 1<<20 {
+		return response, fmt.Errorf("response too large: %d bytes", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return response, fmt.Errorf("cannot read response: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return response, fmt.Errorf("JSON parse failed")
+	}
+	return response, nil
+}
+
+func sendZabbixValue(server, host, key, value string, timeout time.Duration) error {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, zabbixDefaultPort)
+	}
+
+	now := time.Now().Unix()
+	payload, err := json.Marshal(ZabbixRequest{
+		Request: "sender data",
+		Data: []ZabbixItem{
+			{Host: host, Key: key, Value: value, Clock: now},
+		},
+		Clock: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", server, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(zabbixPacket(payload)); err != nil {
+		return err
+	}
+
+	response, err := readZabbixResponse(conn)
+	if err != nil {
+		return err
+	}
+	if response.Response != "success" {
+		return fmt.Errorf("server response: %s %s", response.Response, response.Info)
+	}
+	if !strings.Contains(response.Info, "failed: 0") {
+		return fmt.Errorf("item not processed: %s", response.Info)
+	}
+	return nil
+}
+
+func submitZabbixValue(result *escheck.CheckResult) error {
+	if result.Count == nil {
+		return fmt.Errorf("no value to send: %s", result.Message)
+	}
+	return sendZabbixValue(*zabbixServer, *zabbixHost, *zabbixKey, fmt.Sprintf("%d", *result.Count), time.Second*time.Duration(*timeout))
+}